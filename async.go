@@ -0,0 +1,195 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// QueryFuture is the handle of a query which runs in the background.
+type QueryFuture struct {
+	done     chan struct{}
+	response *QueryResponse
+	err      error
+}
+
+// Done returns a channel which is closed when the query is complete.
+func (f *QueryFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits until the query is complete and returns its response.
+func (f *QueryFuture) Result() (*QueryResponse, error) {
+	<-f.done
+	return f.response, f.err
+}
+
+// QueryAsync runs the given query in the background with the given options and returns immediately.
+// At most AsyncConcurrency asynchronous queries of the client are sent at a time,
+// the others wait for a running query to complete.
+func (c *Client) QueryAsync(query PQLQuery, options ...interface{}) *QueryFuture {
+	return c.QueryAsyncWithContext(context.Background(), query, options...)
+}
+
+// QueryAsyncWithContext runs the given query in the background with the given options and returns immediately.
+// The query fails with the error of the context if the context is done
+// before the query is sent or while it is running.
+func (c *Client) QueryAsyncWithContext(ctx context.Context, query PQLQuery, options ...interface{}) *QueryFuture {
+	future := &QueryFuture{done: make(chan struct{})}
+	go func() {
+		defer close(future.done)
+		select {
+		case c.asyncSlots <- struct{}{}:
+			defer func() { <-c.asyncSlots }()
+		case <-ctx.Done():
+			future.err = ctx.Err()
+			return
+		}
+		future.response, future.err = c.QueryWithContext(ctx, query, options...)
+	}()
+	return future
+}
+
+// QueryErrors is returned by QueryAllPartial if some of the queries fail.
+// It contains the error of each query, in the same order as the queries;
+// the error of a successful query is nil.
+type QueryErrors []error
+
+func (e QueryErrors) Error() string {
+	messages := []string{}
+	for i, err := range e {
+		if err != nil {
+			messages = append(messages, fmt.Sprintf("query %d: %s", i, err))
+		}
+	}
+	return fmt.Sprintf("Error: %d of %d queries failed: %s", len(messages), len(e), strings.Join(messages, "; "))
+}
+
+// QueryAll runs the given queries concurrently, at most concurrency queries at a time,
+// and returns their responses in the same order as the queries.
+// If a query fails, the queries which are not complete are canceled and its error is returned.
+// If concurrency is 0 or less, AsyncConcurrency of the client is used.
+func (c *Client) QueryAll(queries []PQLQuery, concurrency int, options ...interface{}) ([]*QueryResponse, error) {
+	return c.QueryAllWithContext(context.Background(), queries, concurrency, options...)
+}
+
+// QueryAllWithContext runs the given queries concurrently and returns their responses in the same order as the queries.
+// If a query fails, the queries which are not complete are canceled and its error is returned.
+func (c *Client) QueryAllWithContext(ctx context.Context, queries []PQLQuery, concurrency int, options ...interface{}) ([]*QueryResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var once sync.Once
+	var firstErr error
+	responses := c.queryAll(ctx, queries, concurrency, options, func(i int, err error) {
+		once.Do(func() {
+			firstErr = errors.Wrapf(err, "running query %d", i)
+			cancel()
+		})
+	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return responses, nil
+}
+
+// QueryAllPartial runs the given queries concurrently, at most concurrency queries at a time,
+// and returns their responses in the same order as the queries.
+// All queries are run even if some of them fail. In that case, the response of a failed query is nil
+// and a QueryErrors which contains the error of each query is returned with the responses.
+// If concurrency is 0 or less, AsyncConcurrency of the client is used.
+func (c *Client) QueryAllPartial(queries []PQLQuery, concurrency int, options ...interface{}) ([]*QueryResponse, error) {
+	return c.QueryAllPartialWithContext(context.Background(), queries, concurrency, options...)
+}
+
+// QueryAllPartialWithContext runs the given queries concurrently and returns their responses
+// in the same order as the queries, with a QueryErrors if some of them fail.
+func (c *Client) QueryAllPartialWithContext(ctx context.Context, queries []PQLQuery, concurrency int, options ...interface{}) ([]*QueryResponse, error) {
+	queryErrors := make(QueryErrors, len(queries))
+	failed := false
+	var mutex sync.Mutex
+	responses := c.queryAll(ctx, queries, concurrency, options, func(i int, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		queryErrors[i] = err
+		failed = true
+	})
+	if failed {
+		return responses, queryErrors
+	}
+	return responses, nil
+}
+
+// queryAll runs the queries with concurrency workers and calls failed for each query which fails,
+// including the queries which are not sent since the context is done.
+func (c *Client) queryAll(ctx context.Context, queries []PQLQuery, concurrency int, options []interface{}, failed func(i int, err error)) []*QueryResponse {
+	if concurrency <= 0 {
+		concurrency = c.options.AsyncConcurrency
+	}
+	if concurrency > len(queries) {
+		concurrency = len(queries)
+	}
+	responses := make([]*QueryResponse, len(queries))
+	indexes := make(chan int)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					failed(i, err)
+					continue
+				}
+				response, err := c.QueryWithContext(ctx, queries[i], options...)
+				if err == nil {
+					err = response.Err()
+				}
+				if err != nil {
+					failed(i, err)
+					continue
+				}
+				responses[i] = response
+			}
+		}()
+	}
+	for i := range queries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return responses
+}
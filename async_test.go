@@ -0,0 +1,219 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryAsync(t *testing.T) {
+	mutex := &sync.Mutex{}
+	inFlight, maxInFlight := 0, 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		inFlight--
+		mutex.Unlock()
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true), AsyncConcurrency(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	futures := []*QueryFuture{}
+	for i := 0; i < 6; i++ {
+		futures = append(futures, client.QueryAsync(sampleIndex.Count(sampleFrame.Bitmap(uint64(i)))))
+	}
+	select {
+	case <-futures[5].Done():
+		t.Fatalf("the query should not be complete yet")
+	default:
+	}
+	for _, future := range futures {
+		response, err := future.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Result().Count != 5 {
+			t.Fatalf("5 != %d", response.Result().Count)
+		}
+		<-future.Done()
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("unexpected number of queries in flight: %d", maxInFlight)
+	}
+}
+
+func TestQueryAsyncContextCanceled(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		started <- struct{}{}
+		<-release
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true), AsyncConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	running := client.QueryAsync(sampleIndex.Count(sampleFrame.Bitmap(1)))
+	// wait until the first query holds the only slot
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := client.QueryAsyncWithContext(ctx, sampleIndex.Count(sampleFrame.Bitmap(2)))
+	cancel()
+	if _, err := waiting.Result(); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	close(release)
+	if _, err := running.Result(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// queryAllTransport responds with the row ID of the query as the count,
+// and with an error for the row IDs in failing.
+func queryAllTransport(failing map[string]bool) http.RoundTripper {
+	rowIDRe := regexp.MustCompile(`rowID=(\d+)`)
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		rowID := rowIDRe.FindStringSubmatch(string(body))[1]
+		// respond out of order
+		time.Sleep(time.Duration(10-len(rowID)) * time.Millisecond)
+		if failing[rowID] {
+			return &http.Response{
+				StatusCode: 400,
+				Body:       ioutil.NopCloser(strings.NewReader("bad query")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"results": [%s]}`, rowID))),
+		}, nil
+	})
+}
+
+func countQueries(n int) []PQLQuery {
+	queries := []PQLQuery{}
+	for i := 0; i < n; i++ {
+		queries = append(queries, sampleIndex.Count(sampleFrame.Bitmap(uint64(i*11))))
+	}
+	return queries
+}
+
+func TestQueryAll(t *testing.T) {
+	client, err := NewClient(":10101", HTTPTransport(queryAllTransport(nil)), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, err := client.QueryAll(countQueries(20), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 20 {
+		t.Fatalf("unexpected number of responses: %d", len(responses))
+	}
+	for i, response := range responses {
+		if response.Result().Count != uint64(i*11) {
+			t.Fatalf("%d: unexpected count: %d", i, response.Result().Count)
+		}
+	}
+	responses, err = client.QueryAll(nil, 0)
+	if err != nil || len(responses) != 0 {
+		t.Fatalf("unexpected responses: %v, err: %v", responses, err)
+	}
+}
+
+func TestQueryAllFails(t *testing.T) {
+	client, err := NewClient(":10101", HTTPTransport(queryAllTransport(map[string]bool{"33": true})), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.QueryAll(countQueries(20), 2)
+	if err == nil || !strings.Contains(err.Error(), "running query 3") {
+		t.Fatalf("expected the error of the failing query, got: %v", err)
+	}
+	if !isCategory(err, CategoryValidation) {
+		t.Fatalf("the cause of the error should be kept: %v", err)
+	}
+}
+
+func TestQueryAllPartial(t *testing.T) {
+	client, err := NewClient(":10101", HTTPTransport(queryAllTransport(map[string]bool{"11": true, "44": true})), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	responses, err := client.QueryAllPartial(countQueries(6), 3)
+	queryErrors, ok := err.(QueryErrors)
+	if !ok {
+		t.Fatalf("expected QueryErrors, got: %v", err)
+	}
+	for i, response := range responses {
+		failed := i == 1 || i == 4
+		if failed != (response == nil) || failed != (queryErrors[i] != nil) {
+			t.Fatalf("%d: unexpected response %v, err: %v", i, response, queryErrors[i])
+		}
+		if !failed && response.Result().Count != uint64(i*11) {
+			t.Fatalf("%d: unexpected count: %d", i, response.Result().Count)
+		}
+	}
+	if !strings.HasPrefix(queryErrors.Error(), "Error: 2 of 6 queries failed: query 1: ") {
+		t.Fatalf("unexpected error message: %s", queryErrors.Error())
+	}
+	if !isCategory(queryErrors[4], CategoryValidation) {
+		t.Fatalf("unexpected error: %v", queryErrors[4])
+	}
+	_, err = client.QueryAllPartial(countQueries(1), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"time"
+)
+
+// AuditOperation is the kind of a state changing call of a client.
+type AuditOperation string
+
+// Audited operations.
+const (
+	// AuditQuery is a query which modifies data, e.g., a batch of SetBit calls.
+	AuditQuery         AuditOperation = "query"
+	AuditImport        AuditOperation = "import"
+	AuditImportValues  AuditOperation = "import-values"
+	AuditImportRoaring AuditOperation = "import-roaring"
+	AuditCreateIndex   AuditOperation = "create-index"
+	AuditDeleteIndex   AuditOperation = "delete-index"
+	AuditCreateFrame   AuditOperation = "create-frame"
+	AuditDeleteFrame   AuditOperation = "delete-frame"
+	AuditCreateField   AuditOperation = "create-field"
+	AuditDeleteField   AuditOperation = "delete-field"
+	AuditDeleteView    AuditOperation = "delete-view"
+)
+
+// AuditEvent describes a state changing call of a client.
+type AuditEvent struct {
+	Operation AuditOperation
+	// Index and Frame are the names of the target of the call. Frame is empty for index operations.
+	Index string
+	Frame string
+	// Field is the name of the field of field operations and value imports.
+	Field string
+	// View is the name of the deleted view.
+	View string
+	// Query is the PQL of a query.
+	Query string
+	// Slice and Count are the slice and the number of bits or values of an import batch.
+	Slice uint64
+	Count int
+	// Principal is the principal set in the context of the call with ContextWithPrincipal,
+	// or the user name of basic authentication.
+	Principal string
+	// Time is the time the call started, and Duration is the time it took.
+	Time     time.Time
+	Duration time.Duration
+	// Err is the error of the call if it failed, including query errors returned in the response.
+	Err error
+}
+
+// AuditHook is called after each state changing call of a client: write queries, import batches and
+// creating or deleting indexes, frames, fields and views. Set it with the Audit client option.
+// It is called synchronously and concurrently by imports, so it should return quickly.
+type AuditHook func(event AuditEvent)
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a context which sets the principal of the audit events of the calls made with it.
+// Use it when the client acts on behalf of the users of an application.
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// startAudit records the start of a state changing call. The returned function should be deferred
+// with a pointer to the result error of the call, so the event is passed to the audit hook when the call returns.
+func (c *Client) startAudit(ctx context.Context, event AuditEvent) func(err *error) {
+	hook := c.options.AuditHook
+	if hook == nil {
+		return func(err *error) {}
+	}
+	event.Time = time.Now()
+	if principal, ok := ctx.Value(principalKey{}).(string); ok {
+		event.Principal = principal
+	} else {
+		event.Principal = c.options.Username
+	}
+	return func(err *error) {
+		event.Duration = time.Since(event.Time)
+		event.Err = *err
+		hook(event)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingAudit struct {
+	mutex  sync.Mutex
+	events []AuditEvent
+}
+
+func (a *recordingAudit) hook(event AuditEvent) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.events = append(a.events, event)
+}
+
+func auditClient(t *testing.T, audit *recordingAudit, options ...ClientOption) *Client {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch {
+		case req.URL.Path == "/fragment/nodes":
+			body = `[{"scheme":"http","host":"node1:10101"}]`
+		case strings.HasSuffix(req.URL.Path, "/query"):
+			pql, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = `{"results": [true]}`
+			if strings.Contains(string(pql), "rowID=666") {
+				body = `{"error": "row is cursed"}`
+			}
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	options = append(options, HTTPTransport(transport), JSONFormat(true), Audit(audit.hook))
+	client, err := NewClient("node1:10101", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestAudit(t *testing.T) {
+	audit := &recordingAudit{}
+	client := auditClient(t, audit, BasicAuth("importer", "secret"))
+	if err := client.CreateIndex(sampleIndex); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Query(sampleFrame.Bitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+	setBit := sampleFrame.SetBit(1, 100)
+	if _, err := client.Query(setBit); err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{{RowID: 1, ColumnID: 1}, {RowID: 2, ColumnID: 2}}
+	if err := client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ImportRoaringBitmap(sampleFrame, 3, bytes.NewBufferString("roaring")); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteView(sampleFrame, "standard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteFrame(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteIndex(sampleIndex); err != nil {
+		t.Fatal(err)
+	}
+	targets := []AuditEvent{
+		{Operation: AuditCreateIndex, Index: "sample-index"},
+		{Operation: AuditCreateFrame, Index: "sample-index", Frame: "sample-frame"},
+		{Operation: AuditQuery, Index: "sample-index", Query: setBit.serialize()},
+		{Operation: AuditImport, Index: "sample-index", Frame: "sample-frame", Count: 2},
+		{Operation: AuditImportRoaring, Index: "sample-index", Frame: "sample-frame", Slice: 3},
+		{Operation: AuditDeleteView, Index: "sample-index", Frame: "sample-frame", View: "standard"},
+		{Operation: AuditDeleteFrame, Index: "sample-index", Frame: "sample-frame"},
+		{Operation: AuditDeleteIndex, Index: "sample-index"},
+	}
+	if len(audit.events) != len(targets) {
+		t.Fatalf("unexpected events: %v", audit.events)
+	}
+	for i, target := range targets {
+		event := audit.events[i]
+		if event.Time.IsZero() || event.Err != nil || event.Principal != "importer" {
+			t.Fatalf("unexpected event: %v", event)
+		}
+		target.Principal, target.Time, target.Duration = event.Principal, event.Time, event.Duration
+		if event != target {
+			t.Fatalf("%v != %v", target, event)
+		}
+	}
+}
+
+func TestAuditFailures(t *testing.T) {
+	audit := &recordingAudit{}
+	client := auditClient(t, audit, ProtectDestructive(true))
+	ctx := ContextWithPrincipal(context.Background(), "alice")
+	if _, err := client.QueryWithContext(ctx, sampleFrame.SetBit(666, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.DeleteIndexWithContext(ctx, sampleIndex); err == nil {
+		t.Fatal("should have failed")
+	}
+	if len(audit.events) != 2 {
+		t.Fatalf("unexpected events: %v", audit.events)
+	}
+	query, deleteIndex := audit.events[0], audit.events[1]
+	if query.Operation != AuditQuery || query.Principal != "alice" || query.Err == nil || query.Err.Error() != "Error: row is cursed" {
+		t.Fatalf("unexpected event: %v", query)
+	}
+	if deleteIndex.Operation != AuditDeleteIndex || deleteIndex.Err != ErrDestructiveNotConfirmed {
+		t.Fatalf("unexpected event: %v", deleteIndex)
+	}
+}
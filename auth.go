@@ -0,0 +1,121 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+func basicAuthInterceptor(username, password string) Interceptor {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req = cloneRequest(req)
+			req.SetBasicAuth(username, password)
+			return next.Do(req)
+		})
+	}
+}
+
+// tokenAuth caches the token returned from the token source,
+// and fetches a new one if the server responds with 401.
+type tokenAuth struct {
+	source func() (string, error)
+	mutex  sync.Mutex
+	token  string
+}
+
+func (a *tokenAuth) getToken(refresh bool) (string, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.token == "" || refresh {
+		token, err := a.source()
+		if err != nil {
+			return "", errors.Wrap(err, "getting token")
+		}
+		a.token = token
+	}
+	return a.token, nil
+}
+
+func (a *tokenAuth) interceptor(next Doer) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		token, err := a.getToken(false)
+		if err != nil {
+			return nil, err
+		}
+		response, err := next.Do(withBearerToken(req, token))
+		if err != nil || response.StatusCode != http.StatusUnauthorized {
+			return response, err
+		}
+		// the token may have expired, so the request is sent again with a new token
+		if req.Body != nil && req.GetBody == nil {
+			// the body cannot be sent again
+			return response, nil
+		}
+		token, err = a.getToken(true)
+		if err != nil {
+			return response, nil
+		}
+		retryReq := withBearerToken(req, token)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return response, nil
+			}
+			retryReq.Body = body
+		}
+		response.Body.Close()
+		return next.Do(retryReq)
+	})
+}
+
+func withBearerToken(req *http.Request, token string) *http.Request {
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+// cloneRequest returns a shallow copy of the request with a copy of the headers,
+// so interceptors do not modify the request passed to them.
+func cloneRequest(req *http.Request) *http.Request {
+	clone := &http.Request{}
+	*clone = *req
+	clone.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		clone.Header[k] = append([]string(nil), v...)
+	}
+	return clone
+}
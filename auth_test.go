@@ -0,0 +1,129 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBasicAuth(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		username, password, ok := req.BasicAuth()
+		if !ok || username != "user" || password != "secret" {
+			t.Fatalf("basic auth credentials should be sent")
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": []}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), BasicAuth("user", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Views(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenSourceRefreshesToken(t *testing.T) {
+	tokens := []string{"expired", "fresh"}
+	sourceCalls := 0
+	source := func() (string, error) {
+		token := tokens[sourceCalls]
+		sourceCalls++
+		return token, nil
+	}
+	var authorizations []string
+	var bodies []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		authorization := req.Header.Get("Authorization")
+		authorizations = append(authorizations, authorization)
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, string(body))
+		if authorization != "Bearer fresh" {
+			return &http.Response{
+				StatusCode: http.StatusUnauthorized,
+				Body:       ioutil.NopCloser(strings.NewReader("unauthorized")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": []}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), TokenSource(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteField(sampleFrame, "some-field"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Views(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{"Bearer expired", "Bearer fresh", "Bearer fresh"}
+	if strings.Join(target, ",") != strings.Join(authorizations, ",") {
+		t.Fatalf("%v != %v", target, authorizations)
+	}
+	if bodies[0] != bodies[1] {
+		t.Fatalf("the request body should be sent again: %v", bodies)
+	}
+	if sourceCalls != 2 {
+		t.Fatalf("the token should be cached, source was called %d times", sourceCalls)
+	}
+}
+
+func TestTokenSourceFails(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("the request should not be sent")
+		return nil, nil
+	})
+	source := func() (string, error) {
+		return "", errors.New("no token")
+	}
+	client, err := NewClient(":10101", HTTPTransport(transport), TokenSource(source), MaxHostAttempts(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Views(sampleFrame); err == nil {
+		t.Fatalf("should have failed")
+	}
+}
@@ -0,0 +1,488 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Package bench drives a configurable mix of SetBit, Bitmap, TopN and import traffic
+// through a go-pilosa client, and reports the latency percentiles of each operation,
+// to size clusters and compare client configurations.
+//
+//	report, err := bench.Run(ctx, client, frame,
+//		bench.Duration(time.Minute),
+//		bench.Concurrency(16),
+//		bench.Mix(map[bench.Operation]int{bench.OpSetBit: 1, bench.OpBitmap: 4}))
+//	fmt.Println(report)
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+// ErrInvalidOption is returned when a benchmark option is invalid.
+var ErrInvalidOption = pilosa.NewError("Invalid benchmark option")
+
+// Operation is a kind of request sent by the benchmark.
+type Operation string
+
+// Operations.
+const (
+	// OpSetBit sets a random bit with a SetBit query.
+	OpSetBit Operation = "SetBit"
+	// OpBitmap queries a random row with a Bitmap query.
+	OpBitmap Operation = "Bitmap"
+	// OpTopN queries the top rows of the frame with a TopN query.
+	OpTopN Operation = "TopN"
+	// OpImport imports a batch of random bits.
+	OpImport Operation = "Import"
+)
+
+var operations = []Operation{OpSetBit, OpBitmap, OpTopN, OpImport}
+
+// Options control the traffic of a benchmark.
+type Options struct {
+	// Duration is how long the benchmark runs.
+	// The benchmark runs until Requests operations are done if it is 0 and Requests is set.
+	Duration time.Duration
+	// Requests is the number of operations done by the benchmark, or unlimited if it is 0.
+	Requests int
+	// Concurrency is the number of goroutines sending requests.
+	Concurrency int
+	// Mix contains the relative weights of the operations.
+	Mix map[Operation]int
+	// RowCount is the number of rows the random row IDs are picked from.
+	RowCount uint64
+	// ColumnCount is the number of columns the random column IDs are picked from.
+	ColumnCount uint64
+	// TopN is the number of rows returned by TopN queries.
+	TopN uint64
+	// ImportBatchSize is the number of bits imported by an import operation.
+	ImportBatchSize uint
+	// Seed is the seed of the random IDs, so runs can be repeated.
+	Seed int64
+}
+
+func (options *Options) withDefaults() (updated *Options) {
+	updated = &Options{}
+	*updated = *options
+	if updated.Duration <= 0 && updated.Requests <= 0 {
+		updated.Duration = 10 * time.Second
+	}
+	if updated.Concurrency <= 0 {
+		updated.Concurrency = 1
+	}
+	if len(updated.Mix) == 0 {
+		updated.Mix = map[Operation]int{OpSetBit: 1, OpBitmap: 1, OpTopN: 1}
+	}
+	if updated.RowCount == 0 {
+		updated.RowCount = 1000
+	}
+	if updated.ColumnCount == 0 {
+		updated.ColumnCount = 1000000
+	}
+	if updated.TopN == 0 {
+		updated.TopN = 10
+	}
+	if updated.ImportBatchSize == 0 {
+		updated.ImportBatchSize = 1000
+	}
+	return
+}
+
+// Option is used to customize a benchmark.
+type Option func(options *Options) error
+
+// Duration sets how long the benchmark runs.
+func Duration(d time.Duration) Option {
+	return func(options *Options) error {
+		if d <= 0 {
+			return ErrInvalidOption
+		}
+		options.Duration = d
+		return nil
+	}
+}
+
+// Requests sets the number of operations done by the benchmark.
+func Requests(n int) Option {
+	return func(options *Options) error {
+		if n <= 0 {
+			return ErrInvalidOption
+		}
+		options.Requests = n
+		return nil
+	}
+}
+
+// Concurrency sets the number of goroutines sending requests.
+func Concurrency(n int) Option {
+	return func(options *Options) error {
+		if n <= 0 {
+			return ErrInvalidOption
+		}
+		options.Concurrency = n
+		return nil
+	}
+}
+
+// Mix sets the relative weights of the operations, e.g., {OpSetBit: 1, OpBitmap: 9}.
+func Mix(mix map[Operation]int) Option {
+	return func(options *Options) error {
+		total := 0
+		for op, weight := range mix {
+			if !validOperation(op) || weight < 0 {
+				return ErrInvalidOption
+			}
+			total += weight
+		}
+		if total == 0 {
+			return ErrInvalidOption
+		}
+		options.Mix = mix
+		return nil
+	}
+}
+
+// IDRange sets the number of rows and columns the random IDs are picked from.
+func IDRange(rowCount uint64, columnCount uint64) Option {
+	return func(options *Options) error {
+		if rowCount == 0 || columnCount == 0 {
+			return ErrInvalidOption
+		}
+		options.RowCount = rowCount
+		options.ColumnCount = columnCount
+		return nil
+	}
+}
+
+// TopN sets the number of rows returned by TopN queries.
+func TopN(n uint64) Option {
+	return func(options *Options) error {
+		if n == 0 {
+			return ErrInvalidOption
+		}
+		options.TopN = n
+		return nil
+	}
+}
+
+// ImportBatchSize sets the number of bits imported by an import operation.
+func ImportBatchSize(size uint) Option {
+	return func(options *Options) error {
+		if size == 0 {
+			return ErrInvalidOption
+		}
+		options.ImportBatchSize = size
+		return nil
+	}
+}
+
+// Seed sets the seed of the random IDs.
+func Seed(seed int64) Option {
+	return func(options *Options) error {
+		options.Seed = seed
+		return nil
+	}
+}
+
+// ParseMix parses a mix of operations in "SetBit=1,Bitmap=4" form.
+func ParseMix(s string) (map[Operation]int, error) {
+	mix := map[Operation]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid operation weight: %s", part)
+		}
+		op := Operation(strings.TrimSpace(kv[0]))
+		if !validOperation(op) {
+			return nil, fmt.Errorf("unknown operation: %s", op)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for %s: %s", op, kv[1])
+		}
+		mix[op] = weight
+	}
+	return mix, nil
+}
+
+func validOperation(op Operation) bool {
+	for _, known := range operations {
+		if op == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Report contains the results of a benchmark.
+type Report struct {
+	// Duration is how long the benchmark ran.
+	Duration time.Duration
+	// Operations contains the statistics of each operation which was done.
+	Operations map[Operation]*Stats
+	// Total contains the statistics of all operations.
+	Total *Stats
+}
+
+// Stats contains the latency statistics of an operation.
+// Latencies are measured for the successful operations.
+type Stats struct {
+	Count  int
+	Errors int
+	// Throughput is the number of operations per second.
+	Throughput float64
+	Min        time.Duration
+	Mean       time.Duration
+	P50        time.Duration
+	P90        time.Duration
+	P99        time.Duration
+	Max        time.Duration
+	// LastError is the error of the last failed operation, if any.
+	LastError error
+}
+
+// String returns the statistics as a table.
+func (r *Report) String() string {
+	lines := []string{fmt.Sprintf("%-8s %8s %7s %10s %10s %10s %10s %10s %10s",
+		"op", "count", "errors", "ops/s", "mean", "p50", "p90", "p99", "max")}
+	format := func(name string, s *Stats) string {
+		return fmt.Sprintf("%-8s %8d %7d %10.1f %10s %10s %10s %10s %10s",
+			name, s.Count, s.Errors, s.Throughput, round(s.Mean), round(s.P50), round(s.P90), round(s.P99), round(s.Max))
+	}
+	for _, op := range operations {
+		if s, ok := r.Operations[op]; ok {
+			lines = append(lines, format(string(op), s))
+		}
+	}
+	lines = append(lines, format("total", r.Total))
+	return strings.Join(lines, "\n")
+}
+
+func round(d time.Duration) time.Duration {
+	if d > time.Millisecond {
+		return d - d%(10*time.Microsecond)
+	}
+	return d - d%time.Microsecond
+}
+
+// sample is the result of an operation.
+type sample struct {
+	op      Operation
+	latency time.Duration
+	err     error
+}
+
+// Run sends the traffic to the frame using client until the duration or the number of requests is reached,
+// or the context is done. The index and the frame should exist.
+// Failed operations are counted in the report and do not stop the benchmark.
+func Run(ctx context.Context, client pilosa.ClientInterface, frame *pilosa.Frame, options ...Option) (*Report, error) {
+	benchOptions := &Options{}
+	for _, option := range options {
+		if err := option(benchOptions); err != nil {
+			return nil, err
+		}
+	}
+	benchOptions = benchOptions.withDefaults()
+	if benchOptions.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, benchOptions.Duration)
+		defer cancel()
+	}
+	picker := newPicker(benchOptions.Mix)
+	remaining := int64(benchOptions.Requests)
+	samples := make([][]sample, benchOptions.Concurrency)
+	start := time.Now()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < benchOptions.Concurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := &worker{
+				client:  client,
+				frame:   frame,
+				options: benchOptions,
+				rand:    rand.New(rand.NewSource(benchOptions.Seed + int64(i))),
+			}
+			for ctx.Err() == nil {
+				if benchOptions.Requests > 0 && atomic.AddInt64(&remaining, -1) < 0 {
+					return
+				}
+				op := picker.pick(w.rand)
+				opStart := time.Now()
+				err := w.do(ctx, op)
+				latency := time.Since(opStart)
+				if err != nil && ctx.Err() != nil {
+					// the operation was interrupted by the end of the benchmark
+					return
+				}
+				samples[i] = append(samples[i], sample{op: op, latency: latency, err: err})
+			}
+		}(i)
+	}
+	wg.Wait()
+	return newReport(samples, time.Since(start)), nil
+}
+
+type worker struct {
+	client  pilosa.ClientInterface
+	frame   *pilosa.Frame
+	options *Options
+	rand    *rand.Rand
+}
+
+func (w *worker) do(ctx context.Context, op Operation) error {
+	var err error
+	switch op {
+	case OpSetBit:
+		_, err = w.client.QueryWithContext(ctx, w.frame.SetBit(w.rowID(), w.columnID()))
+	case OpBitmap:
+		_, err = w.client.QueryWithContext(ctx, w.frame.Bitmap(w.rowID()))
+	case OpTopN:
+		_, err = w.client.QueryWithContext(ctx, w.frame.TopN(w.options.TopN))
+	case OpImport:
+		bits := make([]pilosa.Bit, w.options.ImportBatchSize)
+		for i := range bits {
+			bits[i] = pilosa.Bit{RowID: w.rowID(), ColumnID: w.columnID()}
+		}
+		err = w.client.ImportFrameWithContext(ctx, w.frame, pilosa.NewSliceBitIterator(bits), w.options.ImportBatchSize)
+	}
+	return err
+}
+
+func (w *worker) rowID() uint64 {
+	return uint64(w.rand.Int63n(int64(w.options.RowCount)))
+}
+
+func (w *worker) columnID() uint64 {
+	return uint64(w.rand.Int63n(int64(w.options.ColumnCount)))
+}
+
+// picker picks operations at random according to their weights.
+type picker struct {
+	ops     []Operation
+	weights []int
+	total   int
+}
+
+func newPicker(mix map[Operation]int) *picker {
+	p := &picker{}
+	// iterate in a fixed order, so runs with the same seed pick the same operations
+	for _, op := range operations {
+		if weight := mix[op]; weight > 0 {
+			p.ops = append(p.ops, op)
+			p.weights = append(p.weights, weight)
+			p.total += weight
+		}
+	}
+	return p
+}
+
+func (p *picker) pick(r *rand.Rand) Operation {
+	n := r.Intn(p.total)
+	for i, weight := range p.weights {
+		if n < weight {
+			return p.ops[i]
+		}
+		n -= weight
+	}
+	return p.ops[len(p.ops)-1]
+}
+
+func newReport(workerSamples [][]sample, duration time.Duration) *Report {
+	byOp := map[Operation][]sample{}
+	all := []sample{}
+	for _, samples := range workerSamples {
+		for _, s := range samples {
+			byOp[s.op] = append(byOp[s.op], s)
+		}
+		all = append(all, samples...)
+	}
+	report := &Report{
+		Duration:   duration,
+		Operations: map[Operation]*Stats{},
+		Total:      newStats(all, duration),
+	}
+	for op, samples := range byOp {
+		report.Operations[op] = newStats(samples, duration)
+	}
+	return report
+}
+
+func newStats(samples []sample, duration time.Duration) *Stats {
+	stats := &Stats{Count: len(samples)}
+	if duration > 0 {
+		stats.Throughput = float64(len(samples)) / duration.Seconds()
+	}
+	latencies := make([]time.Duration, 0, len(samples))
+	var sum time.Duration
+	for _, s := range samples {
+		if s.err != nil {
+			stats.Errors++
+			stats.LastError = s.err
+			continue
+		}
+		latencies = append(latencies, s.latency)
+		sum += s.latency
+	}
+	if len(latencies) == 0 {
+		return stats
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.Min = latencies[0]
+	stats.Max = latencies[len(latencies)-1]
+	stats.Mean = sum / time.Duration(len(latencies))
+	stats.P50 = percentile(latencies, 0.5)
+	stats.P90 = percentile(latencies, 0.9)
+	stats.P99 = percentile(latencies, 0.99)
+	return stats
+}
+
+// percentile returns the nearest rank percentile of the sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
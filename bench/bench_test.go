@@ -0,0 +1,170 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package bench
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/go-pilosa/pilosatest"
+)
+
+func newBenchFrame(t *testing.T) (*pilosatest.MemoryClient, *pilosa.Frame) {
+	index, err := pilosa.NewIndex("bench", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("bench", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := pilosatest.NewMemoryClient()
+	if err := client.CreateIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	return client, frame
+}
+
+func TestRun(t *testing.T) {
+	client, frame := newBenchFrame(t)
+	report, err := Run(context.Background(), client, frame,
+		Requests(400),
+		Concurrency(4),
+		Mix(map[Operation]int{OpSetBit: 2, OpBitmap: 1, OpTopN: 1, OpImport: 1}),
+		IDRange(10, 100),
+		ImportBatchSize(10),
+		Seed(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Count != 400 || report.Total.Errors != 0 {
+		t.Fatalf("400 operations without errors expected: %d, %d", report.Total.Count, report.Total.Errors)
+	}
+	count := 0
+	for _, op := range operations {
+		stats := report.Operations[op]
+		if stats == nil || stats.Count == 0 {
+			t.Fatalf("%s should be done", op)
+		}
+		if !(stats.Min <= stats.P50 && stats.P50 <= stats.P90 && stats.P90 <= stats.P99 && stats.P99 <= stats.Max) {
+			t.Fatalf("percentiles of %s should be ordered: %+v", op, stats)
+		}
+		count += stats.Count
+	}
+	if count != 400 {
+		t.Fatalf("operation counts should add up to the total: %d", count)
+	}
+	if !strings.Contains(report.String(), "SetBit") || !strings.Contains(report.String(), "total") {
+		t.Fatalf("unexpected report: %s", report)
+	}
+}
+
+func TestRunDuration(t *testing.T) {
+	client, frame := newBenchFrame(t)
+	report, err := Run(context.Background(), client, frame, Duration(50*time.Millisecond), Mix(map[Operation]int{OpBitmap: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Count == 0 || report.Operations[OpSetBit] != nil {
+		t.Fatalf("only Bitmap operations should be done: %s", report)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	_, frame := newBenchFrame(t)
+	// the frame does not exist in this client
+	client := pilosatest.NewMemoryClient()
+	report, err := Run(context.Background(), client, frame, Requests(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Errors != 10 || report.Total.LastError == nil {
+		t.Fatalf("failed operations should be counted: %d", report.Total.Errors)
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	client, frame := newBenchFrame(t)
+	options := []Option{
+		Duration(0),
+		Requests(-1),
+		Concurrency(0),
+		Mix(map[Operation]int{"Unknown": 1}),
+		Mix(map[Operation]int{OpSetBit: 0}),
+		IDRange(0, 10),
+		TopN(0),
+		ImportBatchSize(0),
+	}
+	for i, option := range options {
+		if _, err := Run(context.Background(), client, frame, option); err != ErrInvalidOption {
+			t.Fatalf("%d: ErrInvalidOption expected, got: %v", i, err)
+		}
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := ParseMix("SetBit=1, Bitmap=4,TopN=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := map[Operation]int{OpSetBit: 1, OpBitmap: 4, OpTopN: 0}
+	if !reflect.DeepEqual(mix, target) {
+		t.Fatalf("%v != %v", target, mix)
+	}
+	for _, s := range []string{"SetBit", "Unknown=1", "SetBit=x", "SetBit=-1"} {
+		if _, err := ParseMix(s); err == nil {
+			t.Fatalf("parsing %s should fail", s)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	if p := percentile(latencies, 0.5); p != 5 {
+		t.Fatalf("p50 should be 5: %d", p)
+	}
+	if p := percentile(latencies, 0.99); p != 10 {
+		t.Fatalf("p99 should be 10: %d", p)
+	}
+	if stats := newStats([]sample{{op: OpBitmap, err: errors.New("failed")}}, time.Second); stats.Errors != 1 || stats.Max != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ColumnIterator structs return column IDs one by one.
+type ColumnIterator interface {
+	NextColumn() (uint64, error)
+}
+
+// SliceColumnIterator returns column IDs from a slice of column IDs.
+type SliceColumnIterator struct {
+	columns []uint64
+	index   int
+}
+
+// NewSliceColumnIterator creates a SliceColumnIterator which returns the given column IDs in order.
+func NewSliceColumnIterator(columns []uint64) *SliceColumnIterator {
+	return &SliceColumnIterator{columns: columns}
+}
+
+// NextColumn returns the next column ID in the slice.
+// Returns io.EOF on end of iteration.
+func (s *SliceColumnIterator) NextColumn() (uint64, error) {
+	if s.index >= len(s.columns) {
+		return 0, io.EOF
+	}
+	column := s.columns[s.index]
+	s.index++
+	return column, nil
+}
+
+// Iterator returns a ColumnIterator over the bits of the result.
+// Use Client.StreamBitmap to decode the bits of a large result while it is received.
+func (b *BitmapResult) Iterator() ColumnIterator {
+	if b.packed != nil {
+		return &packedColumnIterator{packed: b.packed}
+	}
+	return NewSliceColumnIterator(b.Bits)
+}
+
+// StreamBitmap runs the given bitmap query and returns an iterator which decodes
+// the column IDs of the result while the response is received,
+// instead of reading the whole response into memory.
+// The iterator must be closed when it is not used anymore.
+func (c *Client) StreamBitmap(query *PQLBitmapQuery, options ...interface{}) (*BitmapStream, error) {
+	return c.StreamBitmapWithContext(context.Background(), query, options...)
+}
+
+// StreamBitmapWithContext runs the given bitmap query and returns an iterator over the column IDs of the result.
+// The context is used for the whole lifetime of the iterator.
+// The request is sent to a single host and it is not retried.
+func (c *Client) StreamBitmapWithContext(ctx context.Context, query *PQLBitmapQuery, options ...interface{}) (*BitmapStream, error) {
+	if err := query.Error(); err != nil {
+		return nil, err
+	}
+	queryOptions := &QueryOptions{}
+	if err := queryOptions.addOptions(options...); err != nil {
+		return nil, err
+	}
+	path := makeJSONRequestPath(fmt.Sprintf("/index/%s/query", query.Index().name), queryOptions)
+	headers := jsonHeaders
+	if len(queryOptions.Headers) > 0 {
+		headers = mergeHeaders(queryOptions.Headers, headers)
+	}
+	host := c.cluster.hostFor(query.Index().name, c.breaker)
+	if host == nil {
+		return nil, ErrEmptyCluster
+	}
+	pql := query.serialize()
+	ctx = c.withTraceQuery(ctx, query.Index().name, pql)
+	ctx, cancel := c.withRequestTimeout(ctx)
+	c.cluster.requestStarted(host)
+	resp, err := c.doRequest(ctx, host, "POST", path, headers, []byte(pql))
+	c.cluster.requestFinished(host)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.cluster.hostFailed(host, c.breaker)
+		}
+		cancel()
+		return nil, errors.Wrap(err, "doing query request")
+	}
+	c.cluster.hostSucceeded(host, c.breaker)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer cancel()
+		defer resp.Body.Close()
+		buf, err := readResponseBody(resp, c.options.MaxResponseSize)
+		if err != nil {
+			return nil, err
+		}
+		return nil, newPilosaError(host, resp, buf)
+	}
+	body := newLimitedBody(resp.Body, c.options.MaxResponseSize)
+	decoder := json.NewDecoder(body)
+	decoder.UseNumber()
+	return &BitmapStream{
+		body:    body,
+		decoder: decoder,
+		cancel:  cancel,
+	}, nil
+}
+
+const (
+	streamStarting = iota
+	streamInBits
+	streamDone
+)
+
+// BitmapStream returns the column IDs of a bitmap query result
+// as they are decoded from the response.
+type BitmapStream struct {
+	body       io.ReadCloser
+	decoder    *json.Decoder
+	cancel     context.CancelFunc
+	state      int
+	attributes map[string]interface{}
+}
+
+// NextColumn returns the next column ID in the result.
+// Returns io.EOF on end of iteration.
+func (s *BitmapStream) NextColumn() (uint64, error) {
+	switch s.state {
+	case streamStarting:
+		found, err := s.seekBits()
+		if err != nil {
+			s.state = streamDone
+			return 0, err
+		}
+		if !found {
+			s.state = streamDone
+			return 0, io.EOF
+		}
+		s.state = streamInBits
+		return s.NextColumn()
+	case streamInBits:
+		if !s.decoder.More() {
+			s.state = streamDone
+			return 0, io.EOF
+		}
+		var column uint64
+		if err := s.decoder.Decode(&column); err != nil {
+			s.state = streamDone
+			return 0, errors.Wrap(err, "decoding column")
+		}
+		return column, nil
+	}
+	return 0, io.EOF
+}
+
+// Attributes returns the attributes of the result.
+// The attributes are available once NextColumn is called,
+// if the server sent them before the bits.
+func (s *BitmapStream) Attributes() map[string]interface{} {
+	return s.attributes
+}
+
+// Close closes the response.
+func (s *BitmapStream) Close() error {
+	s.state = streamDone
+	defer s.cancel()
+	return s.body.Close()
+}
+
+// seekBits decodes the response up to the start of the bits of the first result.
+// Returns false if the result has no bits.
+func (s *BitmapStream) seekBits() (bool, error) {
+	if err := s.expectDelim('{'); err != nil {
+		return false, err
+	}
+	for s.decoder.More() {
+		key, err := s.nextKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case "results":
+			if err := s.expectDelim('['); err != nil {
+				return false, err
+			}
+			if !s.decoder.More() {
+				return false, nil
+			}
+			return s.seekResultBits()
+		case "error":
+			var message string
+			if err := s.decoder.Decode(&message); err != nil {
+				return false, errors.Wrap(err, "decoding error")
+			}
+			return false, NewError(message)
+		default:
+			if err := s.skipValue(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *BitmapStream) seekResultBits() (bool, error) {
+	if err := s.expectDelim('{'); err != nil {
+		return false, err
+	}
+	for s.decoder.More() {
+		key, err := s.nextKey()
+		if err != nil {
+			return false, err
+		}
+		switch key {
+		case "attrs":
+			attrs := map[string]interface{}{}
+			if err := s.decoder.Decode(&attrs); err != nil {
+				return false, errors.Wrap(err, "decoding attributes")
+			}
+			s.attributes = convertJSONAttrs(attrs)
+		case "bits":
+			if err := s.expectDelim('['); err != nil {
+				return false, err
+			}
+			return true, nil
+		default:
+			if err := s.skipValue(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, nil
+}
+
+func (s *BitmapStream) nextKey() (string, error) {
+	token, err := s.decoder.Token()
+	if err != nil {
+		return "", errors.Wrap(err, "decoding response")
+	}
+	key, ok := token.(string)
+	if !ok {
+		return "", errors.Errorf("expected a key in the response, got: %v", token)
+	}
+	return key, nil
+}
+
+func (s *BitmapStream) expectDelim(delim json.Delim) error {
+	token, err := s.decoder.Token()
+	if err != nil {
+		return errors.Wrap(err, "decoding response")
+	}
+	if token != delim {
+		return errors.Errorf("expected '%s' in the response, got: %v", delim, token)
+	}
+	return nil
+}
+
+func (s *BitmapStream) skipValue() error {
+	var value json.RawMessage
+	return errors.Wrap(s.decoder.Decode(&value), "decoding response")
+}
@@ -0,0 +1,172 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBitmapResultIterator(t *testing.T) {
+	result := &BitmapResult{Bits: []uint64{3, 10, 42}}
+	columns := readColumns(t, result.Iterator())
+	if !reflect.DeepEqual([]uint64{3, 10, 42}, columns) {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+	columns = readColumns(t, (&BitmapResult{}).Iterator())
+	if len(columns) != 0 {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+}
+
+func TestStreamBitmap(t *testing.T) {
+	var requested, body string
+	client := streamClient(t, 200, `{"results":[{"attrs":{"name":"a","weight":2},"bits":[3,10,42]}]}`, func(req *http.Request) {
+		requested = req.URL.Path + "?" + req.URL.RawQuery
+		buf, _ := ioutil.ReadAll(req.Body)
+		body = string(buf)
+	})
+	stream, err := client.StreamBitmap(sampleFrame.Bitmap(5), &QueryOptions{Columns: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	columns := readColumns(t, stream)
+	if !reflect.DeepEqual([]uint64{3, 10, 42}, columns) {
+		t.Fatalf("unexpected columns: %v", columns)
+	}
+	if requested != "/index/sample-index/query?columnAttrs=true" {
+		t.Fatalf("unexpected request: %s", requested)
+	}
+	if body != "Bitmap(rowID=5, frame='sample-frame')" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+	attrs := map[string]interface{}{"name": "a", "weight": int64(2)}
+	if !reflect.DeepEqual(attrs, stream.Attributes()) {
+		t.Fatalf("unexpected attributes: %v", stream.Attributes())
+	}
+	if _, err := stream.NextColumn(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+}
+
+func TestStreamBitmapNoBits(t *testing.T) {
+	responses := []string{
+		`{"results":[]}`,
+		`{"results":[{"attrs":{}}]}`,
+		`{}`,
+	}
+	for _, response := range responses {
+		client := streamClient(t, 200, response, nil)
+		stream, err := client.StreamBitmap(sampleFrame.Bitmap(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns := readColumns(t, stream)
+		if len(columns) != 0 {
+			t.Fatalf("unexpected columns for %s: %v", response, columns)
+		}
+		stream.Close()
+	}
+}
+
+func TestStreamBitmapFails(t *testing.T) {
+	client := streamClient(t, 200, `{"error":"frame not found"}`, nil)
+	stream, err := client.StreamBitmap(sampleFrame.Bitmap(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.NextColumn(); err == nil || err == io.EOF {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+	stream.Close()
+
+	client = streamClient(t, 200, `{"results":[{"bits":[1,"x"]}]}`, nil)
+	stream, err = client.StreamBitmap(sampleFrame.Bitmap(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if column, err := stream.NextColumn(); err != nil || column != 1 {
+		t.Fatalf("unexpected column %d, err: %v", column, err)
+	}
+	if _, err := stream.NextColumn(); err == nil || err == io.EOF {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+	stream.Close()
+
+	client = streamClient(t, 400, "bad query", nil)
+	_, err = client.StreamBitmap(sampleFrame.Bitmap(5))
+	if !isCategory(err, CategoryValidation) {
+		t.Fatalf("expected a validation error, got: %v", err)
+	}
+
+	_, err = client.StreamBitmap(sampleFrame.Bitmap(5), "not an option")
+	if err != ErrInvalidQueryOption {
+		t.Fatalf("expected ErrInvalidQueryOption, got: %v", err)
+	}
+}
+
+func streamClient(t *testing.T, status int, response string, inspect func(*http.Request)) *Client {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if inspect != nil {
+			inspect(req)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader(response)),
+			Request:    req,
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func readColumns(t *testing.T, iterator ColumnIterator) []uint64 {
+	columns := []uint64{}
+	for {
+		column, err := iterator.NextColumn()
+		if err == io.EOF {
+			return columns
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns = append(columns, column)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// readResponseBody reads the whole response body.
+// The buffer is allocated at once if the response has a content length,
+// and reading fails with ErrResponseTooLarge if the body is larger than limit.
+// There is no limit if limit is 0.
+func readResponseBody(response *http.Response, limit int64) ([]byte, error) {
+	if limit > 0 && response.ContentLength > limit {
+		return nil, ErrResponseTooLarge
+	}
+	buf := &bytes.Buffer{}
+	if response.ContentLength > 0 {
+		buf.Grow(int(response.ContentLength) + bytes.MinRead)
+	}
+	_, err := buf.ReadFrom(newLimitedBody(response.Body, limit))
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// maxPooledBufferSize is the capacity above which buffers are not put back in the pool,
+// so a few large responses do not keep the memory allocated.
+const maxPooledBufferSize = 1 << 20
+
+var bodyBufferPool = sync.Pool{
+	New: func() interface{} {
+		return &bytes.Buffer{}
+	},
+}
+
+// pooledBodies keeps the pooled buffers of the response bodies read for a request,
+// so they are put back in the pool once the bodies are decoded.
+type pooledBodies struct {
+	mutex    sync.Mutex
+	buffers  []*bytes.Buffer
+	released bool
+}
+
+type pooledBodiesKey struct{}
+
+// withPooledBodies returns a context whose response bodies are read into pooled buffers.
+// The returned release function should be called once the bodies are no longer used.
+func withPooledBodies(ctx context.Context) (context.Context, func()) {
+	bodies := &pooledBodies{}
+	return context.WithValue(ctx, pooledBodiesKey{}, bodies), bodies.release
+}
+
+func pooledBodiesFromContext(ctx context.Context) *pooledBodies {
+	bodies, _ := ctx.Value(pooledBodiesKey{}).(*pooledBodies)
+	return bodies
+}
+
+// read reads the whole response body like readResponseBody, into a buffer from the pool.
+// It falls back to readResponseBody if bodies is nil.
+func (bodies *pooledBodies) read(response *http.Response, limit int64) ([]byte, error) {
+	if bodies == nil {
+		return readResponseBody(response, limit)
+	}
+	if limit > 0 && response.ContentLength > limit {
+		return nil, ErrResponseTooLarge
+	}
+	buf := bodyBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if response.ContentLength > 0 {
+		buf.Grow(int(response.ContentLength) + bytes.MinRead)
+	}
+	if _, err := buf.ReadFrom(newLimitedBody(response.Body, limit)); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	// the buffer is added once it is read, since a hedged request may still be reading after the release
+	bodies.mutex.Lock()
+	defer bodies.mutex.Unlock()
+	if bodies.released {
+		putBuffer(buf)
+		return nil, context.Canceled
+	}
+	bodies.buffers = append(bodies.buffers, buf)
+	return buf.Bytes(), nil
+}
+
+func (bodies *pooledBodies) release() {
+	bodies.mutex.Lock()
+	defer bodies.mutex.Unlock()
+	for _, buf := range bodies.buffers {
+		putBuffer(buf)
+	}
+	bodies.buffers = nil
+	bodies.released = true
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bodyBufferPool.Put(buf)
+	}
+}
+
+// limitedBody fails reading with ErrResponseTooLarge once more than limit bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func newLimitedBody(body io.ReadCloser, limit int64) io.ReadCloser {
+	if limit <= 0 {
+		return body
+	}
+	return &limitedBody{ReadCloser: body, limit: limit}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n, ErrResponseTooLarge
+	}
+	return n, err
+}
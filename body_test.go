@@ -0,0 +1,145 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+func TestReadResponseBody(t *testing.T) {
+	response := func(body string, contentLength int64) *http.Response {
+		return &http.Response{
+			Body:          ioutil.NopCloser(strings.NewReader(body)),
+			ContentLength: contentLength,
+		}
+	}
+	data, err := readResponseBody(response("some data", 9), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "some data" {
+		t.Fatalf("unexpected body: %s", data)
+	}
+	data, err = readResponseBody(response("some data", -1), 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "some data" {
+		t.Fatalf("unexpected body: %s", data)
+	}
+	if _, err = readResponseBody(response("some data", 9), 5); err != ErrResponseTooLarge {
+		t.Fatalf("ErrResponseTooLarge expected, got: %v", err)
+	}
+	if _, err = readResponseBody(response("some data", -1), 5); err != ErrResponseTooLarge {
+		t.Fatalf("ErrResponseTooLarge expected, got: %v", err)
+	}
+}
+
+func TestPooledBodies(t *testing.T) {
+	response := &http.Response{
+		Body:          ioutil.NopCloser(strings.NewReader("some data")),
+		ContentLength: 9,
+	}
+	ctx, release := withPooledBodies(context.Background())
+	bodies := pooledBodiesFromContext(ctx)
+	data, err := bodies.read(response, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "some data" || len(bodies.buffers) != 1 {
+		t.Fatalf("unexpected body: %s", data)
+	}
+	release()
+	if len(bodies.buffers) != 0 {
+		t.Fatal("buffers should be released")
+	}
+	response.Body = ioutil.NopCloser(strings.NewReader("some data"))
+	if _, err := bodies.read(response, 0); err != context.Canceled {
+		t.Fatalf("reading after the release should fail, got: %v", err)
+	}
+	if pooledBodiesFromContext(context.Background()) != nil {
+		t.Fatal("bodies should not be pooled without withPooledBodies")
+	}
+}
+
+func TestPooledQueryResponses(t *testing.T) {
+	for _, jsonFormat := range []bool{false, true} {
+		name := "aaaa"
+		transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var body []byte
+			if jsonFormat {
+				body = []byte(`{"results": [{"attrs": {"name": "` + name + `"}, "bits": [1]}]}`)
+			} else {
+				var err error
+				body, err = proto.Marshal(&pbuf.QueryResponse{Results: []*pbuf.QueryResult{{
+					Bitmap: &pbuf.Bitmap{Bits: []uint64{1}, Attrs: []*pbuf.Attr{{Key: "name", Type: stringType, StringValue: name}}},
+				}}})
+				if err != nil {
+					return nil, err
+				}
+			}
+			return &http.Response{
+				StatusCode:    200,
+				Body:          ioutil.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+				Request:       req,
+			}, nil
+		})
+		client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(jsonFormat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first, err := client.Query(sampleFrame.Bitmap(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the buffer of the first response is reused for the next responses
+		name = "bbbb"
+		for i := 0; i < 10; i++ {
+			if _, err := client.Query(sampleFrame.Bitmap(1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if value := first.Result().Bitmap.Attributes["name"]; value != "aaaa" {
+			t.Fatalf("the first response should not change, got: %v", value)
+		}
+	}
+}
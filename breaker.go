@@ -0,0 +1,143 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 1
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// breakerSettings are the threshold and cooldown of the circuit breakers.
+// They are set per client, so clients sharing a cluster may use different settings.
+type breakerSettings struct {
+	threshold int
+	cooldown  time.Duration
+}
+
+var defaultBreakerSettings = breakerSettings{
+	threshold: defaultBreakerThreshold,
+	cooldown:  defaultBreakerCooldown,
+}
+
+// BreakerState is the state of the circuit breaker of a host.
+type BreakerState int
+
+// Circuit breaker states.
+const (
+	// BreakerClosed means requests are routed to the host.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen means the host is failing and requests are not routed to it.
+	BreakerOpen
+	// BreakerHalfOpen means the cooldown of a failing host is over,
+	// and the next request is routed to it in order to probe it.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// HostStatus contains the circuit breaker state of a host in the cluster.
+type HostStatus struct {
+	URI URI
+	// State is the state of the circuit breaker of the host.
+	State BreakerState
+	// Failures is the number of consecutive failures of the host.
+	Failures int
+	// OpenedAt is the time from which the cooldown of the breaker is measured,
+	// i.e., the last failure of the host or the last probe, zero if the breaker is closed.
+	OpenedAt time.Time
+	// Healthy is false if the host failed its last health check.
+	Healthy bool
+	// Weight is the weight of the host, see Cluster.AddHostWithWeight.
+	Weight int
+}
+
+// hostBreaker tracks consecutive failures of a single host.
+// It records the failures regardless of the settings, since it is shared by the clients using the cluster,
+// and each client derives the state of the breaker with its own threshold and cooldown.
+type hostBreaker struct {
+	failures int
+	// failedAt is the time of the last failure.
+	failedAt time.Time
+	// probedAt is the time a request was last routed to the host after its cooldown.
+	probedAt time.Time
+	// unhealthy is set by the health checker, see Client.StartHealthCheck.
+	unhealthy bool
+}
+
+// openedAt returns the time from which the cooldown is measured, the last failure or probe.
+func (b *hostBreaker) openedAt() time.Time {
+	if b.probedAt.After(b.failedAt) {
+		return b.probedAt
+	}
+	return b.failedAt
+}
+
+func (b *hostBreaker) state(now time.Time, settings breakerSettings) BreakerState {
+	if b.failures < settings.threshold {
+		return BreakerClosed
+	}
+	if now.Sub(b.openedAt()) < settings.cooldown {
+		return BreakerOpen
+	}
+	return BreakerHalfOpen
+}
+
+func (b *hostBreaker) succeeded() {
+	b.failures = 0
+	b.failedAt = time.Time{}
+	b.probedAt = time.Time{}
+}
+
+func (b *hostBreaker) failed(now time.Time) {
+	b.failures++
+	b.failedAt = now
+}
+
+// probed restarts the cooldown, so only one request probes the host.
+func (b *hostBreaker) probed(now time.Time) {
+	b.probedAt = now
+}
@@ -34,14 +34,19 @@ package pilosa
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -51,6 +56,15 @@ import (
 
 const maxHosts = 10
 const sliceWidth = 1048576
+const defaultKeepAlive = 30 * time.Second
+const defaultIdleConnTimeout = 90 * time.Second
+const defaultAsyncConcurrency = 10
+
+// ClientVersion is the version of the client.
+// Use Client.Version to get the version of the server.
+const ClientVersion = "0.8.0"
+
+const defaultUserAgent = "go-pilosa/" + ClientVersion
 
 // // both Content-Type and Accept headers must be set for protobuf content
 var protobufHeaders = map[string]string{
@@ -58,10 +72,24 @@ var protobufHeaders = map[string]string{
 	"Accept":       "application/x-protobuf",
 }
 
+var roaringHeaders = map[string]string{
+	"Content-Type": "application/octet-stream",
+	"Accept":       "application/json",
+}
+
 // Client is the HTTP client for Pilosa server.
 type Client struct {
 	cluster *Cluster
+	// breaker is the circuit breaker settings of the client for the hosts of the cluster
+	breaker breakerSettings
 	client  *http.Client
+	doer    Doer
+	options *ClientOptions
+	names   *nameCache
+	schemas *schemaCache
+	results *resultCache
+	// asyncSlots limits the number of asynchronous queries in flight
+	asyncSlots chan struct{}
 }
 
 // DefaultClient creates a client with the default address and options.
@@ -70,6 +98,7 @@ func DefaultClient() *Client {
 }
 
 // NewClientWithURI creates a client with the given server address.
+// *Deprecated*: Use `NewClient(uri, options...)` instead.
 func NewClientWithURI(uri *URI) *Client {
 	return NewClientWithCluster(NewClusterWithHost(uri), nil)
 }
@@ -77,7 +106,18 @@ func NewClientWithURI(uri *URI) *Client {
 // NewClientFromAddresses creates a client for a cluster specified by `hosts`. Each
 // string in `hosts` is the string representation of a URI. E.G
 // node0.pilosa.com:10101
+// *Deprecated*: Use `NewClient(addresses, options...)` instead.
 func NewClientFromAddresses(addresses []string, options *ClientOptions) (*Client, error) {
+	cluster, err := newClusterFromAddresses(addresses)
+	if err != nil {
+		return nil, err
+	}
+	client := NewClientWithCluster(cluster, options)
+	return client, nil
+}
+
+// newClusterFromAddresses creates a cluster with the hosts at the given addresses.
+func newClusterFromAddresses(addresses []string) (*Cluster, error) {
 	uris := make([]*URI, len(addresses))
 	for i, address := range addresses {
 		uri, err := NewURIFromAddress(address)
@@ -86,24 +126,22 @@ func NewClientFromAddresses(addresses []string, options *ClientOptions) (*Client
 		}
 		uris[i] = uri
 	}
-	cluster := NewClusterWithHost(uris...)
-	client := NewClientWithCluster(cluster, options)
-	return client, nil
+	return NewClusterWithHost(uris...), nil
 }
 
 // NewClientWithCluster creates a client with the given cluster and options.
 // Pass nil for default options.
+// *Deprecated*: Use `NewClient(cluster, options...)` instead.
 func NewClientWithCluster(cluster *Cluster, options *ClientOptions) *Client {
 	if options == nil {
 		options = &ClientOptions{}
 	}
-	return &Client{
-		cluster: cluster,
-		client:  newHTTPClient(options.withDefaults()),
-	}
+	return newClientWithOptions(cluster, options)
 }
 
 // NewClient creates a client with the given address, URI, or cluster and options.
+// `addrUriOrCluster` may be an address string, a slice of address strings, a *URI,
+// a slice of *URI, a *Cluster or nil.
 func NewClient(addrUriOrCluster interface{}, options ...ClientOption) (*Client, error) {
 	var cluster *Cluster
 	clientOptions := &ClientOptions{}
@@ -120,7 +158,10 @@ func NewClient(addrUriOrCluster interface{}, options ...ClientOption) (*Client,
 		}
 		cluster = NewClusterWithHost(uri)
 	case []string:
-		return NewClientFromAddresses(u, clientOptions)
+		cluster, err = newClusterFromAddresses(u)
+		if err != nil {
+			return nil, err
+		}
 	case *URI:
 		cluster = NewClusterWithHost(u)
 	case []*URI:
@@ -133,108 +174,293 @@ func NewClient(addrUriOrCluster interface{}, options ...ClientOption) (*Client,
 		return nil, ErrAddrURIClusterExpected
 	}
 
-	return &Client{
+	if clientOptions.customTransport() {
+		for _, host := range cluster.allHosts() {
+			if host.SocketPath() != "" {
+				return nil, ErrUnixSocketUnsupported
+			}
+		}
+	}
+	client := newClientWithOptions(cluster, clientOptions)
+	if err = client.checkVersionAtStartup(); err != nil {
+		return nil, err
+	}
+	client.prewarmAtStartup()
+	return client, nil
+}
+
+func newClientWithOptions(cluster *Cluster, options *ClientOptions) *Client {
+	options = options.withDefaults()
+	client := newHTTPClient(options)
+	c := &Client{
 		cluster: cluster,
-		client:  newHTTPClient(clientOptions.withDefaults()),
-	}, nil
+		breaker: breakerSettings{
+			threshold: options.BreakerThreshold,
+			cooldown:  options.BreakerCooldown,
+		},
+		client:     client,
+		doer:       chainInterceptors(client, options.interceptors()),
+		options:    options,
+		names:      newNameCache(),
+		schemas:    newSchemaCache(options.SchemaCacheTTL),
+		results:    newResultCache(options.ResultCacheSize, options.ResultCacheTTL),
+		asyncSlots: make(chan struct{}, options.AsyncConcurrency),
+	}
+	if options.PrewarmConnections > 0 {
+		cluster.RegisterObserver(prewarmObserver{client: c})
+	}
+	return c
 }
 
 // Query runs the given query against the server with the given options.
 // Pass nil for default options.
 func (c *Client) Query(query PQLQuery, options ...interface{}) (*QueryResponse, error) {
+	return c.QueryWithContext(context.Background(), query, options...)
+}
+
+// QueryWithContext runs the given query against the server with the given options.
+// The request is canceled if the context is canceled or its deadline expires.
+func (c *Client) QueryWithContext(ctx context.Context, query PQLQuery, options ...interface{}) (queryResponse *QueryResponse, err error) {
 	if err := query.Error(); err != nil {
 		return nil, err
 	}
 	queryOptions := &QueryOptions{}
-	err := queryOptions.addOptions(options...)
+	err = queryOptions.addOptions(options...)
 	if err != nil {
 		return nil, err
 	}
-	data, err := makeRequestData(query.serialize(), queryOptions)
-	if err != nil {
-		return nil, errors.Wrap(err, "making request data")
+	if queryOptions.DryRun {
+		return dryRunQuery(query)
+	}
+	indexName := query.Index().name
+	pql := query.serialize()
+	retryPolicy := c.options.RetryPolicy
+	if queryOptions.RetryPolicy != nil {
+		retryPolicy = queryOptions.RetryPolicy
+	}
+	hedge := c.options.HedgeDelay > 0 && len(c.cluster.availableHosts(c.breaker)) > 1
+	// the query is parsed only if it matters whether it modifies data
+	readOnly := false
+	if retryPolicy != nil || hedge || c.results != nil || c.options.AuditHook != nil {
+		readOnly = isReadOnlyPQL(pql)
+	}
+	if !readOnly {
+		retryPolicy = nil
+		hedge = false
+	}
+	var cacheKey string
+	if readOnly && c.results != nil {
+		cacheKey = resultCacheKey(indexName, pql, queryOptions, c.options.JSONFormat)
+		if response := c.results.get(cacheKey); response != nil {
+			return response, nil
+		}
+	} else if !readOnly {
+		// invalidate the cached results even if the query fails, since it may be partially applied
+		defer c.results.invalidateQuery(indexName, pql)
+		finishAudit := c.startAudit(ctx, AuditEvent{Operation: AuditQuery, Index: indexName, Query: pql})
+		defer func() {
+			auditErr := err
+			if auditErr == nil {
+				auditErr = queryResponse.Err()
+			}
+			finishAudit(&auditErr)
+		}()
+	}
+	ctx = c.withTraceQuery(ctx, indexName, pql)
+	ctx = ensureRequestID(ctx)
+	lazy := queryOptions.LazyBits && !c.options.JSONFormat
+	if !lazy {
+		// the response is decoded into new values, so its body can be read into a pooled buffer
+		var releaseBodies func()
+		ctx, releaseBodies = withPooledBodies(ctx)
+		defer releaseBodies()
+	}
+	path := fmt.Sprintf("/index/%s/query", indexName)
+	headers := protobufHeaders
+	var data []byte
+	if c.options.JSONFormat {
+		path = makeJSONRequestPath(path, queryOptions)
+		headers = jsonHeaders
+		data = []byte(pql)
+	} else {
+		data = makeRequestData(pql, queryOptions)
+	}
+	if len(queryOptions.Headers) > 0 {
+		headers = mergeHeaders(queryOptions.Headers, headers)
 	}
-	path := fmt.Sprintf("/index/%s/query", query.Index().name)
-	_, buf, err := c.httpRequest("POST", path, data, protobufHeaders)
-	if err != nil {
-		return nil, err
+	var response *http.Response
+	var buf []byte
+	start := time.Now()
+	if hedge {
+		response, buf, err = c.hedgedRequest(ctx, "POST", path, data, headers, retryPolicy, c.options.HedgeDelay)
+	} else {
+		response, buf, err = c.httpRequestWithRetry(ctx, "POST", path, data, headers, retryPolicy)
 	}
-	iqr := &pbuf.QueryResponse{}
-	err = proto.Unmarshal(buf, iqr)
 	if err != nil {
 		return nil, err
 	}
-	queryResponse, err := newQueryResponseFromInternal(iqr)
+	metadata := newResponseMetadata(response, buf, time.Since(start))
+	if c.options.JSONFormat {
+		queryResponse, err = newQueryResponseFromJSON(buf)
+	} else if lazy {
+		queryResponse, err = decodeQueryResponseLazily(buf)
+	} else {
+		iqr := &pbuf.QueryResponse{}
+		if err = proto.Unmarshal(buf, iqr); err != nil {
+			return nil, err
+		}
+		queryResponse, err = newQueryResponseFromInternal(iqr)
+	}
 	if err != nil {
 		return nil, err
 	}
+	queryResponse.Metadata = metadata
+	c.logSlowQuery(ctx, indexName, pql, metadata, time.Since(start))
+	if cacheKey != "" && queryResponse.Success {
+		c.results.set(cacheKey, indexName, pql, queryResponse)
+	}
 	return queryResponse, nil
 }
 
 // CreateIndex creates an index on the server using the given Index struct.
 func (c *Client) CreateIndex(index *Index) error {
-	data := []byte(index.options.String())
+	return c.CreateIndexWithContext(context.Background(), index)
+}
+
+// CreateIndexWithContext creates an index on the server using the given Index struct.
+func (c *Client) CreateIndexWithContext(ctx context.Context, index *Index) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditCreateIndex, Index: index.name})(&err)
+	data, err := json.Marshal(index.options.request())
+	if err != nil {
+		return errors.Wrap(err, "marshaling index options")
+	}
 	path := fmt.Sprintf("/index/%s", index.name)
-	response, _, err := c.httpRequest("POST", path, data, nil)
+	_, err = c.schemaRequest(ctx, "POST", path, data)
 	if err != nil {
-		if response.StatusCode == 409 {
+		if isCategory(err, CategoryConflict) {
+			c.names.addIndex(index.name)
 			return ErrIndexExists
 		}
 		return err
 	}
-	if index.options.TimeQuantum != TimeQuantumNone {
-		err = c.patchIndexTimeQuantum(index)
-	}
-	return err
-
+	c.names.addIndex(index.name)
+	c.schemas.invalidate()
+	return nil
 }
 
 // CreateFrame creates a frame on the server using the given Frame struct.
 func (c *Client) CreateFrame(frame *Frame) error {
-	data := []byte(frame.options.String())
+	return c.CreateFrameWithContext(context.Background(), frame)
+}
+
+// CreateFrameWithContext creates a frame on the server using the given Frame struct.
+func (c *Client) CreateFrameWithContext(ctx context.Context, frame *Frame) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditCreateFrame, Index: frame.index.name, Frame: frame.name})(&err)
+	data, err := json.Marshal(frame.options.request())
+	if err != nil {
+		return errors.Wrap(err, "marshaling frame options")
+	}
 	path := fmt.Sprintf("/index/%s/frame/%s", frame.index.name, frame.name)
-	response, _, err := c.httpRequest("POST", path, data, nil)
+	_, err = c.schemaRequest(ctx, "POST", path, data)
 	if err != nil {
-		if response.StatusCode == 409 {
+		if isCategory(err, CategoryConflict) {
+			c.names.addFrame(frame.index.name, frame.name)
 			return ErrFrameExists
 		}
 		return err
 	}
-	if frame.options.TimeQuantum != TimeQuantumNone {
-		err = c.patchFrameTimeQuantum(frame)
-	}
-	return err
+	c.names.addFrame(frame.index.name, frame.name)
+	c.schemas.invalidate()
+	return nil
 }
 
 // EnsureIndex creates an index on the server if it does not exist.
 func (c *Client) EnsureIndex(index *Index) error {
-	err := c.CreateIndex(index)
+	return c.EnsureIndexWithContext(context.Background(), index)
+}
+
+// EnsureIndexWithContext creates an index on the server if it does not exist.
+func (c *Client) EnsureIndexWithContext(ctx context.Context, index *Index) error {
+	_, err := c.EnsureIndexCreatedWithContext(ctx, index)
+	return err
+}
+
+// EnsureIndexCreated creates an index on the server if it does not exist.
+// Returns true if the index was created.
+func (c *Client) EnsureIndexCreated(index *Index) (bool, error) {
+	return c.EnsureIndexCreatedWithContext(context.Background(), index)
+}
+
+// EnsureIndexCreatedWithContext creates an index on the server if it does not exist.
+// Returns true if the index was created.
+func (c *Client) EnsureIndexCreatedWithContext(ctx context.Context, index *Index) (bool, error) {
+	err := c.CreateIndexWithContext(ctx, index)
 	if err == ErrIndexExists {
-		return nil
+		return false, nil
 	}
-	return err
+	return err == nil, err
 }
 
 // EnsureFrame creates a frame on the server if it doesn't exists.
 func (c *Client) EnsureFrame(frame *Frame) error {
-	err := c.CreateFrame(frame)
+	return c.EnsureFrameWithContext(context.Background(), frame)
+}
+
+// EnsureFrameWithContext creates a frame on the server if it doesn't exists.
+func (c *Client) EnsureFrameWithContext(ctx context.Context, frame *Frame) error {
+	_, err := c.EnsureFrameCreatedWithContext(ctx, frame)
+	return err
+}
+
+// EnsureFrameCreated creates a frame on the server if it doesn't exist.
+// Returns true if the frame was created.
+func (c *Client) EnsureFrameCreated(frame *Frame) (bool, error) {
+	return c.EnsureFrameCreatedWithContext(context.Background(), frame)
+}
+
+// EnsureFrameCreatedWithContext creates a frame on the server if it doesn't exist.
+// Returns true if the frame was created.
+func (c *Client) EnsureFrameCreatedWithContext(ctx context.Context, frame *Frame) (bool, error) {
+	err := c.CreateFrameWithContext(ctx, frame)
 	if err == ErrFrameExists {
-		return nil
+		return false, nil
 	}
-	return err
+	return err == nil, err
 }
 
 // DeleteIndex deletes an index on the server.
 func (c *Client) DeleteIndex(index *Index) error {
-	path := fmt.Sprintf("/index/%s", index.name)
-	_, _, err := c.httpRequest("DELETE", path, nil, nil)
-	return err
+	return c.DeleteIndexWithContext(context.Background(), index)
+}
 
+// DeleteIndexWithContext deletes an index on the server.
+// If the client is created with ProtectDestructive, the context should confirm the name of the index.
+func (c *Client) DeleteIndexWithContext(ctx context.Context, index *Index) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditDeleteIndex, Index: index.name})(&err)
+	if err = c.checkDestructive(ctx, index.name); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/index/%s", index.name)
+	err = c.deleteRequest(ctx, path)
+	c.schemas.invalidate()
+	c.results.invalidate(index.name, "")
+	if err != nil {
+		return err
+	}
+	c.names.removeIndex(index.name)
+	return nil
 }
 
 // CreateIntField creates an integer range field.
 // *Experimental*: This feature may be removed or its interface may be modified in the future.
 func (c *Client) CreateIntField(frame *Frame, name string, min int, max int) error {
+	return c.CreateIntFieldWithContext(context.Background(), frame, name, min, max)
+}
+
+// CreateIntFieldWithContext creates an integer range field.
+// *Experimental*: This feature may be removed or its interface may be modified in the future.
+func (c *Client) CreateIntFieldWithContext(ctx context.Context, frame *Frame, name string, min int, max int) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditCreateField, Index: frame.index.name, Frame: frame.name, Field: name})(&err)
 	// TODO: refactor the code below when we have more fields types
 	field, err := newIntRangeField(name, min, max)
 	if err != nil {
@@ -243,45 +469,238 @@ func (c *Client) CreateIntField(frame *Frame, name string, min int, max int) err
 	path := fmt.Sprintf("/index/%s/frame/%s/field/%s",
 		frame.index.name, frame.name, name)
 	data := []byte(encodeMap(field))
-	_, _, err = c.httpRequest("POST", path, data, nil)
-	if err != nil {
+	retried, err := c.schemaRequest(ctx, "POST", path, data)
+	if err != nil && !(retried && isCategory(err, CategoryConflict)) {
+		// a conflict after a retry is the field created by the previous attempt
 		return err
 	}
+	c.schemas.invalidate()
+	// keep the local frame definition in sync with the server
+	frame.options.fields = copyFields(frame.options.fields)
+	frame.options.fields[name] = field
 	return nil
 }
 
 // DeleteField delete a range field.
 // *Experimental*: This feature may be removed or its interface may be modified in the future.
 func (c *Client) DeleteField(frame *Frame, name string) error {
+	return c.DeleteFieldWithContext(context.Background(), frame, name)
+}
+
+// DeleteFieldWithContext delete a range field.
+// If the client is created with ProtectDestructive, the context should confirm the name of the field.
+// *Experimental*: This feature may be removed or its interface may be modified in the future.
+func (c *Client) DeleteFieldWithContext(ctx context.Context, frame *Frame, name string) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditDeleteField, Index: frame.index.name, Frame: frame.name, Field: name})(&err)
+	if err = c.checkDestructive(ctx, name); err != nil {
+		return err
+	}
 	path := fmt.Sprintf("/index/%s/frame/%s/field/%s",
 		frame.index.name, frame.name, name)
-	_, _, err := c.httpRequest("DELETE", path, nil, nil)
+	err = c.deleteRequest(ctx, path)
+	c.schemas.invalidate()
+	c.results.invalidate(frame.index.name, frame.name)
 	if err != nil {
 		return err
 	}
+	frame.options.fields = copyFields(frame.options.fields)
+	delete(frame.options.fields, name)
+	delete(frame.fields, name)
 	return nil
 }
 
+// Fields returns the definitions of the fields of a frame on the server, sorted by name.
+// *Experimental*: This feature may be removed or its interface may be modified in the future.
+func (c *Client) Fields(frame *Frame) ([]FieldInfo, error) {
+	return c.FieldsWithContext(context.Background(), frame)
+}
+
+// FieldsWithContext returns the definitions of the fields of a frame on the server, sorted by name.
+// Returns ErrFrameNotFound if the frame is not on the server.
+// *Experimental*: This feature may be removed or its interface may be modified in the future.
+func (c *Client) FieldsWithContext(ctx context.Context, frame *Frame) ([]FieldInfo, error) {
+	schema, err := c.SchemaWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	index, ok := schema.indexes[frame.index.name]
+	if !ok {
+		return nil, ErrFrameNotFound
+	}
+	serverFrame, ok := index.frames[frame.name]
+	if !ok {
+		return nil, ErrFrameNotFound
+	}
+	return serverFrame.options.Fields(), nil
+}
+
 // DeleteFrame deletes a frame on the server.
 func (c *Client) DeleteFrame(frame *Frame) error {
+	return c.DeleteFrameWithContext(context.Background(), frame)
+}
+
+// DeleteFrameWithContext deletes a frame on the server.
+// If the client is created with ProtectDestructive, the context should confirm the name of the frame.
+func (c *Client) DeleteFrameWithContext(ctx context.Context, frame *Frame) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditDeleteFrame, Index: frame.index.name, Frame: frame.name})(&err)
+	if err = c.checkDestructive(ctx, frame.name); err != nil {
+		return err
+	}
 	path := fmt.Sprintf("/index/%s/frame/%s", frame.index.name, frame.name)
-	_, _, err := c.httpRequest("DELETE", path, nil, nil)
-	return err
+	err = c.deleteRequest(ctx, path)
+	c.schemas.invalidate()
+	c.results.invalidate(frame.index.name, frame.name)
+	if err != nil {
+		return err
+	}
+	c.names.removeFrame(frame.index.name, frame.name)
+	return nil
+}
+
+// Indexes returns the names of the indexes on the server, sorted by name.
+func (c *Client) Indexes() ([]string, error) {
+	return c.IndexesWithContext(context.Background())
+}
+
+// IndexesWithContext returns the names of the indexes on the server, sorted by name.
+func (c *Client) IndexesWithContext(ctx context.Context) ([]string, error) {
+	if err := c.updateNames(ctx); err != nil {
+		return nil, err
+	}
+	return c.names.indexNames(), nil
+}
+
+// IndexExists returns true if the index with the given name is on the server.
+// Indexes which are known to exist are cached, so checking them again doesn't send a request.
+func (c *Client) IndexExists(name string) (bool, error) {
+	return c.IndexExistsWithContext(context.Background(), name)
+}
+
+// IndexExistsWithContext returns true if the index with the given name is on the server.
+// Indexes which are known to exist are cached, so checking them again doesn't send a request.
+func (c *Client) IndexExistsWithContext(ctx context.Context, name string) (bool, error) {
+	if c.names.hasIndex(name) {
+		return true, nil
+	}
+	if err := c.updateNames(ctx); err != nil {
+		return false, err
+	}
+	return c.names.hasIndex(name), nil
+}
+
+// FrameExists returns true if the frame with the given name is in the index on the server.
+// Frames which are known to exist are cached, so checking them again doesn't send a request.
+func (c *Client) FrameExists(indexName string, frameName string) (bool, error) {
+	return c.FrameExistsWithContext(context.Background(), indexName, frameName)
+}
+
+// FrameExistsWithContext returns true if the frame with the given name is in the index on the server.
+// Frames which are known to exist are cached, so checking them again doesn't send a request.
+func (c *Client) FrameExistsWithContext(ctx context.Context, indexName string, frameName string) (bool, error) {
+	if c.names.hasFrame(indexName, frameName) {
+		return true, nil
+	}
+	if err := c.updateNames(ctx); err != nil {
+		return false, err
+	}
+	return c.names.hasFrame(indexName, frameName), nil
+}
+
+func (c *Client) updateNames(ctx context.Context) error {
+	status, err := c.status(ctx)
+	if err != nil {
+		return err
+	}
+	c.names.update(status)
+	return nil
 }
 
 // SyncSchema updates a schema with the indexes and frames on the server and
 // creates the indexes and frames in the schema on the server side.
 // This function does not delete indexes and the frames on the server side nor in the schema.
-func (c *Client) SyncSchema(schema *Schema) error {
-	serverSchema, err := c.Schema()
+// Pass SyncSchemaReport to find out which indexes and frames were created and which exist only on the server.
+func (c *Client) SyncSchema(schema *Schema, options ...SyncSchemaOption) error {
+	return c.SyncSchemaWithContext(context.Background(), schema, options...)
+}
+
+// SyncSchemaWithContext updates a schema with the indexes and frames on the server and
+// creates the indexes and frames in the schema on the server side.
+func (c *Client) SyncSchemaWithContext(ctx context.Context, schema *Schema, options ...SyncSchemaOption) error {
+	syncOptions := &SyncSchemaOptions{}
+	for _, option := range options {
+		if err := option(syncOptions); err != nil {
+			return err
+		}
+	}
+	serverSchema, err := c.SchemaWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if report := syncOptions.Report; report != nil {
+		// the schema is updated with the server schema, so the report is made before syncing
+		diff := schema.Diff(serverSchema)
+		report.Created = diff.Extra
+		report.Extraneous = diff.Missing
+	}
+
+	return c.syncSchema(ctx, schema, serverSchema)
+}
+
+// SchemaReport lists the differences between a local schema and the server schema
+// found by SyncSchema.
+type SchemaReport struct {
+	// Created contains the indexes and frames which were created on the server.
+	Created *Schema
+	// Extraneous contains the indexes and frames which exist on the server but were not in the local schema.
+	Extraneous *Schema
+}
+
+// SyncSchemaOptions contains options to customize SyncSchema.
+type SyncSchemaOptions struct {
+	// Report is filled with the differences between the local schema and the server schema.
+	Report *SchemaReport
+}
+
+// SyncSchemaOption is used when using options with SyncSchema.
+type SyncSchemaOption func(options *SyncSchemaOptions) error
+
+// SyncSchemaReport sets the report which is filled with the differences between
+// the local schema and the server schema.
+func SyncSchemaReport(report *SchemaReport) SyncSchemaOption {
+	return func(options *SyncSchemaOptions) error {
+		options.Report = report
+		return nil
+	}
+}
+
+// SyncCluster replaces the hosts in the cluster with the nodes reported by the server.
+// Hosts which are no longer in the server cluster are removed, and new nodes are added.
+func (c *Client) SyncCluster() error {
+	return c.SyncClusterWithContext(context.Background())
+}
+
+// SyncClusterWithContext replaces the hosts in the cluster with the nodes reported by the server.
+func (c *Client) SyncClusterWithContext(ctx context.Context) error {
+	status, err := c.status(ctx)
 	if err != nil {
 		return err
 	}
+	hosts := statusToHosts(status)
+	if len(hosts) == 0 {
+		// keep the current hosts rather than ending up with an empty cluster
+		return nil
+	}
+	c.cluster.syncHosts(hosts)
+	return nil
+}
 
-	return c.syncSchema(schema, serverSchema)
+// HostStatus returns the circuit breaker status of the hosts in the cluster of the client,
+// using the breaker threshold and cooldown set with the CircuitBreaker option.
+func (c *Client) HostStatus() []HostStatus {
+	return c.cluster.hostStatus(c.breaker)
 }
 
-func (c *Client) syncSchema(schema *Schema, serverSchema *Schema) error {
+func (c *Client) syncSchema(ctx context.Context, schema *Schema, serverSchema *Schema) error {
 	var err error
 
 	// find out local - remote schema
@@ -289,13 +708,13 @@ func (c *Client) syncSchema(schema *Schema, serverSchema *Schema) error {
 	// create the indexes and frames which doesn't exist on the server side
 	for indexName, index := range diffSchema.indexes {
 		if _, ok := serverSchema.indexes[indexName]; !ok {
-			err = c.EnsureIndex(index)
+			err = c.EnsureIndexWithContext(ctx, index)
 			if err != nil {
 				return err
 			}
 		}
 		for _, frame := range index.frames {
-			err = c.EnsureFrame(frame)
+			err = c.EnsureFrameWithContext(ctx, frame)
 			if err != nil {
 				return err
 			}
@@ -317,15 +736,31 @@ func (c *Client) syncSchema(schema *Schema, serverSchema *Schema) error {
 	return nil
 }
 
+// InvalidateSchema removes the cached schema, so the schema is read from the server the next time.
+// The cached schema is invalidated automatically when the client creates or deletes an index, frame or field.
+func (c *Client) InvalidateSchema() {
+	c.schemas.invalidate()
+}
+
 // Schema returns the indexes and frames on the server.
 func (c *Client) Schema() (*Schema, error) {
-	status, err := c.status()
+	return c.SchemaWithContext(context.Background())
+}
+
+// SchemaWithContext returns the indexes and frames on the server.
+// If SchemaCacheTTL is set, the schema is read from the server only if the cached schema is expired.
+func (c *Client) SchemaWithContext(ctx context.Context) (*Schema, error) {
+	if schema := c.schemas.get(); schema != nil {
+		return schema, nil
+	}
+	status, err := c.status(ctx)
 	if err != nil {
 		return nil, err
 	}
 	if len(status.Nodes) == 0 {
 		return nil, errors.New("Status should contain at least 1 node")
 	}
+	c.names.update(status)
 	schema := NewSchema()
 	for _, indexInfo := range status.Nodes[0].Indexes {
 		options := &IndexOptions{
@@ -347,11 +782,12 @@ func (c *Client) Schema() (*Schema, error) {
 				RangeEnabled:   frameInfo.Meta.RangeEnabled,
 			}
 			for _, fieldInfo := range frameInfo.Meta.Fields {
+				// use the same keys as the fields defined locally
 				fields[fieldInfo.Name] = map[string]interface{}{
-					"Name": fieldInfo.Name,
-					"Type": fieldInfo.Type,
-					"Max":  fieldInfo.Max,
-					"Min":  fieldInfo.Min,
+					"name": fieldInfo.Name,
+					"type": fieldInfo.Type,
+					"min":  fieldInfo.Min,
+					"max":  fieldInfo.Max,
 				}
 			}
 			frameOptions.fields = fields
@@ -367,137 +803,254 @@ func (c *Client) Schema() (*Schema, error) {
 			}
 		}
 	}
+	c.schemas.set(schema)
 	return schema, nil
 }
 
-// ImportFrame imports bits from the given CSV iterator.
-func (c *Client) ImportFrame(frame *Frame, bitIterator BitIterator, batchSize uint) error {
-	linesLeft := true
-	bitGroup := map[uint64][]Bit{}
-	var currentBatchSize uint
-	indexName := frame.index.name
-	frameName := frame.name
+// ImportFrame imports bits from the given iterator.
+// Bits are sent to the /import endpoint of the nodes which own their slices in batches of batchSize bits.
+// Pass *ImportOptions or ImportOption values to customize the import.
+func (c *Client) ImportFrame(frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportFrameWithContext(context.Background(), frame, bitIterator, batchSize, options...)
+}
 
-	for linesLeft {
+// ImportFrameWithContext imports bits from the given iterator.
+// The import stops with an error if the context is canceled.
+func (c *Client) ImportFrameWithContext(ctx context.Context, frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error {
+	importOptions := &ImportOptions{}
+	if err := importOptions.addOptions(options...); err != nil {
+		return err
+	}
+	if importOptions.DryRun != nil {
+		return dryRunImportBits(importOptions.DryRun, bitIterator)
+	}
+	manager, err := c.startImport(ctx, frame, batchSize, importOptions)
+	if err != nil {
+		return err
+	}
+	for {
 		bit, err := bitIterator.NextBit()
 		if err == io.EOF {
-			linesLeft = false
-		} else if err != nil {
+			return manager.Close()
+		}
+		if err != nil {
+			manager.abort()
 			return err
 		}
-
-		slice := bit.ColumnID / sliceWidth
-		if sliceArray, ok := bitGroup[slice]; ok {
-			bitGroup[slice] = append(sliceArray, bit)
-		} else {
-			bitGroup[slice] = []Bit{bit}
-		}
-		currentBatchSize++
-		// if the batch is full or there's no line left, start importing bits
-		if currentBatchSize >= batchSize || !linesLeft {
-			for slice, bits := range bitGroup {
-				if len(bits) > 0 {
-					err := c.importBits(indexName, frameName, slice, bits)
-					if err != nil {
-						return err
-					}
-				}
-			}
-			bitGroup = map[uint64][]Bit{}
-			currentBatchSize = 0
+		if err = manager.Ingest(bit); err != nil {
+			manager.abort()
+			return err
 		}
 	}
+}
 
-	return nil
+// sortedSlices returns the slices in the bit group in ascending order.
+func sortedSlices(bitGroup map[uint64][]Bit) []uint64 {
+	slices := make([]uint64, 0, len(bitGroup))
+	for slice := range bitGroup {
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i] < slices[j] })
+	return slices
 }
 
-// ImportValueFrame imports field values from the given CSV iterator.
-func (c *Client) ImportValueFrame(frame *Frame, field string, valueIterator ValueIterator, batchSize uint) error {
-	linesLeft := true
-	valGroup := map[uint64][]FieldValue{}
-	var currentBatchSize uint
-	indexName := frame.index.name
-	frameName := frame.name
-	fieldName := field
+// ImportValueFrame imports field values from the given iterator.
+// Values are sent to the /import-value endpoint of the nodes which own their slices in batches of batchSize values.
+// Pass *ImportOptions or ImportOption values to customize the import.
+func (c *Client) ImportValueFrame(frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportValueFrameWithContext(context.Background(), frame, field, valueIterator, batchSize, options...)
+}
 
-	for linesLeft {
+// ImportValueFrameWithContext imports field values from the given iterator.
+// The import stops with an error if the context is canceled.
+func (c *Client) ImportValueFrameWithContext(ctx context.Context, frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error {
+	importOptions := &ImportOptions{}
+	if err := importOptions.addOptions(options...); err != nil {
+		return err
+	}
+	if importOptions.Clear {
+		return ErrInvalidImportOption
+	}
+	if importOptions.DryRun != nil {
+		return dryRunImportValues(importOptions.DryRun, frame, field, valueIterator)
+	}
+	manager, err := c.startImport(ctx, frame, batchSize, importOptions)
+	if err != nil {
+		return err
+	}
+	manager.field = field
+	for {
 		val, err := valueIterator.NextValue()
 		if err == io.EOF {
-			linesLeft = false
-		} else if err != nil {
+			return manager.Close()
+		}
+		if err != nil {
+			manager.abort()
 			return err
 		}
-
-		slice := val.ColumnID / sliceWidth
-		if sliceArray, ok := valGroup[slice]; ok {
-			valGroup[slice] = append(sliceArray, val)
-		} else {
-			valGroup[slice] = []FieldValue{val}
-		}
-		currentBatchSize++
-		// if the batch is full or there's no line left, start importing values
-		if currentBatchSize >= batchSize || !linesLeft {
-			for slice, vals := range valGroup {
-				if len(vals) > 0 {
-					err := c.importValues(indexName, frameName, slice, fieldName, vals)
-					if err != nil {
-						return err
-					}
-				}
-			}
-			valGroup = map[uint64][]FieldValue{}
-			currentBatchSize = 0
+		if err = manager.ingestValues(val); err != nil {
+			manager.abort()
+			return err
 		}
 	}
+}
 
-	return nil
+// sortedValueSlices returns the slices in the value group in ascending order.
+func sortedValueSlices(valGroup map[uint64][]FieldValue) []uint64 {
+	slices := make([]uint64, 0, len(valGroup))
+	for slice := range valGroup {
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i] < slices[j] })
+	return slices
 }
 
-func (c *Client) importBits(indexName string, frameName string, slice uint64, bits []Bit) error {
+func (c *Client) importBits(ctx context.Context, indexName string, frameName string, slice uint64, bits []Bit, nodeCache *fragmentNodeCache, progress *importProgress, options *ImportOptions) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditImport, Index: indexName, Frame: frameName, Slice: slice, Count: len(bits)})(&err)
+	batchStart := time.Now()
 	sort.Sort(bitsForSort(bits))
-	nodes, err := c.fetchFragmentNodes(indexName, slice)
+	defer c.results.invalidate(indexName, frameName)
+	nodes, err := c.cachedFragmentNodes(ctx, indexName, slice, nodeCache)
 	if err != nil {
 		return err
 	}
-	for _, node := range nodes {
-		uri, err := NewURIFromAddress(node.Host)
+	uris, err := fragmentNodeURIs(nodes)
+	if err != nil {
+		return err
+	}
+	// send the bits to each node which owns the slice, rather than to a coordinator
+	body, err := c.importRequestBody(bitsToImportRequest(indexName, frameName, slice, bits), options)
+	if err != nil {
+		return err
+	}
+	path := "/import"
+	if options.Clear {
+		path = "/import?clear=true"
+	}
+	for _, uri := range uris {
+		start := time.Now()
+		uri := uri
+		err = retryImport(ctx, options.RetryPolicy, c.countRetries("/import", func() error {
+			return c.importNode(ctx, uri, path, body)
+		}))
 		if err != nil {
 			return err
 		}
-		uri.SetScheme(node.Scheme)
-		err = c.importNode(uri, bitsToImportRequest(indexName, frameName, slice, bits))
-		if err != nil {
+		if err = progress.nodeImported(ctx, slice, uri, len(bits), time.Since(start)); err != nil {
 			return err
 		}
 	}
+	progress.batchImported(slice, len(bits))
+	c.logger().Info("imported batch", "index", indexName, "frame", frameName, "slice", slice, "count", len(bits), "duration", time.Since(batchStart))
 
 	return nil
 }
 
-func (c *Client) importValues(indexName string, frameName string, slice uint64, fieldName string, vals []FieldValue) error {
+// clearBitsWithQuery clears the bits of a batch with a batch query of ClearBit calls,
+// for servers which cannot clear the bits of imports.
+func (c *Client) clearBitsWithQuery(ctx context.Context, frame *Frame, slice uint64, bits []Bit, progress *importProgress, options *ImportOptions) error {
+	batchStart := time.Now()
+	queries := make([]PQLQuery, len(bits))
+	for i, bit := range bits {
+		queries[i] = frame.ClearBit(bit.RowID, bit.ColumnID)
+	}
+	query := frame.index.BatchQuery(queries...)
+	// clearing bits again has no effect, so the query is retried like an import
+	err := retryImport(ctx, options.RetryPolicy, func() error {
+		response, err := c.QueryWithContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		return response.Err()
+	})
+	if err != nil {
+		return err
+	}
+	progress.batchImported(slice, len(bits))
+	c.logger().Info("cleared batch", "index", frame.index.name, "frame", frame.name, "slice", slice, "count", len(bits), "duration", time.Since(batchStart))
+	return nil
+}
+
+func (c *Client) importValues(ctx context.Context, indexName string, frameName string, slice uint64, fieldName string, vals []FieldValue, nodeCache *fragmentNodeCache, progress *importProgress, options *ImportOptions) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditImportValues, Index: indexName, Frame: frameName, Field: fieldName, Slice: slice, Count: len(vals)})(&err)
+	batchStart := time.Now()
 	sort.Sort(valsForSort(vals))
-	nodes, err := c.fetchFragmentNodes(indexName, slice)
+	defer c.results.invalidate(indexName, frameName)
+	nodes, err := c.cachedFragmentNodes(ctx, indexName, slice, nodeCache)
 	if err != nil {
 		return err
 	}
-	for _, node := range nodes {
-		uri, err := NewURIFromAddress(node.Host)
+	uris, err := fragmentNodeURIs(nodes)
+	if err != nil {
+		return err
+	}
+	body, err := c.importRequestBody(valsToImportRequest(indexName, frameName, slice, fieldName, vals), options)
+	if err != nil {
+		return err
+	}
+	for _, uri := range uris {
+		start := time.Now()
+		uri := uri
+		err = retryImport(ctx, options.RetryPolicy, c.countRetries("/import-value", func() error {
+			return c.importValueNode(ctx, uri, body)
+		}))
 		if err != nil {
 			return err
 		}
-		uri.SetScheme(node.Scheme)
-		err = c.importValueNode(uri, valsToImportRequest(indexName, frameName, slice, fieldName, vals))
-		if err != nil {
+		if err = progress.nodeImported(ctx, slice, uri, len(vals), time.Since(start)); err != nil {
 			return err
 		}
 	}
+	progress.batchImported(slice, len(vals))
+	c.logger().Info("imported batch", "index", indexName, "frame", frameName, "field", fieldName, "slice", slice, "count", len(vals), "duration", time.Since(batchStart))
+
+	return nil
+}
+
+// ImportRoaringBitmap imports a roaring bitmap into a slice of a frame.
+// The bitmap is serialized with its WriteTo method, so a *roaring.Bitmap or a bytes.Buffer
+// holding a serialized bitmap may be passed.
+// Each bit in the bitmap is at position rowID*1048576 + columnID%1048576,
+// where columnID is in the given slice.
+// The bitmap is sent as-is to the roaring import endpoint of each node which owns the slice,
+// which requires a Pilosa server supporting that endpoint.
+func (c *Client) ImportRoaringBitmap(frame *Frame, slice uint64, bitmap io.WriterTo) error {
+	return c.ImportRoaringBitmapWithContext(context.Background(), frame, slice, bitmap)
+}
 
+// ImportRoaringBitmapWithContext imports a roaring bitmap into a slice of a frame.
+func (c *Client) ImportRoaringBitmapWithContext(ctx context.Context, frame *Frame, slice uint64, bitmap io.WriterTo) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditImportRoaring, Index: frame.index.name, Frame: frame.name, Slice: slice})(&err)
+	buf := &bytes.Buffer{}
+	if _, err := bitmap.WriteTo(buf); err != nil {
+		return errors.Wrap(err, "serializing roaring bitmap")
+	}
+	nodes, err := c.fetchFragmentNodes(ctx, frame.index.name, slice)
+	if err != nil {
+		return err
+	}
+	uris, err := fragmentNodeURIs(nodes)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/index/%s/frame/%s/import-roaring/%d", frame.index.name, frame.name, slice)
+	data := buf.Bytes()
+	defer c.results.invalidate(frame.index.name, frame.name)
+	for _, uri := range uris {
+		resp, err := c.doRequest(ctx, uri, "POST", path, roaringHeaders, data)
+		if err = anyError(resp, err); err != nil {
+			return errors.Wrap(err, "doing roaring import request")
+		}
+		if err = resp.Body.Close(); err != nil {
+			return errors.Wrap(err, "closing roaring import response body")
+		}
+	}
 	return nil
 }
 
-func (c *Client) fetchFragmentNodes(indexName string, slice uint64) ([]fragmentNode, error) {
+func (c *Client) fetchFragmentNodes(ctx context.Context, indexName string, slice uint64) ([]fragmentNode, error) {
 	path := fmt.Sprintf("/fragment/nodes?slice=%d&index=%s", slice, indexName)
-	_, body, err := c.httpRequest("GET", path, []byte{}, nil)
+	_, body, err := c.httpRequest(ctx, "GET", path, []byte{}, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -509,43 +1062,133 @@ func (c *Client) fetchFragmentNodes(indexName string, slice uint64) ([]fragmentN
 	return fragmentNodes, nil
 }
 
-func (c *Client) importNode(uri *URI, request *pbuf.ImportRequest) error {
-	data, err := proto.Marshal(request)
-	if err != nil {
-		return errors.Wrap(err, "marshaling to protobuf")
-	}
-	resp, err := c.doRequest(uri, "POST", "/import", protobufHeaders, bytes.NewReader(data))
-	if err = anyError(resp, err); err != nil {
-		return errors.Wrap(err, "doing import request")
-	}
-	return errors.Wrap(resp.Body.Close(), "closing import response body")
+// fragmentNodeURIs returns the URIs of the nodes which own a slice.
+func fragmentNodeURIs(nodes []fragmentNode) ([]*URI, error) {
+	uris := make([]*URI, 0, len(nodes))
+	for _, node := range nodes {
+		uri, err := NewURIFromAddress(node.Host)
+		if err != nil {
+			return nil, err
+		}
+		if node.Scheme != "" {
+			uri.SetScheme(node.Scheme)
+		}
+		uris = append(uris, uri)
+	}
+	return uris, nil
+}
+
+// fragmentNodeCache keeps the nodes of the slices during an import,
+// so they are fetched once per slice rather than once per batch.
+type fragmentNodeCache struct {
+	mutex *sync.Mutex
+	nodes map[uint64][]fragmentNode
+}
+
+func newFragmentNodeCache() *fragmentNodeCache {
+	return &fragmentNodeCache{
+		mutex: &sync.Mutex{},
+		nodes: map[uint64][]fragmentNode{},
+	}
+}
+
+func (c *Client) cachedFragmentNodes(ctx context.Context, indexName string, slice uint64, cache *fragmentNodeCache) ([]fragmentNode, error) {
+	cache.mutex.Lock()
+	nodes, ok := cache.nodes[slice]
+	cache.mutex.Unlock()
+	if ok {
+		return nodes, nil
+	}
+	nodes, err := c.fetchFragmentNodes(ctx, indexName, slice)
+	if err != nil {
+		return nil, err
+	}
+	cache.mutex.Lock()
+	cache.nodes[slice] = nodes
+	cache.mutex.Unlock()
+	return nodes, nil
 }
 
-func (c *Client) importValueNode(uri *URI, request *pbuf.ImportValueRequest) error {
-	data, _ := proto.Marshal(request)
-	// request.Marshal never returns an error
-	_, err := c.doRequest(uri, "POST", "/import-value", protobufHeaders, bytes.NewReader(data))
+// importRequestBody marshals an import request and compresses it, once for all of its nodes and retries.
+func (c *Client) importRequestBody(request proto.Message, options *ImportOptions) (*requestBody, error) {
+	data, err := marshalProto(request)
 	if err != nil {
+		return nil, errors.Wrap(err, "marshaling to protobuf")
+	}
+	return newRequestBody(data, c.importGzipThreshold(options))
+}
+
+func (c *Client) importNode(ctx context.Context, uri *URI, path string, body *requestBody) error {
+	resp, err := c.doRequestWithBody(ctx, uri, "POST", path, protobufHeaders, body)
+	if err = anyError(resp, err); err != nil {
+		return errors.Wrap(err, "doing import request")
+	}
+	return errors.Wrap(resp.Body.Close(), "closing import response body")
+}
+
+func (c *Client) importValueNode(ctx context.Context, uri *URI, body *requestBody) error {
+	resp, err := c.doRequestWithBody(ctx, uri, "POST", "/import-value", protobufHeaders, body)
+	if err = anyError(resp, err); err != nil {
 		return errors.Wrap(err, "doing /import-value request")
 	}
+	return errors.Wrap(resp.Body.Close(), "closing import-value response body")
+}
 
-	return nil
+// importGzipThreshold returns the gzip threshold for the requests of an import.
+func (c *Client) importGzipThreshold(options *ImportOptions) int {
+	if options.GzipThreshold == 0 {
+		return c.options.GzipThreshold
+	}
+	return options.GzipThreshold
 }
 
 // ExportFrame exports bits for a frame.
 func (c *Client) ExportFrame(frame *Frame, view string) (BitIterator, error) {
-	status, err := c.status()
+	return c.ExportFrameWithContext(context.Background(), frame, view)
+}
+
+// ExportFrameWithContext exports bits for a frame.
+// The context is used for all requests made while iterating the returned BitIterator.
+func (c *Client) ExportFrameWithContext(ctx context.Context, frame *Frame, view string) (BitIterator, error) {
+	status, err := c.status(ctx)
 	if err != nil {
 		return nil, err
 	}
 	sliceURIs := c.statusToNodeSlicesForIndex(status, frame.index.Name())
-	return NewCSVBitIterator(newExportReader(c, sliceURIs, frame, view)), nil
+	reader := newExportReader(c, sliceURIs, frame, view)
+	reader.ctx = ctx
+	return NewCSVBitIterator(reader), nil
+}
+
+// ExportFrameTo writes the bits of a view of a frame to w in rowID,columnID CSV form.
+// The bits are exported slice by slice from the nodes which own the slices,
+// and streamed to w as they are received.
+func (c *Client) ExportFrameTo(frame *Frame, view string, w io.Writer) error {
+	return c.ExportFrameToWithContext(context.Background(), frame, view, w)
+}
+
+// ExportFrameToWithContext writes the bits of a view of a frame to w in rowID,columnID CSV form.
+func (c *Client) ExportFrameToWithContext(ctx context.Context, frame *Frame, view string, w io.Writer) error {
+	status, err := c.status(ctx)
+	if err != nil {
+		return err
+	}
+	sliceURIs := c.statusToNodeSlicesForIndex(status, frame.index.Name())
+	reader := newExportReader(c, sliceURIs, frame, view)
+	reader.ctx = ctx
+	_, err = io.Copy(w, reader)
+	return err
 }
 
 // Views fetches and returns the views of a frame
 func (c *Client) Views(frame *Frame) ([]string, error) {
+	return c.ViewsWithContext(context.Background(), frame)
+}
+
+// ViewsWithContext fetches and returns the views of a frame
+func (c *Client) ViewsWithContext(ctx context.Context, frame *Frame) ([]string, error) {
 	path := fmt.Sprintf("/index/%s/frame/%s/views", frame.index.name, frame.name)
-	_, body, err := c.httpRequest("GET", path, nil, nil)
+	_, body, err := c.httpRequest(ctx, "GET", path, nil, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -557,23 +1200,26 @@ func (c *Client) Views(frame *Frame) ([]string, error) {
 	return viewsInfo.Views, nil
 }
 
-func (c *Client) patchIndexTimeQuantum(index *Index) error {
-	data := []byte(fmt.Sprintf(`{"timeQuantum": "%s"}`, index.options.TimeQuantum))
-	path := fmt.Sprintf("/index/%s/time-quantum", index.name)
-	_, _, err := c.httpRequest("PATCH", path, data, nil)
-	return err
+// DeleteView deletes a view of a frame, e.g., a time view which is no longer needed.
+func (c *Client) DeleteView(frame *Frame, view string) error {
+	return c.DeleteViewWithContext(context.Background(), frame, view)
 }
 
-func (c *Client) patchFrameTimeQuantum(frame *Frame) error {
-	data := []byte(fmt.Sprintf(`{"index": "%s", "frame": "%s", "timeQuantum": "%s"}`,
-		frame.index.name, frame.name, frame.options.TimeQuantum))
-	path := fmt.Sprintf("/index/%s/frame/%s/time-quantum", frame.index.name, frame.name)
-	_, _, err := c.httpRequest("PATCH", path, data, nil)
+// DeleteViewWithContext deletes a view of a frame, e.g., a time view which is no longer needed.
+// If the client is created with ProtectDestructive, the context should confirm the name of the view.
+func (c *Client) DeleteViewWithContext(ctx context.Context, frame *Frame, view string) (err error) {
+	defer c.startAudit(ctx, AuditEvent{Operation: AuditDeleteView, Index: frame.index.name, Frame: frame.name, View: view})(&err)
+	if err = c.checkDestructive(ctx, view); err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/index/%s/frame/%s/view/%s", frame.index.name, frame.name, url.PathEscape(view))
+	err = c.deleteRequest(ctx, path)
+	c.results.invalidate(frame.index.name, frame.name)
 	return err
 }
 
-func (c *Client) status() (*Status, error) {
-	_, data, err := c.httpRequest("GET", "/status", nil, nil)
+func (c *Client) status(ctx context.Context) (*Status, error) {
+	_, data, err := c.httpRequest(ctx, "GET", "/status", nil, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "requesting /status")
 	}
@@ -585,49 +1231,253 @@ func (c *Client) status() (*Status, error) {
 	return root.Status, nil
 }
 
+// Status returns the status of the cluster, which contains the nodes with their states,
+// and the indexes and frames with their options and slices.
+func (c *Client) Status() (*Status, error) {
+	return c.StatusWithContext(context.Background())
+}
+
+// StatusWithContext returns the status of the cluster.
+func (c *Client) StatusWithContext(ctx context.Context) (*Status, error) {
+	return c.status(ctx)
+}
+
+// MaxSlices returns the maximum slice of each index on the server.
+// The status of the cluster is used if the server does not support the /slices/max endpoint.
+func (c *Client) MaxSlices() (map[string]uint64, error) {
+	return c.MaxSlicesWithContext(context.Background())
+}
+
+// MaxSlicesWithContext returns the maximum slice of each index on the server.
+func (c *Client) MaxSlicesWithContext(ctx context.Context) (map[string]uint64, error) {
+	maxSlices, err := c.maxSlices(ctx, false)
+	if IsNotFound(err) {
+		status, err := c.status(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return status.MaxSlices(), nil
+	}
+	return maxSlices, err
+}
+
+// MaxInverseSlices returns the maximum inverse slice of each index on the server.
+func (c *Client) MaxInverseSlices() (map[string]uint64, error) {
+	return c.MaxInverseSlicesWithContext(context.Background())
+}
+
+// MaxInverseSlicesWithContext returns the maximum inverse slice of each index on the server.
+func (c *Client) MaxInverseSlicesWithContext(ctx context.Context) (map[string]uint64, error) {
+	return c.maxSlices(ctx, true)
+}
+
+func (c *Client) maxSlices(ctx context.Context, inverse bool) (map[string]uint64, error) {
+	path := "/slices/max"
+	if inverse {
+		path += "?inverse=true"
+	}
+	_, data, err := c.httpRequest(ctx, "GET", path, nil, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "requesting /slices/max")
+	}
+	info := maxSlicesInfo{}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling /slices/max data")
+	}
+	if info.MaxSlices == nil {
+		info.MaxSlices = map[string]uint64{}
+	}
+	return info.MaxSlices, nil
+}
+
 // HttpRequest sends an HTTP request to the Pilosa server.
 // **NOTE**: This function is experimental and may be removed in later revisions.
 func (c *Client) HttpRequest(method string, path string, data []byte, headers map[string]string) (*http.Response, []byte, error) {
-	return c.httpRequest(method, path, data, headers)
+	return c.httpRequest(context.Background(), method, path, data, headers)
+}
+
+// HttpRequestWithContext sends an HTTP request to the Pilosa server.
+// **NOTE**: This function is experimental and may be removed in later revisions.
+func (c *Client) HttpRequestWithContext(ctx context.Context, method string, path string, data []byte, headers map[string]string) (*http.Response, []byte, error) {
+	return c.httpRequest(ctx, method, path, data, headers)
 }
 
 // httpRequest makes a request to the cluster - use this when you want the
 // client to choose a host, and it doesn't matter if the request goes to a
-// specific host
-func (c *Client) httpRequest(method string, path string, data []byte, headers map[string]string) (*http.Response, []byte, error) {
+// specific host.
+// GET requests are retried using the retry policy of the client.
+// Other requests are not retried, since a request which succeeded on the server
+// could be applied again, or fail, if its response is lost.
+// Requests which create or delete resources are retried with schemaRequest.
+func (c *Client) httpRequest(ctx context.Context, method string, path string, data []byte, headers map[string]string) (*http.Response, []byte, error) {
+	var policy *RetryPolicy
+	if method == "GET" {
+		policy = c.options.RetryPolicy
+	}
+	return c.httpRequestWithRetry(ctx, method, path, data, headers, policy)
+}
+
+// schemaRequest makes a request which creates or deletes a resource, and retries it using the retry policy of the client.
+// It returns true if the request was retried, in which case a previous attempt may have succeeded on the server,
+// so the caller should treat a conflict as the resource existing, and not found as the resource being deleted.
+func (c *Client) schemaRequest(ctx context.Context, method string, path string, data []byte) (bool, error) {
+	body, err := c.newHTTPRequestBody(data)
+	if err != nil {
+		return false, err
+	}
+	tried := newTriedHosts(c.options.MaxHostsPerRequest)
+	_, _, err = c.httpRequestWithHosts(ctx, method, path, body, nil, c.options.RetryPolicy, tried)
+	return tried.attempts > 1, err
+}
+
+// deleteRequest deletes a resource with schemaRequest.
+// Not found after a retry is the resource deleted by the previous attempt, so it is not an error.
+func (c *Client) deleteRequest(ctx context.Context, path string) error {
+	retried, err := c.schemaRequest(ctx, "DELETE", path, nil)
+	if retried && isCategory(err, CategoryNotFound) {
+		return nil
+	}
+	return err
+}
+
+// httpRequestWithRetry makes a request to the cluster and retries it
+// according to the given policy. Pass nil to disable retries.
+func (c *Client) httpRequestWithRetry(ctx context.Context, method string, path string, data []byte, headers map[string]string, policy *RetryPolicy) (*http.Response, []byte, error) {
+	body, err := c.newHTTPRequestBody(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return c.httpRequestWithHosts(ctx, method, path, body, headers, policy, newTriedHosts(c.options.MaxHostsPerRequest))
+}
+
+// newHTTPRequestBody returns the body of a request to the cluster, which is compressed once for all of its attempts.
+func (c *Client) newHTTPRequestBody(data []byte) (*requestBody, error) {
 	if data == nil {
 		data = []byte{}
 	}
+	return newRequestBody(data, c.options.GzipThreshold)
+}
+
+// httpRequestWithHosts is like httpRequestWithRetry, selecting the hosts of the request and its retries with tried.
+func (c *Client) httpRequestWithHosts(ctx context.Context, method string, path string, body *requestBody, headers map[string]string, policy *RetryPolicy, tried *triedHosts) (*http.Response, []byte, error) {
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
+	ctx = ensureRequestID(ctx)
+	for attempt := 1; ; attempt++ {
+		tried.attempts = attempt
+		response, buf, err := c.httpRequestOnce(ctx, method, path, body, headers, tried)
+		if attempt >= policy.maxAttempts() || tried.exhausted || !policy.shouldRetry(ctx, err) {
+			return response, buf, err
+		}
+		delay := policy.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			// the retry would not be sent before the deadline
+			return response, buf, err
+		}
+		requestID, _ := RequestIDFromContext(ctx)
+		c.logger().Info("retrying request", "method", method, "path", path, "request_id", requestID,
+			"attempt", attempt, "delay", delay, "error", err)
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return response, buf, err
+		}
+		c.observeRetry(path)
+	}
+}
+
+// withRequestTimeout returns a context which is canceled after the RequestTimeout of the client.
+func (c *Client) withRequestTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.options.RequestTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.options.RequestTimeout)
+}
+
+// triedHosts keeps the distinct hosts tried for a request, across retries.
+type triedHosts struct {
+	max   int
+	hosts []*URI
+	// exhausted is set once a host beyond the maximum is selected
+	exhausted bool
+	// attempts is the number of attempts of the request, including the first one
+	attempts int
+	// selected records the selected hosts for other requests, if it is set
+	selected *hostSet
+	// avoid contains the hosts which are selected only if no other host is available, if it is set
+	avoid *hostSet
+}
+
+func newTriedHosts(max int) *triedHosts {
+	return &triedHosts{max: max}
+}
 
-	// try at most maxHosts non-failed hosts; protect against broken cluster.removeHost
+// try records that host is about to be tried.
+// It returns false if the host is new and the maximum number of hosts has already been tried.
+func (t *triedHosts) try(host *URI) bool {
+	for _, tried := range t.hosts {
+		if tried.Equals(host) {
+			return true
+		}
+	}
+	if t.max > 0 && len(t.hosts) >= t.max {
+		t.exhausted = true
+		return false
+	}
+	t.hosts = append(t.hosts, host)
+	return true
+}
+
+func (c *Client) httpRequestOnce(ctx context.Context, method string, path string, body *requestBody, headers map[string]string, tried *triedHosts) (*http.Response, []byte, error) {
+	requestID, _ := RequestIDFromContext(ctx)
+	// try at most MaxHostAttempts non-failed hosts
 	var response *http.Response
+	var host *URI
 	var err error
-	for i := 0; i < maxHosts; i++ {
-		reader := bytes.NewReader(data)
+	for i := 0; i < c.options.MaxHostAttempts; i++ {
 		// get a host from the cluster
-		host := c.cluster.Host()
+		host = c.cluster.hostFor(indexFromPath(path), c.breaker, tried.avoid.list()...)
 		if host == nil {
+			if i > 0 {
+				// all hosts in the cluster failed
+				return nil, nil, ErrTriedMaxHosts
+			}
 			return nil, nil, ErrEmptyCluster
 		}
+		if !tried.try(host) {
+			// tried MaxHostsPerRequest hosts
+			return nil, nil, ErrTriedMaxHosts
+		}
+		tried.selected.add(host)
+		c.logger().Debug("selected host", "host", host.address(), "method", method, "path", path, "request_id", requestID)
 
-		response, err = c.doRequest(host, method, path, headers, reader)
+		c.cluster.requestStarted(host)
+		response, err = c.doRequestWithBody(ctx, host, method, path, headers, body)
+		c.cluster.requestFinished(host)
 		if err == nil {
+			c.cluster.hostSucceeded(host, c.breaker)
 			break
 		}
-		c.cluster.RemoveHost(host)
+		if err == ErrUnixSocketUnsupported {
+			// the host cannot be used with the transport of the client, which is not a failure of the host
+			return nil, nil, err
+		}
+		if ctx.Err() != nil {
+			// the request was canceled, the host is not at fault
+			return nil, nil, errors.Wrap(ctx.Err(), "doing request")
+		}
+		c.logger().Warn("request failed", "host", host.address(), "method", method, "path", path,
+			"request_id", requestID, "error", err)
+		c.cluster.hostFailed(host, c.breaker)
 	}
 	if response == nil {
 		return nil, nil, ErrTriedMaxHosts
 	}
 	defer response.Body.Close()
-	// TODO: Optimize buffer creation
-	buf, err := ioutil.ReadAll(response.Body)
+	buf, err := pooledBodiesFromContext(ctx).read(response, c.options.MaxResponseSize)
 	if err != nil {
 		return nil, nil, err
 	}
 	if response.StatusCode < 200 || response.StatusCode >= 300 {
-		err := NewError(fmt.Sprintf("Server error (%d) %s: %s", response.StatusCode, response.Status, string(buf)))
-		return response, buf, err
+		return response, buf, newPilosaError(host, response, buf)
 	}
 	return response, buf, nil
 }
@@ -645,19 +1495,96 @@ func anyError(resp *http.Response, err error) error {
 		if err != nil {
 			return errors.Wrapf(err, "bad status '%s' and err reading body", resp.Status)
 		}
-		msg := string(buf)
-		return errors.Errorf("Server error %s body:'%s'", resp.Status, msg)
+		return newPilosaError(nil, resp, buf)
 	}
 	return nil
 }
 
 // doRequest creates and performs an http request.
-func (c *Client) doRequest(host *URI, method, path string, headers map[string]string, reader io.Reader) (*http.Response, error) {
+// The body is compressed if it is at least the GzipThreshold of the client.
+func (c *Client) doRequest(ctx context.Context, host *URI, method, path string, headers map[string]string, data []byte) (*http.Response, error) {
+	body, err := newRequestBody(data, c.options.GzipThreshold)
+	if err != nil {
+		return nil, err
+	}
+	return c.doRequestWithBody(ctx, host, method, path, headers, body)
+}
+
+// doRequestWithBody sends a request with the given body, which may be nil.
+func (c *Client) doRequestWithBody(ctx context.Context, host *URI, method, path string, headers map[string]string, body *requestBody) (*http.Response, error) {
+	if host.SocketPath() != "" && c.options.customTransport() {
+		// e.g., the host was added to the cluster after the client was created
+		return nil, ErrUnixSocketUnsupported
+	}
+	var reader io.Reader
+	size := 0
+	if body != nil {
+		reader = bytes.NewReader(body.data)
+		size = len(body.data)
+	}
 	req, err := makeRequest(host, method, path, headers, reader)
 	if err != nil {
 		return nil, errors.Wrap(err, "building request")
 	}
-	return c.client.Do(req)
+	if body != nil && body.compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range c.options.Headers {
+		if req.Header.Get(k) == "" {
+			req.Header.Set(k, v)
+		}
+	}
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", c.options.UserAgent)
+	}
+	if req.Header.Get(RequestIDHeader) == "" {
+		requestID, ok := RequestIDFromContext(ctx)
+		if !ok {
+			requestID = newRequestID()
+		}
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+	span := c.startSpan(ctx, host, req, path)
+	start := time.Now()
+	resp, err := c.doer.Do(req.WithContext(ctx))
+	if err == nil {
+		if resp.Request == nil {
+			// the request ID of errors is read from the request of the response
+			resp.Request = req
+		}
+		err = gzipResponseBody(resp)
+	}
+	c.observeRequest(host, method, path, size, start, resp, err)
+	if threshold := c.options.SlowRequestThreshold; threshold > 0 && err == nil {
+		if duration := time.Since(start); duration >= threshold {
+			c.logger().Warn("slow request", "host", host.address(), "method", method, "path", path,
+				"request_id", req.Header.Get(RequestIDHeader), "status", resp.StatusCode, "duration", duration)
+		}
+	}
+	finishSpan(span, host, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// statusToHosts returns the URIs of the nodes in the status.
+func statusToHosts(status *Status) []*URI {
+	hosts := make([]*URI, 0, len(status.Nodes))
+	for _, node := range status.Nodes {
+		uri, err := NewURIFromAddress(node.Host)
+		if err != nil {
+			continue
+		}
+		if node.Scheme != "" {
+			if err = uri.SetScheme(node.Scheme); err != nil {
+				continue
+			}
+		}
+		hosts = append(hosts, uri)
+	}
+	return hosts
 }
 
 // statusToNodeSlicesForIndex finds the hosts which contains slices for the given index
@@ -682,8 +1609,32 @@ func (c *Client) statusToNodeSlicesForIndex(status *Status, indexName string) ma
 	return result
 }
 
+// indexFromPath returns the name of the index in paths like /index/<name>/...
+func indexFromPath(path string) string {
+	if !strings.HasPrefix(path, "/index/") {
+		return ""
+	}
+	name := path[len("/index/"):]
+	if i := strings.IndexAny(name, "/?"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// mergeHeaders returns a new map with the given headers.
+// Latter headers override the former ones.
+func mergeHeaders(headers ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, h := range headers {
+		for k, v := range h {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
 func makeRequest(host *URI, method, path string, headers map[string]string, reader io.Reader) (*http.Request, error) {
-	request, err := http.NewRequest(method, host.Normalize()+path, reader)
+	request, err := http.NewRequest(method, host.requestAddress()+path, reader)
 	if err != nil {
 		return nil, err
 	}
@@ -695,14 +1646,51 @@ func makeRequest(host *URI, method, path string, headers map[string]string, read
 	return request, nil
 }
 
+// customTransport returns true if requests are sent with the HTTP client or transport set in the options.
+func (co *ClientOptions) customTransport() bool {
+	return co.HTTPClient != nil || co.HTTPTransport != nil
+}
+
+// newHTTPClient creates the HTTP client which is shared by all requests of a Client,
+// so connections to the hosts are kept alive and reused.
+// If a custom HTTP client or transport was set in the options, that is used instead.
 func newHTTPClient(options *ClientOptions) *http.Client {
+	if options.HTTPClient != nil {
+		return options.HTTPClient
+	}
+	if options.HTTPTransport != nil {
+		return &http.Client{
+			Transport: options.HTTPTransport,
+			Timeout:   options.SocketTimeout,
+		}
+	}
+	proxy := http.ProxyFromEnvironment
+	if options.ProxyURL != nil {
+		proxy = http.ProxyURL(options.ProxyURL)
+	}
+	proxyExceptSockets := func(req *http.Request) (*url.URL, error) {
+		if _, ok := socketPathFromAddress(req.URL.Host); ok {
+			return nil, nil
+		}
+		return proxy(req)
+	}
+	dialer := &net.Dialer{
+		Timeout:   options.ConnectTimeout,
+		KeepAlive: options.KeepAlive,
+	}
 	transport := &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout: options.ConnectTimeout,
-		}).Dial,
+		Proxy: proxyExceptSockets,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if path, ok := socketPathFromAddress(address); ok {
+				return dialer.DialContext(ctx, "unix", path)
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
 		TLSClientConfig:     options.TLSConfig,
+		TLSHandshakeTimeout: options.ConnectTimeout,
 		MaxIdleConnsPerHost: options.PoolSizePerRoute,
 		MaxIdleConns:        options.TotalPoolSize,
+		IdleConnTimeout:     options.IdleConnTimeout,
 	}
 	return &http.Client{
 		Transport: transport,
@@ -710,18 +1698,72 @@ func newHTTPClient(options *ClientOptions) *http.Client {
 	}
 }
 
-func makeRequestData(query string, options *QueryOptions) ([]byte, error) {
-	request := &pbuf.QueryRequest{
-		Query:        query,
-		ColumnAttrs:  options.Columns,
-		ExcludeAttrs: options.ExcludeAttrs,
-		ExcludeBits:  options.ExcludeBits,
+// Field tags of pbuf.QueryRequest, as (field number << 3) | wire type.
+const (
+	queryRequestQueryTag        = 1<<3 | 2
+	queryRequestColumnAttrsTag  = 3 << 3
+	queryRequestExcludeAttrsTag = 6 << 3
+	queryRequestExcludeBitsTag  = 7 << 3
+)
+
+// makeRequestData encodes a pbuf.QueryRequest for the query.
+// It is called for every query, so the request is encoded by hand into a buffer of its exact size
+// instead of copying the query into a message and growing the buffer in proto.Marshal.
+func makeRequestData(query string, options *QueryOptions) []byte {
+	size := 0
+	if query != "" {
+		size += 1 + uvarintSize(uint64(len(query))) + len(query)
 	}
-	r, err := proto.Marshal(request)
-	if err != nil {
-		return nil, errors.Wrap(err, "marshaling request to protobuf")
+	if options.Columns {
+		size += 2
+	}
+	if options.ExcludeAttrs {
+		size += 2
+	}
+	if options.ExcludeBits {
+		size += 2
+	}
+	data := make([]byte, 0, size)
+	if query != "" {
+		data = append(data, queryRequestQueryTag)
+		data = appendUvarint(data, uint64(len(query)))
+		data = append(data, query...)
 	}
-	return r, nil
+	if options.Columns {
+		data = append(data, queryRequestColumnAttrsTag, 1)
+	}
+	if options.ExcludeAttrs {
+		data = append(data, queryRequestExcludeAttrsTag, 1)
+	}
+	if options.ExcludeBits {
+		data = append(data, queryRequestExcludeBitsTag, 1)
+	}
+	return data
+}
+
+func uvarintSize(x uint64) int {
+	n := 1
+	for ; x >= 0x80; x >>= 7 {
+		n++
+	}
+	return n
+}
+
+func appendUvarint(data []byte, x uint64) []byte {
+	for ; x >= 0x80; x >>= 7 {
+		data = append(data, byte(x)|0x80)
+	}
+	return append(data, byte(x))
+}
+
+// marshalProto marshals msg into a buffer allocated at its exact size,
+// so large import requests are not copied while the buffer grows.
+func marshalProto(msg proto.Message) ([]byte, error) {
+	buf := proto.NewBuffer(make([]byte, 0, proto.Size(msg)))
+	if err := buf.Marshal(msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 func bitsToImportRequest(indexName string, frameName string, slice uint64, bits []Bit) *pbuf.ImportRequest {
@@ -767,6 +1809,98 @@ type ClientOptions struct {
 	PoolSizePerRoute int
 	TotalPoolSize    int
 	TLSConfig        *tls.Config
+	KeepAlive        time.Duration
+	IdleConnTimeout  time.Duration
+	// HTTPClient is used for all requests if set.
+	// Other connection options are ignored in that case.
+	HTTPClient *http.Client
+	// HTTPTransport is used to perform the requests if set.
+	// Connection and TLS options are ignored in that case.
+	HTTPTransport http.RoundTripper
+	// RetryPolicy controls retrying failed GET requests and read-only queries.
+	// Requests are not retried if it is nil.
+	RetryPolicy *RetryPolicy
+	// MaxHostAttempts is the maximum number of hosts tried for a request
+	// before giving up, if sending the request fails.
+	MaxHostAttempts int
+	// MaxHostsPerRequest is the maximum number of distinct hosts tried for a request,
+	// including retries. There is no limit if it is 0.
+	MaxHostsPerRequest int
+	// RequestTimeout is the maximum duration of a request, including retries and failover.
+	// There is no limit if it is 0.
+	RequestTimeout time.Duration
+	// BreakerThreshold is the number of consecutive failures after which
+	// requests are not routed to a host until BreakerCooldown passes.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// GzipThreshold is the minimum size of a request body in bytes
+	// which is compressed with gzip. Request bodies are not compressed if it is 0.
+	GzipThreshold int
+	// JSONFormat enables sending queries and receiving responses in JSON instead of protobuf.
+	JSONFormat bool
+	// MaxResponseSize is the maximum size of a response body in bytes.
+	// There is no limit if it is 0.
+	MaxResponseSize int64
+	// Interceptors wrap sending requests, the first one being the outermost.
+	Interceptors []Interceptor
+	// Headers are sent with every request, unless the request sets them.
+	Headers map[string]string
+	// UserAgent is sent in the User-Agent header. Defaults to go-pilosa/<version>.
+	UserAgent string
+	// Username and Password are sent using HTTP basic authentication if Username is set.
+	Username string
+	Password string
+	// TokenSource returns the token sent with requests using bearer authentication.
+	// It is called again if the server responds with 401 Unauthorized.
+	TokenSource func() (string, error)
+	// ProxyURL is the proxy used for all requests if set.
+	// Otherwise the proxy is determined from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL *url.URL
+	// RateLimit is the maximum number of requests per second, allowing bursts of RateLimitBurst requests.
+	// Requests are not limited if it is 0.
+	RateLimit      float64
+	RateLimitBurst int
+	// HedgeDelay is the time to wait for the response of a read-only query
+	// before sending it to another host. Queries are not hedged if it is 0.
+	HedgeDelay time.Duration
+	// ProtectDestructive requires confirming the name of the deleted index, frame, field or view
+	// with ConfirmDestructive before the delete request is sent.
+	ProtectDestructive bool
+	// SchemaCacheTTL is the duration the schema read from the server is cached for.
+	// The schema is not cached if it is 0.
+	SchemaCacheTTL time.Duration
+	// ResultCacheSize is the maximum number of responses of read-only queries which are cached
+	// for ResultCacheTTL. Responses are not cached if either of them is 0.
+	ResultCacheSize int
+	ResultCacheTTL  time.Duration
+	// AsyncConcurrency is the maximum number of queries started with QueryAsync which are in flight at a time.
+	// Defaults to 10.
+	AsyncConcurrency int
+	// ServerVersionCheck enables checking the version of the server when the client is created.
+	// If the version is not supported, a warning is logged, or NewClient fails if StrictServerVersion is set.
+	ServerVersionCheck  bool
+	StrictServerVersion bool
+	// Metrics is notified about each request of the client.
+	Metrics MetricsCollector
+	// Tracer starts a span for each request of the client.
+	Tracer Tracer
+	// Logger receives the log messages of the client. Nothing is logged if it is nil.
+	Logger Logger
+	// SlowRequestThreshold is the duration after which a request is logged as slow,
+	// measured until the response headers are received. Requests are not logged as slow if it is 0.
+	SlowRequestThreshold time.Duration
+	// SlowQueryThreshold is the duration after which a query is logged as slow, with its PQL and timing.
+	// Queries are not logged as slow if it is 0.
+	SlowQueryThreshold time.Duration
+	// DebugRequests enables logging the requests and responses at the debug level,
+	// including their bodies if they are JSON or text, with the auth headers redacted.
+	// They are logged with the standard logger if Logger is nil.
+	DebugRequests bool
+	// AuditHook is called after each state changing call of the client.
+	AuditHook AuditHook
+	// PrewarmConnections is the number of connections opened to each host when the client is created,
+	// and when a host is added to the cluster or comes back up. Connections are opened on demand if it is 0.
+	PrewarmConnections int
 }
 
 func (co *ClientOptions) addOptions(options ...ClientOption) error {
@@ -822,6 +1956,416 @@ func TLSConfig(config *tls.Config) ClientOption {
 	}
 }
 
+// TLSSkipVerify disables verifying the certificate of the server.
+// Do not use this option in production.
+func TLSSkipVerify(skip bool) ClientOption {
+	return func(options *ClientOptions) error {
+		config := options.cloneTLSConfig()
+		config.InsecureSkipVerify = skip
+		options.TLSConfig = config
+		return nil
+	}
+}
+
+// TLSCACertFile adds the PEM encoded CA certificates in the given file to the certificates used to verify the server.
+func TLSCACertFile(path string) ClientOption {
+	return func(options *ClientOptions) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrap(err, "reading CA certificate file")
+		}
+		config := options.cloneTLSConfig()
+		if config.RootCAs == nil {
+			config.RootCAs = x509.NewCertPool()
+		}
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return errors.Errorf("no certificates found in %s", path)
+		}
+		options.TLSConfig = config
+		return nil
+	}
+}
+
+// TLSClientCertFiles sets the certificate and key the client presents to the server.
+// Both files should be PEM encoded.
+func TLSClientCertFiles(certFile string, keyFile string) ClientOption {
+	return func(options *ClientOptions) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return errors.Wrap(err, "loading client certificate")
+		}
+		config := options.cloneTLSConfig()
+		config.Certificates = append(config.Certificates, cert)
+		options.TLSConfig = config
+		return nil
+	}
+}
+
+// TLSClientCertFilesWithReload sets the certificate and key the client presents to the server,
+// like TLSClientCertFiles, and loads them again when either file changes on disk,
+// e.g., when they are rotated by a certificate manager.
+// The files are checked when a connection is opened, so existing connections keep using the previous certificate.
+// It overrides the certificates set with TLSClientCertFiles.
+func TLSClientCertFilesWithReload(certFile string, keyFile string) ClientOption {
+	return func(options *ClientOptions) error {
+		reloader, err := newClientCertReloader(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		config := options.cloneTLSConfig()
+		config.GetClientCertificate = reloader.getClientCertificate
+		options.TLSConfig = config
+		return nil
+	}
+}
+
+// cloneTLSConfig returns a copy of the TLS configuration, so the configuration
+// passed with the TLSConfig option is not modified.
+func (co *ClientOptions) cloneTLSConfig() *tls.Config {
+	if co.TLSConfig == nil {
+		return &tls.Config{}
+	}
+	return co.TLSConfig.Clone()
+}
+
+// KeepAlive is the interval between TCP keep-alive probes of the connections to the server.
+func KeepAlive(interval time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.KeepAlive = interval
+		return nil
+	}
+}
+
+// IdleConnTimeout is the maximum time an idle connection stays in the pool.
+func IdleConnTimeout(timeout time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.IdleConnTimeout = timeout
+		return nil
+	}
+}
+
+// MaxHostAttempts is the maximum number of hosts tried for a single request.
+// If sending a request to a host fails, the client fails over to the next host in the cluster.
+func MaxHostAttempts(attempts int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.MaxHostAttempts = attempts
+		return nil
+	}
+}
+
+// MaxHostsPerRequest is the maximum number of distinct hosts tried for a request,
+// including retries, so a request fails fast if many hosts in the cluster are down.
+func MaxHostsPerRequest(hosts int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.MaxHostsPerRequest = hosts
+		return nil
+	}
+}
+
+// RequestTimeout is the maximum duration of a request, including retries and failover.
+// A request is not retried if the delay before the retry would exceed the timeout.
+func RequestTimeout(timeout time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.RequestTimeout = timeout
+		return nil
+	}
+}
+
+// CircuitBreaker controls routing requests to failing hosts.
+// After threshold consecutive failures, no requests are sent to a host until cooldown passes.
+// Then a single request is sent to the host, which closes the breaker if it succeeds.
+func CircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.BreakerThreshold = threshold
+		options.BreakerCooldown = cooldown
+		return nil
+	}
+}
+
+// GzipThreshold enables compressing request bodies which are at least size bytes with gzip.
+// The server should support gzipped requests in order to use this option.
+// Gzipped responses are always decompressed.
+func GzipThreshold(size int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.GzipThreshold = size
+		return nil
+	}
+}
+
+// JSONFormat enables using JSON instead of protobuf for queries,
+// which is easier to debug. Responses are decoded to the same types.
+func JSONFormat(enable bool) ClientOption {
+	return func(options *ClientOptions) error {
+		options.JSONFormat = enable
+		return nil
+	}
+}
+
+// MaxResponseSize sets the maximum size of a response body in bytes.
+// Reading a larger response fails with ErrResponseTooLarge.
+func MaxResponseSize(size int64) ClientOption {
+	return func(options *ClientOptions) error {
+		options.MaxResponseSize = size
+		return nil
+	}
+}
+
+// Interceptors adds interceptors which wrap sending requests to the server.
+// Interceptors may modify requests, observe responses or return a response
+// without sending the request, e.g., for authentication, metrics or caching.
+func Interceptors(interceptors ...Interceptor) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Interceptors = append(options.Interceptors, interceptors...)
+		return nil
+	}
+}
+
+// Headers adds headers which are sent with every request.
+func Headers(headers map[string]string) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Headers = mergeHeaders(options.Headers, headers)
+		return nil
+	}
+}
+
+// UserAgent sets the User-Agent header of requests.
+func UserAgent(userAgent string) ClientOption {
+	return func(options *ClientOptions) error {
+		options.UserAgent = userAgent
+		return nil
+	}
+}
+
+// BasicAuth enables HTTP basic authentication with the given credentials.
+func BasicAuth(username, password string) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Username = username
+		options.Password = password
+		return nil
+	}
+}
+
+// TokenSource enables bearer token authentication.
+// The token returned from source is cached until the server responds with 401 Unauthorized,
+// in which case a new token is fetched and the request is sent again.
+func TokenSource(source func() (string, error)) ClientOption {
+	return func(options *ClientOptions) error {
+		options.TokenSource = source
+		return nil
+	}
+}
+
+// ProxyURL sets the proxy used for all requests, e.g., http://proxy.example.com:3128.
+// Requests use the proxy set in the environment by default.
+func ProxyURL(proxyURL string) ClientOption {
+	return func(options *ClientOptions) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return errors.Wrap(err, "parsing proxy URL")
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("invalid proxy URL: %s", proxyURL)
+		}
+		options.ProxyURL = u
+		return nil
+	}
+}
+
+// RateLimit limits the number of requests sent per second, allowing bursts of up to burst requests.
+// Requests wait until they are allowed, or their context is canceled.
+func RateLimit(requestsPerSecond float64, burst int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.RateLimit = requestsPerSecond
+		options.RateLimitBurst = burst
+		return nil
+	}
+}
+
+// HedgeDelay enables hedged read-only queries, which reduces tail latency if some hosts are slow.
+// If there is no response after delay, the query is sent to another host as well,
+// and the first successful response is used.
+func HedgeDelay(delay time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.HedgeDelay = delay
+		return nil
+	}
+}
+
+// ProtectDestructive enables or disables requiring a confirmation for delete requests.
+// Deleting an index, frame, field or view fails with ErrDestructiveNotConfirmed
+// unless its name is confirmed in the context with ConfirmDestructive.
+func ProtectDestructive(enable bool) ClientOption {
+	return func(options *ClientOptions) error {
+		options.ProtectDestructive = enable
+		return nil
+	}
+}
+
+// SchemaCacheTTL enables caching the schema read from the server for the given duration.
+// Use this if the schema is read often, e.g., to validate frames, and it is changed only by this client.
+func SchemaCacheTTL(ttl time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.SchemaCacheTTL = ttl
+		return nil
+	}
+}
+
+// ResultCache enables caching the responses of at most size read-only queries for ttl.
+// The least recently used responses are evicted first.
+// Cached responses are invalidated when a query, an import or a delete through this client
+// modifies a frame used by the query, but not when the data is modified by other clients.
+func ResultCache(size int, ttl time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.ResultCacheSize = size
+		options.ResultCacheTTL = ttl
+		return nil
+	}
+}
+
+// AsyncConcurrency sets the maximum number of queries started with QueryAsync which are in flight at a time.
+func AsyncConcurrency(n int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.AsyncConcurrency = n
+		return nil
+	}
+}
+
+// ServerVersionCheck enables checking that the version of the server is supported by the client
+// when the client is created. If the version is not supported or cannot be retrieved,
+// a warning is logged, or NewClient fails if strict is true.
+func ServerVersionCheck(strict bool) ClientOption {
+	return func(options *ClientOptions) error {
+		options.ServerVersionCheck = true
+		options.StrictServerVersion = strict
+		return nil
+	}
+}
+
+// Metrics sets the collector which is notified about each request of the client,
+// e.g., to export request counts, errors, latencies and sizes to a monitoring system.
+func Metrics(collector MetricsCollector) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Metrics = collector
+		return nil
+	}
+}
+
+// Tracing sets the tracer which starts a span for each request of the client
+// and propagates the trace to the server in the request headers.
+func Tracing(tracer Tracer) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Tracer = tracer
+		return nil
+	}
+}
+
+// WithLogger sets the logger which receives the log messages of the client.
+func WithLogger(logger Logger) ClientOption {
+	return func(options *ClientOptions) error {
+		options.Logger = logger
+		return nil
+	}
+}
+
+// SlowRequestThreshold sets the duration after which a request is logged as slow with the logger of the client.
+func SlowRequestThreshold(threshold time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.SlowRequestThreshold = threshold
+		return nil
+	}
+}
+
+// SlowQueryThreshold sets the duration after which a query is logged as slow with the logger of the client,
+// to help finding expensive queries.
+func SlowQueryThreshold(threshold time.Duration) ClientOption {
+	return func(options *ClientOptions) error {
+		options.SlowQueryThreshold = threshold
+		return nil
+	}
+}
+
+// DebugRequests enables logging the method, URL, headers and size of each request and response,
+// and their bodies if they are JSON or text, e.g., in JSON mode. Auth headers are redacted.
+// Messages are logged at the debug level with the logger of the client,
+// or with the standard logger if the client has no logger.
+func DebugRequests(enable bool) ClientOption {
+	return func(options *ClientOptions) error {
+		options.DebugRequests = enable
+		return nil
+	}
+}
+
+// Audit sets the hook which is called after each state changing call of the client,
+// e.g., to keep an audit trail of the writes, imports and schema changes.
+func Audit(hook AuditHook) ClientOption {
+	return func(options *ClientOptions) error {
+		options.AuditHook = hook
+		return nil
+	}
+}
+
+// PrewarmConnections opens n connections to each host when the client is created with NewClient,
+// and when a host is added to the cluster or comes back up after failing,
+// so the first requests to a host do not wait for the TCP and TLS handshakes.
+// Set PoolSizePerRoute to at least n, so the connections are kept in the pool.
+func PrewarmConnections(n int) ClientOption {
+	return func(options *ClientOptions) error {
+		options.PrewarmConnections = n
+		return nil
+	}
+}
+
+// HTTPClient sets the HTTP client used to send requests to the server.
+func HTTPClient(client *http.Client) ClientOption {
+	return func(options *ClientOptions) error {
+		options.HTTPClient = client
+		return nil
+	}
+}
+
+// HTTPTransport sets the transport used to send requests to the server.
+// Useful for adding instrumentation, proxies or test doubles.
+func HTTPTransport(transport http.RoundTripper) ClientOption {
+	return func(options *ClientOptions) error {
+		options.HTTPTransport = transport
+		return nil
+	}
+}
+
+// Retry sets the retry policy for requests which do not modify data on the server.
+// Read-only queries and GET requests, e.g., for the schema or the status, are retried.
+// Creating or deleting indexes, frames, fields and views, and queries which modify data are not retried.
+func Retry(policy *RetryPolicy) ClientOption {
+	return func(options *ClientOptions) error {
+		options.RetryPolicy = policy
+		return nil
+	}
+}
+
+// interceptors returns the interceptors set by the user,
+// followed by the rate limiter and the ones for authentication, so credentials are added last.
+func (co *ClientOptions) interceptors() []Interceptor {
+	interceptors := append([]Interceptor{}, co.Interceptors...)
+	if co.RateLimit > 0 {
+		interceptors = append(interceptors, newRateLimiter(co.RateLimit, co.RateLimitBurst).interceptor)
+	}
+	if co.Username != "" {
+		interceptors = append(interceptors, basicAuthInterceptor(co.Username, co.Password))
+	}
+	if co.TokenSource != nil {
+		auth := &tokenAuth{source: co.TokenSource}
+		interceptors = append(interceptors, auth.interceptor)
+	}
+	if co.DebugRequests {
+		logger := co.Logger
+		if logger == nil {
+			logger = NewStdLogger(nil, LevelDebug)
+		}
+		interceptors = append(interceptors, debugInterceptor(logger, co.JSONFormat))
+	}
+	return interceptors
+}
+
 func (co *ClientOptions) withDefaults() (updated *ClientOptions) {
 	// copy options so the original is not updated
 	updated = &ClientOptions{}
@@ -842,6 +2386,27 @@ func (co *ClientOptions) withDefaults() (updated *ClientOptions) {
 	if updated.TLSConfig == nil {
 		updated.TLSConfig = &tls.Config{}
 	}
+	if updated.KeepAlive <= 0 {
+		updated.KeepAlive = defaultKeepAlive
+	}
+	if updated.IdleConnTimeout <= 0 {
+		updated.IdleConnTimeout = defaultIdleConnTimeout
+	}
+	if updated.MaxHostAttempts <= 0 {
+		updated.MaxHostAttempts = maxHosts
+	}
+	if updated.BreakerThreshold <= 0 {
+		updated.BreakerThreshold = defaultBreakerThreshold
+	}
+	if updated.BreakerCooldown <= 0 {
+		updated.BreakerCooldown = defaultBreakerCooldown
+	}
+	if updated.UserAgent == "" {
+		updated.UserAgent = defaultUserAgent
+	}
+	if updated.AsyncConcurrency <= 0 {
+		updated.AsyncConcurrency = defaultAsyncConcurrency
+	}
 	return
 }
 
@@ -853,6 +2418,17 @@ type QueryOptions struct {
 	ExcludeAttrs bool
 	// ExcludeBits inhibits returning bits
 	ExcludeBits bool
+	// DryRun validates the query on the client side without sending it to the server.
+	// The response contains an empty result of the expected kind for each call in the query.
+	DryRun bool
+	// RetryPolicy overrides the retry policy of the client for this query.
+	// Only read-only queries are retried.
+	RetryPolicy *RetryPolicy
+	// Headers are sent with the query request in addition to the headers of the client.
+	Headers map[string]string
+	// LazyBits keeps the bits of bitmap results in the protobuf response instead of decoding them into Bits.
+	// It is ignored in JSON format.
+	LazyBits bool
 }
 
 func (qo *QueryOptions) addOptions(options ...interface{}) error {
@@ -907,6 +2483,194 @@ func ExcludeBits(enable bool) QueryOption {
 	}
 }
 
+// DryRun enables validating a query without running it.
+func DryRun(enable bool) QueryOption {
+	return func(options *QueryOptions) error {
+		options.DryRun = enable
+		return nil
+	}
+}
+
+// LazyBits enables keeping the bits of bitmap results in the response buffer, and decoding them
+// only when they are read with BitmapResult.Columns, Chunks or Iterator, which cuts the memory used
+// by large results roughly in half. The Bits field of the results is nil in that case.
+func LazyBits(enable bool) QueryOption {
+	return func(options *QueryOptions) error {
+		options.LazyBits = enable
+		return nil
+	}
+}
+
+// QueryHeaders adds headers which are sent with the query request.
+func QueryHeaders(headers map[string]string) QueryOption {
+	return func(options *QueryOptions) error {
+		options.Headers = mergeHeaders(options.Headers, headers)
+		return nil
+	}
+}
+
+// QueryRetry overrides the retry policy of the client for a query.
+func QueryRetry(policy *RetryPolicy) QueryOption {
+	return func(options *QueryOptions) error {
+		options.RetryPolicy = policy
+		return nil
+	}
+}
+
+// ImportOptions contains options to customize the import functions.
+type ImportOptions struct {
+	// ThreadCount is the number of goroutines which import the batches of different slices in parallel.
+	// Batches are imported one at a time if it is 0 or 1.
+	ThreadCount int
+	// StatusChannel receives an update after each batch is imported to a node.
+	// The import waits for the update to be received, so the channel should be buffered or drained quickly.
+	// The channel is not closed by the import.
+	StatusChannel chan<- ImportStatusUpdate
+	// Summary is filled with the totals of the import when it finishes, even if it fails.
+	Summary *ImportSummary
+	// RetryPolicy controls retrying a batch which failed to be imported to a node.
+	// The retry policy of the client is used if it is nil.
+	RetryPolicy *RetryPolicy
+	// Checkpoint records the imported batches and skips the ones imported by a previous import.
+	Checkpoint *ImportCheckpoint
+	// Clear clears the imported bits instead of setting them.
+	// If the server is older than MinClearImportServerVersion, the bits are cleared with ClearBit queries instead.
+	// Value imports fail with ErrInvalidImportOption if it is set.
+	Clear bool
+	// MaxBufferSize is the number of bytes of batches which may wait in memory to be imported.
+	// If it is set, reading the iterator does not wait for the batches to be imported,
+	// and batches which do not fit in memory are written to temporary files until they are imported.
+	// Reading the iterator waits for the running batches if it is 0.
+	MaxBufferSize int64
+	// SpillDir is the directory of the temporary files of batches which do not fit in memory.
+	// The default temporary directory is used if it is empty.
+	SpillDir string
+	// GzipThreshold is the minimum size of an import request body in bytes which is compressed with gzip.
+	// The GzipThreshold of the client is used if it is 0, and import requests are not compressed if it is negative.
+	GzipThreshold int
+	// DryRun is filled with the counts of the valid records and the invalid records,
+	// instead of importing them. The import continues after records which cannot be parsed.
+	DryRun *ImportReport
+}
+
+func (imo *ImportOptions) addOptions(options ...interface{}) error {
+	for i, option := range options {
+		switch o := option.(type) {
+		case nil:
+			if i != 0 {
+				return ErrInvalidImportOption
+			}
+			continue
+		case *ImportOptions:
+			if i != 0 {
+				return ErrInvalidImportOption
+			}
+			*imo = *o
+		case ImportOption:
+			err := o(imo)
+			if err != nil {
+				return err
+			}
+		default:
+			return ErrInvalidImportOption
+		}
+	}
+	return nil
+}
+
+// ImportOption is used when using options with the import functions.
+type ImportOption func(options *ImportOptions) error
+
+// ThreadCount sets the number of goroutines which import batches in parallel.
+func ThreadCount(count int) ImportOption {
+	return func(options *ImportOptions) error {
+		if count < 0 {
+			return ErrInvalidImportOption
+		}
+		options.ThreadCount = count
+		return nil
+	}
+}
+
+// StatusChannel sets the channel which receives an update after each batch is imported to a node.
+func StatusChannel(statusChannel chan<- ImportStatusUpdate) ImportOption {
+	return func(options *ImportOptions) error {
+		options.StatusChannel = statusChannel
+		return nil
+	}
+}
+
+// Summary sets the ImportSummary which is filled when the import finishes.
+func Summary(summary *ImportSummary) ImportOption {
+	return func(options *ImportOptions) error {
+		options.Summary = summary
+		return nil
+	}
+}
+
+// ImportRetry overrides the retry policy of the client for an import.
+func ImportRetry(policy *RetryPolicy) ImportOption {
+	return func(options *ImportOptions) error {
+		options.RetryPolicy = policy
+		return nil
+	}
+}
+
+// Checkpoint sets the checkpoint which records the imported batches.
+// Batches which are already in the checkpoint are not imported again.
+func Checkpoint(checkpoint *ImportCheckpoint) ImportOption {
+	return func(options *ImportOptions) error {
+		options.Checkpoint = checkpoint
+		return nil
+	}
+}
+
+// ClearBits enables clearing the imported bits instead of setting them.
+// The version of the server is checked before the import, and the bits are cleared with ClearBit queries
+// if the server is older than MinClearImportServerVersion, since it would set the bits.
+func ClearBits(enable bool) ImportOption {
+	return func(options *ImportOptions) error {
+		options.Clear = enable
+		return nil
+	}
+}
+
+// MaxBufferSize sets the number of bytes of batches which may wait in memory to be imported.
+func MaxBufferSize(size int64) ImportOption {
+	return func(options *ImportOptions) error {
+		if size < 0 {
+			return ErrInvalidImportOption
+		}
+		options.MaxBufferSize = size
+		return nil
+	}
+}
+
+// SpillDir sets the directory of the temporary files of batches which do not fit in memory.
+func SpillDir(dir string) ImportOption {
+	return func(options *ImportOptions) error {
+		options.SpillDir = dir
+		return nil
+	}
+}
+
+// ImportGzipThreshold overrides the gzip threshold of the client for the requests of an import.
+// Pass a negative size to disable compressing them.
+func ImportGzipThreshold(size int) ImportOption {
+	return func(options *ImportOptions) error {
+		options.GzipThreshold = size
+		return nil
+	}
+}
+
+// ImportDryRun validates the records and fills the report instead of importing them.
+func ImportDryRun(report *ImportReport) ImportOption {
+	return func(options *ImportOptions) error {
+		options.DryRun = report
+		return nil
+	}
+}
+
 type fragmentNode struct {
 	Scheme       string
 	Host         string
@@ -924,11 +2688,32 @@ type Status struct {
 
 // StatusNode contains node information.
 type StatusNode struct {
-	Scheme  string
-	Host    string
+	Scheme string
+	Host   string
+	// State is the state of the node reported by the server, e.g., UP or DOWN.
+	State   string
 	Indexes []StatusIndex
 }
 
+// MaxSlices returns the maximum slice of each index, across the nodes in the status.
+func (s *Status) MaxSlices() map[string]uint64 {
+	maxSlices := map[string]uint64{}
+	for _, node := range s.Nodes {
+		for _, index := range node.Indexes {
+			max, ok := maxSlices[index.Name]
+			for _, slice := range index.Slices {
+				if !ok || slice > max {
+					max, ok = slice, true
+				}
+			}
+			if ok {
+				maxSlices[index.Name] = max
+			}
+		}
+	}
+	return maxSlices
+}
+
 // StatusIndex contains index information.
 type StatusIndex struct {
 	Name   string
@@ -967,56 +2752,72 @@ type viewsInfo struct {
 	Views []string `json:"views"`
 }
 
+type maxSlicesInfo struct {
+	MaxSlices map[string]uint64 `json:"maxSlices"`
+}
+
 type exportReader struct {
+	ctx          context.Context
 	client       *Client
 	sliceURIs    map[uint64]*URI
 	frame        *Frame
-	body         []byte
-	bodyIndex    int
-	currentSlice uint64
-	sliceCount   uint64
+	body         io.ReadCloser
+	slices       []uint64
+	currentSlice int
 	view         string
 }
 
 func newExportReader(client *Client, sliceURIs map[uint64]*URI, frame *Frame, view string) *exportReader {
+	// the slices of an index are not necessarily contiguous
+	slices := make([]uint64, 0, len(sliceURIs))
+	for slice := range sliceURIs {
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i] < slices[j] })
 	return &exportReader{
-		client:     client,
-		sliceURIs:  sliceURIs,
-		frame:      frame,
-		sliceCount: uint64(len(sliceURIs)),
-		view:       view,
+		ctx:       context.Background(),
+		client:    client,
+		sliceURIs: sliceURIs,
+		frame:     frame,
+		slices:    slices,
+		view:      view,
 	}
 }
 
-// Read updates the passed array with the exported CSV data and returns the number of bytes read
+// Read updates the passed array with the exported CSV data and returns the number of bytes read.
+// The response for each slice is streamed instead of being read into memory at once.
 func (r *exportReader) Read(p []byte) (n int, err error) {
-	if r.currentSlice >= r.sliceCount {
-		err = io.EOF
-		return
-	}
-	if r.body == nil {
-		uri, _ := r.sliceURIs[r.currentSlice]
-		headers := map[string]string{
-			"Accept": "text/csv",
-		}
-		path := fmt.Sprintf("/export?index=%s&frame=%s&slice=%d&view=%s",
-			r.frame.index.Name(), r.frame.Name(), r.currentSlice, r.view)
-		resp, err := r.client.doRequest(uri, "GET", path, headers, nil)
-		if err = anyError(resp, err); err != nil {
-			return 0, errors.Wrap(err, "doing export request")
+	for r.currentSlice < len(r.slices) {
+		if r.body == nil {
+			slice := r.slices[r.currentSlice]
+			uri := r.sliceURIs[slice]
+			headers := map[string]string{
+				"Accept": "text/csv",
+			}
+			path := fmt.Sprintf("/export?index=%s&frame=%s&slice=%d&view=%s",
+				r.frame.index.Name(), r.frame.Name(), slice, r.view)
+			resp, err := r.client.doRequest(r.ctx, uri, "GET", path, headers, nil)
+			if err = anyError(resp, err); err != nil {
+				return 0, errors.Wrap(err, "doing export request")
+			}
+			r.body = newLimitedBody(resp.Body, r.client.options.MaxResponseSize)
+		}
+		n, err = r.body.Read(p)
+		if err == io.EOF {
+			r.body.Close()
+			r.body = nil
+			r.currentSlice++
+			if n == 0 {
+				continue
+			}
+			return n, nil
 		}
-		defer resp.Body.Close()
-		r.body, err = ioutil.ReadAll(resp.Body)
 		if err != nil {
-			return 0, errors.Wrap(err, "reading response body")
+			r.body.Close()
+			r.body = nil
+			return n, errors.Wrap(err, "reading response body")
 		}
-		r.bodyIndex = 0
-	}
-	n = copy(p, r.body[r.bodyIndex:])
-	r.bodyIndex += n
-	if n >= len(r.body) {
-		r.body = nil
-		r.currentSlice++
+		return n, nil
 	}
-	return
+	return 0, io.EOF
 }
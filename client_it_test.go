@@ -36,14 +36,20 @@ package pilosa
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -489,7 +495,7 @@ func TestQueryFails(t *testing.T) {
 
 func TestInvalidHttpRequest(t *testing.T) {
 	client := getClient()
-	_, _, err := client.httpRequest("INVALID METHOD", "/foo", nil, nil)
+	_, _, err := client.httpRequest(context.Background(), "INVALID METHOD", "/foo", nil, nil)
 	if err == nil {
 		t.Fatal()
 	}
@@ -846,8 +852,8 @@ func TestExportReaderReadBodyFailure(t *testing.T) {
 	sliceURIs := map[uint64]*URI{0: uri}
 	client := NewClientWithURI(uri)
 	reader := newExportReader(client, sliceURIs, frame, "standard")
-	buf := make([]byte, 1000)
-	_, err = reader.Read(buf)
+	// the response is streamed, so reading fails once the body is exhausted
+	_, err = ioutil.ReadAll(reader)
 	if err == nil {
 		t.Fatal("should have failed")
 	}
@@ -855,7 +861,7 @@ func TestExportReaderReadBodyFailure(t *testing.T) {
 
 func TestFetchFragmentNodes(t *testing.T) {
 	client := getClient()
-	nodes, err := client.fetchFragmentNodes(index.Name(), 0)
+	nodes, err := client.fetchFragmentNodes(context.Background(), index.Name(), 0)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -866,7 +872,7 @@ func TestFetchFragmentNodes(t *testing.T) {
 
 func TestFetchStatus(t *testing.T) {
 	client := getClient()
-	status, err := client.status()
+	status, err := client.status(context.Background())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1070,7 +1076,7 @@ func TestImportFailsOnImportBitsError(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	err = client.importBits("foo", "bar", 0, []Bit{})
+	err = client.importBits(context.Background(), "foo", "bar", 0, []Bit{}, newFragmentNodeCache(), nil, &ImportOptions{})
 	if err == nil {
 		t.Fatalf("importBits should fail when fetch fragment nodes fails")
 	}
@@ -1084,7 +1090,7 @@ func TestValueImportFailsOnImportValueError(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	err = client.importValues("foo", "bar", 0, "foo", []FieldValue{})
+	err = client.importValues(context.Background(), "foo", "bar", 0, "foo", []FieldValue{}, newFragmentNodeCache(), nil, &ImportOptions{})
 	if err == nil {
 		t.Fatalf("importValues should fail when fetch fragment nodes fails")
 	}
@@ -1139,7 +1145,7 @@ func TestImportBitsFailInvalidNodeAddress(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	err = client.importBits("foo", "bar", 0, []Bit{})
+	err = client.importBits(context.Background(), "foo", "bar", 0, []Bit{}, newFragmentNodeCache(), nil, &ImportOptions{})
 	if err == nil {
 		t.Fatalf("importBits should fail on invalid node host")
 	}
@@ -1154,7 +1160,7 @@ func TestImportValuesFailInvalidNodeAddress(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	err = client.importValues("foo", "bar", 0, "foo", []FieldValue{})
+	err = client.importValues(context.Background(), "foo", "bar", 0, "foo", []FieldValue{}, newFragmentNodeCache(), nil, &ImportOptions{})
 	if err == nil {
 		t.Fatalf("importValues should fail on invalid node host")
 	}
@@ -1168,7 +1174,7 @@ func TestDecodingFragmentNodesFails(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	_, err = client.fetchFragmentNodes("foo", 0)
+	_, err = client.fetchFragmentNodes(context.Background(), "foo", 0)
 	if err == nil {
 		t.Fatalf("fetchFragmentNodes should fail when response from /fragment/nodes cannot be decoded")
 	}
@@ -1190,7 +1196,11 @@ func TestImportNodeFails(t *testing.T) {
 		Frame:      "bar",
 		Slice:      0,
 	}
-	err = client.importNode(uri, importRequest)
+	body, err := client.importRequestBody(importRequest, &ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.importNode(context.Background(), uri, "/import", body)
 	if err == nil {
 		t.Fatalf("importNode should fail when posting to /import fails")
 	}
@@ -1198,14 +1208,10 @@ func TestImportNodeFails(t *testing.T) {
 
 func TestImportNodeProtobufMarshalFails(t *testing.T) {
 	// even though this function isn't really an integration test,
-	// it needs to access importNode which is not
+	// it needs to access importRequestBody which is not
 	// available to client_test.go
 	client := getClient()
-	uri, err := NewURIFromAddress("http://does-not-matter.foo.bar")
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = client.importNode(uri, nil)
+	_, err := client.importRequestBody((*pbuf.ImportRequest)(nil), &ImportOptions{})
 	if err == nil {
 		t.Fatalf("Should have failed")
 	}
@@ -1244,6 +1250,237 @@ func TestResponseWithInvalidType(t *testing.T) {
 	}
 }
 
+func TestQueryWithContextCanceled(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	uri, err := NewURIFromAddress(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := NewClientWithURI(uri)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = client.QueryWithContext(ctx, testFrame.Bitmap(1))
+	if err == nil {
+		t.Fatalf("Should have failed")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("The request should have been canceled")
+	}
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("%v != %v", context.DeadlineExceeded, err)
+	}
+	// the host should not be removed from the cluster because of the canceled request
+	if len(client.cluster.Hosts()) != 1 {
+		t.Fatalf("The host should stay in the cluster")
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "pilosa.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"views": ["standard"]}`))
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := NewClient("http+unix://" + socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := client.Views(testFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"standard"}, views) {
+		t.Fatalf("unexpected views: %v", views)
+	}
+}
+
+func TestPrewarmConnections(t *testing.T) {
+	mutex := &sync.Mutex{}
+	connections := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"views": ["standard"]}`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			connections++
+			mutex.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := NewClient(server.URL, PrewarmConnections(3), PoolSizePerRoute(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	prewarmed := connections
+	mutex.Unlock()
+	if prewarmed != 3 {
+		t.Fatalf("3 connections expected after creating the client, got %d", prewarmed)
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Views(testFrame); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if connections != 3 {
+		t.Fatalf("the prewarmed connections should be reused, got %d connections", connections)
+	}
+}
+
+func TestTLSClientCertRotation(t *testing.T) {
+	dirs := make([]string, 3)
+	for i := range dirs {
+		dir, err := ioutil.TempDir("", "go-pilosa-tls")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		dirs[i] = dir
+	}
+	serverCertFile, serverKeyFile := writeTestCertificate(t, dirs[0])
+	certFile, keyFile := writeTestCertificate(t, dirs[1])
+	rotatedCertFile, rotatedKeyFile := writeTestCertificate(t, dirs[2])
+	serverCert, err := tls.LoadX509KeyPair(serverCertFile, serverKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientCAs := x509.NewCertPool()
+	for _, path := range []string{certFile, rotatedCertFile} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientCAs.AppendCertsFromPEM(data)
+	}
+	mutex := &sync.Mutex{}
+	var peerCert []byte
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		peerCert = r.TLS.PeerCertificates[0].Raw
+		mutex.Unlock()
+		w.Write([]byte(`{"views": ["standard"]}`))
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	// every request opens a new connection, so the client certificate is checked for each
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+	defer server.Close()
+	uri, err := NewURIFromAddress(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(uri, TLSCACertFile(serverCertFile), TLSClientCertFilesWithReload(certFile, keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	presented := func() []byte {
+		if _, err := client.Views(testFrame); err != nil {
+			t.Fatal(err)
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		return peerCert
+	}
+	first := presented()
+
+	later := time.Now().Add(time.Minute)
+	for src, dst := range map[string]string{rotatedCertFile: certFile, rotatedKeyFile: keyFile} {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(dst, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(dst, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bytes.Equal(first, presented()) {
+		t.Fatalf("the rotated client certificate should be presented")
+	}
+}
+
+func TestTLSCACertFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"views": ["standard"]}`))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	server.StartTLS()
+	defer server.Close()
+	uri, err := NewURIFromAddress(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewClient(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Views(testFrame); err == nil {
+		t.Fatalf("the server certificate should not be trusted without the CA certificate")
+	}
+
+	client, err = NewClient(uri, TLSCACertFile(certFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := client.Views(testFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"standard"}, views) {
+		t.Fatalf("unexpected views: %v", views)
+	}
+}
+
 func TestStatusFails(t *testing.T) {
 	server := getMockServer(404, nil, 0)
 	defer server.Close()
@@ -1252,7 +1489,7 @@ func TestStatusFails(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	_, err = client.status()
+	_, err = client.status(context.Background())
 	if err == nil {
 		t.Fatalf("Should have failed")
 	}
@@ -1266,7 +1503,7 @@ func TestStatusUnmarshalFails(t *testing.T) {
 		t.Fatal(err)
 	}
 	client := NewClientWithURI(uri)
-	_, err = client.status()
+	_, err = client.status(context.Background())
 	if err == nil {
 		t.Fatalf("Should have failed")
 	}
@@ -1431,7 +1668,7 @@ func TestSyncSchemaCantCreateIndex(t *testing.T) {
 	client := NewClientWithURI(uri)
 	schema = NewSchema()
 	schema.Index("foo", nil)
-	err = client.syncSchema(schema, NewSchema())
+	err = client.syncSchema(context.Background(), schema, NewSchema())
 	if err == nil {
 		t.Fatalf("Should have failed")
 	}
@@ -1450,7 +1687,7 @@ func TestSyncSchemaCantCreateFrame(t *testing.T) {
 	index.Frame("fooframe", nil)
 	serverSchema := NewSchema()
 	serverSchema.Index("foo", nil)
-	err = client.syncSchema(schema, serverSchema)
+	err = client.syncSchema(context.Background(), schema, serverSchema)
 	if err == nil {
 		t.Fatalf("Should have failed")
 	}
@@ -33,59 +33,2016 @@
 package pilosa
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
 )
 
-func TestQueryWithError(t *testing.T) {
-	var err error
-	client := DefaultClient()
-	index, err := NewIndex("foo", nil)
+func TestQueryWithError(t *testing.T) {
+	var err error
+	client := DefaultClient()
+	index, err := NewIndex("foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := frame.FilterFieldTopN(12, frame.Bitmap(7), "$invalid$", 80, 81)
+	_, err = client.Query(invalid, nil)
+	if err == nil {
+		t.Fatalf("Should have failed")
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	targets := []*ClientOptions{
+		{SocketTimeout: 10},
+		{ConnectTimeout: 5},
+		{PoolSizePerRoute: 7},
+		{TotalPoolSize: 17},
+		{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+		{KeepAlive: 15},
+		{IdleConnTimeout: 25},
+		{HTTPClient: http.DefaultClient},
+		{HTTPTransport: http.DefaultTransport},
+		{RetryPolicy: DefaultRetryPolicy()},
+		{MaxHostAttempts: 3},
+		{MaxHostsPerRequest: 2},
+		{RequestTimeout: time.Second},
+		{BreakerThreshold: 2, BreakerCooldown: time.Second},
+		{GzipThreshold: 1024},
+		{JSONFormat: true},
+		{MaxResponseSize: 1 << 20},
+		{Headers: map[string]string{"X-Tenant-ID": "tenant1"}},
+		{UserAgent: "my-app/1.0"},
+		{Username: "user", Password: "secret"},
+		{ProxyURL: &url.URL{Scheme: "http", Host: "proxy.example.com:3128"}},
+		{RateLimit: 10, RateLimitBurst: 5},
+		{HedgeDelay: time.Second},
+		{SchemaCacheTTL: time.Minute},
+		{ProtectDestructive: true},
+		{ResultCacheSize: 100, ResultCacheTTL: time.Minute},
+		{AsyncConcurrency: 4},
+		{ServerVersionCheck: true, StrictServerVersion: true},
+		{Metrics: &recordingMetrics{}},
+		{Tracer: &recordingTracer{}},
+		{Logger: &recordingLogger{}},
+		{SlowRequestThreshold: time.Second},
+		{SlowQueryThreshold: time.Second},
+		{DebugRequests: true},
+		{PrewarmConnections: 4},
+	}
+	optionsList := [][]ClientOption{
+		{SocketTimeout(10)},
+		{ConnectTimeout(5)},
+		{PoolSizePerRoute(7)},
+		{TotalPoolSize(17)},
+		{TLSConfig(&tls.Config{InsecureSkipVerify: true})},
+		{KeepAlive(15)},
+		{IdleConnTimeout(25)},
+		{HTTPClient(http.DefaultClient)},
+		{HTTPTransport(http.DefaultTransport)},
+		{Retry(DefaultRetryPolicy())},
+		{MaxHostAttempts(3)},
+		{MaxHostsPerRequest(2)},
+		{RequestTimeout(time.Second)},
+		{CircuitBreaker(2, time.Second)},
+		{GzipThreshold(1024)},
+		{JSONFormat(true)},
+		{MaxResponseSize(1 << 20)},
+		{Headers(map[string]string{"X-Tenant-ID": "tenant1"})},
+		{UserAgent("my-app/1.0")},
+		{BasicAuth("user", "secret")},
+		{ProxyURL("http://proxy.example.com:3128")},
+		{RateLimit(10, 5)},
+		{HedgeDelay(time.Second)},
+		{SchemaCacheTTL(time.Minute)},
+		{ProtectDestructive(true)},
+		{ResultCache(100, time.Minute)},
+		{AsyncConcurrency(4)},
+		{ServerVersionCheck(true)},
+		{Metrics(&recordingMetrics{})},
+		{Tracing(&recordingTracer{})},
+		{WithLogger(&recordingLogger{})},
+		{SlowRequestThreshold(time.Second)},
+		{SlowQueryThreshold(time.Second)},
+		{DebugRequests(true)},
+		{PrewarmConnections(4)},
+	}
+
+	for i := 0; i < len(targets); i++ {
+		options := &ClientOptions{}
+		err := options.addOptions(optionsList[i]...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := targets[i]
+		if !reflect.DeepEqual(target, options) {
+			t.Fatalf("%v != %v", target, options)
+		}
+	}
+}
+
+func TestNewClientSharesTransport(t *testing.T) {
+	client, err := NewClient(":9999", PoolSizePerRoute(7), TotalPoolSize(17), IdleConnTimeout(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, ok := client.client.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("client should use an *http.Transport")
+	}
+	if transport.MaxIdleConnsPerHost != 7 || transport.MaxIdleConns != 17 {
+		t.Fatalf("pool sizes should be set on the transport")
+	}
+	if transport.IdleConnTimeout != time.Minute {
+		t.Fatalf("%v != %v", time.Minute, transport.IdleConnTimeout)
+	}
+	if transport.DisableKeepAlives {
+		t.Fatalf("keep-alives should be enabled")
+	}
+}
+
+func TestNewClientWithCustomHTTP(t *testing.T) {
+	httpClient := &http.Client{}
+	client, err := NewClient(":9999", HTTPClient(httpClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.client != httpClient {
+		t.Fatalf("the custom HTTP client should be used")
+	}
+	transport := &http.Transport{}
+	client, err = NewClient(":9999", HTTPTransport(transport), SocketTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.client.Transport != transport {
+		t.Fatalf("the custom transport should be used")
+	}
+	if client.client.Timeout != time.Second {
+		t.Fatalf("the socket timeout should be set")
+	}
+}
+
+func TestHTTPTransportIsUsed(t *testing.T) {
+	var requested string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": ["standard", "inverse"]}`)),
+		}, nil
+	})
+	client, err := NewClient("pilosa.example.com:10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := client.Views(sampleFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"standard", "inverse"}, views) {
+		t.Fatalf("unexpected views: %v", views)
+	}
+	if requested != "http://pilosa.example.com:10101/index/sample-index/frame/sample-frame/views" {
+		t.Fatalf("unexpected request: %s", requested)
+	}
+}
+
+func TestDeleteView(t *testing.T) {
+	var requested string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.Method + " " + req.URL.Path
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteView(sampleFrame, "standard_2017"); err != nil {
+		t.Fatal(err)
+	}
+	if requested != "DELETE /index/sample-index/frame/sample-frame/view/standard_2017" {
+		t.Fatalf("unexpected request: %s", requested)
+	}
+}
+
+func TestRetryIdempotentRequests(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          3,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	transport, attempts := newFailingTransport(2, `{"views": ["standard"]}`)
+	client, err := NewClient(":10101", HTTPTransport(transport), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Views(sampleFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *attempts != 3 {
+		t.Fatalf("3 attempts expected, got %d", *attempts)
+	}
+
+	transport, attempts = newFailingTransport(3, `{"views": ["standard"]}`)
+	client, err = NewClient(":10101", HTTPTransport(transport), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Views(sampleFrame)
+	if err == nil {
+		t.Fatalf("should have failed")
+	}
+	if *attempts != 3 {
+		t.Fatalf("3 attempts expected, got %d", *attempts)
+	}
+}
+
+func TestRetrySchemaChanges(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          3,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	calls := []func(client *Client) error{
+		func(client *Client) error { return client.CreateIndex(sampleIndex) },
+		func(client *Client) error { return client.CreateFrame(sampleFrame) },
+		func(client *Client) error { return client.CreateIntField(sampleFrame, "foo", 0, 10) },
+		func(client *Client) error { return client.DeleteIndex(sampleIndex) },
+		func(client *Client) error { return client.DeleteFrame(sampleFrame) },
+		func(client *Client) error { return client.DeleteField(sampleFrame, "foo") },
+		func(client *Client) error { return client.DeleteView(sampleFrame, "standard") },
+	}
+	for i, call := range calls {
+		transport, attempts := newFailingTransport(1, "{}")
+		client, err := NewClient(":10101", HTTPTransport(transport), Retry(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = call(client); err != nil {
+			t.Fatalf("call %d should succeed after a retry, got %v", i, err)
+		}
+		if *attempts != 2 {
+			t.Fatalf("2 attempts expected for call %d, got %d", i, *attempts)
+		}
+	}
+}
+
+func TestRetrySchemaChangesAppliedBefore(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          3,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	// the first attempt succeeds on the server, but its response is lost
+	newTransport := func(statuses ...int) roundTripperFunc {
+		return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			status := statuses[0]
+			statuses = statuses[1:]
+			return &http.Response{
+				StatusCode: status,
+				Body:       ioutil.NopCloser(strings.NewReader("{}")),
+			}, nil
+		})
+	}
+	newClient := func(statuses ...int) *Client {
+		client, err := NewClient(":10101", HTTPTransport(newTransport(statuses...)), Retry(policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return client
+	}
+	if err := newClient(503, 409).CreateIndex(sampleIndex); err != ErrIndexExists {
+		t.Fatalf("ErrIndexExists expected, got %v", err)
+	}
+	if err := newClient(503, 409).EnsureFrame(sampleFrame); err != nil {
+		t.Fatalf("ensuring the frame should succeed, got %v", err)
+	}
+	if err := newClient(503, 409).CreateIntField(sampleFrame, "foo", 0, 10); err != nil {
+		t.Fatalf("creating the field should succeed, got %v", err)
+	}
+	deletes := []func(client *Client) error{
+		func(client *Client) error { return client.DeleteIndex(sampleIndex) },
+		func(client *Client) error { return client.DeleteFrame(sampleFrame) },
+		func(client *Client) error { return client.DeleteField(sampleFrame, "foo") },
+		func(client *Client) error { return client.DeleteView(sampleFrame, "standard") },
+	}
+	for i, call := range deletes {
+		if err := call(newClient(503, 404)); err != nil {
+			t.Fatalf("delete %d should succeed after a retry, got %v", i, err)
+		}
+		if err := call(newClient(404)); !IsNotFound(err) {
+			t.Fatalf("delete %d should fail if it is not retried, got %v", i, err)
+		}
+	}
+	if err := newClient(409).CreateIntField(sampleFrame, "foo", 0, 10); !IsConflict(err) {
+		t.Fatalf("creating the field should fail if it is not retried, got %v", err)
+	}
+}
+
+func TestRetryNotHttpRequest(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          3,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	transport, attempts := newFailingTransport(1, "{}")
+	client, err := NewClient(":10101", HTTPTransport(transport), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = client.HttpRequest("POST", "/index/foo", nil, nil); err == nil {
+		t.Fatalf("the request should have failed")
+	}
+	if *attempts != 1 {
+		t.Fatalf("1 attempt expected, got %d", *attempts)
+	}
+}
+
+func TestRetryQuery(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:          2,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	body := string(mustMarshalQueryResponse(t))
+
+	// read-only queries use the retry policy of the client
+	transport, attempts := newFailingTransport(1, body)
+	client, err := NewClient(":10101", HTTPTransport(transport), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Query(sampleFrame.Bitmap(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *attempts != 2 {
+		t.Fatalf("2 attempts expected, got %d", *attempts)
+	}
+
+	// queries which modify data are not retried
+	transport, attempts = newFailingTransport(1, body)
+	client, err = NewClient(":10101", HTTPTransport(transport), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Query(sampleFrame.SetBit(1, 10))
+	if err == nil {
+		t.Fatalf("should have failed")
+	}
+	if *attempts != 1 {
+		t.Fatalf("1 attempt expected, got %d", *attempts)
+	}
+
+	// the retry policy can be overridden per query
+	transport, attempts = newFailingTransport(1, body)
+	client, err = NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Query(sampleFrame.Bitmap(1), QueryRetry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *attempts != 2 {
+		t.Fatalf("2 attempts expected, got %d", *attempts)
+	}
+}
+
+func TestFailoverToNextHost(t *testing.T) {
+	var requested []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Host)
+		if req.URL.Host == "host1:10101" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": ["standard"]}`)),
+		}, nil
+	})
+	client, err := NewClient([]string{"host1:10101", "host2:10101"}, HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Views(sampleFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"host1:10101", "host2:10101"}, requested) {
+		t.Fatalf("unexpected requests: %v", requested)
+	}
+}
+
+func TestMaxHostAttempts(t *testing.T) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		return nil, errors.New("connection refused")
+	})
+	hosts := []string{"host1:10101", "host2:10101", "host3:10101", "host4:10101"}
+	client, err := NewClient(hosts, HTTPTransport(transport), MaxHostAttempts(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Views(sampleFrame)
+	if err != ErrTriedMaxHosts {
+		t.Fatalf("ErrTriedMaxHosts expected, got: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("3 attempts expected, got %d", attempts)
+	}
+}
+
+func TestMaxHostsPerRequest(t *testing.T) {
+	var requested []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.Host)
+		return nil, errors.New("connection refused")
+	})
+	hosts := []string{"host1:10101", "host2:10101", "host3:10101", "host4:10101"}
+	policy := &RetryPolicy{MaxAttempts: 10, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	client, err := NewClient(hosts, HTTPTransport(transport), Retry(policy), MaxHostsPerRequest(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Views(sampleFrame)
+	if err != ErrTriedMaxHosts {
+		t.Fatalf("ErrTriedMaxHosts expected, got: %v", err)
+	}
+	if !reflect.DeepEqual([]string{"host1:10101", "host2:10101"}, requested) {
+		t.Fatalf("unexpected requests: %v", requested)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), RequestTimeout(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = client.Views(sampleFrame)
+	if err == nil || !strings.HasSuffix(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("the request should time out, got: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the request took too long: %v", elapsed)
+	}
+}
+
+func TestRequestTimeoutSkipsLongRetryDelays(t *testing.T) {
+	transport, attempts := newFailingTransport(10, string(mustMarshalQueryResponse(t)))
+	policy := &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute}
+	client, err := NewClient(":10101", HTTPTransport(transport), Retry(policy), RequestTimeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err = client.Query(sampleFrame.Bitmap(1)); err == nil {
+		t.Fatalf("the request should fail")
+	}
+	if *attempts != 1 {
+		t.Fatalf("the request should not be retried after the timeout, %d attempts", *attempts)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("the request should fail fast, took %v", elapsed)
+	}
+}
+
+func TestGzipRequestAndResponse(t *testing.T) {
+	responseBody, err := gzipData(mustMarshalQueryResponse(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encodings []string
+	var bodies []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept-Encoding") != "gzip" {
+			t.Fatalf("gzip should be accepted")
+		}
+		encoding := req.Header.Get("Content-Encoding")
+		var body io.Reader = req.Body
+		if encoding == "gzip" {
+			reader, err := gzip.NewReader(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = reader
+		}
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodings = append(encodings, encoding)
+		bodies = append(bodies, string(data))
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBody)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), GzipThreshold(50))
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := []PQLQuery{
+		sampleFrame.Bitmap(1),
+		sampleIndex.Union(sampleFrame.Bitmap(1), sampleFrame.Bitmap(2)),
+	}
+	for _, query := range queries {
+		response, err := client.Query(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Results()) != 1 {
+			t.Fatalf("the response should be decompressed")
+		}
+	}
+	if !reflect.DeepEqual([]string{"", "gzip"}, encodings) {
+		t.Fatalf("only requests over the threshold should be compressed: %v", encodings)
+	}
+	if !strings.Contains(bodies[1], queries[1].serialize()) {
+		t.Fatalf("the request body should contain the query: %s", bodies[1])
+	}
+}
+
+func TestGzipRequestBodyOnRetry(t *testing.T) {
+	responseBody := mustMarshalQueryResponse(t)
+	var bodies [][]byte
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("each attempt should send the compressed body")
+		}
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies = append(bodies, data)
+		if len(bodies) == 1 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "503 Service Unavailable",
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBody)),
+		}, nil
+	})
+	policy := &RetryPolicy{
+		MaxAttempts:          2,
+		RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+	}
+	client, err := NewClient(":10101", HTTPTransport(transport), GzipThreshold(1), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Query(sampleFrame.Bitmap(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("2 attempts expected, got %d", len(bodies))
+	}
+	if !bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatalf("the retry should send the same compressed body")
+	}
+}
+
+func TestImportFrameGzipThreshold(t *testing.T) {
+	var encoding string
+	var request *pbuf.ImportRequest
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			encoding = req.Header.Get("Content-Encoding")
+			var reader io.Reader = req.Body
+			if encoding == "gzip" {
+				gzipReader, err := gzip.NewReader(req.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				reader = gzipReader
+			}
+			data, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request = &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	bits := []Bit{}
+	for i := uint64(0); i < 100; i++ {
+		bits = append(bits, Bit{RowID: 1, ColumnID: i})
+	}
+	tests := []struct {
+		clientThreshold int
+		importOptions   []interface{}
+		encoding        string
+	}{
+		{0, nil, ""},
+		{0, []interface{}{ImportGzipThreshold(100)}, "gzip"},
+		{100, nil, "gzip"},
+		{100, []interface{}{ImportGzipThreshold(-1)}, ""},
+		{100, []interface{}{ImportGzipThreshold(100000)}, ""},
+	}
+	for i, test := range tests {
+		client, err := NewClient(":10101", HTTPTransport(transport), GzipThreshold(test.clientThreshold))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 1000, test.importOptions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding != test.encoding {
+			t.Fatalf("%d: %q encoding expected, got %q", i, test.encoding, encoding)
+		}
+		if len(request.ColumnIDs) != len(bits) {
+			t.Fatalf("%d: %d bits should be imported, got %d", i, len(bits), len(request.ColumnIDs))
+		}
+	}
+}
+
+func TestQueryJSONFormat(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Accept") != "application/json" {
+			t.Fatalf("JSON response should be requested")
+		}
+		if req.URL.RawQuery != "columnAttrs=true" {
+			t.Fatalf("unexpected URL parameters: %s", req.URL.RawQuery)
+		}
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "Count(Bitmap(rowID=1, frame='sample-frame'))" {
+			t.Fatalf("unexpected body: %s", body)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Query(sampleIndex.Count(sampleFrame.Bitmap(1)), ColumnAttrs(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result().Count != 5 {
+		t.Fatalf("5 != %d", response.Result().Count)
+	}
+}
+
+func TestQueryResponseMetadata(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(time.Millisecond)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+			Request:    req,
+		}, nil
+	})
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Query(sampleIndex.Count(sampleFrame.Bitmap(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := response.Metadata
+	if metadata == nil {
+		t.Fatalf("metadata should be set")
+	}
+	if metadata.Host != "node1:10101" {
+		t.Fatalf("unexpected host: %s", metadata.Host)
+	}
+	if metadata.Size != len(`{"results": [5]}`) {
+		t.Fatalf("unexpected size: %d", metadata.Size)
+	}
+	if metadata.Duration < time.Millisecond {
+		t.Fatalf("unexpected duration: %s", metadata.Duration)
+	}
+	response, err = client.Query(sampleFrame.Bitmap(1), &QueryOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Metadata != nil {
+		t.Fatalf("metadata should not be set for dry runs")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var requested string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.Method + " " + req.URL.Path
+		body := `{"status":{"Nodes":[
+			{"Scheme":"http","Host":"node1:10101","State":"UP","Indexes":[
+				{"Name":"i1","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"f1","Meta":{"RowLabel":"rowID","CacheType":"ranked"}}],"Slices":[0,3]},
+				{"Name":"i2","Meta":{},"Frames":[],"Slices":[]}]},
+			{"Scheme":"http","Host":"node2:10101","State":"DOWN","Indexes":[
+				{"Name":"i1","Meta":{"ColumnLabel":"columnID"},"Frames":[],"Slices":[1,5,2]}]}]}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := client.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "GET /status" {
+		t.Fatalf("unexpected request: %s", requested)
+	}
+	if len(status.Nodes) != 2 || status.Nodes[0].State != "UP" || status.Nodes[1].State != "DOWN" {
+		t.Fatalf("unexpected nodes: %v", status.Nodes)
+	}
+	frame := status.Nodes[0].Indexes[0].Frames[0]
+	if frame.Name != "f1" || frame.Meta.CacheType != "ranked" {
+		t.Fatalf("unexpected frame: %v", frame)
+	}
+	if maxSlices := status.MaxSlices(); !reflect.DeepEqual(map[string]uint64{"i1": 5}, maxSlices) {
+		t.Fatalf("unexpected max slices: %v", maxSlices)
+	}
+}
+
+func TestMaxSlices(t *testing.T) {
+	requested := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.RequestURI())
+		body := `{"maxSlices":{"i1":5,"i2":0}}`
+		if req.URL.RawQuery == "inverse=true" {
+			body = `{"maxSlices":{"i1":2}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxSlices, err := client.MaxSlices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]uint64{"i1": 5, "i2": 0}, maxSlices) {
+		t.Fatalf("unexpected max slices: %v", maxSlices)
+	}
+	maxSlices, err = client.MaxInverseSlices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]uint64{"i1": 2}, maxSlices) {
+		t.Fatalf("unexpected max inverse slices: %v", maxSlices)
+	}
+	if !reflect.DeepEqual([]string{"/slices/max", "/slices/max?inverse=true"}, requested) {
+		t.Fatalf("unexpected requests: %v", requested)
+	}
+}
+
+func TestMaxSlicesFromStatus(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/slices/max" {
+			return &http.Response{
+				StatusCode: 404,
+				Body:       ioutil.NopCloser(strings.NewReader("not found")),
+			}, nil
+		}
+		body := `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+			{"Name":"i1","Meta":{},"Frames":[],"Slices":[0,3]}]}]}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxSlices, err := client.MaxSlices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]uint64{"i1": 3}, maxSlices) {
+		t.Fatalf("unexpected max slices: %v", maxSlices)
+	}
+}
+
+func TestImportFrame(t *testing.T) {
+	var imports []*pbuf.ImportRequest
+	fragmentRequests := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			fragmentRequests++
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			if req.URL.Host != "node1:10101" {
+				t.Fatalf("import sent to the wrong node: %s", req.URL.Host)
+			}
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+			imports = append(imports, request)
+		default:
+			t.Fatalf("unexpected request: %s", req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewCSVBitIterator(strings.NewReader("10,7\n2,1048577\n3,5\n"))
+	if err = client.ImportFrame(sampleFrame, iterator, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(imports) != 3 {
+		t.Fatalf("3 import requests expected, got %d", len(imports))
+	}
+	if imports[0].Slice != 0 || imports[1].Slice != 1 || imports[2].Slice != 0 {
+		t.Fatalf("slices should be imported in order in each batch: %v", imports)
+	}
+	bits := 0
+	for _, request := range imports {
+		bits += len(request.ColumnIDs)
+	}
+	if bits != 3 {
+		t.Fatalf("only the bits in the iterator should be imported, got %d bits", bits)
+	}
+	if fragmentRequests != 2 {
+		t.Fatalf("the nodes of each slice should be fetched once, %d requests", fragmentRequests)
+	}
+}
+
+func TestImportFrameThreadCount(t *testing.T) {
+	mutex := &sync.Mutex{}
+	imported := map[uint64]int{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				return nil, err
+			}
+			if request.Slice == 3 {
+				return &http.Response{
+					StatusCode: http.StatusInternalServerError,
+					Body:       ioutil.NopCloser(strings.NewReader("slice 3 is broken")),
+				}, nil
+			}
+			mutex.Lock()
+			imported[request.Slice] += len(request.ColumnIDs)
+			mutex.Unlock()
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{}
+	for slice := uint64(0); slice < 3; slice++ {
+		for i := uint64(0); i < 10; i++ {
+			bits = append(bits, Bit{RowID: i, ColumnID: slice*sliceWidth + i})
+		}
+	}
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 5, ThreadCount(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[uint64]int{0: 10, 1: 10, 2: 10}, imported) {
+		t.Fatalf("unexpected imported bits: %v", imported)
+	}
+
+	bits = append(bits, Bit{RowID: 1, ColumnID: 3 * sliceWidth})
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 5, &ImportOptions{ThreadCount: 2})
+	if err == nil || !strings.HasSuffix(err.Error(), "slice 3 is broken") {
+		t.Fatalf("the error of the failing batch should be returned, got: %v", err)
+	}
+}
+
+func TestImportFrameProgress(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		if req.URL.Path == "/fragment/nodes" {
+			if req.URL.Query().Get("slice") == "0" {
+				body = []byte(`[{"scheme":"http","host":"node1:10101"},{"scheme":"http","host":"node2:10101"}]`)
+			} else {
+				body = []byte(`[{"scheme":"http","host":"node3:10101"}]`)
+			}
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{{RowID: 1, ColumnID: 1}, {RowID: 1, ColumnID: 2}, {RowID: 1, ColumnID: sliceWidth}}
+	statusChannel := make(chan ImportStatusUpdate, 10)
+	summary := &ImportSummary{}
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 10, StatusChannel(statusChannel), Summary(summary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(statusChannel)
+	updates := []string{}
+	for update := range statusChannel {
+		updates = append(updates, fmt.Sprintf("%d %s %d", update.Slice, update.Node, update.Count))
+	}
+	target := []string{"0 node1:10101 2", "0 node2:10101 2", "1 node3:10101 1"}
+	if !reflect.DeepEqual(target, updates) {
+		t.Fatalf("%v != %v", target, updates)
+	}
+	if summary.Count != 3 || summary.Batches != 2 || summary.Duration <= 0 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if summary.Throughput() <= 0 {
+		t.Fatalf("throughput should be positive")
+	}
+	if (ImportSummary{Count: 10}).Throughput() != 0 {
+		t.Fatalf("throughput should be 0 without a duration")
+	}
+}
+
+func TestImportValueFrame(t *testing.T) {
+	var imports []*pbuf.ImportValueRequest
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import-value":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			request := &pbuf.ImportValueRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				return nil, err
+			}
+			imports = append(imports, request)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewCSVValueIterator(strings.NewReader("10,7\n1048577,-5\n3,42\n"))
+	if err = client.ImportValueFrame(sampleFrame, "price", iterator, 100); err != nil {
+		t.Fatal(err)
+	}
+	if len(imports) != 2 {
+		t.Fatalf("2 import requests expected, got %d", len(imports))
+	}
+	first, second := imports[0], imports[1]
+	if first.Slice != 0 || first.Field != "price" || !reflect.DeepEqual([]uint64{3, 10}, first.ColumnIDs) || !reflect.DeepEqual([]int64{42, 7}, first.Values) {
+		t.Fatalf("unexpected import request for slice 0: %v", first)
+	}
+	if second.Slice != 1 || !reflect.DeepEqual([]int64{-5}, second.Values) {
+		t.Fatalf("unexpected import request for slice 1: %v", second)
+	}
+}
+
+func TestImportValueFrameFailsOnErrorStatus(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fragment/nodes" {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"scheme":"http","host":"node1:10101"}]`)),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(strings.NewReader("field not found")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewCSVValueIterator(strings.NewReader("10,7"))
+	err = client.ImportValueFrame(sampleFrame, "price", iterator, 100, ThreadCount(2))
+	if err == nil || !strings.HasSuffix(err.Error(), "field not found") {
+		t.Fatalf("the import should fail with the server error, got: %v", err)
+	}
+}
+
+func TestImportValueFrameResumesFromCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosa-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	failSlice := uint64(1)
+	imported := map[uint64]int{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import-value":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &pbuf.ImportValueRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+			if request.Slice == failSlice {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Body:       ioutil.NopCloser(strings.NewReader("bad request")),
+				}, nil
+			}
+			imported[request.Slice]++
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	csv := fmt.Sprintf("1,10\n%d,20\n2,30\n%d,40\n", sliceWidth+1, sliceWidth+2)
+	checkpoint := NewImportCheckpoint()
+	err = client.ImportValueFrame(sampleFrame, "price", NewCSVValueIterator(strings.NewReader(csv)), 2, Checkpoint(checkpoint))
+	if err == nil {
+		t.Fatal("the import should fail")
+	}
+	if checkpoint.Batches(0) != 1 || checkpoint.Batches(1) != 0 {
+		t.Fatalf("unexpected checkpoint: %s", checkpoint.Token())
+	}
+	failSlice = 99
+	// the values are spilled to disk while they wait for the workers
+	err = client.ImportValueFrame(sampleFrame, "price", NewCSVValueIterator(strings.NewReader(csv)), 2,
+		Checkpoint(checkpoint), MaxBufferSize(1), SpillDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first batch of slice 0 is not imported again
+	target := map[uint64]int{0: 2, 1: 2}
+	if !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+}
+
+func TestImportFrameInvalidOptions(t *testing.T) {
+	client := DefaultClient()
+	invalid := [][]interface{}{
+		{ThreadCount(-1)},
+		{"thread count"},
+		{ThreadCount(2), &ImportOptions{}},
+	}
+	for i, options := range invalid {
+		if err := client.ImportFrame(sampleFrame, NewSliceBitIterator(nil), 10, options...); err != ErrInvalidImportOption {
+			t.Fatalf("%d: ErrInvalidImportOption expected, got %v", i, err)
+		}
+	}
+}
+
+func TestImportFrameTimestamps(t *testing.T) {
+	var request *pbuf.ImportRequest
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			request = &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				return nil, err
+			}
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewCSVBitIteratorWithTimestampFormat(strings.NewReader("1,10,1991-09-02T09:33\n2,5"), "2006-01-02T15:04")
+	if err = client.ImportFrame(sampleFrame, iterator, 100); err != nil {
+		t.Fatal(err)
+	}
+	// bits are sorted by row ID, then column ID
+	if !reflect.DeepEqual([]uint64{10, 5}, request.ColumnIDs) || !reflect.DeepEqual([]int64{683803980, 0}, request.Timestamps) {
+		t.Fatalf("unexpected import request: %v", request)
+	}
+}
+
+func TestImportRoaringBitmap(t *testing.T) {
+	mutex := &sync.Mutex{}
+	imported := map[string][]byte{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"},{"scheme":"http","host":"node2:10101"}]`)
+		case "/index/sample-index/frame/sample-frame/import-roaring/3":
+			if req.Header.Get("Content-Type") != "application/octet-stream" {
+				t.Fatalf("unexpected content type: %s", req.Header.Get("Content-Type"))
+			}
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mutex.Lock()
+			imported[req.URL.Host] = data
+			mutex.Unlock()
+		default:
+			t.Fatalf("unexpected request: %s", req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.ImportRoaringBitmap(sampleFrame, 3, bytes.NewBufferString("roaring")); err != nil {
+		t.Fatal(err)
+	}
+	target := map[string][]byte{
+		"node1:10101": []byte("roaring"),
+		"node2:10101": []byte("roaring"),
+	}
+	if !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+}
+
+func TestImportRoaringBitmapFailsOnErrorStatus(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fragment/nodes" {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"scheme":"http","host":"node1:10101"}]`)),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(strings.NewReader("invalid bitmap")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.ImportRoaringBitmap(sampleFrame, 0, bytes.NewBufferString("not roaring"))
+	if err == nil || !strings.HasSuffix(err.Error(), "invalid bitmap") {
+		t.Fatalf("the import should fail with the server error, got: %v", err)
+	}
+}
+
+func TestImportFrameRetriesFailedBatches(t *testing.T) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fragment/nodes" {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"scheme":"http","host":"node1:10101"}]`)),
+			}, nil
+		}
+		attempts++
+		if attempts == 1 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &RetryPolicy{MaxAttempts: 2}
+	iterator := NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 1}})
+	if err = client.ImportFrame(sampleFrame, iterator, 100, ImportRetry(policy)); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Fatalf("the batch should be imported on the second attempt, %d attempts", attempts)
+	}
+}
+
+func TestImportFrameResumesFromCheckpoint(t *testing.T) {
+	failSlice := uint64(1)
+	imported := map[uint64]int{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+			if request.Slice == failSlice {
+				return &http.Response{
+					StatusCode: http.StatusBadRequest,
+					Body:       ioutil.NopCloser(strings.NewReader("bad request")),
+				}, nil
+			}
+			imported[request.Slice]++
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{
+		{RowID: 1, ColumnID: 1},
+		{RowID: 1, ColumnID: sliceWidth + 1},
+		{RowID: 1, ColumnID: 2},
+		{RowID: 1, ColumnID: sliceWidth + 2},
+	}
+	checkpoint := NewImportCheckpoint()
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 2, Checkpoint(checkpoint))
+	if err == nil {
+		t.Fatal("the import should fail")
+	}
+	if checkpoint.Batches(0) != 1 || checkpoint.Batches(1) != 0 {
+		t.Fatalf("unexpected checkpoint: %s", checkpoint.Token())
+	}
+	resumed, err := ParseImportCheckpoint(checkpoint.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	failSlice = 99
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 2, Checkpoint(resumed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first batch of slice 0 is not imported again
+	target := map[uint64]int{0: 2, 1: 2}
+	if !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+	if resumed.Token() != "2:0=2,1=2" {
+		t.Fatalf("unexpected checkpoint: %s", resumed.Token())
+	}
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 3, Checkpoint(resumed))
+	if err != ErrInvalidImportCheckpoint {
+		t.Fatalf("ErrInvalidImportCheckpoint expected for another batch size, got %v", err)
+	}
+}
+
+func TestImportFrameClearBits(t *testing.T) {
+	var query url.Values
+	var request *pbuf.ImportRequest
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/version":
+			body = []byte(`{"version": "v0.9.0"}`)
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			query = req.URL.Query()
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request = &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 10}})
+	if err = client.ImportFrame(sampleFrame, iterator, 100, ClearBits(true)); err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("clear") != "true" {
+		t.Fatalf("the bits should be cleared: %v", query)
+	}
+	if !reflect.DeepEqual([]uint64{10}, request.ColumnIDs) {
+		t.Fatalf("unexpected import request: %v", request)
+	}
+	iterator = NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 10}})
+	if err = client.ImportFrame(sampleFrame, iterator, 100); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := query["clear"]; ok {
+		t.Fatalf("the bits should be set: %v", query)
+	}
+	valueIterator := NewCSVValueIterator(strings.NewReader("10,7"))
+	if err = client.ImportValueFrame(sampleFrame, "price", valueIterator, 100, ClearBits(true)); err != ErrInvalidImportOption {
+		t.Fatalf("ErrInvalidImportOption expected, got %v", err)
+	}
+}
+
+func TestImportFrameMaxBufferSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosa-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mutex := &sync.Mutex{}
+	imported := map[uint64][]uint64{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			imported[request.Slice] = append(imported[request.Slice], request.ColumnIDs...)
+			mutex.Unlock()
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{}
+	target := map[uint64][]uint64{}
+	for i := uint64(0); i < 20; i++ {
+		slice := i % 3
+		bits = append(bits, Bit{RowID: 1, ColumnID: slice*sliceWidth + i})
+		target[slice] = append(target[slice], slice*sliceWidth+i)
+	}
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator(bits), 2, ThreadCount(2), MaxBufferSize(bitSize), SpillDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("the spill files should be removed, %d files", len(files))
+	}
+	if err = client.ImportFrame(sampleFrame, NewSliceBitIterator(nil), 2, MaxBufferSize(-1)); err != ErrInvalidImportOption {
+		t.Fatalf("ErrInvalidImportOption expected, got %v", err)
+	}
+}
+
+func TestImportFrameDryRun(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("a dry run should not send requests: %s", req.URL.Path)
+		return nil, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := `1,10
+		x,20
+		2,1048577,683793200
+
+		3,30,-999999999999
+		4,1048578`
+	report := &ImportReport{}
+	err = client.ImportFrame(sampleFrame, NewCSVBitIterator(strings.NewReader(text)), 100, ImportDryRun(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count != 3 || !reflect.DeepEqual(map[uint64]int{0: 1, 1: 2}, report.SliceCounts) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	lines := []int{}
+	for _, recordErr := range report.Errors {
+		lines = append(lines, recordErr.Line)
+	}
+	if !reflect.DeepEqual([]int{2, 4, 5}, lines) {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+	if report.Errors[0].Error() != "Invalid row ID at line: 2" {
+		t.Fatalf("unexpected error: %s", report.Errors[0])
+	}
+}
+
+func TestImportValueFrameDryRun(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("a dry run should not send requests: %s", req.URL.Path)
+		return nil, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := sampleIndex.Frame("range-frame", IntField("price", 0, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := &ImportReport{}
+	iterator := NewCSVValueIterator(strings.NewReader("10,7\n20,101\n30,x\n1048576,100"))
+	err = client.ImportValueFrame(frame, "price", iterator, 100, ImportDryRun(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Count != 2 || !reflect.DeepEqual(map[uint64]int{0: 1, 1: 1}, report.SliceCounts) {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Error() != "Value out of range at line: 2" || report.Errors[1].Line != 3 {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+}
+
+func TestImportFrameDryRunFailsOnReadError(t *testing.T) {
+	client := DefaultClient()
+	readErr := errors.New("read error")
+	iterator := bitIteratorFunc(func() (Bit, error) { return Bit{}, readErr })
+	if err := client.ImportFrame(sampleFrame, iterator, 100, ImportDryRun(&ImportReport{})); err != readErr {
+		t.Fatalf("the read error expected, got %v", err)
+	}
+}
+
+type bitIteratorFunc func() (Bit, error)
+
+func (fn bitIteratorFunc) NextBit() (Bit, error) {
+	return fn()
+}
+
+func TestImportFrameRoutesToSliceNodes(t *testing.T) {
+	imported := map[string][]uint64{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			if req.URL.Query().Get("index") != sampleIndex.Name() {
+				t.Fatalf("unexpected index: %s", req.URL.RawQuery)
+			}
+			if req.URL.Query().Get("slice") == "0" {
+				body = []byte(`[{"scheme":"http","host":"node1:10101"},{"scheme":"http","host":"node2:10101"}]`)
+			} else {
+				body = []byte(`[{"scheme":"https","host":"node3:10101"}]`)
+			}
+		case "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+			key := req.URL.Scheme + "://" + req.URL.Host
+			imported[key] = append(imported[key], request.Slice)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient("coordinator:10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterator := NewCSVBitIterator(strings.NewReader("10,7\n2,1048577\n"))
+	if err = client.ImportFrame(sampleFrame, iterator, 100); err != nil {
+		t.Fatal(err)
+	}
+	target := map[string][]uint64{
+		"http://node1:10101":  {0},
+		"http://node2:10101":  {0},
+		"https://node3:10101": {1},
+	}
+	if !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+}
+
+func TestExportReaderStreamsSlices(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := "1,10\n"
+		if req.URL.Query().Get("slice") == "1" {
+			body = "2,1048577\n3,1048578\n"
+		}
+		return &http.Response{
+			StatusCode:    200,
+			Body:          ioutil.NopCloser(strings.NewReader(body)),
+			ContentLength: -1,
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sliceURIs := map[uint64]*URI{
+		0: URIFromAddress("index1.pilosa.com:10101"),
+		1: URIFromAddress("index2.pilosa.com:10101"),
+	}
+	reader := newExportReader(client, sliceURIs, sampleFrame, "standard")
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1,10\n2,1048577\n3,1048578\n" {
+		t.Fatalf("unexpected export: %s", data)
+	}
+
+	client, err = NewClient(":10101", HTTPTransport(transport), MaxResponseSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader = newExportReader(client, sliceURIs, sampleFrame, "standard")
+	if _, err = ioutil.ReadAll(reader); err == nil || !strings.HasSuffix(err.Error(), ErrResponseTooLarge.Error()) {
+		t.Fatalf("ErrResponseTooLarge expected, got: %v", err)
+	}
+}
+
+func TestExportFrameTo(t *testing.T) {
+	requested := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch req.URL.Path {
+		case "/status":
+			body = `{"status":{"Nodes":[
+				{"Scheme":"http","Host":"node1:10101","Indexes":[{"Name":"sample-index","Slices":[0,5]}]},
+				{"Scheme":"http","Host":"node2:10101","Indexes":[{"Name":"sample-index","Slices":[2]}]}]}}`
+		case "/export":
+			slice := req.URL.Query().Get("slice")
+			requested = append(requested, req.URL.Host+"/"+slice)
+			body = fmt.Sprintf("%s,1\n", slice)
+		default:
+			t.Fatalf("unexpected request: %s", req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	if err = client.ExportFrameTo(sampleFrame, "standard", buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "0,1\n2,1\n5,1\n" {
+		t.Fatalf("unexpected export: %s", buf.String())
+	}
+	target := []string{"node1:10101/0", "node2:10101/2", "node1:10101/5"}
+	if !reflect.DeepEqual(target, requested) {
+		t.Fatalf("%v != %v", target, requested)
+	}
+}
+
+func TestSyncSchemaReport(t *testing.T) {
+	created := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch {
+		case req.URL.Path == "/status":
+			body = `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+				{"Name":"index1","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"frame1","Meta":{"RowLabel":"rowID"}}]},
+				{"Name":"index2","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"frame9","Meta":{"RowLabel":"rowID"}}]}]}]}}`
+		case req.Method == "POST":
+			created = append(created, req.URL.Path)
+		default:
+			t.Fatalf("unexpected request: %s %s", req.Method, req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := NewSchema()
+	index1, _ := schema.Index("index1")
+	index1.Frame("frame1")
+	index1.Frame("frame2")
+	index3, _ := schema.Index("index3")
+	index3.Frame("frame3")
+	report := &SchemaReport{}
+	if err = client.SyncSchema(schema, SyncSchemaReport(report)); err != nil {
+		t.Fatal(err)
+	}
+	schemaNames := func(schema *Schema) []string {
+		names := []string{}
+		for indexName, index := range schema.Indexes() {
+			for frameName := range index.Frames() {
+				names = append(names, indexName+"/"+frameName)
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+	if target := []string{"index1/frame2", "index3/frame3"}; !reflect.DeepEqual(target, schemaNames(report.Created)) {
+		t.Fatalf("%v != %v", target, schemaNames(report.Created))
+	}
+	if target := []string{"index2/frame9"}; !reflect.DeepEqual(target, schemaNames(report.Extraneous)) {
+		t.Fatalf("%v != %v", target, schemaNames(report.Extraneous))
+	}
+	sort.Strings(created)
+	if target := []string{"/index/index1/frame/frame2", "/index/index3", "/index/index3/frame/frame3"}; !reflect.DeepEqual(target, created) {
+		t.Fatalf("%v != %v", target, created)
+	}
+	// the local schema is updated with the server schema
+	if _, ok := schema.Indexes()["index2"]; !ok {
+		t.Fatal("index2 should be added to the local schema")
+	}
+}
+
+func TestRequestHeaders(t *testing.T) {
+	var header http.Header
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(mustMarshalQueryResponse(t))),
+		}, nil
+	})
+	client, err := NewClient(":10101",
+		HTTPTransport(transport),
+		Headers(map[string]string{"X-Tenant-ID": "tenant1", "Accept": "text/plain"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Query(sampleFrame.Bitmap(1), QueryHeaders(map[string]string{"X-Request-ID": "42"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targets := map[string]string{
+		"X-Tenant-ID":  "tenant1",
+		"X-Request-ID": "42",
+		"Accept":       "application/x-protobuf",
+		"User-Agent":   "go-pilosa/" + ClientVersion,
+	}
+	for k, v := range targets {
+		if header.Get(k) != v {
+			t.Fatalf("%s: %s != %s", k, v, header.Get(k))
+		}
+	}
+
+	client, err = NewClient(":10101", HTTPTransport(transport), UserAgent("my-app/1.0"))
 	if err != nil {
 		t.Fatal(err)
 	}
-	frame, err := index.Frame("foo", nil)
+	if _, err = client.Query(sampleFrame.Bitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("User-Agent") != "my-app/1.0" || header.Get("X-Request-ID") == "" || header.Get("X-Request-ID") == "42" {
+		t.Fatalf("unexpected headers: %v", header)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	statusCode := http.StatusConflict
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       ioutil.NopCloser(strings.NewReader("some error\n")),
+		}, nil
+	})
+	client, err := NewClient("index1.pilosa.com:10101", HTTPTransport(transport))
 	if err != nil {
 		t.Fatal(err)
 	}
-	invalid := frame.FilterFieldTopN(12, frame.Bitmap(7), "$invalid$", 80, 81)
-	_, err = client.Query(invalid, nil)
-	if err == nil {
-		t.Fatalf("Should have failed")
+	if err = client.CreateIndex(sampleIndex); err != ErrIndexExists {
+		t.Fatalf("ErrIndexExists expected, got: %v", err)
+	}
+	if err = client.CreateFrame(sampleFrame); err != ErrFrameExists {
+		t.Fatalf("ErrFrameExists expected, got: %v", err)
+	}
+
+	statusCode = http.StatusInternalServerError
+	err = client.DeleteIndex(sampleIndex)
+	pilosaErr, ok := err.(*PilosaError)
+	if !ok {
+		t.Fatalf("PilosaError expected, got: %v", err)
+	}
+	if pilosaErr.RequestID == "" {
+		t.Fatalf("request ID expected in the error")
+	}
+	target := &PilosaError{StatusCode: 500, Host: "index1.pilosa.com:10101", ServerMessage: "some error\n", RequestID: pilosaErr.RequestID}
+	if !reflect.DeepEqual(target, pilosaErr) {
+		t.Fatalf("%v != %v", target, pilosaErr)
+	}
+	// the index is still on the server, so it should stay in the name cache
+	if !client.names.hasIndex(sampleIndex.Name()) {
+		t.Fatalf("the index should not be removed from the name cache if deleting it fails")
+	}
+	if err = client.DeleteFrame(sampleFrame); err == nil {
+		t.Fatalf("should have failed")
+	}
+	if !client.names.hasFrame(sampleIndex.Name(), sampleFrame.Name()) {
+		t.Fatalf("the frame should not be removed from the name cache if deleting it fails")
 	}
 }
 
-func TestClientOptions(t *testing.T) {
-	targets := []*ClientOptions{
-		{SocketTimeout: 10},
-		{ConnectTimeout: 5},
-		{PoolSizePerRoute: 7},
-		{TotalPoolSize: 17},
-		{TLSConfig: &tls.Config{InsecureSkipVerify: true}},
+func TestCreateIndexFailsWithoutResponse(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errors.New("connection refused")
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
 	}
-	optionsList := [][]ClientOption{
-		{SocketTimeout(10)},
-		{ConnectTimeout(5)},
-		{PoolSizePerRoute(7)},
-		{TotalPoolSize(17)},
-		{TLSConfig(&tls.Config{InsecureSkipVerify: true})},
+	if err = client.CreateIndex(sampleIndex); err == nil {
+		t.Fatalf("should have failed")
+	}
+	if err = client.CreateFrame(sampleFrame); err == nil {
+		t.Fatalf("should have failed")
 	}
+}
 
-	for i := 0; i < len(targets); i++ {
-		options := &ClientOptions{}
-		err := options.addOptions(optionsList[i]...)
-		if err != nil {
-			t.Fatal(err)
+// newFailingTransport returns a transport which responds with 503 for the
+// first failCount requests and with the given body afterwards.
+func newFailingTransport(failCount int, body string) (roundTripperFunc, *int) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts <= failCount {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Status:     "503 Service Unavailable",
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
 		}
-		target := targets[i]
-		if !reflect.DeepEqual(target, options) {
-			t.Fatalf("%v != %v", target, options)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	return transport, &attempts
+}
+
+func mustMarshalQueryResponse(t *testing.T) []byte {
+	response := &pbuf.QueryResponse{
+		Results: []*pbuf.QueryResult{{}},
+	}
+	data, err := proto.Marshal(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientOptionsDefaults(t *testing.T) {
+	options := (&ClientOptions{}).withDefaults()
+	if options.KeepAlive != defaultKeepAlive {
+		t.Fatalf("%v != %v", defaultKeepAlive, options.KeepAlive)
+	}
+	if options.IdleConnTimeout != defaultIdleConnTimeout {
+		t.Fatalf("%v != %v", defaultIdleConnTimeout, options.IdleConnTimeout)
+	}
+	if options.MaxHostAttempts != maxHosts {
+		t.Fatalf("%v != %v", maxHosts, options.MaxHostAttempts)
+	}
+	if options.UserAgent != "go-pilosa/"+ClientVersion {
+		t.Fatalf("unexpected user agent: %s", options.UserAgent)
+	}
+	if options.AsyncConcurrency != defaultAsyncConcurrency {
+		t.Fatalf("%v != %v", defaultAsyncConcurrency, options.AsyncConcurrency)
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	client, err := NewClient(":10101", ProxyURL("http://proxy.example.com:3128"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := client.client.Transport.(*http.Transport)
+	req, err := http.NewRequest("GET", "http://localhost:10101/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := transport.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxy == nil || proxy.Host != "proxy.example.com:3128" {
+		t.Fatalf("unexpected proxy: %v", proxy)
+	}
+
+	for _, proxyURL := range []string{"proxy.example.com", "http://%zz", ""} {
+		if _, err = NewClient(":10101", ProxyURL(proxyURL)); err == nil {
+			t.Fatalf("should have failed: %s", proxyURL)
+		}
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	original := &tls.Config{ServerName: "pilosa.local"}
+	options := &ClientOptions{}
+	err = options.addOptions(
+		TLSConfig(original),
+		TLSSkipVerify(true),
+		TLSCACertFile(certFile),
+		TLSClientCertFiles(certFile, keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := options.TLSConfig
+	if original.InsecureSkipVerify || original.RootCAs != nil || len(original.Certificates) != 0 {
+		t.Fatalf("the original TLS configuration should not be modified")
+	}
+	if config.ServerName != "pilosa.local" || !config.InsecureSkipVerify {
+		t.Fatalf("TLS configuration was not set correctly")
+	}
+	if config.RootCAs == nil || len(config.RootCAs.Subjects()) != 1 {
+		t.Fatalf("CA certificate should be added")
+	}
+	if len(config.Certificates) != 1 {
+		t.Fatalf("client certificate should be added")
+	}
+}
+
+func TestTLSOptionsFail(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, _ := writeTestCertificate(t, dir)
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	optionsList := []ClientOption{
+		TLSCACertFile(filepath.Join(dir, "does-not-exist.pem")),
+		TLSCACertFile(notPEM),
+		TLSClientCertFiles(certFile, notPEM),
+	}
+	for _, option := range optionsList {
+		if _, err := NewClient(":9999", option); err == nil {
+			t.Fatalf("should have failed")
 		}
 	}
 }
 
+func writeTestCertificate(t *testing.T, dir string) (certFile string, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test.pilosa.local"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
 func TestNewClientWithErrorredOption(t *testing.T) {
 	_, err := NewClient(":8888", ClientOptionErr(0))
 	if err == nil {
@@ -147,6 +2104,10 @@ func TestQueryOptions(t *testing.T) {
 		{ExcludeAttrs: false},
 		{ExcludeBits: true},
 		{ExcludeBits: false},
+		{DryRun: true},
+		{RetryPolicy: DefaultRetryPolicy()},
+		{Headers: map[string]string{"X-Request-ID": "42"}},
+		{LazyBits: true},
 	}
 
 	optionsList := [][]interface{}{
@@ -156,6 +2117,10 @@ func TestQueryOptions(t *testing.T) {
 		{ExcludeAttrs(false)},
 		{ExcludeBits(true)},
 		{ExcludeBits(false)},
+		{DryRun(true)},
+		{QueryRetry(DefaultRetryPolicy())},
+		{QueryHeaders(map[string]string{"X-Request-ID": "42"})},
+		{LazyBits(true)},
 	}
 
 	for i := 0; i < len(targets); i++ {
@@ -221,3 +2186,347 @@ func QueryOptionErr(int) QueryOption {
 		return errors.New("Some error")
 	}
 }
+
+func TestSchemaFrameOptions(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/status" {
+			t.Fatalf("unexpected request: %s", req.URL.Path)
+		}
+		body := `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+			{"Name":"index1","Meta":{"ColumnLabel":"col","TimeQuantum":"Y"},"Frames":[
+				{"Name":"frame1","Meta":{"RowLabel":"row","CacheType":"ranked","CacheSize":5000,"InverseEnabled":true,"TimeQuantum":"YMD","RangeEnabled":true,
+					"Fields":[{"Name":"foo","Type":"int","Min":-10,"Max":100},{"Name":"bar","Type":"int","Min":0,"Max":5}]}}]}]}]}}`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := schema.Indexes()["index1"]
+	indexOptions := index.IndexOptions()
+	if indexOptions.ColumnLabel != "col" || indexOptions.TimeQuantum != TimeQuantumYear {
+		t.Fatalf("unexpected index options: %v", indexOptions)
+	}
+	options := index.Frames()["frame1"].FrameOptions()
+	if options.RowLabel != "row" || options.CacheType != CacheTypeRanked || options.CacheSize != 5000 ||
+		!options.InverseEnabled || options.TimeQuantum != TimeQuantumYearMonthDay || !options.RangeEnabled {
+		t.Fatalf("unexpected frame options: %v", options)
+	}
+	targetFields := []FieldInfo{
+		{Name: "bar", Type: "int", Min: 0, Max: 5},
+		{Name: "foo", Type: "int", Min: -10, Max: 100},
+	}
+	if !reflect.DeepEqual(targetFields, options.Fields()) {
+		t.Fatalf("%v != %v", targetFields, options.Fields())
+	}
+	// modifying the returned options should not change the frame
+	options.AddIntField("baz", 0, 1)
+	if len(index.Frames()["frame1"].FrameOptions().Fields()) != 2 {
+		t.Fatalf("frame options should not be modified")
+	}
+}
+
+func TestIntFieldManagement(t *testing.T) {
+	requests := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests = append(requests, req.Method+" "+req.URL.Path)
+		body := ""
+		if req.URL.Path == "/status" {
+			body = `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+				{"Name":"sample-index","Meta":{"ColumnLabel":"columnID"},"Frames":[
+					{"Name":"fields-frame","Meta":{"RowLabel":"rowID","RangeEnabled":true,"Fields":[{"Name":"foo","Type":"int","Min":-10,"Max":100}]}}]}]}]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := sampleIndex.Frame("fields-frame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateIntField(frame, "foo", -10, 100); err != nil {
+		t.Fatal(err)
+	}
+	target := []FieldInfo{{Name: "foo", Type: "int", Min: -10, Max: 100}}
+	if !reflect.DeepEqual(target, frame.FrameOptions().Fields()) {
+		t.Fatalf("%v != %v", target, frame.FrameOptions().Fields())
+	}
+	fields, err := client.Fields(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(target, fields) {
+		t.Fatalf("%v != %v", target, fields)
+	}
+	if err = client.DeleteField(frame, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if len(frame.FrameOptions().Fields()) != 0 {
+		t.Fatalf("deleted field should be removed from the frame")
+	}
+	targetRequests := []string{
+		"POST /index/sample-index/frame/fields-frame/field/foo",
+		"GET /status",
+		"DELETE /index/sample-index/frame/fields-frame/field/foo",
+	}
+	if !reflect.DeepEqual(targetRequests, requests) {
+		t.Fatalf("%v != %v", targetRequests, requests)
+	}
+	otherFrame, err := sampleIndex.Frame("not-on-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Fields(otherFrame); !IsNotFound(err) {
+		t.Fatalf("ErrFrameNotFound expected, got: %v", err)
+	}
+}
+
+func TestIndexAndFrameExists(t *testing.T) {
+	statusRequests := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if req.URL.Path == "/status" {
+			statusRequests++
+			body = `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+				{"Name":"index2","Frames":[{"Name":"frame2"}]},
+				{"Name":"index1","Frames":[{"Name":"frame1"}]}]}]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := client.Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"index1", "index2"}, indexes) {
+		t.Fatalf("unexpected indexes: %v", indexes)
+	}
+	check := func(exists bool, err error, target bool) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists != target {
+			t.Fatalf("%v != %v", target, exists)
+		}
+	}
+	exists, err := client.IndexExists("index1")
+	check(exists, err, true)
+	exists, err = client.FrameExists("index2", "frame2")
+	check(exists, err, true)
+	if statusRequests != 1 {
+		t.Fatalf("known names should be cached, status requests: %d", statusRequests)
+	}
+	exists, err = client.FrameExists("index1", "frame2")
+	check(exists, err, false)
+	if statusRequests != 2 {
+		t.Fatalf("unknown names should not be cached, status requests: %d", statusRequests)
+	}
+	index, _ := NewIndex("index3", nil)
+	frame, _ := index.Frame("frame3")
+	if err = client.CreateFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	exists, err = client.FrameExists("index3", "frame3")
+	check(exists, err, true)
+	if err = client.DeleteFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	exists, err = client.FrameExists("index3", "frame3")
+	check(exists, err, false)
+	if statusRequests != 3 {
+		t.Fatalf("unexpected status requests: %d", statusRequests)
+	}
+}
+
+func TestEnsureCreated(t *testing.T) {
+	existing := map[string]bool{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		statusCode := 200
+		if existing[req.URL.Path] {
+			statusCode = http.StatusConflict
+		}
+		existing[req.URL.Path] = true
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := NewIndex("ensure-index", nil)
+	frame, _ := index.Frame("ensure-frame")
+	for i, target := range []bool{true, false} {
+		created, err := client.EnsureIndexCreated(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != target {
+			t.Fatalf("index %d: %v != %v", i, target, created)
+		}
+		created, err = client.EnsureFrameCreated(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created != target {
+			t.Fatalf("frame %d: %v != %v", i, target, created)
+		}
+	}
+}
+
+func TestSchemaCache(t *testing.T) {
+	statusRequests := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if req.URL.Path == "/status" {
+			statusRequests++
+			body = `{"status":{"Nodes":[{"Scheme":"http","Host":"node1:10101","Indexes":[
+				{"Name":"index1","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"frame1","Meta":{"RowLabel":"rowID"}}]}]}]}}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), SchemaCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// modifying the returned schema should not modify the cached schema
+	index, _ := schema.Index("index1")
+	index.Frame("local-frame")
+	schema, err = client.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusRequests != 1 {
+		t.Fatalf("the schema should be cached, status requests: %d", statusRequests)
+	}
+	if len(schema.indexes["index1"].frames) != 1 {
+		t.Fatalf("the cached schema should not be modified: %v", schema)
+	}
+	client.InvalidateSchema()
+	client.Schema()
+	frame, _ := index.Frame("frame2")
+	client.CreateFrame(frame)
+	client.Schema()
+	if statusRequests != 3 {
+		t.Fatalf("the schema should be invalidated, status requests: %d", statusRequests)
+	}
+
+	// the schema is not cached by default
+	client, err = NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Schema()
+	client.Schema()
+	if statusRequests != 5 {
+		t.Fatalf("the schema should not be cached, status requests: %d", statusRequests)
+	}
+}
+
+func TestCreateRequestBodies(t *testing.T) {
+	bodies := map[string]string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bodies[req.Method+" "+req.URL.Path] = string(body)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := NewIndex("bodies", &IndexOptions{ColumnLabel: "user", TimeQuantum: TimeQuantumYear})
+	frame, _ := index.Frame("frame", InverseEnabled(true), CacheTypeLRU, CacheSize(10), TimeQuantumDayHour, IntField("foo", -5, 5))
+	if err = client.CreateIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	target := map[string]string{
+		"POST /index/bodies":             `{"options":{"columnLabel":"user","timeQuantum":"Y"}}`,
+		"POST /index/bodies/frame/frame": `{"options":{"rowLabel":"rowID","inverseEnabled":true,"timeQuantum":"DH","cacheType":"lru","cacheSize":10,"rangeEnabled":true,"fields":[{"name":"foo","type":"int","min":-5,"max":5}]}}`,
+	}
+	if !reflect.DeepEqual(target, bodies) {
+		t.Fatalf("%v != %v", target, bodies)
+	}
+}
+
+func TestMakeRequestDataMatchesProtobuf(t *testing.T) {
+	long := strings.Repeat("Bitmap(rowID=1, frame='sample-frame')", 10)
+	for _, query := range []string{"", "Bitmap(rowID=1, frame='sample-frame')", long} {
+		for i := 0; i < 8; i++ {
+			options := &QueryOptions{
+				Columns:      i&1 != 0,
+				ExcludeAttrs: i&2 != 0,
+				ExcludeBits:  i&4 != 0,
+			}
+			target, err := proto.Marshal(&pbuf.QueryRequest{
+				Query:        query,
+				ColumnAttrs:  options.Columns,
+				ExcludeAttrs: options.ExcludeAttrs,
+				ExcludeBits:  options.ExcludeBits,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := makeRequestData(query, options)
+			if !bytes.Equal(target, data) {
+				t.Fatalf("%v != %v for %q %+v", target, data, query, options)
+			}
+			if cap(data) != len(data) {
+				t.Fatalf("request data should be allocated at its exact size")
+			}
+		}
+	}
+}
+
+func BenchmarkMakeRequestData(b *testing.B) {
+	pql := sampleIndex.BatchQuery(sampleFrame.SetBit(1, 100), sampleFrame.SetBit(2, 200)).serialize()
+	options := &QueryOptions{Columns: true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		makeRequestData(pql, options)
+	}
+}
+
+func BenchmarkSetBitRequest(b *testing.B) {
+	options := &QueryOptions{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		// the query is not parsed unless retries, hedging, the result cache or auditing are enabled
+		pql := sampleFrame.SetBit(uint64(i), uint64(i)*1000).serialize()
+		makeRequestData(pql, options)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io"
+)
+
+// ClientInterface contains the methods of Client which are used to query and
+// manage the data and the schema of a Pilosa cluster.
+// Applications may depend on ClientInterface instead of *Client, so a mock or
+// a fake client can be injected in their tests.
+type ClientInterface interface {
+	Query(query PQLQuery, options ...interface{}) (*QueryResponse, error)
+	QueryWithContext(ctx context.Context, query PQLQuery, options ...interface{}) (*QueryResponse, error)
+	CreateIndex(index *Index) error
+	CreateIndexWithContext(ctx context.Context, index *Index) error
+	CreateFrame(frame *Frame) error
+	CreateFrameWithContext(ctx context.Context, frame *Frame) error
+	EnsureIndex(index *Index) error
+	EnsureIndexWithContext(ctx context.Context, index *Index) error
+	EnsureFrame(frame *Frame) error
+	EnsureFrameWithContext(ctx context.Context, frame *Frame) error
+	DeleteIndex(index *Index) error
+	DeleteIndexWithContext(ctx context.Context, index *Index) error
+	DeleteFrame(frame *Frame) error
+	DeleteFrameWithContext(ctx context.Context, frame *Frame) error
+	CreateIntField(frame *Frame, name string, min int, max int) error
+	CreateIntFieldWithContext(ctx context.Context, frame *Frame, name string, min int, max int) error
+	DeleteField(frame *Frame, name string) error
+	DeleteFieldWithContext(ctx context.Context, frame *Frame, name string) error
+	Schema() (*Schema, error)
+	SchemaWithContext(ctx context.Context) (*Schema, error)
+	SyncSchema(schema *Schema, options ...SyncSchemaOption) error
+	SyncSchemaWithContext(ctx context.Context, schema *Schema, options ...SyncSchemaOption) error
+	ImportFrame(frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error
+	ImportFrameWithContext(ctx context.Context, frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error
+	ImportValueFrame(frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error
+	ImportValueFrameWithContext(ctx context.Context, frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error
+	ExportFrame(frame *Frame, view string) (BitIterator, error)
+	ExportFrameWithContext(ctx context.Context, frame *Frame, view string) (BitIterator, error)
+	Views(frame *Frame) ([]string, error)
+	ViewsWithContext(ctx context.Context, frame *Frame) ([]string, error)
+	DeleteView(frame *Frame, view string) error
+	DeleteViewWithContext(ctx context.Context, frame *Frame, view string) error
+}
+
+var _ ClientInterface = (*Client)(nil)
+
+// NopClient is a ClientInterface which doesn't send any requests.
+// Queries are validated and get an empty result of the expected kind for each call,
+// as in a dry run. Other methods do nothing and return no error.
+type NopClient struct{}
+
+var _ ClientInterface = NopClient{}
+
+// Query validates the query and returns an empty result for each call.
+func (c NopClient) Query(query PQLQuery, options ...interface{}) (*QueryResponse, error) {
+	return c.QueryWithContext(context.Background(), query, options...)
+}
+
+// QueryWithContext validates the query and returns an empty result for each call.
+func (NopClient) QueryWithContext(ctx context.Context, query PQLQuery, options ...interface{}) (*QueryResponse, error) {
+	if err := query.Error(); err != nil {
+		return nil, err
+	}
+	return dryRunQuery(query)
+}
+
+// CreateIndex does nothing.
+func (NopClient) CreateIndex(index *Index) error { return nil }
+
+// CreateIndexWithContext does nothing.
+func (NopClient) CreateIndexWithContext(ctx context.Context, index *Index) error { return nil }
+
+// CreateFrame does nothing.
+func (NopClient) CreateFrame(frame *Frame) error { return nil }
+
+// CreateFrameWithContext does nothing.
+func (NopClient) CreateFrameWithContext(ctx context.Context, frame *Frame) error { return nil }
+
+// EnsureIndex does nothing.
+func (NopClient) EnsureIndex(index *Index) error { return nil }
+
+// EnsureIndexWithContext does nothing.
+func (NopClient) EnsureIndexWithContext(ctx context.Context, index *Index) error { return nil }
+
+// EnsureFrame does nothing.
+func (NopClient) EnsureFrame(frame *Frame) error { return nil }
+
+// EnsureFrameWithContext does nothing.
+func (NopClient) EnsureFrameWithContext(ctx context.Context, frame *Frame) error { return nil }
+
+// DeleteIndex does nothing.
+func (NopClient) DeleteIndex(index *Index) error { return nil }
+
+// DeleteIndexWithContext does nothing.
+func (NopClient) DeleteIndexWithContext(ctx context.Context, index *Index) error { return nil }
+
+// DeleteFrame does nothing.
+func (NopClient) DeleteFrame(frame *Frame) error { return nil }
+
+// DeleteFrameWithContext does nothing.
+func (NopClient) DeleteFrameWithContext(ctx context.Context, frame *Frame) error { return nil }
+
+// CreateIntField does nothing.
+func (NopClient) CreateIntField(frame *Frame, name string, min int, max int) error { return nil }
+
+// CreateIntFieldWithContext does nothing.
+func (NopClient) CreateIntFieldWithContext(ctx context.Context, frame *Frame, name string, min int, max int) error {
+	return nil
+}
+
+// DeleteField does nothing.
+func (NopClient) DeleteField(frame *Frame, name string) error { return nil }
+
+// DeleteFieldWithContext does nothing.
+func (NopClient) DeleteFieldWithContext(ctx context.Context, frame *Frame, name string) error {
+	return nil
+}
+
+// Schema returns an empty schema.
+func (NopClient) Schema() (*Schema, error) { return NewSchema(), nil }
+
+// SchemaWithContext returns an empty schema.
+func (NopClient) SchemaWithContext(ctx context.Context) (*Schema, error) { return NewSchema(), nil }
+
+// SyncSchema does nothing.
+func (NopClient) SyncSchema(schema *Schema, options ...SyncSchemaOption) error { return nil }
+
+// SyncSchemaWithContext does nothing.
+func (NopClient) SyncSchemaWithContext(ctx context.Context, schema *Schema, options ...SyncSchemaOption) error {
+	return nil
+}
+
+// ImportFrame discards the bits.
+func (c NopClient) ImportFrame(frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportFrameWithContext(context.Background(), frame, bitIterator, batchSize, options...)
+}
+
+// ImportFrameWithContext reads and discards the bits.
+// It returns the error of the iterator, if any.
+func (NopClient) ImportFrameWithContext(ctx context.Context, frame *Frame, bitIterator BitIterator, batchSize uint, options ...interface{}) error {
+	for {
+		if _, err := bitIterator.NextBit(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ImportValueFrame discards the values.
+func (c NopClient) ImportValueFrame(frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportValueFrameWithContext(context.Background(), frame, field, valueIterator, batchSize, options...)
+}
+
+// ImportValueFrameWithContext reads and discards the values.
+// It returns the error of the iterator, if any.
+func (NopClient) ImportValueFrameWithContext(ctx context.Context, frame *Frame, field string, valueIterator ValueIterator, batchSize uint, options ...interface{}) error {
+	for {
+		if _, err := valueIterator.NextValue(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ExportFrame returns an iterator without any bits.
+func (NopClient) ExportFrame(frame *Frame, view string) (BitIterator, error) {
+	return NewSliceBitIterator(nil), nil
+}
+
+// ExportFrameWithContext returns an iterator without any bits.
+func (NopClient) ExportFrameWithContext(ctx context.Context, frame *Frame, view string) (BitIterator, error) {
+	return NewSliceBitIterator(nil), nil
+}
+
+// Views returns no views.
+func (NopClient) Views(frame *Frame) ([]string, error) { return []string{}, nil }
+
+// ViewsWithContext returns no views.
+func (NopClient) ViewsWithContext(ctx context.Context, frame *Frame) ([]string, error) {
+	return []string{}, nil
+}
+
+// DeleteView does nothing.
+func (NopClient) DeleteView(frame *Frame, view string) error { return nil }
+
+// DeleteViewWithContext does nothing.
+func (NopClient) DeleteViewWithContext(ctx context.Context, frame *Frame, view string) error {
+	return nil
+}
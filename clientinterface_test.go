@@ -0,0 +1,81 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNopClientQuery(t *testing.T) {
+	var client ClientInterface = NopClient{}
+	response, err := client.Query(sampleIndex.BatchQuery(
+		sampleFrame.SetBit(1, 100),
+		sampleIndex.Count(sampleFrame.Bitmap(1)),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Results()) != 2 {
+		t.Fatalf("2 results should be returned: %v", response.Results())
+	}
+	if response.Results()[0].Kind != ResultKindChanged || response.Results()[1].Kind != ResultKindCount {
+		t.Fatalf("unexpected result kinds: %s, %s", response.Results()[0].Kind, response.Results()[1].Kind)
+	}
+	if _, err := client.Query(sampleIndex.RawQuery("Unknown()")); err == nil {
+		t.Fatal("invalid query should fail")
+	}
+}
+
+func TestNopClientImport(t *testing.T) {
+	client := NopClient{}
+	iterator := NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 10}, {RowID: 2, ColumnID: 20}})
+	if err := client.ImportFrame(sampleFrame, iterator, 10); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := iterator.NextBit(); err == nil {
+		t.Fatal("all bits should be read")
+	}
+	failing := &failingBitIterator{errors.New("read failed")}
+	if err := client.ImportFrame(sampleFrame, failing, 10); err == nil {
+		t.Fatal("iterator error should be returned")
+	}
+}
+
+type failingBitIterator struct {
+	err error
+}
+
+func (it *failingBitIterator) NextBit() (Bit, error) {
+	return Bit{}, it.err
+}
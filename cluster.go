@@ -33,91 +33,477 @@
 package pilosa
 
 import (
+	"context"
 	"sync"
+	"time"
 )
 
+const defaultHostWeight = 1
+
 // Cluster contains hosts in a Pilosa cluster.
+// Each host has a circuit breaker which opens after consecutive failures,
+// so requests are not routed to the host until the cooldown is over.
+// After the cooldown, a single request is routed to the host to probe it.
+//
+// The state of the breakers is kept in the cluster, while their threshold and cooldown
+// are set by each client, see the CircuitBreaker option.
+//
+// A Cluster is safe for concurrent use by multiple goroutines,
+// so it can be shared by clients.
 type Cluster struct {
-	hosts       []*URI
-	okList      []bool
-	mutex       *sync.RWMutex
-	lastHostIdx int
+	hosts     []*URI
+	breakers  []*hostBreaker
+	weights   []int
+	mutex     *sync.RWMutex
+	strategy  Strategy
+	now       func() time.Time
+	resolver  Resolver
+	observers []ClusterObserver
+	// events are recorded while the mutex is held, see unlock
+	events []clusterEvent
 }
 
 // DefaultCluster returns the default Cluster.
 func DefaultCluster() *Cluster {
 	return &Cluster{
-		hosts:  make([]*URI, 0),
-		okList: make([]bool, 0),
-		mutex:  &sync.RWMutex{},
+		hosts:    make([]*URI, 0),
+		breakers: make([]*hostBreaker, 0),
+		weights:  make([]int, 0),
+		mutex:    &sync.RWMutex{},
+		strategy: NewRoundRobinStrategy(),
+		now:      time.Now,
 	}
 }
 
 // NewClusterWithHost returns a cluster with the given URIs.
 func NewClusterWithHost(hosts ...*URI) *Cluster {
+	return NewClusterWithStrategy(NewRoundRobinStrategy(), hosts...)
+}
+
+// NewClusterWithStrategy returns a cluster with the given URIs,
+// which uses the given strategy to select hosts.
+func NewClusterWithStrategy(strategy Strategy, hosts ...*URI) *Cluster {
 	cluster := DefaultCluster()
+	cluster.strategy = strategy
 	for _, host := range hosts {
 		cluster.AddHost(host)
 	}
 	return cluster
 }
 
-// AddHost adds a host to the cluster.
+// NewClusterWithResolver returns a cluster with the hosts returned by the given resolver.
+// Call Refresh on the cluster, or Client.StartClusterRefresh, to update them.
+func NewClusterWithResolver(ctx context.Context, resolver Resolver) (*Cluster, error) {
+	cluster := DefaultCluster()
+	cluster.resolver = resolver
+	if err := cluster.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return cluster, nil
+}
+
+// NewClusterWithDNS returns a cluster with the hosts resolved by the given DNS resolver.
+func NewClusterWithDNS(ctx context.Context, resolver *DNSResolver) (*Cluster, error) {
+	return NewClusterWithResolver(ctx, resolver)
+}
+
+// Refresh gets the hosts from the resolver of a cluster created with NewClusterWithResolver
+// and replaces the hosts in the cluster with them.
+// The hosts are kept if the resolver does not return any hosts.
+// It does nothing for other clusters.
+func (c *Cluster) Refresh(ctx context.Context) error {
+	if c.resolver == nil {
+		return nil
+	}
+	resolved, err := c.resolver.Hosts(ctx)
+	if err != nil {
+		return err
+	}
+	if len(resolved) == 0 {
+		return nil
+	}
+	hosts := make([]*URI, 0, len(resolved))
+	for i := range resolved {
+		hosts = append(hosts, &resolved[i])
+	}
+	c.syncHosts(hosts)
+	return nil
+}
+
+// AddHost adds a host to the cluster with the default weight of 1.
+// Adding a host which is already in the cluster has no effect.
 func (c *Cluster) AddHost(address *URI) {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	defer c.unlock()
+	if c.hostIndex(address) >= 0 {
+		return
+	}
+	c.addHost(address, defaultHostWeight)
+}
+
+// AddHostWithWeight adds a host to the cluster with the given weight,
+// or sets the weight of the host if it is already in the cluster.
+// Strategies which support weights, such as the round robin strategy,
+// select a host with weight 2 twice as often as a host with weight 1.
+// A host with weight 0 is selected only if no host with a positive weight is available.
+func (c *Cluster) AddHostWithWeight(address *URI, weight int) {
+	if weight < 0 {
+		weight = 0
+	}
+	c.mutex.Lock()
+	defer c.unlock()
+	if i := c.hostIndex(address); i >= 0 {
+		c.weights[i] = weight
+		return
+	}
+	c.addHost(address, weight)
+}
+
+// addHost appends the host to the cluster.
+// The mutex must be held by the caller.
+func (c *Cluster) addHost(address *URI, weight int) {
 	c.hosts = append(c.hosts, address)
-	c.okList = append(c.okList, true)
+	c.breakers = append(c.breakers, &hostBreaker{})
+	c.weights = append(c.weights, weight)
+	c.record(eventHostAdded, address, "")
 }
 
-// Host returns a host in the cluster.
+// Host returns a host in the cluster, using the default breaker threshold and cooldown.
+// It does not change the state of the breakers, e.g., it does not count as the probe of a half-open host.
 func (c *Cluster) Host() *URI {
+	return c.selectHostFor("", defaultBreakerSettings, false, nil)
+}
+
+// hostFor returns a host in the cluster for a request about the given index,
+// selected by the strategy of the cluster among the healthy hosts whose breaker is not open.
+// If all hosts failed their health check, unhealthy hosts are selected as well.
+// The excluded hosts are selected only if there are no other candidates.
+func (c *Cluster) hostFor(key string, settings breakerSettings, exclude ...*URI) *URI {
+	return c.selectHostFor(key, settings, true, exclude)
+}
+
+// selectHostFor returns a host like hostFor.
+// If route is set, the host is selected for a request, so a half-open host is probed,
+// and the breakers are closed if no host is available.
+func (c *Cluster) selectHostFor(key string, settings breakerSettings, route bool, exclude []*URI) *URI {
 	c.mutex.Lock()
-	var host *URI
-	for i := range c.okList {
-		idx := (i + c.lastHostIdx) % len(c.okList)
-		ok := c.okList[idx]
-		if ok {
-			host = c.hosts[idx]
-			break
+	defer c.unlock()
+	now := c.now()
+	candidates := c.candidates(now, false, settings)
+	if len(candidates) == 0 {
+		candidates = c.candidates(now, true, settings)
+	}
+	if len(exclude) > 0 {
+		candidates = c.excluding(candidates, exclude)
+	}
+	if len(candidates) == 0 {
+		if route {
+			c.reset()
 		}
+		return nil
 	}
-	c.lastHostIdx++
-	c.mutex.Unlock()
-	if host != nil {
-		return host
+	hosts := make([]*URI, 0, len(candidates))
+	weights := make([]int, 0, len(candidates))
+	for _, i := range candidates {
+		hosts = append(hosts, c.hosts[i])
+		weights = append(weights, c.weights[i])
+	}
+	idx := c.selectHost(hosts, weights, key)
+	if breaker := c.breakers[candidates[idx]]; route && breaker.state(now, settings) == BreakerHalfOpen {
+		breaker.probed(now)
+	}
+	c.record(eventRequestRouted, hosts[idx], key)
+	return hosts[idx]
+}
+
+// selectHost selects one of the hosts using the strategy of the cluster.
+// Weights are passed to the strategy only if it supports them and they are not all the same.
+func (c *Cluster) selectHost(hosts []*URI, weights []int, key string) int {
+	if weighted, ok := c.strategy.(WeightedStrategy); ok {
+		for _, weight := range weights {
+			if weight != weights[0] {
+				return weighted.SelectWeighted(hosts, weights, key)
+			}
+		}
+	}
+	return c.strategy.Select(hosts, key)
+}
+
+// candidates returns the positions of the hosts whose breaker is not open.
+// Unhealthy hosts are included only if includeUnhealthy is true.
+// Hosts with weight 0 are included only if there are no other candidates.
+// The mutex must be held by the caller.
+func (c *Cluster) candidates(now time.Time, includeUnhealthy bool, settings breakerSettings) []int {
+	positions := make([]int, 0, len(c.hosts))
+	backups := make([]int, 0)
+	for i, breaker := range c.breakers {
+		if breaker.unhealthy && !includeUnhealthy {
+			continue
+		}
+		if breaker.state(now, settings) == BreakerOpen {
+			continue
+		}
+		if c.weights[i] == 0 {
+			backups = append(backups, i)
+		} else {
+			positions = append(positions, i)
+		}
+	}
+	if len(positions) == 0 {
+		return backups
+	}
+	return positions
+}
+
+// excluding returns the candidates which are not excluded, or all candidates if all of them are excluded.
+// The mutex must be held by the caller.
+func (c *Cluster) excluding(candidates []int, exclude []*URI) []int {
+	kept := make([]int, 0, len(candidates))
+	for _, i := range candidates {
+		excluded := false
+		for _, host := range exclude {
+			if c.hosts[i].Equals(host) {
+				excluded = true
+				break
+			}
+		}
+		if !excluded {
+			kept = append(kept, i)
+		}
 	}
-	c.reset()
-	return host
+	if len(kept) == 0 {
+		return candidates
+	}
+	return kept
 }
 
-// RemoveHost black lists the host with the given URI from the cluster.
+// RemoveHost removes the host with the given URI from the cluster.
 func (c *Cluster) RemoveHost(address *URI) {
+	c.mutex.Lock()
+	defer c.unlock()
+	i := c.hostIndex(address)
+	if i < 0 {
+		return
+	}
+	c.record(eventHostRemoved, c.hosts[i], "")
+	c.hosts = append(c.hosts[:i], c.hosts[i+1:]...)
+	c.breakers = append(c.breakers[:i], c.breakers[i+1:]...)
+	c.weights = append(c.weights[:i], c.weights[i+1:]...)
+}
+
+// syncHosts adds the given hosts which are not in the cluster
+// and removes the hosts in the cluster which are not given.
+// The state of the hosts which are kept is preserved.
+func (c *Cluster) syncHosts(hosts []*URI) {
+	c.mutex.Lock()
+	defer c.unlock()
+	keptHosts := make([]*URI, 0, len(hosts))
+	keptBreakers := make([]*hostBreaker, 0, len(hosts))
+	keptWeights := make([]int, 0, len(hosts))
+	for _, host := range hosts {
+		if i := c.hostIndex(host); i >= 0 {
+			keptHosts = append(keptHosts, c.hosts[i])
+			keptBreakers = append(keptBreakers, c.breakers[i])
+			keptWeights = append(keptWeights, c.weights[i])
+			continue
+		}
+		duplicate := false
+		for _, kept := range keptHosts {
+			if kept.Equals(host) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			keptHosts = append(keptHosts, host)
+			keptBreakers = append(keptBreakers, &hostBreaker{})
+			keptWeights = append(keptWeights, defaultHostWeight)
+			c.record(eventHostAdded, host, "")
+		}
+	}
+	for _, host := range c.hosts {
+		kept := false
+		for _, keptHost := range keptHosts {
+			if keptHost == host {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			c.record(eventHostRemoved, host, "")
+		}
+	}
+	c.hosts = keptHosts
+	c.breakers = keptBreakers
+	c.weights = keptWeights
+}
+
+// hostFailed records a failure of the host with the given URI.
+// The breaker of the host opens once it fails often enough.
+func (c *Cluster) hostFailed(address *URI, settings breakerSettings) {
+	c.mutex.Lock()
+	defer c.unlock()
+	if i := c.hostIndex(address); i >= 0 {
+		breaker := c.breakers[i]
+		breaker.failed(c.now())
+		if breaker.failures == settings.threshold {
+			c.record(eventHostDown, c.hosts[i], "")
+		}
+	}
+}
+
+// RegisterObserver registers an observer which is notified about the changes in the cluster.
+func (c *Cluster) RegisterObserver(observer ClusterObserver) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	// copy on write, so unlock can notify the observers without holding the mutex
+	observers := make([]ClusterObserver, len(c.observers), len(c.observers)+1)
+	copy(observers, c.observers)
+	c.observers = append(observers, observer)
+}
+
+// record records an event for the observers, if there are any.
+// The mutex must be held by the caller.
+func (c *Cluster) record(kind clusterEventKind, host *URI, index string) {
+	if len(c.observers) > 0 {
+		c.events = append(c.events, clusterEvent{kind: kind, host: host, index: index})
+	}
+}
+
+// unlock unlocks the mutex, then sends the recorded events to the observers.
+func (c *Cluster) unlock() {
+	events := c.events
+	observers := c.observers
+	c.events = nil
+	c.mutex.Unlock()
+	for _, event := range events {
+		for _, observer := range observers {
+			event.notify(observer)
+		}
+	}
+}
+
+// hostIndex returns the index of the host with the given URI, or -1 if it is not in the cluster.
+// The mutex must be held by the caller.
+func (c *Cluster) hostIndex(address *URI) int {
 	for i, uri := range c.hosts {
 		if uri.Equals(address) {
-			c.okList[i] = false
-			break
+			return i
+		}
+	}
+	return -1
+}
+
+// HostStatus returns the circuit breaker status of all hosts in the cluster,
+// using the default breaker threshold and cooldown.
+// Use Client.HostStatus to get the status using the breaker settings of a client.
+func (c *Cluster) HostStatus() []HostStatus {
+	return c.hostStatus(defaultBreakerSettings)
+}
+
+func (c *Cluster) hostStatus(settings breakerSettings) []HostStatus {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	now := c.now()
+	statuses := make([]HostStatus, 0, len(c.hosts))
+	for i, host := range c.hosts {
+		breaker := c.breakers[i]
+		status := HostStatus{
+			URI:      *host,
+			State:    breaker.state(now, settings),
+			Failures: breaker.failures,
+			Healthy:  !breaker.unhealthy,
+			Weight:   c.weights[i],
+		}
+		if status.State != BreakerClosed {
+			status.OpenedAt = breaker.openedAt()
 		}
+		statuses = append(statuses, status)
 	}
+	return statuses
 }
 
 // Hosts returns all available hosts in the cluster.
+// Hosts which failed their last health check, or whose breaker is open, are not available.
 func (c *Cluster) Hosts() []URI {
+	return c.availableHosts(defaultBreakerSettings)
+}
+
+func (c *Cluster) availableHosts(settings breakerSettings) []URI {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	now := c.now()
 	hosts := make([]URI, 0, len(c.hosts))
 	for i, host := range c.hosts {
-		if c.okList[i] {
+		breaker := c.breakers[i]
+		if !breaker.unhealthy && breaker.state(now, settings) != BreakerOpen {
 			hosts = append(hosts, *host)
 		}
 	}
 	return hosts
 }
 
-func (c *Cluster) reset() {
+// allHosts returns all hosts in the cluster, including unavailable ones.
+func (c *Cluster) allHosts() []*URI {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	hosts := make([]*URI, len(c.hosts))
+	copy(hosts, c.hosts)
+	return hosts
+}
+
+// setHealthy records the result of a health check of the host with the given URI.
+// Unhealthy hosts are removed from rotation. A host which recovers is put back
+// with its breaker closed. Returns true if the health of the host changed.
+func (c *Cluster) setHealthy(address *URI, healthy bool) bool {
 	c.mutex.Lock()
-	defer c.mutex.Unlock()
-	for i := range c.okList {
-		c.okList[i] = true
+	defer c.unlock()
+	i := c.hostIndex(address)
+	if i < 0 {
+		return false
+	}
+	breaker := c.breakers[i]
+	if breaker.unhealthy != healthy {
+		return false
+	}
+	breaker.unhealthy = !healthy
+	if healthy {
+		breaker.succeeded()
+		c.record(eventHostUp, c.hosts[i], "")
+	} else {
+		c.record(eventHostDown, c.hosts[i], "")
+	}
+	return true
+}
+
+func (c *Cluster) hostSucceeded(address *URI, settings breakerSettings) {
+	c.mutex.Lock()
+	defer c.unlock()
+	if i := c.hostIndex(address); i >= 0 {
+		breaker := c.breakers[i]
+		if breaker.failures >= settings.threshold {
+			c.record(eventHostUp, c.hosts[i], "")
+		}
+		breaker.succeeded()
+	}
+}
+
+func (c *Cluster) requestStarted(host *URI) {
+	if tracker, ok := c.strategy.(RequestTracker); ok {
+		tracker.RequestStarted(host)
+	}
+}
+
+func (c *Cluster) requestFinished(host *URI) {
+	if tracker, ok := c.strategy.(RequestTracker); ok {
+		tracker.RequestFinished(host)
+	}
+}
+
+// reset closes the breakers of all hosts.
+// The mutex must be held by the caller.
+func (c *Cluster) reset() {
+	for _, breaker := range c.breakers {
+		breaker.succeeded()
 	}
 }
@@ -32,7 +32,12 @@
 
 package pilosa
 
-import "testing"
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
 
 func TestNewClusterWithHost(t *testing.T) {
 	c := NewClusterWithHost(DefaultURI())
@@ -92,3 +97,181 @@ func TestRemoveHost(t *testing.T) {
 		t.Fatalf("The cluster should not contain the host")
 	}
 }
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2017, time.December, 1, 0, 0, 0, 0, time.UTC)
+	uri1 := URIFromAddress("index1.pilosa.com:10101")
+	uri2 := URIFromAddress("index2.pilosa.com:10101")
+	c := NewClusterWithHost(uri1, uri2)
+	settings := breakerSettings{threshold: 2, cooldown: time.Minute}
+	c.now = func() time.Time { return now }
+
+	c.hostFailed(uri1, settings)
+	if state := c.hostStatus(settings)[0].State; state != BreakerClosed {
+		t.Fatalf("breaker should be closed before reaching the threshold, got %s", state)
+	}
+	c.hostFailed(uri1, settings)
+	status := c.hostStatus(settings)[0]
+	if status.State != BreakerOpen || status.Failures != 2 || !status.OpenedAt.Equal(now) {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	for i := 0; i < 4; i++ {
+		if !c.hostFor("", settings).Equals(uri2) {
+			t.Fatalf("should not route to a host with an open breaker")
+		}
+	}
+
+	// after the cooldown, a single request probes the host
+	now = now.Add(time.Minute)
+	if state := c.hostStatus(settings)[0].State; state != BreakerHalfOpen {
+		t.Fatalf("breaker should be half-open after the cooldown, got %s", state)
+	}
+	probes := 0
+	for i := 0; i < 4; i++ {
+		if c.hostFor("", settings).Equals(uri1) {
+			probes++
+		}
+	}
+	if probes != 1 {
+		t.Fatalf("1 probe expected, got %d", probes)
+	}
+
+	c.hostSucceeded(uri1, settings)
+	status = c.hostStatus(settings)[0]
+	if status.State != BreakerClosed || status.Failures != 0 {
+		t.Fatalf("breaker should be closed after a success: %v", status)
+	}
+}
+
+func TestCircuitBreakerSettingsPerClient(t *testing.T) {
+	uri := URIFromAddress("index1.pilosa.com:10101")
+	cluster := NewClusterWithHost(uri)
+	client1, err := NewClient(cluster, CircuitBreaker(3, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client2, err := NewClient(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.hostFailed(uri, client2.breaker)
+	if state := client1.HostStatus()[0].State; state != BreakerClosed {
+		t.Fatalf("the breaker should be closed for the client with a higher threshold, got %s", state)
+	}
+	if state := client2.HostStatus()[0].State; state != BreakerOpen {
+		t.Fatalf("the breaker should be open for the client with the default threshold, got %s", state)
+	}
+	if client1.breaker.threshold != 3 || client1.breaker.cooldown != time.Minute {
+		t.Fatalf("creating another client should not change the breaker settings: %v", client1.breaker)
+	}
+}
+
+func TestCircuitBreakerFailuresOfOtherClients(t *testing.T) {
+	now := time.Date(2017, time.December, 1, 0, 0, 0, 0, time.UTC)
+	uri := URIFromAddress("index1.pilosa.com:10101")
+	c := NewClusterWithHost(uri)
+	c.now = func() time.Time { return now }
+	lenient := breakerSettings{threshold: 3, cooldown: time.Second}
+	strict := breakerSettings{threshold: 1, cooldown: time.Minute}
+
+	// the failure is recorded by a client with a higher threshold
+	c.hostFailed(uri, lenient)
+	if state := c.hostStatus(lenient)[0].State; state != BreakerClosed {
+		t.Fatalf("breaker should be closed below the threshold, got %s", state)
+	}
+	status := c.hostStatus(strict)[0]
+	if status.State != BreakerOpen || !status.OpenedAt.Equal(now) {
+		t.Fatalf("breaker should be open for the client with a lower threshold: %v", status)
+	}
+
+	// Host does not probe the host, so the cooldown is not restarted
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if !c.Host().Equals(uri) {
+			t.Fatalf("the half-open host should be returned")
+		}
+	}
+	if state := c.hostStatus(strict)[0].State; state != BreakerHalfOpen {
+		t.Fatalf("breaker should still be half-open, got %s", state)
+	}
+	if !c.hostFor("", strict).Equals(uri) {
+		t.Fatalf("the half-open host should be probed")
+	}
+	if state := c.hostStatus(strict)[0].State; state != BreakerOpen {
+		t.Fatalf("breaker should be open while the host is probed, got %s", state)
+	}
+}
+
+func TestBreakerStateString(t *testing.T) {
+	targets := map[BreakerState]string{
+		BreakerClosed:    "closed",
+		BreakerOpen:      "open",
+		BreakerHalfOpen:  "half-open",
+		BreakerState(42): "unknown",
+	}
+	for state, target := range targets {
+		if state.String() != target {
+			t.Fatalf("%s != %s", target, state.String())
+		}
+	}
+}
+
+func TestAddHostIsIdempotent(t *testing.T) {
+	c := NewClusterWithHost(URIFromAddress("index1.pilosa.com:10101"))
+	c.AddHost(URIFromAddress("index1.pilosa.com:10101"))
+	if len(c.hosts) != 1 {
+		t.Fatalf("the host should be added once, got %d hosts", len(c.hosts))
+	}
+}
+
+func TestRemoveHostKeepsRotation(t *testing.T) {
+	uri1 := URIFromAddress("index1.pilosa.com:10101")
+	uri2 := URIFromAddress("index2.pilosa.com:10101")
+	uri3 := URIFromAddress("index3.pilosa.com:10101")
+	c := NewClusterWithHost(uri1, uri2, uri3)
+	if !c.Host().Equals(uri1) || !c.Host().Equals(uri2) {
+		t.Fatalf("hosts should be returned in order")
+	}
+	// the next host is uri3, removing a host before it should not change that
+	c.RemoveHost(uri1)
+	if !c.Host().Equals(uri3) {
+		t.Fatalf("the next host should be kept after removing a host")
+	}
+	if !c.Host().Equals(uri2) {
+		t.Fatalf("the rotation should continue with the remaining hosts")
+	}
+	c.RemoveHost(uri3)
+	c.RemoveHost(URIFromAddress("unknown.pilosa.com:10101"))
+	if !c.Host().Equals(uri2) || !c.Host().Equals(uri2) {
+		t.Fatalf("the remaining host should be returned")
+	}
+	c.RemoveHost(uri2)
+	if c.Host() != nil {
+		t.Fatalf("an empty cluster should not return a host")
+	}
+}
+
+func TestClusterConcurrentUse(t *testing.T) {
+	c := DefaultCluster()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uri := URIFromAddress(fmt.Sprintf("index1.pilosa.com:%d", 10000+i))
+			for j := 0; j < 100; j++ {
+				c.AddHost(uri)
+				if host := c.Host(); host != nil {
+					c.hostFailed(host, defaultBreakerSettings)
+				}
+				c.Hosts()
+				c.HostStatus()
+				c.RemoveHost(uri)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(c.Hosts()) != 0 {
+		t.Fatalf("all hosts should be removed")
+	}
+}
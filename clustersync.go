@@ -0,0 +1,84 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"time"
+)
+
+// ClusterSync periodically updates the hosts in the cluster of a client.
+// See Client.StartClusterSync and Client.StartClusterRefresh.
+type ClusterSync struct {
+	syncFn func(ctx context.Context) error
+	task   *periodicTask
+	onErr  func(err error)
+}
+
+// StartClusterSync starts syncing the cluster with the server every interval.
+// onErr is called when syncing fails, it may be nil. The cluster is left unchanged in that case.
+// Call Stop on the returned value to stop syncing.
+func (c *Client) StartClusterSync(interval time.Duration, onErr func(err error)) (*ClusterSync, error) {
+	return startClusterSync(interval, c.SyncClusterWithContext, onErr)
+}
+
+// StartClusterRefresh starts updating the hosts of a cluster created with NewClusterWithResolver
+// every interval. onErr is called when the resolver fails, it may be nil.
+// Call Stop on the returned value to stop updating.
+func (c *Client) StartClusterRefresh(interval time.Duration, onErr func(err error)) (*ClusterSync, error) {
+	return startClusterSync(interval, c.cluster.Refresh, onErr)
+}
+
+func startClusterSync(interval time.Duration, syncFn func(ctx context.Context) error, onErr func(err error)) (*ClusterSync, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidClusterSyncInterval
+	}
+	clusterSync := &ClusterSync{
+		syncFn: syncFn,
+		onErr:  onErr,
+	}
+	clusterSync.task = startPeriodicTask(interval, clusterSync.sync)
+	return clusterSync, nil
+}
+
+// Stop stops syncing the cluster and waits for the running sync to finish.
+func (s *ClusterSync) Stop() {
+	s.task.Stop()
+}
+
+func (s *ClusterSync) sync(ctx context.Context) {
+	err := s.syncFn(ctx)
+	if err != nil && ctx.Err() == nil && s.onErr != nil {
+		s.onErr(err)
+	}
+}
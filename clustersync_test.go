@@ -0,0 +1,120 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func newStatusTransport(status string) roundTripperFunc {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(status))),
+		}, nil
+	})
+}
+
+func TestSyncCluster(t *testing.T) {
+	status := `{"status":{"Nodes":[
+		{"Scheme":"http","Host":"seed:10101"},
+		{"Scheme":"https","Host":"node2:10101"},
+		{"Scheme":"http","Host":"node3:10101"}]}}`
+	client, err := NewClient([]string{"seed:10101", "old:10101"}, HTTPTransport(newStatusTransport(status)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.cluster.hostFailed(URIFromAddress("seed:10101"), defaultBreakerSettings)
+	if err = client.SyncCluster(); err != nil {
+		t.Fatal(err)
+	}
+	statuses := client.cluster.HostStatus()
+	target := []string{"http://seed:10101", "https://node2:10101", "http://node3:10101"}
+	if len(statuses) != len(target) {
+		t.Fatalf("%v != %v", statuses, target)
+	}
+	for i, s := range statuses {
+		if s.URI.Normalize() != target[i] {
+			t.Fatalf("%d: %s != %s", i, s.URI.Normalize(), target[i])
+		}
+	}
+	if statuses[0].Failures != 1 {
+		t.Fatalf("the state of existing hosts should be kept")
+	}
+}
+
+func TestSyncClusterKeepsHostsWithoutNodes(t *testing.T) {
+	client, err := NewClient("seed:10101", HTTPTransport(newStatusTransport(`{"status":{"Nodes":[]}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.SyncCluster(); err != nil {
+		t.Fatal(err)
+	}
+	if hosts := client.cluster.Hosts(); len(hosts) != 1 {
+		t.Fatalf("the hosts should be kept if the server reports no nodes")
+	}
+}
+
+func TestStartClusterSync(t *testing.T) {
+	client, err := NewClient("seed:10101", HTTPTransport(newStatusTransport("not json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.StartClusterSync(0, nil); err != ErrInvalidClusterSyncInterval {
+		t.Fatalf("should fail with an invalid interval")
+	}
+	errs := make(chan error, 1)
+	clusterSync, err := client.StartClusterSync(time.Millisecond, func(err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clusterSync.Stop()
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatalf("the error callback was not called")
+	}
+	if hosts := client.cluster.Hosts(); len(hosts) != 1 || hosts[0].HostPort() != "seed:10101" {
+		t.Fatalf("the cluster should not change if syncing fails")
+	}
+}
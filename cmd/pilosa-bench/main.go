@@ -0,0 +1,119 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Command pilosa-bench runs a benchmark against a Pilosa cluster and prints the latency percentiles of each operation.
+//
+//	pilosa-bench -addr localhost:10101 -duration 1m -concurrency 16 -mix SetBit=1,Bitmap=4,TopN=1
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/go-pilosa/bench"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:10101", "address of the Pilosa server")
+	indexName := flag.String("index", "bench", "index the traffic is sent to")
+	frameName := flag.String("frame", "bench", "frame the traffic is sent to")
+	create := flag.Bool("create", true, "create the index and the frame if they do not exist")
+	duration := flag.Duration("duration", 10*time.Second, "how long the benchmark runs, or 0 to run until -requests operations are done")
+	requests := flag.Int("requests", 0, "number of operations, or 0 for no limit")
+	concurrency := flag.Int("concurrency", 1, "number of goroutines sending requests")
+	mix := flag.String("mix", "SetBit=1,Bitmap=1,TopN=1", "relative weights of the SetBit, Bitmap, TopN and Import operations")
+	rows := flag.Uint64("rows", 1000, "number of rows the random row IDs are picked from")
+	columns := flag.Uint64("columns", 1000000, "number of columns the random column IDs are picked from")
+	topN := flag.Uint64("topn", 10, "number of rows returned by TopN queries")
+	importBatch := flag.Uint("import-batch", 1000, "number of bits imported by an import operation")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random IDs")
+	flag.Parse()
+
+	if err := run(*addr, *indexName, *frameName, *create, *duration, *requests, *concurrency, *mix, *rows, *columns, *topN, *importBatch, *seed); err != nil {
+		fmt.Fprintln(os.Stderr, "pilosa-bench:", err)
+		os.Exit(1)
+	}
+}
+
+func run(addr string, indexName string, frameName string, create bool, duration time.Duration, requests int, concurrency int,
+	mixString string, rows uint64, columns uint64, topN uint64, importBatch uint, seed int64) error {
+	mix, err := bench.ParseMix(mixString)
+	if err != nil {
+		return err
+	}
+	client, err := pilosa.NewClient(addr)
+	if err != nil {
+		return err
+	}
+	index, err := pilosa.NewIndex(indexName, nil)
+	if err != nil {
+		return err
+	}
+	frame, err := index.Frame(frameName, nil)
+	if err != nil {
+		return err
+	}
+	if create {
+		if err := client.EnsureIndex(index); err != nil {
+			return err
+		}
+		if err := client.EnsureFrame(frame); err != nil {
+			return err
+		}
+	}
+	options := []bench.Option{
+		bench.Concurrency(concurrency),
+		bench.Mix(mix),
+		bench.IDRange(rows, columns),
+		bench.TopN(topN),
+		bench.ImportBatchSize(importBatch),
+		bench.Seed(seed),
+	}
+	if duration > 0 {
+		options = append(options, bench.Duration(duration))
+	}
+	if requests > 0 {
+		options = append(options, bench.Requests(requests))
+	}
+	report, err := bench.Run(context.Background(), client, frame, options...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(report)
+	if report.Total.LastError != nil {
+		fmt.Println("last error:", report.Total.LastError)
+	}
+	return nil
+}
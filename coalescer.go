@@ -0,0 +1,295 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCoalesceMaxDelay = 10 * time.Millisecond
+	defaultCoalesceMaxBits  = 1000
+)
+
+// CoalesceOptions contains options to customize a write coalescer.
+type CoalesceOptions struct {
+	// MaxDelay is the maximum time a bit is buffered before it is written.
+	MaxDelay time.Duration
+	// MaxBits is the number of buffered bits after which they are written without waiting for MaxDelay.
+	MaxBits int
+	// Import enables writing the bits with an import instead of a batch query of SetBit calls.
+	Import bool
+	// OnError is called when writing a batch of bits fails, with the error and the bits of the batch.
+	// It is called in its own goroutine, so it may call SetBit, e.g., to retry the bits later,
+	// and it may be called concurrently for different batches.
+	// Flush and Close wait for it, so it must not call them.
+	OnError func(err error, bits []Bit)
+}
+
+func (co *CoalesceOptions) addOptions(options ...CoalesceOption) error {
+	for _, option := range options {
+		err := option(co)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CoalesceOption is used when starting a write coalescer.
+type CoalesceOption func(options *CoalesceOptions) error
+
+// CoalesceMaxDelay sets the maximum time a bit is buffered before it is written.
+func CoalesceMaxDelay(delay time.Duration) CoalesceOption {
+	return func(options *CoalesceOptions) error {
+		if delay <= 0 {
+			return ErrInvalidCoalesceOption
+		}
+		options.MaxDelay = delay
+		return nil
+	}
+}
+
+// CoalesceMaxBits sets the number of buffered bits after which they are written without waiting.
+func CoalesceMaxBits(n int) CoalesceOption {
+	return func(options *CoalesceOptions) error {
+		if n <= 0 {
+			return ErrInvalidCoalesceOption
+		}
+		options.MaxBits = n
+		return nil
+	}
+}
+
+// CoalesceWithImport enables writing the bits with an import instead of a batch query.
+// Imports are more efficient for large batches, but they are not atomic and don't report which bits changed.
+func CoalesceWithImport(enable bool) CoalesceOption {
+	return func(options *CoalesceOptions) error {
+		options.Import = enable
+		return nil
+	}
+}
+
+// CoalesceOnError sets the function which is called when writing a batch of bits fails.
+// The function is called in its own goroutine, and it must not call Flush or Close.
+func CoalesceOnError(fn func(err error, bits []Bit)) CoalesceOption {
+	return func(options *CoalesceOptions) error {
+		options.OnError = fn
+		return nil
+	}
+}
+
+// WriteCoalescer buffers the bits set with SetBit and writes them together,
+// once MaxBits bits are buffered or the oldest one was buffered for MaxDelay,
+// turning many small writes into a few batches.
+// Batches are written one at a time, in order, while the next one is buffered.
+// SetBit waits if a batch is being written and another one is full.
+// It is safe to use a WriteCoalescer from several goroutines. Call Close when done.
+type WriteCoalescer struct {
+	client  *Client
+	ctx     context.Context
+	frame   *Frame
+	options *CoalesceOptions
+	mutex   *sync.Mutex
+	bits    []Bit
+	timer   *time.Timer
+	// generation is incremented when the buffered bits are sent, so a stale timer does not send the next batch
+	generation uint64
+	batches    chan coalescedBatch
+	done       chan struct{}
+	closed     bool
+}
+
+// coalescedBatch is a batch of bits to write.
+// If flushed is set, the error of the batches written since the previous flush is sent to it.
+type coalescedBatch struct {
+	bits    []Bit
+	flushed chan error
+}
+
+// StartWriteCoalescer starts a write coalescer for a frame, to which bits are added with SetBit.
+func (c *Client) StartWriteCoalescer(frame *Frame, options ...CoalesceOption) (*WriteCoalescer, error) {
+	return c.StartWriteCoalescerWithContext(context.Background(), frame, options...)
+}
+
+// StartWriteCoalescerWithContext starts a write coalescer for a frame.
+// The context is used for all of the requests of the coalescer.
+func (c *Client) StartWriteCoalescerWithContext(ctx context.Context, frame *Frame, options ...CoalesceOption) (*WriteCoalescer, error) {
+	coalesceOptions := &CoalesceOptions{
+		MaxDelay: defaultCoalesceMaxDelay,
+		MaxBits:  defaultCoalesceMaxBits,
+	}
+	if err := coalesceOptions.addOptions(options...); err != nil {
+		return nil, err
+	}
+	w := &WriteCoalescer{
+		client:  c,
+		ctx:     ctx,
+		frame:   frame,
+		options: coalesceOptions,
+		mutex:   &sync.Mutex{},
+		batches: make(chan coalescedBatch, 1),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// SetBit buffers a bit to be set. It returns ErrCoalescerClosed if the coalescer is closed.
+// Errors of writing the bits are passed to the OnError function, and returned by Flush and Close.
+func (w *WriteCoalescer) SetBit(rowID uint64, columnID uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return ErrCoalescerClosed
+	}
+	w.bits = append(w.bits, Bit{RowID: rowID, ColumnID: columnID})
+	if len(w.bits) >= w.options.MaxBits {
+		w.send(nil)
+	} else if len(w.bits) == 1 {
+		generation := w.generation
+		w.timer = time.AfterFunc(w.options.MaxDelay, func() {
+			w.sendExpired(generation)
+		})
+	}
+	return nil
+}
+
+// Flush writes the buffered bits and waits until they are written, and the OnError calls for them returned.
+// It returns the first error of the batches written since the previous call of Flush.
+func (w *WriteCoalescer) Flush() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return ErrCoalescerClosed
+	}
+	flushed := make(chan error, 1)
+	w.send(flushed)
+	w.mutex.Unlock()
+	return <-flushed
+}
+
+// Close writes the buffered bits, waits until they are written and stops the coalescer.
+// It returns the first error of the batches written since the previous call of Flush.
+// It is safe to call Close more than once.
+func (w *WriteCoalescer) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		<-w.done
+		return nil
+	}
+	w.closed = true
+	flushed := make(chan error, 1)
+	w.send(flushed)
+	close(w.batches)
+	w.mutex.Unlock()
+	err := <-flushed
+	<-w.done
+	return err
+}
+
+// sendExpired sends the bits buffered in the given generation, if they were not sent yet.
+func (w *WriteCoalescer) sendExpired(generation uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.generation == generation && !w.closed {
+		w.send(nil)
+	}
+}
+
+// send passes the buffered bits to the writer, even if there are none when flushed is set.
+// It waits if the writer is busy and a batch is already waiting. The mutex must be held by the caller.
+func (w *WriteCoalescer) send(flushed chan error) {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.generation++
+	if len(w.bits) == 0 && flushed == nil {
+		return
+	}
+	w.batches <- coalescedBatch{bits: w.bits, flushed: flushed}
+	w.bits = nil
+}
+
+// run writes the batches in order until the coalescer is closed.
+func (w *WriteCoalescer) run() {
+	defer close(w.done)
+	// firstErr is the first error since the previous flush
+	var firstErr error
+	// handlers are the OnError calls since the previous flush
+	handlers := &sync.WaitGroup{}
+	for batch := range w.batches {
+		if len(batch.bits) > 0 {
+			if err := w.write(batch.bits); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				if w.options.OnError != nil {
+					// OnError may call SetBit, which waits for the writer if a batch is already waiting
+					handlers.Add(1)
+					go func(handlers *sync.WaitGroup, bits []Bit) {
+						defer handlers.Done()
+						w.options.OnError(err, bits)
+					}(handlers, batch.bits)
+				}
+			}
+		}
+		if batch.flushed != nil {
+			go func(handlers *sync.WaitGroup, flushed chan error, err error) {
+				handlers.Wait()
+				flushed <- err
+			}(handlers, batch.flushed, firstErr)
+			firstErr = nil
+			handlers = &sync.WaitGroup{}
+		}
+	}
+}
+
+func (w *WriteCoalescer) write(bits []Bit) error {
+	if w.options.Import {
+		return w.client.ImportFrameWithContext(w.ctx, w.frame, NewSliceBitIterator(bits), uint(len(bits)))
+	}
+	queries := make([]PQLQuery, len(bits))
+	for i, bit := range bits {
+		queries[i] = w.frame.SetBit(bit.RowID, bit.ColumnID)
+	}
+	response, err := w.client.QueryWithContext(w.ctx, w.frame.index.BatchQuery(queries...))
+	if err != nil {
+		return err
+	}
+	return response.Err()
+}
@@ -0,0 +1,299 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedQueries struct {
+	mutex   *sync.Mutex
+	queries []string
+}
+
+func (r *recordedQueries) get() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.queries...)
+}
+
+func newCoalescerTestClient(t *testing.T, status int) (*Client, *recordedQueries) {
+	recorded := &recordedQueries{mutex: &sync.Mutex{}}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		recorded.mutex.Lock()
+		recorded.queries = append(recorded.queries, string(data))
+		recorded.mutex.Unlock()
+		body := `{"results": [true]}`
+		if status != 200 {
+			body = "query failed"
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, recorded
+}
+
+func TestWriteCoalescerBatchesBits(t *testing.T) {
+	client, recorded := newCoalescerTestClient(t, 200)
+	coalescer, err := client.StartWriteCoalescer(sampleFrame, CoalesceMaxBits(3), CoalesceMaxDelay(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(1); i <= 7; i++ {
+		if err = coalescer.SetBit(i, i*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = coalescer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{
+		sampleIndex.BatchQuery(sampleFrame.SetBit(1, 10), sampleFrame.SetBit(2, 20), sampleFrame.SetBit(3, 30)).serialize(),
+		sampleIndex.BatchQuery(sampleFrame.SetBit(4, 40), sampleFrame.SetBit(5, 50), sampleFrame.SetBit(6, 60)).serialize(),
+		sampleFrame.SetBit(7, 70).serialize(),
+	}
+	if queries := recorded.get(); !reflect.DeepEqual(target, queries) {
+		t.Fatalf("%v != %v", target, queries)
+	}
+	if err = coalescer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if queries := recorded.get(); len(queries) != 3 {
+		t.Fatalf("closing with no buffered bits should not send a query, got %v", queries)
+	}
+}
+
+func TestWriteCoalescerMaxDelay(t *testing.T) {
+	client, recorded := newCoalescerTestClient(t, 200)
+	coalescer, err := client.StartWriteCoalescer(sampleFrame, CoalesceMaxDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coalescer.Close()
+	coalescer.SetBit(1, 10)
+	coalescer.SetBit(2, 20)
+	target := []string{sampleIndex.BatchQuery(sampleFrame.SetBit(1, 10), sampleFrame.SetBit(2, 20)).serialize()}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queries := recorded.get()
+		if len(queries) > 0 {
+			if !reflect.DeepEqual(target, queries) {
+				t.Fatalf("%v != %v", target, queries)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the bits should be written after the maximum delay")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWriteCoalescerConcurrent(t *testing.T) {
+	client, recorded := newCoalescerTestClient(t, 200)
+	coalescer, err := client.StartWriteCoalescer(sampleFrame, CoalesceMaxBits(10), CoalesceMaxDelay(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(row uint64) {
+			defer wg.Done()
+			for column := uint64(0); column < 100; column++ {
+				if err := coalescer.SetBit(row, column); err != nil {
+					t.Error(err)
+				}
+			}
+		}(uint64(i))
+	}
+	wg.Wait()
+	if err = coalescer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	for _, query := range recorded.get() {
+		count += strings.Count(query, "SetBit(")
+	}
+	if count != 400 {
+		t.Fatalf("400 bits expected, got %d", count)
+	}
+}
+
+func TestWriteCoalescerImport(t *testing.T) {
+	client, imported := newImportManagerTestClient(t, 200)
+	coalescer, err := client.StartWriteCoalescer(sampleFrame, CoalesceWithImport(true), CoalesceMaxDelay(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range []uint64{5, 3, 9} {
+		coalescer.SetBit(1, column)
+	}
+	if err = coalescer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if columns := imported.get(); !reflect.DeepEqual([]uint64{3, 5, 9}, columns) {
+		t.Fatalf("unexpected imported columns: %v", columns)
+	}
+}
+
+func TestWriteCoalescerFails(t *testing.T) {
+	client, _ := newCoalescerTestClient(t, 400)
+	var failed []Bit
+	coalescer, err := client.StartWriteCoalescer(sampleFrame, CoalesceMaxDelay(time.Minute),
+		CoalesceOnError(func(err error, bits []Bit) {
+			failed = append(failed, bits...)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	coalescer.SetBit(1, 10)
+	coalescer.SetBit(2, 20)
+	if err = coalescer.Flush(); !isCategory(err, CategoryValidation) {
+		t.Fatalf("the error of the batch expected, got %v", err)
+	}
+	target := []Bit{{RowID: 1, ColumnID: 10}, {RowID: 2, ColumnID: 20}}
+	if !reflect.DeepEqual(target, failed) {
+		t.Fatalf("%v != %v", target, failed)
+	}
+	if err = coalescer.Flush(); err != nil {
+		t.Fatalf("the error should be returned once, got %v", err)
+	}
+	if err = coalescer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteCoalescerOnErrorSetsBits(t *testing.T) {
+	mutex := &sync.Mutex{}
+	requests := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		requests++
+		first := requests == 1
+		mutex.Unlock()
+		if first {
+			return &http.Response{
+				StatusCode: 400,
+				Body:       ioutil.NopCloser(strings.NewReader("query failed")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [true]}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var coalescer *WriteCoalescer
+	coalescer, err = client.StartWriteCoalescer(sampleFrame, CoalesceMaxBits(1), CoalesceMaxDelay(time.Minute),
+		CoalesceOnError(func(err error, bits []Bit) {
+			// each bit fills a batch, so the second one waits for the writer
+			for _, bit := range bits {
+				coalescer.SetBit(bit.RowID, bit.ColumnID)
+				coalescer.SetBit(bit.RowID+1, bit.ColumnID)
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	go func() {
+		coalescer.SetBit(1, 10)
+		if err := coalescer.Flush(); !isCategory(err, CategoryValidation) {
+			closed <- err
+			return
+		}
+		closed <- coalescer.Close()
+	}()
+	select {
+	case err = <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the coalescer should not deadlock when OnError sets bits")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if requests != 3 {
+		t.Fatalf("3 requests expected, got %d", requests)
+	}
+}
+
+func TestWriteCoalescerClosed(t *testing.T) {
+	client, _ := newCoalescerTestClient(t, 200)
+	coalescer, err := client.StartWriteCoalescer(sampleFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = coalescer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = coalescer.SetBit(1, 10); err != ErrCoalescerClosed {
+		t.Fatalf("ErrCoalescerClosed expected, got %v", err)
+	}
+	if err = coalescer.Flush(); err != ErrCoalescerClosed {
+		t.Fatalf("ErrCoalescerClosed expected, got %v", err)
+	}
+	if err = coalescer.Close(); err != nil {
+		t.Fatalf("closing twice should succeed, got %v", err)
+	}
+}
+
+func TestWriteCoalescerInvalidOptions(t *testing.T) {
+	client, _ := newCoalescerTestClient(t, 200)
+	for _, option := range []CoalesceOption{CoalesceMaxBits(0), CoalesceMaxDelay(0)} {
+		if _, err := client.StartWriteCoalescer(sampleFrame, option); err != ErrInvalidCoalesceOption {
+			t.Fatalf("ErrInvalidCoalesceOption expected, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// CopyFrame copies the bits of the standard view of a frame from the cluster of src to the cluster of dst.
+// The index and the frame are created on dst if they do not exist.
+// The bits are streamed from the export of src to the import of dst in batches of batchSize bits.
+// Pass *ImportOptions or ImportOption values to customize the import, e.g., StatusChannel to report progress.
+// Time views and field values are not copied.
+func CopyFrame(src *Client, dst *Client, frame *Frame, batchSize uint, options ...interface{}) error {
+	return CopyFrameWithContext(context.Background(), src, dst, frame, batchSize, options...)
+}
+
+// CopyFrameWithContext copies the bits of the standard view of a frame from the cluster of src to the cluster of dst.
+// The copy stops with an error if the context is canceled.
+func CopyFrameWithContext(ctx context.Context, src *Client, dst *Client, frame *Frame, batchSize uint, options ...interface{}) error {
+	if err := dst.EnsureIndexWithContext(ctx, frame.index); err != nil {
+		return err
+	}
+	if err := dst.EnsureFrameWithContext(ctx, frame); err != nil {
+		return err
+	}
+	iterator, err := src.ExportFrameWithContext(ctx, frame, "standard")
+	if err != nil {
+		return err
+	}
+	return dst.ImportFrameWithContext(ctx, frame, iterator, batchSize, options...)
+}
+
+// CopyDatabase copies the schema and the bits of all of the frames from the cluster of src to the cluster of dst.
+// The frames are copied one by one with CopyFrame.
+// If a Summary is set in the options, it is filled with the totals of all of the frames.
+// If a Checkpoint is set in the options, it keeps the imported batches of each frame separately.
+func CopyDatabase(src *Client, dst *Client, batchSize uint, options ...interface{}) error {
+	return CopyDatabaseWithContext(context.Background(), src, dst, batchSize, options...)
+}
+
+// CopyDatabaseWithContext copies the schema and the bits of all of the frames from the cluster of src to the cluster of dst.
+// The copy stops with an error if the context is canceled.
+func CopyDatabaseWithContext(ctx context.Context, src *Client, dst *Client, batchSize uint, options ...interface{}) error {
+	importOptions := &ImportOptions{}
+	if err := importOptions.addOptions(options...); err != nil {
+		return err
+	}
+	start := time.Now()
+	total := importOptions.Summary
+	if total != nil {
+		*total = ImportSummary{}
+		defer func() { total.Duration = time.Since(start) }()
+	}
+	schema, err := src.SchemaWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	if err = dst.SyncSchemaWithContext(ctx, schema); err != nil {
+		return err
+	}
+	indexes := schema.Indexes()
+	indexNames := make([]string, 0, len(indexes))
+	for name := range indexes {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+	for _, indexName := range indexNames {
+		frames := indexes[indexName].Frames()
+		frameNames := make([]string, 0, len(frames))
+		for name := range frames {
+			frameNames = append(frameNames, name)
+		}
+		sort.Strings(frameNames)
+		for _, frameName := range frameNames {
+			frame := frames[frameName]
+			frameOptions := *importOptions
+			frameOptions.Checkpoint = importOptions.Checkpoint.frame(indexName, frameName)
+			summary := ImportSummary{}
+			frameOptions.Summary = &summary
+			err := CopyFrameWithContext(ctx, src, dst, frame, batchSize, &frameOptions)
+			if total != nil {
+				total.Count += summary.Count
+				total.Batches += summary.Batches
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
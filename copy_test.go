@@ -0,0 +1,209 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+const copySourceStatus = `{"status":{"Nodes":[{"Scheme":"http","Host":"src1:10101","Indexes":[
+	{"Name":"index1","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"frame1","Meta":{"RowLabel":"rowID"}},{"Name":"frame2","Meta":{"RowLabel":"rowID"}}],"Slices":[0]},
+	{"Name":"index2","Meta":{"ColumnLabel":"columnID"},"Frames":[{"Name":"frame3","Meta":{"RowLabel":"rowID"}}],"Slices":[0]}]}]}}`
+
+func newCopySourceClient(t *testing.T) *Client {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch req.URL.Path {
+		case "/status":
+			body = copySourceStatus
+		case "/export":
+			switch req.URL.Query().Get("frame") {
+			case "frame1":
+				body = "1,10\n2,20\n"
+			case "frame2":
+				body = "3,30\n"
+			case "frame3":
+				body = "4,40\n"
+			}
+		default:
+			t.Fatalf("unexpected source request: %s %s", req.Method, req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+type copyDestination struct {
+	mutex    *sync.Mutex
+	created  []string
+	imported map[string][]uint64
+}
+
+func newCopyDestinationClient(t *testing.T) (*Client, *copyDestination) {
+	dst := &copyDestination{mutex: &sync.Mutex{}, imported: map[string][]uint64{}}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		switch {
+		case req.URL.Path == "/status":
+			body = []byte(`{"status":{"Nodes":[{"Scheme":"http","Host":"dst1:10101","Indexes":[]}]}}`)
+		case req.URL.Path == "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"dst1:10101"}]`)
+		case req.URL.Path == "/import":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				t.Fatal(err)
+			}
+			dst.mutex.Lock()
+			key := request.Index + "/" + request.Frame
+			dst.imported[key] = append(dst.imported[key], request.ColumnIDs...)
+			dst.mutex.Unlock()
+		case req.Method == "POST" && strings.HasPrefix(req.URL.Path, "/index/"):
+			dst.mutex.Lock()
+			dst.created = append(dst.created, req.URL.Path)
+			dst.mutex.Unlock()
+		default:
+			t.Fatalf("unexpected destination request: %s %s", req.Method, req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, dst
+}
+
+func TestCopyFrame(t *testing.T) {
+	src := newCopySourceClient(t)
+	dst, copied := newCopyDestinationClient(t)
+	index, err := NewIndex("index1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("frame1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := &ImportSummary{}
+	if err = CopyFrame(src, dst, frame, 100, Summary(summary)); err != nil {
+		t.Fatal(err)
+	}
+	if target := []string{"/index/index1", "/index/index1/frame/frame1"}; !reflect.DeepEqual(target, copied.created) {
+		t.Fatalf("%v != %v", target, copied.created)
+	}
+	if target := map[string][]uint64{"index1/frame1": {10, 20}}; !reflect.DeepEqual(target, copied.imported) {
+		t.Fatalf("%v != %v", target, copied.imported)
+	}
+	if summary.Count != 2 {
+		t.Fatalf("2 bits should be copied, got %d", summary.Count)
+	}
+}
+
+func TestCopyDatabase(t *testing.T) {
+	src := newCopySourceClient(t)
+	dst, copied := newCopyDestinationClient(t)
+	summary := &ImportSummary{}
+	if err := CopyDatabase(src, dst, 100, ThreadCount(2), Summary(summary)); err != nil {
+		t.Fatal(err)
+	}
+	target := map[string][]uint64{
+		"index1/frame1": {10, 20},
+		"index1/frame2": {30},
+		"index2/frame3": {40},
+	}
+	if !reflect.DeepEqual(target, copied.imported) {
+		t.Fatalf("%v != %v", target, copied.imported)
+	}
+	if summary.Count != 4 || summary.Batches != 3 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}
+
+func TestCopyDatabaseCheckpoint(t *testing.T) {
+	src := newCopySourceClient(t)
+	dst, copied := newCopyDestinationClient(t)
+	checkpoint := NewImportCheckpoint()
+	if err := CopyDatabase(src, dst, 1, Checkpoint(checkpoint)); err != nil {
+		t.Fatal(err)
+	}
+	// the frames have their own batches, so none of them is skipped
+	target := map[string][]uint64{
+		"index1/frame1": {10, 20},
+		"index1/frame2": {30},
+		"index2/frame3": {40},
+	}
+	if !reflect.DeepEqual(target, copied.imported) {
+		t.Fatalf("%v != %v", target, copied.imported)
+	}
+	resumed, err := ParseImportCheckpoint(checkpoint.Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, copied = newCopyDestinationClient(t)
+	if err = CopyDatabase(src, dst, 1, Checkpoint(resumed)); err != nil {
+		t.Fatal(err)
+	}
+	if len(copied.imported) != 0 {
+		t.Fatalf("the copied batches should be skipped, got %v", copied.imported)
+	}
+}
+
+func TestCopyDatabaseInvalidOptions(t *testing.T) {
+	src := newCopySourceClient(t)
+	dst, _ := newCopyDestinationClient(t)
+	if err := CopyDatabase(src, dst, 100, "thread count"); err != ErrInvalidImportOption {
+		t.Fatalf("ErrInvalidImportOption expected, got %v", err)
+	}
+}
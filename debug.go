@@ -0,0 +1,193 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxDebugBodySize is the maximum number of bytes of a request or response body which are logged in debug mode.
+const maxDebugBodySize = 4096
+
+// redactedHeaders are the headers whose values are not logged in debug mode.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// debugInterceptor logs the requests sent to the server and the responses at the debug level.
+// It is the innermost interceptor, so it logs the requests as they are sent, with the auth headers redacted.
+// Compressed bodies are logged decompressed. In JSON mode, bodies without a content type are logged as text.
+func debugInterceptor(logger Logger, jsonFormat bool) Interceptor {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			req = cloneRequest(req)
+			keyvals := []interface{}{
+				"method", req.Method,
+				"url", req.URL.String(),
+				"headers", formatDebugHeaders(req.Header),
+				"size", req.ContentLength,
+			}
+			if req.Body != nil && isTextBody(req.Header, jsonFormat) {
+				body, err := ioutil.ReadAll(req.Body)
+				req.Body.Close()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+				keyvals = append(keyvals, "body", truncateDebugBody(debugRequestBody(req.Header, body)))
+			}
+			logger.Debug("http request", keyvals...)
+			start := time.Now()
+			resp, err := next.Do(req)
+			if err != nil {
+				logger.Debug("http request failed", "method", req.Method, "url", req.URL.String(),
+					"duration", time.Since(start), "error", err)
+				return nil, err
+			}
+			keyvals = []interface{}{
+				"method", req.Method,
+				"url", req.URL.String(),
+				"status", resp.StatusCode,
+				"headers", formatDebugHeaders(resp.Header),
+				"size", resp.ContentLength,
+				"duration", time.Since(start),
+			}
+			if resp.Body != nil && isTextBody(resp.Header, jsonFormat) {
+				head, err := readDebugResponseHead(resp)
+				if err != nil {
+					resp.Body.Close()
+					return nil, err
+				}
+				keyvals = append(keyvals, "body", truncateDebugBody(head))
+			}
+			logger.Debug("http response", keyvals...)
+			return resp, nil
+		})
+	}
+}
+
+// prefixedBody is a response body whose beginning was already read.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// isTextBody returns true if the body with the given headers is JSON or text, which may be compressed with gzip.
+// In JSON mode, a body without a content type is text as well.
+func isTextBody(header http.Header, jsonFormat bool) bool {
+	if encoding := header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "gzip") {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return jsonFormat
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasPrefix(mediaType, "text/")
+}
+
+// debugRequestBody returns the request body to log, decompressed if it is compressed.
+func debugRequestBody(header http.Header, body []byte) []byte {
+	if !strings.EqualFold(header.Get("Content-Encoding"), "gzip") {
+		return body
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return body
+	}
+	// the body may be truncated, so errors after the first bytes are ignored
+	decompressed, _ := ioutil.ReadAll(io.LimitReader(reader, maxDebugBodySize+1))
+	return decompressed
+}
+
+// readDebugResponseHead returns the beginning of the response body to log, decompressed if it is compressed.
+// Only the beginning of the body is read, so streamed responses are not buffered,
+// and the body of the response is replaced so the bytes which were read are read again.
+func readDebugResponseHead(resp *http.Response) ([]byte, error) {
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		head, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDebugBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(head), resp.Body), Closer: resp.Body}
+		return head, nil
+	}
+	consumed := &bytes.Buffer{}
+	reader, err := gzip.NewReader(io.TeeReader(resp.Body, consumed))
+	var head []byte
+	if err == nil {
+		// a decompression error is returned when the body is read by the client
+		head, _ = ioutil.ReadAll(io.LimitReader(reader, maxDebugBodySize+1))
+	}
+	resp.Body = &prefixedBody{Reader: io.MultiReader(consumed, resp.Body), Closer: resp.Body}
+	return head, nil
+}
+
+func truncateDebugBody(body []byte) string {
+	if len(body) > maxDebugBodySize {
+		return string(body[:maxDebugBodySize]) + "..."
+	}
+	return string(body)
+}
+
+// formatDebugHeaders formats headers sorted by name, like `Accept: application/json; Authorization: REDACTED`.
+func formatDebugHeaders(header http.Header) string {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		value := strings.Join(header[name], ", ")
+		if redactedHeaders[http.CanonicalHeaderKey(name)] {
+			value = "REDACTED"
+		}
+		parts[i] = name + ": " + value
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,186 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDebugRequests(t *testing.T) {
+	var sentBody string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sentBody = string(body)
+		return &http.Response{
+			StatusCode:    200,
+			Header:        http.Header{"Content-Type": []string{"application/json"}},
+			Body:          ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+			ContentLength: 16,
+		}, nil
+	})
+	logger := &recordingLogger{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true),
+		BasicAuth("user", "secret"), WithLogger(logger), DebugRequests(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Query(sampleIndex.Count(sampleFrame.Bitmap(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result().Count != 5 {
+		t.Fatalf("unexpected response: %v", response.Result())
+	}
+	pql := sampleIndex.Count(sampleFrame.Bitmap(1)).serialize()
+	if sentBody != pql {
+		t.Fatalf("%s != %s", pql, sentBody)
+	}
+	var request, resp *logEntry
+	for i, entry := range logger.entries {
+		switch entry.msg {
+		case "http request":
+			request = &logger.entries[i]
+		case "http response":
+			resp = &logger.entries[i]
+		}
+	}
+	if request == nil || resp == nil {
+		t.Fatalf("requests are not logged: %v", logger.messages())
+	}
+	if request.level != LevelDebug || request.value("method") != "POST" || request.value("url") != "http://node1:10101/index/sample-index/query" {
+		t.Fatalf("unexpected request entry: %v", request)
+	}
+	headers := request.value("headers").(string)
+	if !strings.Contains(headers, "Authorization: REDACTED") || strings.Contains(headers, "secret") {
+		t.Fatalf("auth header is not redacted: %s", headers)
+	}
+	if request.value("body") != pql {
+		t.Fatalf("unexpected request body: %v", request.value("body"))
+	}
+	if resp.value("status") != 200 || resp.value("body") != `{"results": [5]}` || resp.value("size") != int64(16) {
+		t.Fatalf("unexpected response entry: %v", resp)
+	}
+}
+
+func TestDebugRequestsCompressedJSON(t *testing.T) {
+	responseBody, err := gzipData([]byte(`{"results": [5]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Content-Encoding") != "gzip" {
+			t.Fatalf("the request should be compressed")
+		}
+		// the server does not set the content type of the response
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Encoding": []string{"gzip"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(responseBody)),
+		}, nil
+	})
+	logger := &recordingLogger{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true), GzipThreshold(1),
+		WithLogger(logger), DebugRequests(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := sampleIndex.Count(sampleFrame.Bitmap(1))
+	response, err := client.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result().Count != 5 {
+		t.Fatalf("the response should be read after it is logged: %v", response.Result())
+	}
+	bodies := map[string]interface{}{}
+	for _, entry := range logger.entries {
+		bodies[entry.msg] = entry.value("body")
+	}
+	if bodies["http request"] != query.serialize() {
+		t.Fatalf("unexpected request body: %v", bodies["http request"])
+	}
+	if bodies["http response"] != `{"results": [5]}` {
+		t.Fatalf("unexpected response body: %v", bodies["http response"])
+	}
+}
+
+func TestDebugRequestsLargeBody(t *testing.T) {
+	body := strings.Repeat("x", maxDebugBodySize*2)
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	logger := &recordingLogger{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), WithLogger(logger), DebugRequests(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, buf, err := client.HttpRequest("GET", "/version", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != body {
+		t.Fatalf("response body is changed: %d bytes", len(buf))
+	}
+	for _, entry := range logger.entries {
+		if entry.msg == "http response" {
+			if logged := entry.value("body").(string); logged != body[:maxDebugBodySize]+"..." {
+				t.Fatalf("unexpected logged body: %d bytes", len(logged))
+			}
+			return
+		}
+	}
+	t.Fatalf("response is not logged: %v", logger.messages())
+}
+
+func TestFormatDebugHeaders(t *testing.T) {
+	header := http.Header{
+		"Content-Type":  []string{"text/plain"},
+		"Authorization": []string{"Bearer token"},
+		"Accept":        []string{"application/json", "text/plain"},
+	}
+	target := "Accept: application/json, text/plain; Authorization: REDACTED; Content-Type: text/plain"
+	if formatted := formatDebugHeaders(header); formatted != target {
+		t.Fatalf("%s != %s", target, formatted)
+	}
+}
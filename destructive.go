@@ -0,0 +1,64 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import "context"
+
+type destructiveKey struct{}
+
+// ConfirmDestructive returns a context which confirms deleting the indexes, frames, fields or views
+// with the given names. It is required by clients created with the ProtectDestructive option:
+//
+//	ctx := pilosa.ConfirmDestructive(context.Background(), "repository")
+//	err := client.DeleteIndexWithContext(ctx, repository)
+func ConfirmDestructive(ctx context.Context, names ...string) context.Context {
+	confirmed, _ := ctx.Value(destructiveKey{}).([]string)
+	all := make([]string, 0, len(confirmed)+len(names))
+	all = append(all, confirmed...)
+	all = append(all, names...)
+	return context.WithValue(ctx, destructiveKey{}, all)
+}
+
+// checkDestructive returns ErrDestructiveNotConfirmed if the client protects destructive requests
+// and the name is not confirmed in the context.
+func (c *Client) checkDestructive(ctx context.Context, name string) error {
+	if !c.options.ProtectDestructive {
+		return nil
+	}
+	confirmed, _ := ctx.Value(destructiveKey{}).([]string)
+	for _, confirmedName := range confirmed {
+		if confirmedName == name {
+			return nil
+		}
+	}
+	return ErrDestructiveNotConfirmed
+}
@@ -0,0 +1,100 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProtectDestructive(t *testing.T) {
+	requested := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.Method+" "+req.URL.Path)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), ProtectDestructive(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteIndex(sampleIndex); err != ErrDestructiveNotConfirmed {
+		t.Fatalf("%v != %v", ErrDestructiveNotConfirmed, err)
+	}
+	if err = client.DeleteFrame(sampleFrame); err != ErrDestructiveNotConfirmed {
+		t.Fatalf("%v != %v", ErrDestructiveNotConfirmed, err)
+	}
+	if err = client.DeleteField(sampleFrame, "foo"); err != ErrDestructiveNotConfirmed {
+		t.Fatalf("%v != %v", ErrDestructiveNotConfirmed, err)
+	}
+	if err = client.DeleteView(sampleFrame, "standard"); err != ErrDestructiveNotConfirmed {
+		t.Fatalf("%v != %v", ErrDestructiveNotConfirmed, err)
+	}
+	ctx := ConfirmDestructive(context.Background(), "sample-frame")
+	// confirming the frame doesn't confirm the index
+	if err = client.DeleteIndexWithContext(ctx, sampleIndex); err != ErrDestructiveNotConfirmed {
+		t.Fatalf("%v != %v", ErrDestructiveNotConfirmed, err)
+	}
+	if err = client.DeleteFrameWithContext(ctx, sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	ctx = ConfirmDestructive(ctx, "foo", "standard")
+	if err = client.DeleteFieldWithContext(ctx, sampleFrame, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteViewWithContext(ctx, sampleFrame, "standard"); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{
+		"DELETE /index/sample-index/frame/sample-frame",
+		"DELETE /index/sample-index/frame/sample-frame/field/foo",
+		"DELETE /index/sample-index/frame/sample-frame/view/standard",
+	}
+	if !reflect.DeepEqual(target, requested) {
+		t.Fatalf("%v != %v", target, requested)
+	}
+
+	// delete requests are sent without confirmation by default
+	client, err = NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteIndex(sampleIndex); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDNSPort = 10101
+
+// dnsLookuper is the subset of *net.Resolver used to resolve hosts.
+type dnsLookuper interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DNSResolver resolves the hosts of a cluster from DNS records.
+// Names which start with an underscore, e.g., `_pilosa._tcp.example.com`, are resolved
+// using SRV records, which contain the port of each host.
+// Other names are resolved using A and AAAA records, e.g., a Kubernetes headless service.
+type DNSResolver struct {
+	name     string
+	scheme   string
+	port     uint16
+	lookuper dnsLookuper
+}
+
+// DNSOption is used when creating a DNS resolver.
+type DNSOption func(resolver *DNSResolver) error
+
+// DNSScheme sets the scheme of the resolved hosts, http by default.
+func DNSScheme(scheme string) DNSOption {
+	return func(resolver *DNSResolver) error {
+		if !schemeRegexp.MatchString(scheme) {
+			return ErrInvalidDNSOption
+		}
+		resolver.scheme = scheme
+		return nil
+	}
+}
+
+// DNSPort sets the port of the hosts resolved using A and AAAA records, 10101 by default.
+func DNSPort(port uint16) DNSOption {
+	return func(resolver *DNSResolver) error {
+		if port == 0 {
+			return ErrInvalidDNSOption
+		}
+		resolver.port = port
+		return nil
+	}
+}
+
+// NewDNSResolver creates a resolver for the given DNS name.
+func NewDNSResolver(name string, options ...DNSOption) (*DNSResolver, error) {
+	if name == "" {
+		return nil, ErrInvalidDNSOption
+	}
+	resolver := &DNSResolver{
+		name:     strings.TrimSuffix(strings.ToLower(name), "."),
+		scheme:   "http",
+		port:     defaultDNSPort,
+		lookuper: net.DefaultResolver,
+	}
+	for _, option := range options {
+		if err := option(resolver); err != nil {
+			return nil, err
+		}
+	}
+	return resolver, nil
+}
+
+// Hosts resolves the DNS name of the resolver into URIs.
+func (r *DNSResolver) Hosts(ctx context.Context) ([]URI, error) {
+	if strings.HasPrefix(r.name, "_") {
+		return r.srvHosts(ctx)
+	}
+	return r.addressHosts(ctx)
+}
+
+func (r *DNSResolver) srvHosts(ctx context.Context) ([]URI, error) {
+	_, records, err := r.lookuper.LookupSRV(ctx, "", "", r.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "looking up SRV records of %s", r.name)
+	}
+	hosts := make([]URI, 0, len(records))
+	for _, record := range records {
+		target := strings.TrimSuffix(strings.ToLower(record.Target), ".")
+		hosts, err = r.appendHost(hosts, target, record.Port)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+func (r *DNSResolver) addressHosts(ctx context.Context) ([]URI, error) {
+	addresses, err := r.lookuper.LookupHost(ctx, r.name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "looking up addresses of %s", r.name)
+	}
+	hosts := make([]URI, 0, len(addresses))
+	for _, address := range addresses {
+		if strings.Contains(address, ":") {
+			address = "[" + address + "]"
+		}
+		hosts, err = r.appendHost(hosts, address, r.port)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+// appendHost appends the URI for the given host and port to hosts, unless it is already there.
+func (r *DNSResolver) appendHost(hosts []URI, host string, port uint16) ([]URI, error) {
+	uri, err := NewURIFromHostPort(host, port)
+	if err != nil {
+		return nil, errors.Wrapf(err, "resolving %s", r.name)
+	}
+	if err = uri.SetScheme(r.scheme); err != nil {
+		return nil, err
+	}
+	for _, existing := range hosts {
+		if existing.Equals(uri) {
+			return hosts, nil
+		}
+	}
+	return append(hosts, *uri), nil
+}
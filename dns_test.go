@@ -0,0 +1,180 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeLookuper struct {
+	mutex     *sync.Mutex
+	srv       map[string][]*net.SRV
+	addresses map[string][]string
+}
+
+func newFakeLookuper() *fakeLookuper {
+	return &fakeLookuper{
+		mutex:     &sync.Mutex{},
+		srv:       map[string][]*net.SRV{},
+		addresses: map[string][]string{},
+	}
+}
+
+func (l *fakeLookuper) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	records, ok := l.srv[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, records, nil
+}
+
+func (l *fakeLookuper) LookupHost(ctx context.Context, host string) ([]string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	addresses, ok := l.addresses[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addresses, nil
+}
+
+func newTestDNSResolver(t *testing.T, lookuper dnsLookuper, name string, options ...DNSOption) *DNSResolver {
+	resolver, err := NewDNSResolver(name, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolver.lookuper = lookuper
+	return resolver
+}
+
+func compareHosts(t *testing.T, hosts []URI, target []string) {
+	if len(hosts) != len(target) {
+		t.Fatalf("%v != %v", hosts, target)
+	}
+	for i, host := range hosts {
+		if host.Normalize() != target[i] {
+			t.Fatalf("%d: %s != %s", i, host.Normalize(), target[i])
+		}
+	}
+}
+
+func TestDNSResolverSRV(t *testing.T) {
+	lookuper := newFakeLookuper()
+	lookuper.srv["_pilosa._tcp.example.com"] = []*net.SRV{
+		{Target: "Node1.example.com.", Port: 10101},
+		{Target: "node2.example.com.", Port: 10102},
+		{Target: "node1.example.com.", Port: 10101},
+	}
+	resolver := newTestDNSResolver(t, lookuper, "_pilosa._tcp.example.com", DNSScheme("https"))
+	hosts, err := resolver.Hosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, hosts, []string{"https://node1.example.com:10101", "https://node2.example.com:10102"})
+}
+
+func TestDNSResolverAddresses(t *testing.T) {
+	lookuper := newFakeLookuper()
+	lookuper.addresses["pilosa.default.svc.cluster.local"] = []string{"10.0.0.1", "fd42::1"}
+	resolver := newTestDNSResolver(t, lookuper, "pilosa.default.svc.cluster.local.", DNSPort(10111))
+	hosts, err := resolver.Hosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, hosts, []string{"http://10.0.0.1:10111", "http://[fd42::1]:10111"})
+}
+
+func TestDNSResolverFails(t *testing.T) {
+	resolver := newTestDNSResolver(t, newFakeLookuper(), "missing.example.com")
+	if _, err := resolver.Hosts(context.Background()); err == nil {
+		t.Fatalf("should fail for a name which does not resolve")
+	}
+}
+
+func TestNewDNSResolverInvalidOptions(t *testing.T) {
+	invalid := [][]DNSOption{
+		{DNSScheme("?")},
+		{DNSPort(0)},
+	}
+	if _, err := NewDNSResolver(""); err != ErrInvalidDNSOption {
+		t.Fatalf("should fail with an empty name")
+	}
+	for i, options := range invalid {
+		if _, err := NewDNSResolver("example.com", options...); err != ErrInvalidDNSOption {
+			t.Fatalf("%d: should fail with an invalid option", i)
+		}
+	}
+}
+
+func TestClusterWithDNSRefresh(t *testing.T) {
+	lookuper := newFakeLookuper()
+	lookuper.addresses["pilosa.local"] = []string{"10.0.0.1", "10.0.0.2"}
+	resolver := newTestDNSResolver(t, lookuper, "pilosa.local")
+	cluster, err := NewClusterWithDNS(context.Background(), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, cluster.Hosts(), []string{"http://10.0.0.1:10101", "http://10.0.0.2:10101"})
+
+	lookuper.mutex.Lock()
+	lookuper.addresses["pilosa.local"] = []string{"10.0.0.2", "10.0.0.3"}
+	lookuper.mutex.Unlock()
+	client := NewClientWithCluster(cluster, nil)
+	clusterSync, err := client.StartClusterRefresh(time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for cluster.Hosts()[0].Normalize() != "http://10.0.0.2:10101" {
+		if time.Now().After(deadline) {
+			t.Fatalf("the cluster was not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clusterSync.Stop()
+	compareHosts(t, cluster.Hosts(), []string{"http://10.0.0.2:10101", "http://10.0.0.3:10101"})
+}
+
+func TestNewClusterWithDNSFails(t *testing.T) {
+	resolver := newTestDNSResolver(t, newFakeLookuper(), "missing.local")
+	if _, err := NewClusterWithDNS(context.Background(), resolver); err == nil {
+		t.Fatalf("should fail if the name does not resolve")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"fmt"
+
+	"github.com/pilosa/go-pilosa/internal/pqlparse"
+)
+
+// ResultKind is the kind of a query result.
+type ResultKind string
+
+// ResultKind constants
+const (
+	ResultKindBitmap     ResultKind = "bitmap"
+	ResultKindCount      ResultKind = "count"
+	ResultKindCountItems ResultKind = "count-items"
+	ResultKindSum        ResultKind = "sum"
+	ResultKindChanged    ResultKind = "changed"
+	ResultKindNone       ResultKind = "none"
+)
+
+var callResultKinds = map[string]ResultKind{
+	"Bitmap":         ResultKindBitmap,
+	"Union":          ResultKindBitmap,
+	"Intersect":      ResultKindBitmap,
+	"Difference":     ResultKindBitmap,
+	"Xor":            ResultKindBitmap,
+	"Range":          ResultKindBitmap,
+	"Options":        ResultKindBitmap,
+	"Count":          ResultKindCount,
+	"TopN":           ResultKindCountItems,
+	"Sum":            ResultKindSum,
+	"SetBit":         ResultKindChanged,
+	"ClearBit":       ResultKindChanged,
+	"SetRowAttrs":    ResultKindNone,
+	"SetColumnAttrs": ResultKindNone,
+	"SetFieldValue":  ResultKindNone,
+}
+
+// dryRunQuery validates the query on the client side and returns a response
+// with a result of the expected kind for each call in the query.
+func dryRunQuery(query PQLQuery) (*QueryResponse, error) {
+	calls, err := parsePQL(query.serialize())
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*QueryResult, 0, len(calls))
+	for _, call := range calls {
+		if err := validateCall(call); err != nil {
+			return nil, err
+		}
+		results = append(results, &QueryResult{
+			Bitmap:     &BitmapResult{},
+			CountItems: []*CountResultItem{},
+			Kind:       callResultKinds[call.Name],
+		})
+	}
+	return &QueryResponse{
+		ResultList: results,
+		ColumnList: []*ColumnItem{},
+		Success:    true,
+	}, nil
+}
+
+func validateCall(call *pqlparse.Call) error {
+	if _, ok := callResultKinds[call.Name]; !ok {
+		return NewError(fmt.Sprintf("Unknown call: %s", call.Name))
+	}
+	for _, child := range call.Children {
+		if kind := callResultKinds[child.Name]; kind != ResultKindBitmap && kind != "" {
+			return NewError(fmt.Sprintf("%s cannot be used as an argument of %s", child.Name, call.Name))
+		}
+		if err := validateCall(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
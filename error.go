@@ -33,12 +33,20 @@
 package pilosa
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
 )
 
 // Error contains a Pilosa specific error.
 type Error struct {
 	Message string
+	// category is set for the errors which are returned for a server response in that category
+	category ErrorCategory
 }
 
 // NewError creates a Pilosa error.
@@ -46,10 +54,21 @@ func NewError(message string) *Error {
 	return &Error{Message: message}
 }
 
+// newCategoryError creates a Pilosa error which matches the sentinel error of the category with errors.Is.
+func newCategoryError(message string, category ErrorCategory) *Error {
+	return &Error{Message: message, category: category}
+}
+
 func (e Error) Error() string {
 	return fmt.Sprintf("Error: %s", e.Message)
 }
 
+// Is returns true if target is the sentinel error of the category of this error,
+// e.g., ErrConflict for ErrIndexExists.
+func (e *Error) Is(target error) bool {
+	return e.category != CategoryUnknown && target == categoryError(e.category)
+}
+
 // Predefined Pilosa errors.
 // Deprecated. Use Err forms instead.
 var (
@@ -64,15 +83,183 @@ var (
 
 // Predefined Pilosa errors.
 var (
-	ErrEmptyCluster           = NewError("No usable addresses in the cluster")
-	ErrIndexExists            = NewError("Index exists")
-	ErrFrameExists            = NewError("Frame exists")
-	ErrInvalidIndexName       = NewError("Invalid index name")
-	ErrInvalidFrameName       = NewError("Invalid frame name")
-	ErrInvalidLabel           = NewError("Invalid label")
-	ErrTriedMaxHosts          = NewError("Tried max hosts, still failing")
-	ErrAddrURIClusterExpected = NewError("Addresses, URIs or a cluster is expected")
-	ErrInvalidQueryOption     = NewError("Invalid query option")
-	ErrInvalidIndexOption     = NewError("Invalid index option")
-	ErrInvalidFrameOption     = NewError("Invalid frame option")
+	ErrEmptyCluster               = NewError("No usable addresses in the cluster")
+	ErrIndexExists                = newCategoryError("Index exists", CategoryConflict)
+	ErrFrameExists                = newCategoryError("Frame exists", CategoryConflict)
+	ErrFrameNotFound              = newCategoryError("Frame not found", CategoryNotFound)
+	ErrInvalidIndexName           = NewError("Invalid index name")
+	ErrInvalidFrameName           = NewError("Invalid frame name")
+	ErrInvalidLabel               = NewError("Invalid label")
+	ErrInvalidTimeQuantum         = NewError("Invalid time quantum")
+	ErrInvalidCacheType           = NewError("Invalid cache type")
+	ErrTriedMaxHosts              = NewError("Tried max hosts, still failing")
+	ErrAddrURIClusterExpected     = NewError("Addresses, URIs or a cluster is expected")
+	ErrInvalidQueryOption         = NewError("Invalid query option")
+	ErrInvalidIndexOption         = NewError("Invalid index option")
+	ErrInvalidFrameOption         = NewError("Invalid frame option")
+	ErrInvalidImportOption        = NewError("Invalid import option")
+	ErrImportManagerClosed        = NewError("Import manager is closed")
+	ErrInvalidStructMapping       = NewError("Invalid struct mapping")
+	ErrInvalidImportCheckpoint    = NewError("Invalid import checkpoint")
+	ErrDestructiveNotConfirmed    = NewError("Destructive operation is not confirmed")
+	ErrNoKeyTranslator            = NewError("No key translator set for the frame")
+	ErrResponseTooLarge           = NewError("Response is larger than the maximum response size")
+	ErrConflict                   = NewError("Conflict")
+	ErrNotFound                   = NewError("Not found")
+	ErrValidation                 = NewError("Validation failed")
+	ErrServer                     = NewError("Server error")
+	ErrInvalidHealthCheckOption   = NewError("Invalid health check option")
+	ErrInvalidClusterSyncInterval = NewError("Invalid cluster sync interval")
+	ErrInvalidDNSOption           = NewError("Invalid DNS option")
+	ErrUnsupportedServerVersion   = NewError("Unsupported server version")
+	ErrInvalidCoalesceOption      = NewError("Invalid coalesce option")
+	ErrCoalescerClosed            = NewError("Write coalescer is closed")
+	ErrUnixSocketUnsupported      = NewError("Unix domain sockets are not supported with a custom HTTP client or transport")
+)
+
+// ErrorCategory classifies errors returned by the server.
+type ErrorCategory int
+
+// Error categories.
+const (
+	CategoryUnknown ErrorCategory = iota
+	// CategoryConflict is used when the resource already exists.
+	CategoryConflict
+	// CategoryNotFound is used when the resource does not exist.
+	CategoryNotFound
+	// CategoryValidation is used when the server rejects the request.
+	CategoryValidation
+	// CategoryServer is used when the server fails to process the request.
+	CategoryServer
 )
+
+func (c ErrorCategory) String() string {
+	switch c {
+	case CategoryConflict:
+		return "conflict"
+	case CategoryNotFound:
+		return "not found"
+	case CategoryValidation:
+		return "validation"
+	case CategoryServer:
+		return "server error"
+	}
+	return "unknown"
+}
+
+// PilosaError is returned when the server responds with an error status.
+type PilosaError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Host is the host which returned the error, in host:port form,
+	// or the path of the socket for a Unix domain socket.
+	Host string
+	// ServerMessage is the body of the response.
+	ServerMessage string
+	// RequestID is the ID sent in the X-Request-ID header of the request, if any.
+	RequestID string
+}
+
+func newPilosaError(host *URI, response *http.Response, body []byte) *PilosaError {
+	err := &PilosaError{
+		StatusCode:    response.StatusCode,
+		ServerMessage: string(body),
+	}
+	if host != nil {
+		err.Host = host.address()
+	} else if response.Request != nil && response.Request.URL != nil {
+		err.Host = hostFromRequestAddress(response.Request.URL.Host)
+	}
+	if response.Request != nil {
+		err.RequestID = response.Request.Header.Get(RequestIDHeader)
+	}
+	return err
+}
+
+func (e *PilosaError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("Error: Server error (%d) %s from %s (request ID %s): %s",
+			e.StatusCode, http.StatusText(e.StatusCode), e.Host, e.RequestID, e.ServerMessage)
+	}
+	return fmt.Sprintf("Error: Server error (%d) %s from %s: %s",
+		e.StatusCode, http.StatusText(e.StatusCode), e.Host, e.ServerMessage)
+}
+
+// Category returns the category of the error based on its status code.
+func (e *PilosaError) Category() ErrorCategory {
+	switch {
+	case e.StatusCode == http.StatusConflict:
+		return CategoryConflict
+	case e.StatusCode == http.StatusNotFound:
+		return CategoryNotFound
+	case e.StatusCode >= 400 && e.StatusCode < 500:
+		return CategoryValidation
+	case e.StatusCode >= 500:
+		return CategoryServer
+	}
+	return CategoryUnknown
+}
+
+// Is returns true if target is the sentinel error of the category of this error,
+// e.g., ErrConflict for a 409 response.
+func (e *PilosaError) Is(target error) bool {
+	category := e.Category()
+	return category != CategoryUnknown && target == categoryError(category)
+}
+
+// categoryError returns the sentinel error of a category, or nil for CategoryUnknown.
+func categoryError(category ErrorCategory) error {
+	switch category {
+	case CategoryConflict:
+		return ErrConflict
+	case CategoryNotFound:
+		return ErrNotFound
+	case CategoryValidation:
+		return ErrValidation
+	case CategoryServer:
+		return ErrServer
+	}
+	return nil
+}
+
+// isCategory returns true if the cause of err is a PilosaError in the given category.
+func isCategory(err error, category ErrorCategory) bool {
+	if pilosaErr, ok := errors.Cause(err).(*PilosaError); ok {
+		return pilosaErr.Category() == category
+	}
+	return false
+}
+
+// IsConflict returns true if the server responded that the resource already exists.
+func IsConflict(err error) bool {
+	cause := errors.Cause(err)
+	return cause == ErrIndexExists || cause == ErrFrameExists || isCategory(err, CategoryConflict)
+}
+
+// IsNotFound returns true if the server responded that the resource does not exist.
+func IsNotFound(err error) bool {
+	return errors.Cause(err) == ErrFrameNotFound || isCategory(err, CategoryNotFound)
+}
+
+// IsRetryable returns true if trying the request again may succeed.
+// Network errors and 502, 503 and 504 responses are retryable.
+func IsRetryable(err error) bool {
+	cause := errors.Cause(err)
+	switch cause {
+	case nil, ErrEmptyCluster, context.Canceled, context.DeadlineExceeded:
+		return false
+	case ErrTriedMaxHosts, io.ErrUnexpectedEOF:
+		return true
+	}
+	switch e := cause.(type) {
+	case *PilosaError:
+		switch e.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	case net.Error:
+		return true
+	}
+	return false
+}
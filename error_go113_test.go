@@ -0,0 +1,102 @@
+// +build go1.13
+
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestErrorsIsCreateConflict(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusConflict,
+			Body:       ioutil.NopCloser(strings.NewReader("exists")),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.CreateIndex(sampleIndex)
+	if !errors.Is(err, ErrIndexExists) || !errors.Is(err, ErrConflict) || errors.Is(err, ErrNotFound) {
+		t.Fatalf("the error should match ErrIndexExists and ErrConflict, got %v", err)
+	}
+	err = client.CreateFrame(sampleFrame)
+	if !errors.Is(err, ErrFrameExists) || !errors.Is(err, ErrConflict) {
+		t.Fatalf("the error should match ErrFrameExists and ErrConflict, got %v", err)
+	}
+	if !errors.Is(ErrFrameNotFound, ErrNotFound) || errors.Is(ErrInvalidIndexName, ErrValidation) {
+		t.Fatalf("only the errors of a category should match its sentinel")
+	}
+}
+
+func TestErrorsIsWrapped(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/fragment/nodes" {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`[{"scheme":"http","host":"node1:10101"}]`)),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte("bad request"))),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.ImportFrame(sampleFrame, NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 10}}), 100)
+	if !strings.Contains(err.Error(), "doing import request") {
+		t.Fatalf("the import error should be wrapped, got %v", err)
+	}
+	if !errors.Is(err, ErrValidation) || errors.Is(err, ErrServer) {
+		t.Fatalf("the wrapped import error should match ErrValidation, got %v", err)
+	}
+	_, err = client.Status()
+	if !strings.Contains(err.Error(), "requesting /status") {
+		t.Fatalf("the status error should be wrapped, got %v", err)
+	}
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("the wrapped status error should match ErrValidation, got %v", err)
+	}
+}
@@ -33,8 +33,14 @@
 package pilosa
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"testing"
+
+	"github.com/pkg/errors"
 )
 
 func TestError(t *testing.T) {
@@ -44,3 +50,76 @@ func TestError(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestPilosaError(t *testing.T) {
+	response := &http.Response{StatusCode: http.StatusNotFound}
+	err := newPilosaError(URIFromAddress("index1.pilosa.com:10101"), response, []byte("index not found\n"))
+	if err.Host != "index1.pilosa.com:10101" || err.StatusCode != 404 || err.ServerMessage != "index not found\n" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	target := "Error: Server error (404) Not Found from index1.pilosa.com:10101: index not found\n"
+	if err.Error() != target {
+		t.Fatalf("%s != %s", target, err.Error())
+	}
+	if !err.Is(ErrNotFound) || err.Is(ErrConflict) {
+		t.Fatalf("error should only match ErrNotFound")
+	}
+	if !isCategory(errors.Wrap(err, "wrapped"), CategoryNotFound) {
+		t.Fatalf("category of wrapped errors should be detected")
+	}
+}
+
+func TestPilosaErrorCategory(t *testing.T) {
+	targets := map[int]ErrorCategory{
+		200: CategoryUnknown,
+		400: CategoryValidation,
+		404: CategoryNotFound,
+		409: CategoryConflict,
+		422: CategoryValidation,
+		500: CategoryServer,
+		503: CategoryServer,
+	}
+	for code, target := range targets {
+		err := &PilosaError{StatusCode: code}
+		if err.Category() != target {
+			t.Fatalf("%d: %s != %s", code, target, err.Category())
+		}
+	}
+	if isCategory(NewError("some error"), CategoryUnknown) {
+		t.Fatalf("only PilosaError has a category")
+	}
+}
+
+func TestErrorClassification(t *testing.T) {
+	conflict := &PilosaError{StatusCode: http.StatusConflict}
+	notFound := &PilosaError{StatusCode: http.StatusNotFound}
+	unavailable := &PilosaError{StatusCode: http.StatusServiceUnavailable}
+	if !IsConflict(conflict) || !IsConflict(ErrIndexExists) || !IsConflict(errors.Wrap(ErrFrameExists, "creating frame")) {
+		t.Fatalf("conflicts should be detected")
+	}
+	if IsConflict(notFound) || IsConflict(nil) {
+		t.Fatalf("not a conflict")
+	}
+	if !IsNotFound(errors.Wrap(notFound, "deleting index")) || IsNotFound(conflict) {
+		t.Fatalf("not found errors should be detected")
+	}
+	targets := map[error]bool{
+		nil:                          false,
+		conflict:                     false,
+		notFound:                     false,
+		unavailable:                  true,
+		ErrTriedMaxHosts:             true,
+		ErrEmptyCluster:              false,
+		io.ErrUnexpectedEOF:          true,
+		context.Canceled:             false,
+		context.DeadlineExceeded:     false,
+		NewError("some error"):       false,
+		&net.OpError{Op: "dial"}:     true,
+		errors.Wrap(unavailable, ""): true,
+	}
+	for err, target := range targets {
+		if IsRetryable(err) != target {
+			t.Fatalf("%v: %v != %v", err, target, IsRetryable(err))
+		}
+	}
+}
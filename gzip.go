@@ -0,0 +1,123 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// gzipWriterPool keeps gzip writers, since creating one allocates several hundred kilobytes.
+var gzipWriterPool = sync.Pool{
+	New: func() interface{} {
+		return gzip.NewWriter(nil)
+	},
+}
+
+func gzipData(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := gzipWriterPool.Get().(*gzip.Writer)
+	writer.Reset(buf)
+	// the writer is put back without a reference to the buffer, so the buffer is not kept alive by the pool
+	defer func() {
+		writer.Reset(ioutil.Discard)
+		gzipWriterPool.Put(writer)
+	}()
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// requestBody is the body of a request, compressed with gzip if it is large enough.
+// It is prepared once and sent as-is by the retries of the request and to each host.
+type requestBody struct {
+	data       []byte
+	compressed bool
+}
+
+// newRequestBody returns the body of a request with data, compressed if it is at least gzipThreshold bytes.
+// The body is not compressed if gzipThreshold is 0 or less.
+// A nil body is returned for nil data, in which case the request is sent without a body.
+func newRequestBody(data []byte, gzipThreshold int) (*requestBody, error) {
+	if data == nil {
+		return nil, nil
+	}
+	if gzipThreshold <= 0 || len(data) < gzipThreshold {
+		return &requestBody{data: data}, nil
+	}
+	compressed, err := gzipData(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "compressing request body")
+	}
+	return &requestBody{data: compressed, compressed: true}, nil
+}
+
+// gzipResponseBody replaces the body of a gzipped response with a reader
+// which decompresses it.
+func gzipResponseBody(response *http.Response) error {
+	if !strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		return nil
+	}
+	reader, err := gzip.NewReader(response.Body)
+	if err != nil {
+		response.Body.Close()
+		return errors.Wrap(err, "decompressing response body")
+	}
+	response.Body = &gzipReadCloser{Reader: reader, body: response.Body}
+	response.Header.Del("Content-Encoding")
+	response.Header.Del("Content-Length")
+	response.ContentLength = -1
+	response.Uncompressed = true
+	return nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
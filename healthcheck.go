@@ -0,0 +1,221 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultHealthCheckPath    = "/status"
+	defaultHealthCheckTimeout = 5 * time.Second
+	pingPath                  = "/version"
+)
+
+// HealthCheckOptions contains options to customize the health checker.
+type HealthCheckOptions struct {
+	// Path is the endpoint requested from each host, /status by default.
+	Path string
+	// Timeout is the maximum duration of a single health check.
+	Timeout time.Duration
+	// OnHostDown is called when a healthy host fails a health check.
+	OnHostDown func(host *URI)
+	// OnHostUp is called when an unhealthy host passes a health check.
+	OnHostUp func(host *URI)
+}
+
+func (ho *HealthCheckOptions) addOptions(options ...HealthCheckOption) error {
+	for _, option := range options {
+		err := option(ho)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HealthCheckOption is used when starting a health checker.
+type HealthCheckOption func(options *HealthCheckOptions) error
+
+// HealthCheckPath sets the endpoint requested from each host.
+func HealthCheckPath(path string) HealthCheckOption {
+	return func(options *HealthCheckOptions) error {
+		if path == "" || path[0] != '/' {
+			return ErrInvalidHealthCheckOption
+		}
+		options.Path = path
+		return nil
+	}
+}
+
+// HealthCheckTimeout sets the maximum duration of a single health check.
+func HealthCheckTimeout(timeout time.Duration) HealthCheckOption {
+	return func(options *HealthCheckOptions) error {
+		if timeout <= 0 {
+			return ErrInvalidHealthCheckOption
+		}
+		options.Timeout = timeout
+		return nil
+	}
+}
+
+// OnHostDown sets the function which is called when a host is removed from rotation.
+func OnHostDown(fn func(host *URI)) HealthCheckOption {
+	return func(options *HealthCheckOptions) error {
+		options.OnHostDown = fn
+		return nil
+	}
+}
+
+// OnHostUp sets the function which is called when a host is put back in rotation.
+func OnHostUp(fn func(host *URI)) HealthCheckOption {
+	return func(options *HealthCheckOptions) error {
+		options.OnHostUp = fn
+		return nil
+	}
+}
+
+// HealthChecker periodically checks the hosts in the cluster of a client.
+// Hosts which fail a check are not routed requests until they pass a check again.
+// If all hosts are unhealthy, requests are routed to them anyway.
+type HealthChecker struct {
+	client  *Client
+	options *HealthCheckOptions
+	task    *periodicTask
+}
+
+// StartHealthCheck starts a health checker which checks all hosts in the cluster
+// every interval. Call Stop on the returned health checker to stop it.
+func (c *Client) StartHealthCheck(interval time.Duration, options ...HealthCheckOption) (*HealthChecker, error) {
+	if interval <= 0 {
+		return nil, ErrInvalidHealthCheckOption
+	}
+	healthOptions := &HealthCheckOptions{
+		Path:    defaultHealthCheckPath,
+		Timeout: defaultHealthCheckTimeout,
+	}
+	if err := healthOptions.addOptions(options...); err != nil {
+		return nil, err
+	}
+	checker := &HealthChecker{
+		client:  c,
+		options: healthOptions,
+	}
+	checker.task = startPeriodicTask(interval, checker.check)
+	return checker, nil
+}
+
+// Stop stops the health checker and waits for the running check to finish.
+// Hosts keep the health they had at the last check.
+func (h *HealthChecker) Stop() {
+	h.task.Stop()
+}
+
+// check checks all hosts concurrently, then updates their health and calls the callbacks.
+func (h *HealthChecker) check(ctx context.Context) {
+	hosts := h.client.cluster.allHosts()
+	results := make([]bool, len(hosts))
+	wg := &sync.WaitGroup{}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host *URI) {
+			defer wg.Done()
+			results[i] = h.checkHost(ctx, host)
+		}(i, host)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		// the checker was stopped in the middle of the check
+		return
+	}
+	for i, host := range hosts {
+		healthy := results[i]
+		if !h.client.cluster.setHealthy(host, healthy) {
+			continue
+		}
+		if healthy && h.options.OnHostUp != nil {
+			h.options.OnHostUp(host)
+		} else if !healthy && h.options.OnHostDown != nil {
+			h.options.OnHostDown(host)
+		}
+	}
+}
+
+func (h *HealthChecker) checkHost(ctx context.Context, host *URI) bool {
+	ctx, cancel := context.WithTimeout(ctx, h.options.Timeout)
+	defer cancel()
+	_, err := h.client.ping(ctx, host, h.options.Path)
+	return err == nil
+}
+
+// Ping sends a lightweight request to a host selected by the cluster
+// and returns the latency of the request.
+// Use it, e.g., for readiness probes.
+func (c *Client) Ping() (time.Duration, error) {
+	return c.PingWithContext(context.Background())
+}
+
+// PingWithContext sends a lightweight request to a host selected by the cluster
+// and returns the latency of the request.
+func (c *Client) PingWithContext(ctx context.Context) (time.Duration, error) {
+	host := c.cluster.hostFor("", c.breaker)
+	if host == nil {
+		return 0, ErrEmptyCluster
+	}
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
+	return c.ping(ctx, host, pingPath)
+}
+
+// ping requests the given path from the host and returns the latency of the request.
+// A response with an error status is returned as a PilosaError.
+func (c *Client) ping(ctx context.Context, host *URI, path string) (time.Duration, error) {
+	start := time.Now()
+	resp, err := c.doRequest(ctx, host, "GET", path, nil, nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "doing ping request")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, newPilosaError(host, resp, body)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return time.Since(start), nil
+}
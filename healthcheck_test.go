@@ -0,0 +1,207 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newHealthTransport returns a transport where health checks of the hosts in down fail.
+func newHealthTransport(mutex *sync.Mutex, down map[string]bool) roundTripperFunc {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		failing := down[req.URL.Host]
+		mutex.Unlock()
+		if failing && req.URL.Path == "/status" {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}, nil
+	})
+}
+
+func TestHealthCheckEvictsAndReinstatesHosts(t *testing.T) {
+	mutex := &sync.Mutex{}
+	down := map[string]bool{"host2:10101": true}
+	client, err := NewClient([]string{"host1:10101", "host2:10101"},
+		HTTPTransport(newHealthTransport(mutex, down)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	checker := &HealthChecker{
+		client: client,
+		options: &HealthCheckOptions{
+			Path:       defaultHealthCheckPath,
+			Timeout:    time.Second,
+			OnHostDown: func(host *URI) { events = append(events, "down "+host.HostPort()) },
+			OnHostUp:   func(host *URI) { events = append(events, "up "+host.HostPort()) },
+		},
+	}
+
+	checker.check(context.Background())
+	hosts := client.cluster.Hosts()
+	if len(hosts) != 1 || hosts[0].HostPort() != "host1:10101" {
+		t.Fatalf("unhealthy host should be removed from rotation: %v", hosts)
+	}
+	for i := 0; i < 4; i++ {
+		if host := client.cluster.Host(); host.HostPort() != "host1:10101" {
+			t.Fatalf("request routed to unhealthy host %s", host.HostPort())
+		}
+	}
+	if status := client.cluster.HostStatus(); !status[0].Healthy || status[1].Healthy {
+		t.Fatalf("unexpected host status: %v", status)
+	}
+
+	// a host which is still failing does not trigger the callback again
+	checker.check(context.Background())
+
+	mutex.Lock()
+	down["host2:10101"] = false
+	mutex.Unlock()
+	checker.check(context.Background())
+	if hosts := client.cluster.Hosts(); len(hosts) != 2 {
+		t.Fatalf("recovered host should be put back in rotation: %v", hosts)
+	}
+
+	if len(events) != 2 || events[0] != "down host2:10101" || events[1] != "up host2:10101" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+}
+
+func TestHealthCheckAllHostsUnhealthy(t *testing.T) {
+	mutex := &sync.Mutex{}
+	down := map[string]bool{"host1:10101": true}
+	client, err := NewClient("host1:10101", HTTPTransport(newHealthTransport(mutex, down)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := &HealthChecker{
+		client:  client,
+		options: &HealthCheckOptions{Path: defaultHealthCheckPath, Timeout: time.Second},
+	}
+	checker.check(context.Background())
+	if host := client.cluster.Host(); host == nil || host.HostPort() != "host1:10101" {
+		t.Fatalf("requests should be routed to unhealthy hosts if there are no healthy ones")
+	}
+}
+
+func TestStartHealthCheck(t *testing.T) {
+	mutex := &sync.Mutex{}
+	down := map[string]bool{"host2:10101": true}
+	client, err := NewClient([]string{"host1:10101", "host2:10101"},
+		HTTPTransport(newHealthTransport(mutex, down)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostDown := make(chan string, 1)
+	checker, err := client.StartHealthCheck(time.Millisecond,
+		OnHostDown(func(host *URI) { hostDown <- host.HostPort() }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case host := <-hostDown:
+		if host != "host2:10101" {
+			t.Fatalf("unexpected host down: %s", host)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("host down callback was not called")
+	}
+	checker.Stop()
+	// stopping twice is fine
+	checker.Stop()
+}
+
+func TestStartHealthCheckInvalidOptions(t *testing.T) {
+	client := DefaultClient()
+	invalid := [][]HealthCheckOption{
+		{HealthCheckPath("status")},
+		{HealthCheckTimeout(0)},
+	}
+	if _, err := client.StartHealthCheck(0); err != ErrInvalidHealthCheckOption {
+		t.Fatalf("should fail with an invalid interval")
+	}
+	for i, options := range invalid {
+		if _, err := client.StartHealthCheck(time.Second, options...); err != ErrInvalidHealthCheckOption {
+			t.Fatalf("%d: should fail with an invalid option", i)
+		}
+	}
+}
+
+func TestPing(t *testing.T) {
+	status := 200
+	var requested string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.Method + " " + req.URL.Host + req.URL.Path
+		time.Sleep(time.Millisecond)
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"version":"v0.8.0"}`))),
+		}, nil
+	})
+	client, err := NewClient("node1:10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	latency, err := client.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latency < time.Millisecond {
+		t.Fatalf("unexpected latency: %s", latency)
+	}
+	if requested != "GET node1:10101/version" {
+		t.Fatalf("unexpected request: %s", requested)
+	}
+	status = 503
+	if _, err = client.Ping(); !isCategory(err, CategoryServer) {
+		t.Fatalf("expected a server error, got: %v", err)
+	}
+	client, err = NewClient(NewClusterWithHost())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Ping(); err != ErrEmptyCluster {
+		t.Fatalf("expected ErrEmptyCluster, got: %v", err)
+	}
+}
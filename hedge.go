@@ -0,0 +1,122 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type httpResult struct {
+	response *http.Response
+	body     []byte
+	err      error
+}
+
+// hostSet is a set of hosts which is safe for concurrent use.
+// A nil hostSet is empty and ignores the added hosts.
+type hostSet struct {
+	mutex sync.Mutex
+	hosts []*URI
+}
+
+func (s *hostSet) add(host *URI) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, h := range s.hosts {
+		if h.Equals(host) {
+			return
+		}
+	}
+	s.hosts = append(s.hosts, host)
+}
+
+func (s *hostSet) list() []*URI {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]*URI(nil), s.hosts...)
+}
+
+// hedgedRequest sends the request, and sends it again to another host
+// if there is no response after delay. The first successful response is returned,
+// and the other request is canceled.
+// The hedged request avoids the hosts selected for the first request,
+// so it is sent to another host even if the strategy of the cluster prefers the same host.
+func (c *Client) hedgedRequest(ctx context.Context, method string, path string, data []byte, headers map[string]string, policy *RetryPolicy, delay time.Duration) (*http.Response, []byte, error) {
+	reqBody, err := c.newHTTPRequestBody(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx, cancel := c.withRequestTimeout(ctx)
+	defer cancel()
+	ctx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	results := make(chan httpResult, 2)
+	send := func(tried *triedHosts) {
+		go func() {
+			response, body, err := c.httpRequestWithHosts(ctx, method, path, reqBody, headers, policy, tried)
+			results <- httpResult{response: response, body: body, err: err}
+		}()
+	}
+	primaryHosts := &hostSet{}
+	primary := newTriedHosts(c.options.MaxHostsPerRequest)
+	primary.selected = primaryHosts
+	send(primary)
+	pending := 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	hedge := timer.C
+	for {
+		select {
+		case result := <-results:
+			pending--
+			if result.err == nil || pending == 0 {
+				return result.response, result.body, result.err
+			}
+		case <-hedge:
+			hedge = nil
+			hedged := newTriedHosts(c.options.MaxHostsPerRequest)
+			hedged.avoid = primaryHosts
+			send(hedged)
+			pending++
+		}
+	}
+}
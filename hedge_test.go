@@ -0,0 +1,144 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHedgedQuery(t *testing.T) {
+	body := mustMarshalQueryResponse(t)
+	var mutex sync.Mutex
+	var requested []string
+	canceled := make(chan struct{})
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		requested = append(requested, req.URL.Host)
+		mutex.Unlock()
+		if req.URL.Host == "slow:10101" {
+			<-req.Context().Done()
+			close(canceled)
+			return nil, req.Context().Err()
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient([]string{"slow:10101", "fast:10101"},
+		HTTPTransport(transport),
+		HedgeDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleFrame.Bitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatalf("the slow request should be canceled")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(requested) != 2 || requested[0] != "slow:10101" || requested[1] != "fast:10101" {
+		t.Fatalf("unexpected requests: %v", requested)
+	}
+	if status := client.cluster.HostStatus()[0]; status.Failures != 0 {
+		t.Fatalf("the canceled host should not be marked as failed")
+	}
+}
+
+func TestHedgedQueryNotUsedForWrites(t *testing.T) {
+	body := mustMarshalQueryResponse(t)
+	requests := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		time.Sleep(20 * time.Millisecond)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient([]string{"host1:10101", "host2:10101"},
+		HTTPTransport(transport),
+		HedgeDelay(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleFrame.SetBit(1, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 1 {
+		t.Fatalf("queries which modify data should not be hedged, %d requests sent", requests)
+	}
+}
+
+func TestHedgedQueryAvoidsPrimaryHost(t *testing.T) {
+	body := mustMarshalQueryResponse(t)
+	var mutex sync.Mutex
+	var requested []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mutex.Lock()
+		requested = append(requested, req.URL.Host)
+		first := len(requested) == 1
+		mutex.Unlock()
+		if first {
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	// the sticky strategy selects the same host for the queries of an index
+	cluster := NewClusterWithStrategy(NewStickyStrategy(), URIFromAddress("host1:10101"), URIFromAddress("host2:10101"))
+	client, err := NewClient(cluster, HTTPTransport(transport), HedgeDelay(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleFrame.Bitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(requested) != 2 || requested[0] == requested[1] {
+		t.Fatalf("the hedged request should be sent to another host: %v", requested)
+	}
+}
@@ -0,0 +1,777 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// importWorkers runs the import jobs of an import, in parallel if there are several workers.
+// The jobs with the same key, i.e., the batches of the same slice, run on the same worker in order,
+// so a value imported later is not overwritten by a value imported earlier.
+// The first failing job cancels the others.
+type importWorkers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	jobs   []chan func(ctx context.Context) error
+	queues []*importQueue
+	wg     *sync.WaitGroup
+	mutex  *sync.Mutex
+	err    error
+}
+
+// newImportWorkers starts count workers. Jobs run synchronously if count is 0 or 1.
+func newImportWorkers(ctx context.Context, count int) *importWorkers {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &importWorkers{
+		ctx:    ctx,
+		cancel: cancel,
+		wg:     &sync.WaitGroup{},
+		mutex:  &sync.Mutex{},
+	}
+	if count <= 1 {
+		return w
+	}
+	w.jobs = make([]chan func(ctx context.Context) error, count)
+	for i := range w.jobs {
+		w.jobs[i] = make(chan func(ctx context.Context) error)
+		w.wg.Add(1)
+		go w.work(w.jobs[i])
+	}
+	return w
+}
+
+// newQueuedImportWorkers starts count workers, at least one, which have unbounded queues,
+// so passing a job to a worker does not wait for the worker to take it.
+func newQueuedImportWorkers(ctx context.Context, count int) *importWorkers {
+	w := newImportWorkers(ctx, 1)
+	if count < 1 {
+		count = 1
+	}
+	w.queues = make([]*importQueue, count)
+	for i := range w.queues {
+		w.queues[i] = newImportQueue()
+		w.wg.Add(1)
+		go w.workQueue(w.queues[i])
+	}
+	return w
+}
+
+func (w *importWorkers) workQueue(queue *importQueue) {
+	defer w.wg.Done()
+	for {
+		job, ok := queue.pop()
+		if !ok {
+			return
+		}
+		if w.ctx.Err() != nil {
+			// another job failed, skip the remaining ones
+			continue
+		}
+		if err := job(w.ctx); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+func (w *importWorkers) work(jobs <-chan func(ctx context.Context) error) {
+	defer w.wg.Done()
+	for job := range jobs {
+		if w.ctx.Err() != nil {
+			// another job failed, skip the remaining ones
+			continue
+		}
+		if err := job(w.ctx); err != nil {
+			w.fail(err)
+		}
+	}
+}
+
+// fail records the first error and cancels the running jobs.
+func (w *importWorkers) fail(err error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.err == nil {
+		w.err = err
+		w.cancel()
+	}
+}
+
+func (w *importWorkers) firstErr() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+// run passes the job to the worker for the key, or runs it if there are no workers.
+// It returns the error of the first failing job, if a job failed.
+func (w *importWorkers) run(key uint64, job func(ctx context.Context) error) error {
+	if w.queues != nil {
+		w.queues[key%uint64(len(w.queues))].push(job)
+		if err := w.firstErr(); err != nil {
+			return err
+		}
+		return w.ctx.Err()
+	}
+	if w.jobs == nil {
+		if err := job(w.ctx); err != nil {
+			w.fail(err)
+		}
+		return w.firstErr()
+	}
+	select {
+	case w.jobs[key%uint64(len(w.jobs))] <- job:
+	case <-w.ctx.Done():
+	}
+	if err := w.firstErr(); err != nil {
+		return err
+	}
+	return w.ctx.Err()
+}
+
+// wait waits for the running jobs to finish and stops the workers.
+// It returns the error of the first failing job,
+// or the error of the context if it was canceled before all jobs ran.
+func (w *importWorkers) wait() error {
+	if w.queues != nil {
+		for _, queue := range w.queues {
+			queue.close()
+		}
+		w.wg.Wait()
+		w.queues = nil
+	}
+	if w.jobs != nil {
+		for _, jobs := range w.jobs {
+			close(jobs)
+		}
+		w.wg.Wait()
+		w.jobs = nil
+	}
+	err := w.firstErr()
+	if err == nil {
+		err = w.ctx.Err()
+	}
+	w.cancel()
+	return err
+}
+
+// importQueue is an unbounded queue of jobs.
+type importQueue struct {
+	mutex  *sync.Mutex
+	cond   *sync.Cond
+	jobs   []func(ctx context.Context) error
+	closed bool
+}
+
+func newImportQueue() *importQueue {
+	mutex := &sync.Mutex{}
+	return &importQueue{
+		mutex: mutex,
+		cond:  sync.NewCond(mutex),
+	}
+}
+
+func (q *importQueue) push(job func(ctx context.Context) error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.jobs = append(q.jobs, job)
+	q.cond.Signal()
+}
+
+// pop waits for a job. It returns false once the queue is closed and empty.
+func (q *importQueue) pop() (func(ctx context.Context) error, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for len(q.jobs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.jobs) == 0 {
+		return nil, false
+	}
+	job := q.jobs[0]
+	q.jobs[0] = nil
+	q.jobs = q.jobs[1:]
+	return job, true
+}
+
+func (q *importQueue) close() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// ImportStatusUpdate is sent after a batch of a slice is imported to a node.
+type ImportStatusUpdate struct {
+	// Slice is the slice of the batch.
+	Slice uint64
+	// Node is the host the batch was imported to, in host:port form,
+	// or the path of the socket for a Unix domain socket.
+	Node string
+	// Count is the number of bits or values in the batch.
+	Count int
+	// Duration is the time it took to import the batch to the node.
+	Duration time.Duration
+}
+
+// ImportSummary contains the totals of an import.
+type ImportSummary struct {
+	// Count is the number of bits or values imported.
+	// A batch which is imported to several nodes is counted once.
+	Count int
+	// Batches is the number of batches imported.
+	Batches int
+	// Duration is the time the import took.
+	Duration time.Duration
+}
+
+// Throughput returns the number of bits or values imported per second.
+func (s ImportSummary) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Count) / s.Duration.Seconds()
+}
+
+// importProgress sends status updates and keeps the summary of an import.
+type importProgress struct {
+	statusChannel chan<- ImportStatusUpdate
+	target        *ImportSummary
+	checkpoint    *ImportCheckpoint
+	start         time.Time
+	mutex         *sync.Mutex
+	summary       ImportSummary
+}
+
+func newImportProgress(options *ImportOptions) *importProgress {
+	return &importProgress{
+		statusChannel: options.StatusChannel,
+		target:        options.Summary,
+		checkpoint:    options.Checkpoint,
+		start:         time.Now(),
+		mutex:         &sync.Mutex{},
+	}
+}
+
+// nodeImported sends a status update, unless the context is canceled first.
+// It does nothing if p is nil.
+func (p *importProgress) nodeImported(ctx context.Context, slice uint64, node *URI, count int, duration time.Duration) error {
+	if p == nil || p.statusChannel == nil {
+		return nil
+	}
+	update := ImportStatusUpdate{
+		Slice:    slice,
+		Node:     node.address(),
+		Count:    count,
+		Duration: duration,
+	}
+	select {
+	case p.statusChannel <- update:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// batchImported adds a batch which was imported to all of its nodes to the summary
+// and records it in the checkpoint.
+// It does nothing if p is nil.
+func (p *importProgress) batchImported(slice uint64, count int) {
+	if p == nil {
+		return
+	}
+	p.checkpoint.acknowledge(slice)
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.summary.Count += count
+	p.summary.Batches++
+}
+
+// finish fills the summary requested in the import options.
+func (p *importProgress) finish() {
+	if p.target == nil {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	*p.target = p.summary
+	p.target.Duration = time.Since(p.start)
+}
+
+// ImportCheckpoint keeps the number of batches of each slice which were imported to all of their nodes.
+// Pass the same checkpoint to a later import of the same data with the same batch size,
+// and the batches which were already imported are skipped.
+// The batches of a slice are imported in order and the import stops at the first failing batch,
+// so the imported batches of a slice are always its first ones.
+// With CopyDatabase, the checkpoint keeps the batches of each frame separately.
+type ImportCheckpoint struct {
+	mutex     *sync.Mutex
+	batchSize uint
+	batches   map[uint64]int
+	// frames are the checkpoints of the frames copied with CopyDatabase, keyed by index and frame name
+	frames map[string]*ImportCheckpoint
+}
+
+// NewImportCheckpoint creates an empty checkpoint.
+func NewImportCheckpoint() *ImportCheckpoint {
+	return &ImportCheckpoint{
+		mutex:   &sync.Mutex{},
+		batches: map[uint64]int{},
+		frames:  map[string]*ImportCheckpoint{},
+	}
+}
+
+// ParseImportCheckpoint creates a checkpoint from a token returned by ImportCheckpoint.Token.
+func ParseImportCheckpoint(token string) (*ImportCheckpoint, error) {
+	parts := strings.Split(token, " ")
+	checkpoint, err := parseSliceCheckpoint(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts[1:] {
+		// the checkpoint of a frame is index/frame=token
+		frameToken := strings.SplitN(part, "=", 2)
+		if len(frameToken) != 2 || len(strings.Split(frameToken[0], "/")) != 2 {
+			return nil, ErrInvalidImportCheckpoint
+		}
+		if _, ok := checkpoint.frames[frameToken[0]]; ok {
+			return nil, ErrInvalidImportCheckpoint
+		}
+		frameCheckpoint, err := parseSliceCheckpoint(frameToken[1])
+		if err != nil {
+			return nil, err
+		}
+		checkpoint.frames[frameToken[0]] = frameCheckpoint
+	}
+	return checkpoint, nil
+}
+
+// parseSliceCheckpoint parses the batch size and the batches of each slice of a checkpoint.
+func parseSliceCheckpoint(token string) (*ImportCheckpoint, error) {
+	checkpoint := NewImportCheckpoint()
+	parts := strings.SplitN(token, ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidImportCheckpoint
+	}
+	batchSize, err := strconv.ParseUint(parts[0], 10, 0)
+	if err != nil {
+		return nil, ErrInvalidImportCheckpoint
+	}
+	checkpoint.batchSize = uint(batchSize)
+	if parts[1] == "" {
+		return checkpoint, nil
+	}
+	for _, item := range strings.Split(parts[1], ",") {
+		sliceBatches := strings.SplitN(item, "=", 2)
+		if len(sliceBatches) != 2 {
+			return nil, ErrInvalidImportCheckpoint
+		}
+		slice, err := strconv.ParseUint(sliceBatches[0], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidImportCheckpoint
+		}
+		batches, err := strconv.Atoi(sliceBatches[1])
+		if err != nil || batches < 0 {
+			return nil, ErrInvalidImportCheckpoint
+		}
+		checkpoint.batches[slice] = batches
+	}
+	return checkpoint, nil
+}
+
+// Token returns a string which can be stored to resume the import later with ParseImportCheckpoint.
+func (c *ImportCheckpoint) Token() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	slices := make([]uint64, 0, len(c.batches))
+	for slice := range c.batches {
+		slices = append(slices, slice)
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i] < slices[j] })
+	items := make([]string, 0, len(slices))
+	for _, slice := range slices {
+		items = append(items, fmt.Sprintf("%d=%d", slice, c.batches[slice]))
+	}
+	token := fmt.Sprintf("%d:%s", c.batchSize, strings.Join(items, ","))
+	keys := make([]string, 0, len(c.frames))
+	for key := range c.frames {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		token += fmt.Sprintf(" %s=%s", key, c.frames[key].Token())
+	}
+	return token
+}
+
+// Batches returns the number of imported batches of a slice.
+func (c *ImportCheckpoint) Batches(slice uint64) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.batches[slice]
+}
+
+// frame returns the checkpoint of a frame copied with CopyDatabase, so the frames don't skip each other's batches.
+// It returns nil if c is nil.
+func (c *ImportCheckpoint) frame(indexName string, frameName string) *ImportCheckpoint {
+	if c == nil {
+		return nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	key := indexName + "/" + frameName
+	checkpoint, ok := c.frames[key]
+	if !ok {
+		checkpoint = NewImportCheckpoint()
+		c.frames[key] = checkpoint
+	}
+	return checkpoint
+}
+
+// begin returns the batches imported so far, or an error if the checkpoint is for another batch size.
+// It returns nil if c is nil.
+func (c *ImportCheckpoint) begin(batchSize uint) (map[uint64]int, error) {
+	if c == nil {
+		return nil, nil
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.batchSize != 0 && c.batchSize != batchSize {
+		return nil, ErrInvalidImportCheckpoint
+	}
+	c.batchSize = batchSize
+	imported := make(map[uint64]int, len(c.batches))
+	for slice, batches := range c.batches {
+		imported[slice] = batches
+	}
+	return imported, nil
+}
+
+func (c *ImportCheckpoint) acknowledge(slice uint64) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.batches[slice]++
+}
+
+// importBatches numbers the batches of each slice, so the ones in the checkpoint can be skipped.
+type importBatches struct {
+	imported map[uint64]int
+	sent     map[uint64]int
+}
+
+func newImportBatches(checkpoint *ImportCheckpoint, batchSize uint) (*importBatches, error) {
+	imported, err := checkpoint.begin(batchSize)
+	if err != nil {
+		return nil, err
+	}
+	return &importBatches{
+		imported: imported,
+		sent:     map[uint64]int{},
+	}, nil
+}
+
+// next returns false if the next batch of the slice was already imported.
+func (b *importBatches) next(slice uint64) bool {
+	n := b.sent[slice]
+	b.sent[slice]++
+	return n >= b.imported[slice]
+}
+
+// retryImport calls fn until it succeeds or the policy does not allow another attempt.
+// Imports are idempotent, so a batch may be sent again to a node which already received it.
+func retryImport(ctx context.Context, policy *RetryPolicy, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if attempt >= policy.maxAttempts() || !policy.shouldRetry(ctx, err) {
+			return err
+		}
+		if sleepErr := sleepContext(ctx, policy.delay(attempt)); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// Sizes of the bits and values in memory, used to account for the import buffer.
+const (
+	bitSize   = 24
+	valueSize = 16
+)
+
+// importBuffer keeps the batches which wait to be imported.
+// Batches are kept in memory as long as their total size is below maxSize bytes,
+// and written to temporary files in dir otherwise.
+type importBuffer struct {
+	maxSize int64
+	dir     string
+	mutex   *sync.Mutex
+	size    int64
+	files   map[string]struct{}
+}
+
+// newImportBuffer returns nil if maxSize is 0, in which case batches are not buffered.
+func newImportBuffer(maxSize int64, dir string) *importBuffer {
+	if maxSize <= 0 {
+		return nil
+	}
+	return &importBuffer{
+		maxSize: maxSize,
+		dir:     dir,
+		mutex:   &sync.Mutex{},
+		files:   map[string]struct{}{},
+	}
+}
+
+// holdBits returns a job which calls importFn with the bits,
+// after reading them back from disk if they did not fit in memory.
+func (b *importBuffer) holdBits(bits []Bit, importFn func(ctx context.Context, bits []Bit) error) (func(ctx context.Context) error, error) {
+	if b == nil {
+		return func(ctx context.Context) error { return importFn(ctx, bits) }, nil
+	}
+	size := int64(len(bits) * bitSize)
+	if b.reserve(size) {
+		return func(ctx context.Context) error {
+			defer b.release(size)
+			return importFn(ctx, bits)
+		}, nil
+	}
+	path, err := b.spill(bits)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		spilled := []Bit{}
+		if err := b.load(path, &spilled); err != nil {
+			return err
+		}
+		return importFn(ctx, spilled)
+	}, nil
+}
+
+// holdValues returns a job which calls importFn with the values,
+// after reading them back from disk if they did not fit in memory.
+func (b *importBuffer) holdValues(vals []FieldValue, importFn func(ctx context.Context, vals []FieldValue) error) (func(ctx context.Context) error, error) {
+	if b == nil {
+		return func(ctx context.Context) error { return importFn(ctx, vals) }, nil
+	}
+	size := int64(len(vals) * valueSize)
+	if b.reserve(size) {
+		return func(ctx context.Context) error {
+			defer b.release(size)
+			return importFn(ctx, vals)
+		}, nil
+	}
+	path, err := b.spill(vals)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		spilled := []FieldValue{}
+		if err := b.load(path, &spilled); err != nil {
+			return err
+		}
+		return importFn(ctx, spilled)
+	}, nil
+}
+
+// reserve returns true if size bytes fit in the memory budget.
+func (b *importBuffer) reserve(size int64) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	// a batch is always kept in memory if nothing else is,
+	// so a batch larger than the budget does not have to be spilled
+	if b.size > 0 && b.size+size > b.maxSize {
+		return false
+	}
+	b.size += size
+	return true
+}
+
+func (b *importBuffer) release(size int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.size -= size
+}
+
+// spill writes a batch to a temporary file and returns its path.
+func (b *importBuffer) spill(batch interface{}) (string, error) {
+	file, err := ioutil.TempFile(b.dir, "pilosa-import-")
+	if err != nil {
+		return "", errors.Wrap(err, "creating import spill file")
+	}
+	b.mutex.Lock()
+	b.files[file.Name()] = struct{}{}
+	b.mutex.Unlock()
+	writer := bufio.NewWriter(file)
+	err = gob.NewEncoder(writer).Encode(batch)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "writing import spill file")
+	}
+	return file.Name(), nil
+}
+
+// load reads a batch back from a spill file and removes the file.
+func (b *importBuffer) load(path string, batch interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening import spill file")
+	}
+	err = gob.NewDecoder(bufio.NewReader(file)).Decode(batch)
+	file.Close()
+	b.remove(path)
+	return errors.Wrap(err, "reading import spill file")
+}
+
+func (b *importBuffer) remove(path string) {
+	os.Remove(path)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.files, path)
+}
+
+// close removes the spill files of the batches which were not imported.
+// It does nothing if b is nil.
+func (b *importBuffer) close() {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	paths := make([]string, 0, len(b.files))
+	for path := range b.files {
+		paths = append(paths, path)
+	}
+	b.mutex.Unlock()
+	for _, path := range paths {
+		b.remove(path)
+	}
+}
+
+// ImportReport is filled by an import which runs with the ImportDryRun option.
+type ImportReport struct {
+	// Count is the number of valid bits or values.
+	Count int
+	// SliceCounts is the number of valid bits or values of each slice.
+	SliceCounts map[uint64]int
+	// Errors are the records which could not be parsed or are invalid.
+	Errors []*RecordError
+}
+
+// Bits with timestamps out of this range cannot be stored in the time views of a frame.
+var (
+	minImportTimestamp = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	maxImportTimestamp = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC).Unix()
+)
+
+// dryRunImport reads all of the records with next, which returns the slice of a valid record,
+// and fills the report without importing anything.
+// It stops at the first error which is not a *RecordError.
+func dryRunImport(report *ImportReport, next func(line int) (uint64, error)) error {
+	*report = ImportReport{SliceCounts: map[uint64]int{}}
+	for line := 1; ; line++ {
+		slice, err := next(line)
+		if err == io.EOF {
+			return nil
+		}
+		if recordErr, ok := err.(*RecordError); ok {
+			report.Errors = append(report.Errors, recordErr)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		report.Count++
+		report.SliceCounts[slice]++
+	}
+}
+
+func dryRunImportBits(report *ImportReport, bitIterator BitIterator) error {
+	return dryRunImport(report, func(line int) (uint64, error) {
+		bit, err := bitIterator.NextBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit.Timestamp != 0 && (bit.Timestamp < minImportTimestamp || bit.Timestamp > maxImportTimestamp) {
+			return 0, newRecordError(line, "Timestamp out of range at line")
+		}
+		return bit.ColumnID / sliceWidth, nil
+	})
+}
+
+func dryRunImportValues(report *ImportReport, frame *Frame, field string, valueIterator ValueIterator) error {
+	min, max, hasRange := frameFieldRange(frame, field)
+	return dryRunImport(report, func(line int) (uint64, error) {
+		val, err := valueIterator.NextValue()
+		if err != nil {
+			return 0, err
+		}
+		if hasRange && (val.Value < min || val.Value > max) {
+			return 0, newRecordError(line, "Value out of range at line")
+		}
+		return val.ColumnID / sliceWidth, nil
+	})
+}
+
+// frameFieldRange returns the minimum and maximum values of a field if they are in the frame options.
+func frameFieldRange(frame *Frame, name string) (min int64, max int64, ok bool) {
+	if frame.options == nil {
+		return 0, 0, false
+	}
+	field, ok := frame.options.fields[name]
+	if !ok {
+		return 0, 0, false
+	}
+	min, minOK := field.intValue("min")
+	max, maxOK := field.intValue("max")
+	return min, max, minOK && maxOK
+}
@@ -0,0 +1,345 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestImportWorkersRunInParallel(t *testing.T) {
+	workers := newImportWorkers(context.Background(), 3)
+	mutex := &sync.Mutex{}
+	running, maxRunning := 0, 0
+	for i := 0; i < 6; i++ {
+		err := workers.run(uint64(i), func(ctx context.Context) error {
+			mutex.Lock()
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+			mutex.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mutex.Lock()
+			running--
+			mutex.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := workers.wait(); err != nil {
+		t.Fatal(err)
+	}
+	if maxRunning < 2 || maxRunning > 3 {
+		t.Fatalf("jobs should run on 3 workers, %d ran at the same time", maxRunning)
+	}
+}
+
+func TestImportWorkersKeepOrderForKey(t *testing.T) {
+	workers := newImportWorkers(context.Background(), 4)
+	mutex := &sync.Mutex{}
+	order := []int{}
+	for i := 0; i < 20; i++ {
+		i := i
+		err := workers.run(7, func(ctx context.Context) error {
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := workers.wait(); err != nil {
+		t.Fatal(err)
+	}
+	for i, job := range order {
+		if i != job {
+			t.Fatalf("jobs with the same key should run in order: %v", order)
+		}
+	}
+}
+
+func TestImportWorkersStopOnError(t *testing.T) {
+	for _, count := range []int{0, 4} {
+		workers := newImportWorkers(context.Background(), count)
+		jobErr := errors.New("import failed")
+		var err error
+		for i := 0; i < 100 && err == nil; i++ {
+			i := i
+			err = workers.run(uint64(i), func(ctx context.Context) error {
+				if i == 2 {
+					return jobErr
+				}
+				return nil
+			})
+		}
+		if waitErr := workers.wait(); waitErr != jobErr {
+			t.Fatalf("%d workers: the error of the failing job should be returned, got %v", count, waitErr)
+		}
+		if err == nil {
+			t.Fatalf("%d workers: run should fail after a job failed", count)
+		}
+	}
+}
+
+func TestImportWorkersCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := newImportWorkers(ctx, 2)
+	cancel()
+	workers.run(0, func(ctx context.Context) error { return nil })
+	if err := workers.wait(); err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got %v", err)
+	}
+}
+
+func TestImportCheckpointToken(t *testing.T) {
+	checkpoint := NewImportCheckpoint()
+	if _, err := checkpoint.begin(100); err != nil {
+		t.Fatal(err)
+	}
+	checkpoint.acknowledge(5)
+	checkpoint.acknowledge(0)
+	checkpoint.acknowledge(5)
+	token := checkpoint.Token()
+	if token != "100:0=1,5=2" {
+		t.Fatalf("unexpected token: %s", token)
+	}
+	parsed, err := ParseImportCheckpoint(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Batches(0) != 1 || parsed.Batches(5) != 2 || parsed.Batches(3) != 0 {
+		t.Fatalf("unexpected checkpoint: %s", parsed.Token())
+	}
+	if _, err := parsed.begin(10); err != ErrInvalidImportCheckpoint {
+		t.Fatalf("ErrInvalidImportCheckpoint expected for another batch size, got %v", err)
+	}
+	empty, err := ParseImportCheckpoint(NewImportCheckpoint().Token())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.Token() != "0:" {
+		t.Fatalf("unexpected token: %s", empty.Token())
+	}
+}
+
+func TestImportCheckpointFrameToken(t *testing.T) {
+	checkpoint := NewImportCheckpoint()
+	frame1 := checkpoint.frame("index1", "frame1")
+	if checkpoint.frame("index1", "frame1") != frame1 {
+		t.Fatalf("the checkpoint of a frame should be kept")
+	}
+	if _, err := frame1.begin(100); err != nil {
+		t.Fatal(err)
+	}
+	frame1.acknowledge(0)
+	checkpoint.frame("index2", "frame1").acknowledge(3)
+	token := checkpoint.Token()
+	if token != "0: index1/frame1=100:0=1 index2/frame1=0:3=1" {
+		t.Fatalf("unexpected token: %s", token)
+	}
+	parsed, err := ParseImportCheckpoint(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Token() != token {
+		t.Fatalf("%s != %s", token, parsed.Token())
+	}
+	if parsed.frame("index1", "frame1").Batches(0) != 1 || parsed.frame("index1", "frame2").Batches(0) != 0 {
+		t.Fatalf("unexpected checkpoint: %s", parsed.Token())
+	}
+}
+
+func TestParseImportCheckpointInvalid(t *testing.T) {
+	for _, token := range []string{"", "100", "x:0=1", "100:0", "100:a=1", "100:0=-1", "100:0=1,",
+		"100: index1", "100: index1=100:", "100: index1/frame1=100", "100: index1/frame1=100: index1/frame1=100:"} {
+		if _, err := ParseImportCheckpoint(token); err != ErrInvalidImportCheckpoint {
+			t.Fatalf("ErrInvalidImportCheckpoint expected for %q, got %v", token, err)
+		}
+	}
+}
+
+func TestRetryImport(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3}
+	attempts := 0
+	err := retryImport(context.Background(), policy, func() error {
+		attempts++
+		if attempts < 3 {
+			return ErrTriedMaxHosts
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Fatalf("the import should succeed on the third attempt, got %v after %d attempts", err, attempts)
+	}
+	attempts = 0
+	permanent := errors.New("permanent")
+	err = retryImport(context.Background(), policy, func() error {
+		attempts++
+		return permanent
+	})
+	if err != permanent || attempts != 1 {
+		t.Fatalf("non-retryable errors should not be retried, got %v after %d attempts", err, attempts)
+	}
+}
+
+func TestQueuedImportWorkersDoNotBlock(t *testing.T) {
+	workers := newQueuedImportWorkers(context.Background(), 1)
+	release := make(chan struct{})
+	mutex := &sync.Mutex{}
+	order := []int{}
+	for i := 0; i < 5; i++ {
+		i := i
+		err := workers.run(0, func(ctx context.Context) error {
+			<-release
+			mutex.Lock()
+			order = append(order, i)
+			mutex.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// all of the jobs were queued while the first one is blocked
+	close(release)
+	if err := workers.wait(); err != nil {
+		t.Fatal(err)
+	}
+	if target := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(target, order) {
+		t.Fatalf("%v != %v", target, order)
+	}
+}
+
+func TestImportBufferSpillsBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosa-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buffer := newImportBuffer(2*bitSize, dir)
+	defer buffer.close()
+	imported := [][]Bit{}
+	importFn := func(ctx context.Context, bits []Bit) error {
+		imported = append(imported, bits)
+		return nil
+	}
+	batches := [][]Bit{
+		{{RowID: 1, ColumnID: 1}, {RowID: 1, ColumnID: 2}},
+		{{RowID: 2, ColumnID: 3, Timestamp: 683793200}},
+	}
+	jobs := []func(ctx context.Context) error{}
+	for _, batch := range batches {
+		job, err := buffer.holdBits(batch, importFn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("the second batch should be spilled, %d files", len(files))
+	}
+	for _, job := range jobs {
+		if err := job(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(batches, imported) {
+		t.Fatalf("%v != %v", batches, imported)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("the spill file should be removed, %d files", len(files))
+	}
+	if buffer.size != 0 {
+		t.Fatalf("the buffer should be empty, size: %d", buffer.size)
+	}
+}
+
+func TestImportBufferSpillsValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosa-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buffer := newImportBuffer(1, dir)
+	defer buffer.close()
+	var imported []FieldValue
+	importFn := func(ctx context.Context, vals []FieldValue) error {
+		imported = vals
+		return nil
+	}
+	// the first batch is kept in memory although it is larger than the budget
+	if _, err := buffer.holdValues([]FieldValue{{ColumnID: 1, Value: 1}}, importFn); err != nil {
+		t.Fatal(err)
+	}
+	vals := []FieldValue{{ColumnID: 2, Value: -5}}
+	job, err := buffer.holdValues(vals, importFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = job(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(vals, imported) {
+		t.Fatalf("%v != %v", vals, imported)
+	}
+}
+
+func TestImportBufferCloseRemovesSpillFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosa-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buffer := newImportBuffer(1, dir)
+	importFn := func(ctx context.Context, bits []Bit) error { return nil }
+	for i := 0; i < 3; i++ {
+		if _, err := buffer.holdBits([]Bit{{RowID: 1, ColumnID: uint64(i)}}, importFn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buffer.close()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("the spill files should be removed, %d files", len(files))
+	}
+}
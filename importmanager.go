@@ -0,0 +1,270 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"sync"
+)
+
+// ImportManager imports bits which are pushed to it over time, e.g., by a streaming ingestion service.
+// Bits are grouped by slice and imported in batches of batchSize bits, like with ImportFrame.
+// Call Flush to wait until the bits ingested so far are imported, and Close when done.
+// It is safe to use an ImportManager from several goroutines.
+type ImportManager struct {
+	client    *Client
+	ctx       context.Context
+	frame     *Frame
+	field     string
+	batchSize uint
+	options   *ImportOptions
+	mutex     *sync.Mutex
+	bitGroup  map[uint64][]Bit
+	valGroup  map[uint64][]FieldValue
+	size      uint
+	nodes     *fragmentNodeCache
+	batches   *importBatches
+	progress  *importProgress
+	buffer    *importBuffer
+	workers   *importWorkers
+	err       error
+	closed    bool
+	// clearWithQueries is set if the bits are cleared with ClearBit queries, since the server cannot clear them with imports
+	clearWithQueries bool
+}
+
+// StartImport starts an import for a frame, to which bits are pushed with Ingest.
+// Pass *ImportOptions or ImportOption values to customize the import.
+// The ImportDryRun option is not supported.
+func (c *Client) StartImport(frame *Frame, batchSize uint, options ...interface{}) (*ImportManager, error) {
+	return c.StartImportWithContext(context.Background(), frame, batchSize, options...)
+}
+
+// StartImportWithContext starts an import for a frame, to which bits are pushed with Ingest.
+// The context is used for all of the requests of the import.
+func (c *Client) StartImportWithContext(ctx context.Context, frame *Frame, batchSize uint, options ...interface{}) (*ImportManager, error) {
+	importOptions := &ImportOptions{}
+	if err := importOptions.addOptions(options...); err != nil {
+		return nil, err
+	}
+	if importOptions.DryRun != nil {
+		return nil, ErrInvalidImportOption
+	}
+	return c.startImport(ctx, frame, batchSize, importOptions)
+}
+
+func (c *Client) startImport(ctx context.Context, frame *Frame, batchSize uint, options *ImportOptions) (*ImportManager, error) {
+	clearWithQueries := false
+	if options.Clear {
+		// older servers would set the bits instead
+		supported, err := c.clearImportSupported(ctx)
+		if err != nil {
+			return nil, err
+		}
+		clearWithQueries = !supported
+	}
+	batches, err := newImportBatches(options.Checkpoint, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	if options.RetryPolicy == nil {
+		options.RetryPolicy = c.options.RetryPolicy
+	}
+	m := &ImportManager{
+		client:    c,
+		ctx:       ctx,
+		frame:     frame,
+		batchSize: batchSize,
+		options:   options,
+		mutex:     &sync.Mutex{},
+		bitGroup:  map[uint64][]Bit{},
+		valGroup:  map[uint64][]FieldValue{},
+		nodes:     newFragmentNodeCache(),
+		batches:   batches,
+		progress:  newImportProgress(options),
+		buffer:    newImportBuffer(options.MaxBufferSize, options.SpillDir),
+	}
+	m.clearWithQueries = clearWithQueries
+	m.workers = m.newWorkers()
+	return m, nil
+}
+
+func (m *ImportManager) newWorkers() *importWorkers {
+	if m.buffer != nil {
+		return newQueuedImportWorkers(m.ctx, m.options.ThreadCount)
+	}
+	return newImportWorkers(m.ctx, m.options.ThreadCount)
+}
+
+// Ingest adds bits to the import. The batches which are full are passed to the workers of the import,
+// and Ingest may wait for the workers if there are no buffered batches.
+// It returns the error of the first failing batch, after which the import stops.
+func (m *ImportManager) Ingest(bits ...Bit) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrImportManagerClosed
+	}
+	for _, bit := range bits {
+		if m.err != nil {
+			break
+		}
+		slice := bit.ColumnID / sliceWidth
+		m.bitGroup[slice] = append(m.bitGroup[slice], bit)
+		m.added()
+	}
+	return m.err
+}
+
+// ingestValues adds field values to the import, like Ingest adds bits.
+// The values are imported to the field of the import.
+func (m *ImportManager) ingestValues(vals ...FieldValue) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrImportManagerClosed
+	}
+	for _, val := range vals {
+		if m.err != nil {
+			break
+		}
+		slice := val.ColumnID / sliceWidth
+		m.valGroup[slice] = append(m.valGroup[slice], val)
+		m.added()
+	}
+	return m.err
+}
+
+// added counts an ingested bit or value, and starts importing if the batch is full.
+func (m *ImportManager) added() {
+	m.size++
+	if m.size >= m.batchSize {
+		m.send()
+	}
+}
+
+// Flush imports the bits ingested so far, and waits until they are imported.
+func (m *ImportManager) Flush() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return ErrImportManagerClosed
+	}
+	m.send()
+	m.wait()
+	if m.err == nil {
+		m.workers = m.newWorkers()
+	}
+	return m.err
+}
+
+// Close imports the remaining bits, waits until they are imported and stops the import.
+// It returns the error of the first failing batch, if any.
+// It is safe to call Close more than once.
+func (m *ImportManager) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return m.err
+	}
+	m.send()
+	m.stop()
+	return m.err
+}
+
+// abort stops the import without importing the remaining bits.
+func (m *ImportManager) abort() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.closed {
+		m.stop()
+	}
+}
+
+func (m *ImportManager) stop() {
+	m.closed = true
+	m.wait()
+	m.progress.finish()
+	m.buffer.close()
+}
+
+// send passes the bits and values to the workers. It does nothing if a batch failed before.
+func (m *ImportManager) send() {
+	if m.err != nil {
+		return
+	}
+	indexName := m.frame.index.name
+	frameName := m.frame.name
+	m.sendSlices(sortedSlices(m.bitGroup), func(slice uint64) (func(ctx context.Context) error, error) {
+		return m.buffer.holdBits(m.bitGroup[slice], func(ctx context.Context, bits []Bit) error {
+			if m.clearWithQueries {
+				return m.client.clearBitsWithQuery(ctx, m.frame, slice, bits, m.progress, m.options)
+			}
+			return m.client.importBits(ctx, indexName, frameName, slice, bits, m.nodes, m.progress, m.options)
+		})
+	})
+	m.sendSlices(sortedValueSlices(m.valGroup), func(slice uint64) (func(ctx context.Context) error, error) {
+		return m.buffer.holdValues(m.valGroup[slice], func(ctx context.Context, vals []FieldValue) error {
+			return m.client.importValues(ctx, indexName, frameName, slice, m.field, vals, m.nodes, m.progress, m.options)
+		})
+	})
+	m.bitGroup = map[uint64][]Bit{}
+	m.valGroup = map[uint64][]FieldValue{}
+	m.size = 0
+}
+
+// sendSlices passes the import job of each slice to the workers, and records the error of the first failing job.
+func (m *ImportManager) sendSlices(slices []uint64, hold func(slice uint64) (func(ctx context.Context) error, error)) {
+	for _, slice := range slices {
+		if m.err != nil {
+			return
+		}
+		if !m.batches.next(slice) {
+			// imported before the checkpoint
+			continue
+		}
+		job, err := hold(slice)
+		if err == nil {
+			err = m.workers.run(slice, job)
+		}
+		if err != nil {
+			m.err = err
+		}
+	}
+}
+
+// wait waits for the workers and records their error.
+func (m *ImportManager) wait() {
+	if err := m.workers.wait(); err != nil && m.err == nil {
+		m.err = err
+	}
+}
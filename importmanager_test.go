@@ -0,0 +1,188 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+type recordedImports struct {
+	mutex   *sync.Mutex
+	columns []uint64
+}
+
+func (r *recordedImports) get() []uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]uint64{}, r.columns...)
+}
+
+func newImportManagerTestClient(t *testing.T, importStatus int) (*Client, *recordedImports) {
+	imported := &recordedImports{mutex: &sync.Mutex{}}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		status := 200
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			status = importStatus
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			request := &pbuf.ImportRequest{}
+			if err = proto.Unmarshal(data, request); err != nil {
+				return nil, err
+			}
+			if status == 200 {
+				imported.mutex.Lock()
+				imported.columns = append(imported.columns, request.ColumnIDs...)
+				imported.mutex.Unlock()
+			} else {
+				body = []byte("import failed")
+			}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, imported
+}
+
+func TestImportManager(t *testing.T) {
+	client, imported := newImportManagerTestClient(t, 200)
+	summary := &ImportSummary{}
+	manager, err := client.StartImport(sampleFrame, 3, ThreadCount(2), Summary(summary))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Ingest(Bit{RowID: 1, ColumnID: 1}, Bit{RowID: 1, ColumnID: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.get()) != 0 {
+		t.Fatalf("the batch should not be imported before it is full: %v", imported.get())
+	}
+	if err = manager.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if target := []uint64{1, 2}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+	if err = manager.Ingest(Bit{RowID: 1, ColumnID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if target := []uint64{1, 2, 3}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+	if summary.Count != 3 || summary.Batches != 2 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if err = manager.Close(); err != nil {
+		t.Fatalf("closing again should not fail: %v", err)
+	}
+	if err = manager.Ingest(Bit{RowID: 1, ColumnID: 4}); err != ErrImportManagerClosed {
+		t.Fatalf("ErrImportManagerClosed expected, got %v", err)
+	}
+	if err = manager.Flush(); err != ErrImportManagerClosed {
+		t.Fatalf("ErrImportManagerClosed expected, got %v", err)
+	}
+}
+
+func TestImportManagerImportsFullBatches(t *testing.T) {
+	client, imported := newImportManagerTestClient(t, 200)
+	manager, err := client.StartImport(sampleFrame, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Ingest(Bit{RowID: 1, ColumnID: 1}, Bit{RowID: 1, ColumnID: 2}, Bit{RowID: 1, ColumnID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	// without workers, full batches are imported by Ingest
+	if target := []uint64{1, 2}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+	if err = manager.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if target := []uint64{1, 2, 3}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+}
+
+func TestImportManagerFails(t *testing.T) {
+	client, _ := newImportManagerTestClient(t, http.StatusBadRequest)
+	manager, err := client.StartImport(sampleFrame, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = manager.Ingest(Bit{RowID: 1, ColumnID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	err = manager.Flush()
+	if err == nil || !strings.HasSuffix(err.Error(), "import failed") {
+		t.Fatalf("the flush should fail with the server error, got %v", err)
+	}
+	if manager.Ingest(Bit{RowID: 1, ColumnID: 2}) != err {
+		t.Fatal("Ingest should return the error of the failed batch")
+	}
+	if manager.Close() != err {
+		t.Fatal("Close should return the error of the failed batch")
+	}
+}
+
+func TestStartImportInvalidOptions(t *testing.T) {
+	client := DefaultClient()
+	if _, err := client.StartImport(sampleFrame, 10, ImportDryRun(&ImportReport{})); err != ErrInvalidImportOption {
+		t.Fatalf("ErrInvalidImportOption expected, got %v", err)
+	}
+	if _, err := client.StartImport(sampleFrame, 10, "thread count"); err != ErrInvalidImportOption {
+		t.Fatalf("ErrInvalidImportOption expected, got %v", err)
+	}
+}
@@ -43,8 +43,10 @@ import (
 
 // Bit defines a single Pilosa bit.
 type Bit struct {
-	RowID     uint64
-	ColumnID  uint64
+	RowID    uint64
+	ColumnID uint64
+	// Timestamp is the Unix time of the bit in seconds, used to set the bit in the time views
+	// of a frame with a time quantum. The bit has no time if it is 0.
 	Timestamp int64
 }
 
@@ -53,6 +55,26 @@ type BitIterator interface {
 	NextBit() (Bit, error)
 }
 
+// RecordError is returned by an iterator when a record cannot be parsed.
+// The iteration can continue with the next record.
+type RecordError struct {
+	// Line is the line or row number of the record, starting from 1.
+	Line int
+	// Message describes the error, including the line number.
+	Message string
+}
+
+func newRecordError(line int, message string) *RecordError {
+	return &RecordError{
+		Line:    line,
+		Message: fmt.Sprintf("%s: %d", message, line),
+	}
+}
+
+func (e *RecordError) Error() string {
+	return e.Message
+}
+
 // CSVBitIterator reads bits from a Reader.
 // Each line should contain a single bit in the following form:
 // rowID,columnID[,timestamp]
@@ -73,12 +95,13 @@ func NewCSVBitIterator(reader io.Reader) *CSVBitIterator {
 }
 
 // NewCSVBitIteratorWithTimestampFormat creates a CSVBitIterator from a Reader with a custom timestamp format.
+// The timestamps are parsed with time.Parse using the given layout, e.g., "2006-01-02T15:04".
 func NewCSVBitIteratorWithTimestampFormat(reader io.Reader, timestampFormat string) *CSVBitIterator {
 	return &CSVBitIterator{
 		reader:          reader,
 		line:            0,
 		scanner:         bufio.NewScanner(reader),
-		timestampFormat: timeFormat,
+		timestampFormat: timestampFormat,
 	}
 }
 
@@ -90,27 +113,27 @@ func (c *CSVBitIterator) NextBit() (Bit, error) {
 		text := strings.TrimSpace(c.scanner.Text())
 		parts := strings.Split(text, ",")
 		if len(parts) < 2 {
-			return Bit{}, fmt.Errorf("Invalid CSV line: %d", c.line)
+			return Bit{}, newRecordError(c.line, "Invalid CSV line")
 		}
 		rowID, err := strconv.Atoi(parts[0])
 		if err != nil {
-			return Bit{}, fmt.Errorf("Invalid row ID at line: %d", c.line)
+			return Bit{}, newRecordError(c.line, "Invalid row ID at line")
 		}
 		columnID, err := strconv.Atoi(parts[1])
 		if err != nil {
-			return Bit{}, fmt.Errorf("Invalid column ID at line: %d", c.line)
+			return Bit{}, newRecordError(c.line, "Invalid column ID at line")
 		}
 		timestamp := 0
 		if len(parts) == 3 {
 			if c.timestampFormat == "" {
 				timestamp, err = strconv.Atoi(parts[2])
 				if err != nil {
-					return Bit{}, fmt.Errorf("Invalid timestamp at line: %d", c.line)
+					return Bit{}, newRecordError(c.line, "Invalid timestamp at line")
 				}
 			} else {
 				t, err := time.Parse(c.timestampFormat, parts[2])
 				if err != nil {
-					return Bit{}, fmt.Errorf("Invalid timestamp at line: %d", c.line)
+					return Bit{}, newRecordError(c.line, "Invalid timestamp at line")
 				}
 				timestamp = int(t.Unix())
 			}
@@ -129,6 +152,49 @@ func (c *CSVBitIterator) NextBit() (Bit, error) {
 	return Bit{}, io.EOF
 }
 
+// SliceBitIterator returns bits from a slice of bits.
+type SliceBitIterator struct {
+	bits  []Bit
+	index int
+}
+
+// NewSliceBitIterator creates a SliceBitIterator which returns the given bits in order.
+func NewSliceBitIterator(bits []Bit) *SliceBitIterator {
+	return &SliceBitIterator{bits: bits}
+}
+
+// NextBit returns the next bit in the slice.
+// Returns io.EOF on end of iteration.
+func (s *SliceBitIterator) NextBit() (Bit, error) {
+	if s.index >= len(s.bits) {
+		return Bit{}, io.EOF
+	}
+	bit := s.bits[s.index]
+	s.index++
+	return bit, nil
+}
+
+// ChannelBitIterator returns bits received from a channel.
+type ChannelBitIterator struct {
+	bits <-chan Bit
+}
+
+// NewChannelBitIterator creates a ChannelBitIterator which returns the bits received from the given channel.
+// Close the channel to end the iteration.
+func NewChannelBitIterator(bits <-chan Bit) *ChannelBitIterator {
+	return &ChannelBitIterator{bits: bits}
+}
+
+// NextBit waits for the next bit from the channel.
+// Returns io.EOF once the channel is closed.
+func (c *ChannelBitIterator) NextBit() (Bit, error) {
+	bit, ok := <-c.bits
+	if !ok {
+		return Bit{}, io.EOF
+	}
+	return bit, nil
+}
+
 type bitsForSort []Bit
 
 func (b bitsForSort) Len() int {
@@ -159,6 +225,28 @@ type ValueIterator interface {
 	NextValue() (FieldValue, error)
 }
 
+// SliceValueIterator returns field values from a slice of field values.
+type SliceValueIterator struct {
+	values []FieldValue
+	index  int
+}
+
+// NewSliceValueIterator creates a SliceValueIterator which returns the given field values in order.
+func NewSliceValueIterator(values []FieldValue) *SliceValueIterator {
+	return &SliceValueIterator{values: values}
+}
+
+// NextValue returns the next field value in the slice.
+// Returns io.EOF on end of iteration.
+func (s *SliceValueIterator) NextValue() (FieldValue, error) {
+	if s.index >= len(s.values) {
+		return FieldValue{}, io.EOF
+	}
+	value := s.values[s.index]
+	s.index++
+	return value, nil
+}
+
 // CSVValueIterator reads field values from a Reader.
 // Each line should contain a single field value in the following form:
 // columnID,value
@@ -185,15 +273,15 @@ func (c *CSVValueIterator) NextValue() (FieldValue, error) {
 		text := strings.TrimSpace(c.scanner.Text())
 		parts := strings.Split(text, ",")
 		if len(parts) < 2 {
-			return FieldValue{}, fmt.Errorf("Invalid CSV line: %d", c.line)
+			return FieldValue{}, newRecordError(c.line, "Invalid CSV line")
 		}
 		columnID, err := strconv.Atoi(parts[0])
 		if err != nil {
-			return FieldValue{}, fmt.Errorf("Invalid column ID at line: %d", c.line)
+			return FieldValue{}, newRecordError(c.line, "Invalid column ID at line")
 		}
 		value, err := strconv.Atoi(parts[1])
 		if err != nil {
-			return FieldValue{}, fmt.Errorf("Invalid value at line: %d", c.line)
+			return FieldValue{}, newRecordError(c.line, "Invalid value at line")
 		}
 		fieldValue := FieldValue{
 			ColumnID: uint64(columnID),
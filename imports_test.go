@@ -38,6 +38,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	pilosa "github.com/pilosa/go-pilosa"
 )
@@ -70,8 +71,52 @@ func TestCSVBitIterator(t *testing.T) {
 	}
 }
 
+func TestSliceBitIterator(t *testing.T) {
+	target := []pilosa.Bit{
+		{RowID: 1, ColumnID: 10},
+		{RowID: 5, ColumnID: 20, Timestamp: 683793300},
+	}
+	bits := readBits(t, pilosa.NewSliceBitIterator(target))
+	if !reflect.DeepEqual(target, bits) {
+		t.Fatalf("%v != %v", target, bits)
+	}
+}
+
+func TestChannelBitIterator(t *testing.T) {
+	target := []pilosa.Bit{
+		{RowID: 1, ColumnID: 10},
+		{RowID: 5, ColumnID: 20},
+		{RowID: 3, ColumnID: 41},
+	}
+	ch := make(chan pilosa.Bit)
+	go func() {
+		for _, bit := range target {
+			ch <- bit
+		}
+		close(ch)
+	}()
+	bits := readBits(t, pilosa.NewChannelBitIterator(ch))
+	if !reflect.DeepEqual(target, bits) {
+		t.Fatalf("%v != %v", target, bits)
+	}
+}
+
+func readBits(t *testing.T, iterator pilosa.BitIterator) []pilosa.Bit {
+	bits := []pilosa.Bit{}
+	for {
+		bit, err := iterator.NextBit()
+		if err == io.EOF {
+			return bits
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bits = append(bits, bit)
+	}
+}
+
 func TestCSVBitIteratorWithTimestampFormat(t *testing.T) {
-	format := "2014-07-16T20:55"
+	format := "2006-01-02T15:04"
 	iterator := pilosa.NewCSVBitIteratorWithTimestampFormat(strings.NewReader(`1,10,1991-09-02T09:33
 		5,20,1991-09-02T09:35
 		3,41,1991-09-02T09:36`), format)
@@ -99,6 +144,19 @@ func TestCSVBitIteratorWithTimestampFormat(t *testing.T) {
 	}
 }
 
+func TestCSVBitIteratorWithRFC3339Timestamps(t *testing.T) {
+	iterator := pilosa.NewCSVBitIteratorWithTimestampFormat(strings.NewReader(`1,10,1991-09-02T09:33:00Z
+		5,20,1991-09-02T11:35:00+02:00`), time.RFC3339)
+	target := []pilosa.Bit{
+		{RowID: 1, ColumnID: 10, Timestamp: 683803980},
+		{RowID: 5, ColumnID: 20, Timestamp: 683804100},
+	}
+	bits := readBits(t, iterator)
+	if !reflect.DeepEqual(target, bits) {
+		t.Fatalf("%v != %v", target, bits)
+	}
+}
+
 func TestCSVBitIteratorWithTimestampFormatFail(t *testing.T) {
 	format := "2014-07-16"
 	iterator := pilosa.NewCSVBitIteratorWithTimestampFormat(strings.NewReader(`1,10,X`), format)
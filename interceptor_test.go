@@ -0,0 +1,105 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	var calls []string
+	recorder := func(name string) Interceptor {
+		return func(next Doer) Doer {
+			return DoerFunc(func(req *http.Request) (*http.Response, error) {
+				calls = append(calls, name)
+				req.Header.Add("X-Interceptor", name)
+				return next.Do(req)
+			})
+		}
+	}
+	var headers []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		headers = req.Header["X-Interceptor"]
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": []}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101",
+		HTTPTransport(transport),
+		Interceptors(recorder("first"), recorder("second")),
+		Interceptors(recorder("third")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Views(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{"first", "second", "third"}
+	if !reflect.DeepEqual(target, calls) {
+		t.Fatalf("%v != %v", target, calls)
+	}
+	if !reflect.DeepEqual(target, headers) {
+		t.Fatalf("%v != %v", target, headers)
+	}
+}
+
+func TestInterceptorShortCircuit(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("the request should not be sent")
+		return nil, nil
+	})
+	cached := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(`{"views": ["standard"]}`)),
+			}, nil
+		})
+	}
+	client, err := NewClient(":10101", HTTPTransport(transport), Interceptors(cached))
+	if err != nil {
+		t.Fatal(err)
+	}
+	views, err := client.Views(sampleFrame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"standard"}, views) {
+		t.Fatalf("unexpected views: %v", views)
+	}
+}
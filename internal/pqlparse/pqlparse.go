@@ -0,0 +1,282 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+// Package pqlparse parses PQL queries into calls with their arguments.
+// It is shared by the client, which checks the names and nesting of the calls,
+// and the pilosatest package, which evaluates them.
+package pqlparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Call is a parsed PQL call with its arguments.
+type Call struct {
+	Name string
+	// Args are the arguments of the call with their values, which are strings, Numbers, booleans,
+	// lists of values or nil.
+	Args     map[string]interface{}
+	Children []*Call
+	// Condition is the comparison of a Range call on a field, e.g., "x > 10".
+	Condition *Condition
+}
+
+// Condition is a comparison of a field with a value.
+type Condition struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// Number keeps the text of a number, so it can be read as a signed or an unsigned integer or a float.
+type Number string
+
+// Parse parses the top level calls of the query.
+func Parse(pql string) ([]*Call, error) {
+	p := &pqlParser{s: pql}
+	calls := []*Call{}
+	for {
+		p.skipSpace()
+		if p.done() {
+			return calls, nil
+		}
+		call, err := p.parseCall()
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+	}
+}
+
+type pqlParser struct {
+	s   string
+	pos int
+}
+
+func (p *pqlParser) done() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *pqlParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.s[p.pos]
+}
+
+func (p *pqlParser) skipSpace() {
+	for !p.done() && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *pqlParser) expect(c byte) error {
+	p.skipSpace()
+	if p.peek() != c {
+		return p.errorf("'%c' expected", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *pqlParser) ident() string {
+	start := p.pos
+	for !p.done() && isIdentByte(p.s[p.pos], p.pos == start) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *pqlParser) parseCall() (*Call, error) {
+	name := p.ident()
+	if name == "" {
+		return nil, p.errorf("call name expected")
+	}
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	call := &Call{Name: name, Args: map[string]interface{}{}}
+	p.skipSpace()
+	if p.peek() == ')' {
+		p.pos++
+		return call, nil
+	}
+	for {
+		if err := p.parseArg(call); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ')':
+			p.pos++
+			return call, nil
+		default:
+			return nil, p.errorf("',' or ')' expected in %s", name)
+		}
+	}
+}
+
+func (p *pqlParser) parseArg(call *Call) error {
+	p.skipSpace()
+	start := p.pos
+	key := p.ident()
+	if key == "" {
+		return p.errorf("argument expected in %s", call.Name)
+	}
+	p.skipSpace()
+	if p.peek() == '(' {
+		p.pos = start
+		child, err := p.parseCall()
+		if err != nil {
+			return err
+		}
+		call.Children = append(call.Children, child)
+		return nil
+	}
+	op := p.operator()
+	if op == "" {
+		return p.errorf("'=' expected after %s", key)
+	}
+	value, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	if op == "=" {
+		call.Args[key] = value
+		return nil
+	}
+	if call.Condition != nil {
+		return p.errorf("more than one condition in %s", call.Name)
+	}
+	call.Condition = &Condition{Field: key, Op: op, Value: value}
+	return nil
+}
+
+func (p *pqlParser) operator() string {
+	for _, op := range []string{"==", "!=", "<=", ">=", "><", "=", "<", ">"} {
+		if strings.HasPrefix(p.s[p.pos:], op) {
+			p.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *pqlParser) parseValue() (interface{}, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '\'' || c == '"':
+		return p.parseString(c)
+	case c == '[':
+		return p.parseList()
+	case c == '-' || c >= '0' && c <= '9':
+		start := p.pos
+		p.pos++
+		for !p.done() && strings.IndexByte("0123456789.eE+-", p.s[p.pos]) >= 0 {
+			p.pos++
+		}
+		return Number(p.s[start:p.pos]), nil
+	}
+	switch word := p.ident(); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return nil, p.errorf("value expected")
+}
+
+func (p *pqlParser) parseString(quote byte) (string, error) {
+	start := p.pos
+	p.pos++
+	var b []byte
+	for !p.done() {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			b = append(b, p.s[p.pos+1])
+			p.pos += 2
+			continue
+		case c == quote:
+			p.pos++
+			return string(b), nil
+		}
+		b = append(b, c)
+		p.pos++
+	}
+	p.pos = start
+	return "", p.errorf("unterminated string")
+}
+
+func (p *pqlParser) parseList() ([]interface{}, error) {
+	p.pos++
+	list := []interface{}{}
+	p.skipSpace()
+	if p.peek() == ']' {
+		p.pos++
+		return list, nil
+	}
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+			p.pos++
+			return list, nil
+		default:
+			return nil, p.errorf("',' or ']' expected")
+		}
+	}
+}
+
+func (p *pqlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("PQL parse error at %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func isIdentByte(c byte, first bool) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	return !first && (c >= '0' && c <= '9' || c == '_' || c == '-')
+}
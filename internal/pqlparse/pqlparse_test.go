@@ -0,0 +1,83 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pqlparse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	calls, err := Parse(`SetBit(rowID=1, frame='a(b', columnID=2) Count(Union(Bitmap(rowID=1, frame="f)"), Range(frame='f', x >< [1,2])))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("2 != %d", len(calls))
+	}
+	args := map[string]interface{}{"rowID": Number("1"), "frame": "a(b", "columnID": Number("2")}
+	if calls[0].Name != "SetBit" || !reflect.DeepEqual(args, calls[0].Args) || len(calls[0].Children) != 0 {
+		t.Fatalf("invalid call: %#v", calls[0])
+	}
+	count := calls[1]
+	if count.Name != "Count" || len(count.Children) != 1 {
+		t.Fatalf("invalid call: %#v", count)
+	}
+	union := count.Children[0]
+	if union.Name != "Union" || len(union.Children) != 2 {
+		t.Fatalf("invalid call: %#v", union)
+	}
+	if union.Children[0].Name != "Bitmap" || union.Children[1].Name != "Range" {
+		t.Fatalf("invalid children: %#v", union.Children)
+	}
+	condition := &Condition{Field: "x", Op: "><", Value: []interface{}{Number("1"), Number("2")}}
+	if !reflect.DeepEqual(condition, union.Children[1].Condition) {
+		t.Fatalf("invalid condition: %#v", union.Children[1].Condition)
+	}
+}
+
+func TestParseFails(t *testing.T) {
+	invalid := []string{
+		"Bitmap(rowID=1",
+		"Bitmap rowID=1)",
+		"(rowID=1)",
+		"Bitmap(frame='foo)",
+		"Bitmap(frame=['foo')",
+		"Count(Bitmap(rowID=1, frame='f')",
+	}
+	for _, pql := range invalid {
+		if _, err := Parse(pql); err == nil {
+			t.Fatalf("parsing %s should have failed", pql)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var jsonHeaders = map[string]string{
+	"Content-Type": "text/plain",
+	"Accept":       "application/json",
+}
+
+// makeJSONRequestPath returns the query path with the query options
+// passed as URL parameters, as the body of a JSON request is the raw query.
+func makeJSONRequestPath(path string, options *QueryOptions) string {
+	values := url.Values{}
+	if options.Columns {
+		values.Set("columnAttrs", "true")
+	}
+	if options.ExcludeAttrs {
+		values.Set("excludeAttrs", "true")
+	}
+	if options.ExcludeBits {
+		values.Set("excludeBits", "true")
+	}
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+type jsonQueryResponse struct {
+	Results     []json.RawMessage `json:"results"`
+	ColumnAttrs []struct {
+		ID    uint64                 `json:"id"`
+		Attrs map[string]interface{} `json:"attrs"`
+	} `json:"columnAttrs"`
+	Err string `json:"error"`
+}
+
+type jsonResult struct {
+	Attrs map[string]interface{} `json:"attrs"`
+	Bits  []uint64               `json:"bits"`
+	Sum   *int64                 `json:"sum"`
+	Count uint64                 `json:"count"`
+}
+
+type jsonPair struct {
+	ID    uint64 `json:"id"`
+	Count uint64 `json:"count"`
+}
+
+func newQueryResponseFromJSON(data []byte) (*QueryResponse, error) {
+	response := jsonQueryResponse{}
+	if err := unmarshalJSON(data, &response); err != nil {
+		return nil, errors.Wrap(err, "unmarshaling JSON response")
+	}
+	if response.Err != "" {
+		return &QueryResponse{
+			ErrorMessage: response.Err,
+			Success:      false,
+		}, nil
+	}
+	results := make([]*QueryResult, 0, len(response.Results))
+	for _, r := range response.Results {
+		result, err := newQueryResultFromJSON(r)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	columns := make([]*ColumnItem, 0, len(response.ColumnAttrs))
+	for _, c := range response.ColumnAttrs {
+		columns = append(columns, &ColumnItem{
+			ID:         c.ID,
+			Attributes: convertJSONAttrs(c.Attrs),
+		})
+	}
+	return &QueryResponse{
+		ResultList: results,
+		ColumnList: columns,
+		Success:    true,
+	}, nil
+}
+
+// newQueryResultFromJSON decodes a result, whose kind is determined by its JSON type.
+// Bitmap results are objects with attrs and bits, Sum results are objects with sum and count,
+// Count results are numbers, TopN results are lists of pairs and SetBit results are booleans.
+func newQueryResultFromJSON(data json.RawMessage) (*QueryResult, error) {
+	result := &QueryResult{
+		Bitmap:     &BitmapResult{},
+		CountItems: []*CountResultItem{},
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return result, nil
+	}
+	switch data[0] {
+	case '{':
+		r := jsonResult{}
+		if err := unmarshalJSON(data, &r); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling JSON result")
+		}
+		if r.Sum != nil {
+			result.Sum = *r.Sum
+			result.Count = r.Count
+		} else {
+			result.Bitmap = &BitmapResult{
+				Attributes: convertJSONAttrs(r.Attrs),
+				Bits:       r.Bits,
+			}
+		}
+	case '[':
+		pairs := []jsonPair{}
+		if err := unmarshalJSON(data, &pairs); err != nil {
+			return nil, errors.Wrap(err, "unmarshaling JSON result")
+		}
+		for _, pair := range pairs {
+			result.CountItems = append(result.CountItems, &CountResultItem{ID: pair.ID, Count: pair.Count})
+		}
+	case 't', 'f', 'n':
+		// SetBit, ClearBit and attribute calls do not return data
+	default:
+		count, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "unmarshaling JSON result")
+		}
+		result.Count = count
+	}
+	return result, nil
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// convertJSONAttrs converts attribute values to the types used for protobuf responses,
+// i.e., integers to int64 and other numbers to float64.
+func convertJSONAttrs(attrs map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(attrs))
+	for key, value := range attrs {
+		if number, ok := value.(json.Number); ok {
+			if !strings.ContainsAny(string(number), ".eE") {
+				if i, err := number.Int64(); err == nil {
+					converted[key] = i
+					continue
+				}
+			}
+			f, _ := number.Float64()
+			converted[key] = f
+			continue
+		}
+		converted[key] = value
+	}
+	return converted
+}
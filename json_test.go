@@ -0,0 +1,117 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewQueryResponseFromJSON(t *testing.T) {
+	data := []byte(`{
+		"results": [
+			{"attrs": {"name": "a", "age": 5, "score": 1.5, "active": true}, "bits": [3, 10]},
+			42,
+			[{"id": 5, "count": 10}, {"id": 7, "count": 3}],
+			{"sum": -10, "count": 2},
+			true,
+			null
+		],
+		"columnAttrs": [{"id": 10, "attrs": {"city": "Austin"}}]
+	}`)
+	response, err := newQueryResponseFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !response.Success || len(response.Results()) != 6 {
+		t.Fatalf("unexpected response: %v", response)
+	}
+	results := response.Results()
+	bitmap := &BitmapResult{
+		Attributes: map[string]interface{}{"name": "a", "age": int64(5), "score": 1.5, "active": true},
+		Bits:       []uint64{3, 10},
+	}
+	if !reflect.DeepEqual(bitmap, results[0].Bitmap) {
+		t.Fatalf("%v != %v", bitmap, results[0].Bitmap)
+	}
+	if results[1].Count != 42 {
+		t.Fatalf("42 != %d", results[1].Count)
+	}
+	countItems := []*CountResultItem{{ID: 5, Count: 10}, {ID: 7, Count: 3}}
+	if !reflect.DeepEqual(countItems, results[2].CountItems) {
+		t.Fatalf("%v != %v", countItems, results[2].CountItems)
+	}
+	if results[3].Sum != -10 || results[3].Count != 2 {
+		t.Fatalf("unexpected sum result: %v", results[3])
+	}
+	columns := []*ColumnItem{{ID: 10, Attributes: map[string]interface{}{"city": "Austin"}}}
+	if !reflect.DeepEqual(columns, response.Columns()) {
+		t.Fatalf("%v != %v", columns, response.Columns())
+	}
+}
+
+func TestNewQueryResponseFromJSONWithError(t *testing.T) {
+	response, err := newQueryResponseFromJSON([]byte(`{"error": "frame not found"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Success || response.ErrorMessage != "frame not found" {
+		t.Fatalf("unexpected response: %v", response)
+	}
+}
+
+func TestNewQueryResponseFromJSONFails(t *testing.T) {
+	targets := []string{
+		``,
+		`{"results": [`,
+		`{"results": ["bitmap"]}`,
+		`{"results": [{"bits": ["x"]}]}`,
+		`{"results": [[{"id": "x"}]]}`,
+	}
+	for _, target := range targets {
+		if _, err := newQueryResponseFromJSON([]byte(target)); err == nil {
+			t.Fatalf("should have failed: %s", target)
+		}
+	}
+}
+
+func TestMakeJSONRequestPath(t *testing.T) {
+	path := makeJSONRequestPath("/index/i/query", &QueryOptions{})
+	if path != "/index/i/query" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+	path = makeJSONRequestPath("/index/i/query", &QueryOptions{Columns: true, ExcludeAttrs: true, ExcludeBits: true})
+	if path != "/index/i/query?columnAttrs=true&excludeAttrs=true&excludeBits=true" {
+		t.Fatalf("unexpected path: %s", path)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Package kafka imports bits consumed from a Kafka topic into a Pilosa frame.
+//
+// The package does not depend on a Kafka client library.
+// Wrap the consumer of your Kafka client in the Consumer interface,
+// and provide a Decoder which converts a message to bits.
+package kafka
+
+import (
+	"context"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidImporterOption is returned when an importer option is invalid.
+var ErrInvalidImporterOption = pilosa.NewError("Invalid importer option")
+
+// Message is a record consumed from a Kafka topic.
+type Message struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// Consumer reads messages from a Kafka topic.
+type Consumer interface {
+	// Fetch returns the next message.
+	// It blocks until a message is available or the context is done,
+	// in which case it returns the error of the context.
+	Fetch(ctx context.Context) (Message, error)
+	// Commit commits the offsets of the given messages,
+	// after their bits are imported.
+	Commit(ctx context.Context, messages []Message) error
+}
+
+// Decoder converts a message to the bits it contains.
+type Decoder interface {
+	Decode(message Message) ([]pilosa.Bit, error)
+}
+
+// DecoderFunc is a function which implements Decoder.
+type DecoderFunc func(message Message) ([]pilosa.Bit, error)
+
+// Decode calls fn.
+func (fn DecoderFunc) Decode(message Message) ([]pilosa.Bit, error) {
+	return fn(message)
+}
+
+// ImporterOptions control the batching of an importer.
+type ImporterOptions struct {
+	// BatchSize is the number of bits imported at once.
+	BatchSize int
+	// FlushInterval is the longest time a batch waits for more messages before it is imported.
+	FlushInterval time.Duration
+	// ImportOptions are passed to client.ImportFrame for each batch.
+	ImportOptions []interface{}
+	// OnDecodeError is called with a message which fails to be decoded and the error of the decoder.
+	// The message is skipped and its offset is committed with its batch.
+	// The importer stops at the message if it is nil.
+	OnDecodeError func(message Message, err error)
+}
+
+func (options *ImporterOptions) withDefaults() (updated *ImporterOptions) {
+	updated = &ImporterOptions{}
+	*updated = *options
+	if updated.BatchSize <= 0 {
+		updated.BatchSize = 100000
+	}
+	if updated.FlushInterval <= 0 {
+		updated.FlushInterval = time.Second
+	}
+	return
+}
+
+// ImporterOption is used to customize an importer.
+type ImporterOption func(options *ImporterOptions) error
+
+// BatchSize sets the number of bits imported at once.
+func BatchSize(size int) ImporterOption {
+	return func(options *ImporterOptions) error {
+		if size <= 0 {
+			return ErrInvalidImporterOption
+		}
+		options.BatchSize = size
+		return nil
+	}
+}
+
+// FlushInterval sets the longest time a batch waits for more messages before it is imported.
+func FlushInterval(interval time.Duration) ImporterOption {
+	return func(options *ImporterOptions) error {
+		if interval <= 0 {
+			return ErrInvalidImporterOption
+		}
+		options.FlushInterval = interval
+		return nil
+	}
+}
+
+// OnDecodeError sets the function which is called with the messages which fail to be decoded,
+// which are skipped instead of stopping the importer.
+func OnDecodeError(fn func(message Message, err error)) ImporterOption {
+	return func(options *ImporterOptions) error {
+		options.OnDecodeError = fn
+		return nil
+	}
+}
+
+// ImportOptions sets the options passed to client.ImportFrame for each batch.
+func ImportOptions(importOptions ...interface{}) ImporterOption {
+	return func(options *ImporterOptions) error {
+		options.ImportOptions = importOptions
+		return nil
+	}
+}
+
+// Importer consumes messages from a Kafka topic and imports their bits into a frame.
+// The offsets of the messages in a batch are committed only after the batch is imported,
+// so messages are imported at least once: if the importer stops before a batch is committed,
+// its messages are consumed and imported again the next time.
+type Importer struct {
+	client   *pilosa.Client
+	frame    *pilosa.Frame
+	consumer Consumer
+	decoder  Decoder
+	options  *ImporterOptions
+}
+
+// NewImporter creates an importer which imports the bits decoded from the messages of consumer into frame.
+func NewImporter(client *pilosa.Client, frame *pilosa.Frame, consumer Consumer, decoder Decoder, options ...ImporterOption) (*Importer, error) {
+	importerOptions := &ImporterOptions{}
+	for _, option := range options {
+		if err := option(importerOptions); err != nil {
+			return nil, err
+		}
+	}
+	return &Importer{
+		client:   client,
+		frame:    frame,
+		consumer: consumer,
+		decoder:  decoder,
+		options:  importerOptions.withDefaults(),
+	}, nil
+}
+
+// Run consumes and imports messages until the context is canceled or an error occurs.
+// It returns the error of the context if it was canceled.
+// A batch which is not imported yet when the context is canceled is not committed.
+func (im *Importer) Run(ctx context.Context) error {
+	for {
+		if err := im.runBatch(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// runBatch consumes messages until the batch is full or the flush interval passes,
+// then imports the batch and commits its messages.
+func (im *Importer) runBatch(ctx context.Context) error {
+	var messages []Message
+	var bits []pilosa.Bit
+	var flushDeadline time.Time
+	for len(bits) < im.options.BatchSize {
+		message, err := im.fetch(ctx, flushDeadline)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !flushDeadline.IsZero() && !time.Now().Before(flushDeadline) {
+				// the flush interval passed
+				break
+			}
+			return errors.Wrap(err, "fetching message")
+		}
+		if flushDeadline.IsZero() {
+			// the flush interval starts with the first message of the batch
+			flushDeadline = time.Now().Add(im.options.FlushInterval)
+		}
+		decoded, err := im.decoder.Decode(message)
+		if err != nil {
+			if im.options.OnDecodeError == nil {
+				return errors.Wrapf(err, "decoding message at partition %d offset %d", message.Partition, message.Offset)
+			}
+			// skip the message, committing it with the batch so it isn't consumed again
+			im.options.OnDecodeError(message, err)
+		}
+		messages = append(messages, message)
+		bits = append(bits, decoded...)
+	}
+	if len(bits) > 0 {
+		iterator := pilosa.NewSliceBitIterator(bits)
+		err := im.client.ImportFrameWithContext(ctx, im.frame, iterator, uint(im.options.BatchSize), im.options.ImportOptions...)
+		if err != nil {
+			return errors.Wrap(err, "importing bits")
+		}
+	}
+	if len(messages) > 0 {
+		if err := im.consumer.Commit(ctx, messages); err != nil {
+			return errors.Wrap(err, "committing messages")
+		}
+	}
+	return nil
+}
+
+// fetch fetches a message, waiting until the deadline if it is set.
+func (im *Importer) fetch(ctx context.Context, deadline time.Time) (Message, error) {
+	if deadline.IsZero() {
+		return im.consumer.Fetch(ctx)
+	}
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	return im.consumer.Fetch(ctx)
+}
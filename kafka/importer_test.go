@@ -0,0 +1,272 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pilosa "github.com/pilosa/go-pilosa"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (fn roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return fn(req)
+}
+
+// fakeConsumer returns the given messages, then blocks until the context is done.
+type fakeConsumer struct {
+	mutex     *sync.Mutex
+	messages  []Message
+	committed []int64
+}
+
+func newFakeConsumer(messages ...Message) *fakeConsumer {
+	return &fakeConsumer{mutex: &sync.Mutex{}, messages: messages}
+}
+
+func (c *fakeConsumer) Fetch(ctx context.Context) (Message, error) {
+	c.mutex.Lock()
+	if len(c.messages) > 0 {
+		message := c.messages[0]
+		c.messages = c.messages[1:]
+		c.mutex.Unlock()
+		return message, nil
+	}
+	c.mutex.Unlock()
+	<-ctx.Done()
+	return Message{}, ctx.Err()
+}
+
+func (c *fakeConsumer) Commit(ctx context.Context, messages []Message) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, message := range messages {
+		c.committed = append(c.committed, message.Offset)
+	}
+	return nil
+}
+
+func (c *fakeConsumer) committedOffsets() []int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return append([]int64{}, c.committed...)
+}
+
+// csvDecoder decodes messages in the rowID,columnID form.
+var csvDecoder = DecoderFunc(func(message Message) ([]pilosa.Bit, error) {
+	parts := strings.Split(string(message.Value), ",")
+	if len(parts) != 2 {
+		return nil, errors.New("invalid message")
+	}
+	rowID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	columnID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return []pilosa.Bit{{RowID: rowID, ColumnID: columnID}}, nil
+})
+
+type importedBits struct {
+	mutex   *sync.Mutex
+	columns []uint64
+}
+
+func (b *importedBits) get() []uint64 {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return append([]uint64{}, b.columns...)
+}
+
+func newTestClient(t *testing.T, importStatus int) (*pilosa.Client, *importedBits) {
+	imported := &importedBits{mutex: &sync.Mutex{}}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := []byte{}
+		status := 200
+		switch req.URL.Path {
+		case "/fragment/nodes":
+			body = []byte(`[{"scheme":"http","host":"node1:10101"}]`)
+		case "/import":
+			status = importStatus
+			if status == 200 {
+				data, err := ioutil.ReadAll(req.Body)
+				if err != nil {
+					return nil, err
+				}
+				request := &pbuf.ImportRequest{}
+				if err = proto.Unmarshal(data, request); err != nil {
+					return nil, err
+				}
+				imported.mutex.Lock()
+				imported.columns = append(imported.columns, request.ColumnIDs...)
+				imported.mutex.Unlock()
+			}
+		}
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}, nil
+	})
+	client, err := pilosa.NewClient(":10101", pilosa.HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, imported
+}
+
+func testFrame(t *testing.T) *pilosa.Frame {
+	index, err := pilosa.NewIndex("test-index", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("test-frame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return frame
+}
+
+func TestImporterCommitsImportedBatches(t *testing.T) {
+	client, imported := newTestClient(t, 200)
+	consumer := newFakeConsumer(
+		Message{Offset: 1, Value: []byte("1,10")},
+		Message{Offset: 2, Value: []byte("1,20")},
+		Message{Offset: 3, Value: []byte("2,30")},
+	)
+	importer, err := NewImporter(client, testFrame(t), consumer, csvDecoder, BatchSize(2), FlushInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- importer.Run(ctx) }()
+	deadline := time.Now().Add(time.Second)
+	for len(consumer.committedOffsets()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got %v", err)
+	}
+	if target := []int64{1, 2, 3}; !reflect.DeepEqual(target, consumer.committedOffsets()) {
+		t.Fatalf("%v != %v", target, consumer.committedOffsets())
+	}
+	// the last message is imported once the flush interval passes
+	if target := []uint64{10, 20, 30}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+}
+
+func TestImporterDoesNotCommitFailedBatches(t *testing.T) {
+	client, _ := newTestClient(t, http.StatusBadRequest)
+	consumer := newFakeConsumer(Message{Offset: 1, Value: []byte("1,10")})
+	importer, err := NewImporter(client, testFrame(t), consumer, csvDecoder, BatchSize(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = importer.Run(context.Background()); err == nil {
+		t.Fatal("the import should fail")
+	}
+	if len(consumer.committedOffsets()) != 0 {
+		t.Fatalf("no messages should be committed: %v", consumer.committedOffsets())
+	}
+}
+
+func TestImporterFailsOnInvalidMessage(t *testing.T) {
+	client, _ := newTestClient(t, 200)
+	consumer := newFakeConsumer(Message{Offset: 1, Value: []byte("invalid")})
+	importer, err := NewImporter(client, testFrame(t), consumer, csvDecoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importer.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "offset 1") {
+		t.Fatalf("the import should fail with the offset of the message, got %v", err)
+	}
+	if len(consumer.committedOffsets()) != 0 {
+		t.Fatalf("no messages should be committed: %v", consumer.committedOffsets())
+	}
+}
+
+func TestImporterSkipsInvalidMessages(t *testing.T) {
+	client, imported := newTestClient(t, 200)
+	consumer := newFakeConsumer(
+		Message{Offset: 1, Value: []byte("1,10")},
+		Message{Offset: 2, Value: []byte("invalid")},
+		Message{Offset: 3, Value: []byte("2,30")},
+	)
+	var skipped []int64
+	onDecodeError := func(message Message, err error) {
+		skipped = append(skipped, message.Offset)
+	}
+	importer, err := NewImporter(client, testFrame(t), consumer, csvDecoder, BatchSize(2), OnDecodeError(onDecodeError))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = importer.runBatch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if target := []int64{2}; !reflect.DeepEqual(target, skipped) {
+		t.Fatalf("%v != %v", target, skipped)
+	}
+	if target := []int64{1, 2, 3}; !reflect.DeepEqual(target, consumer.committedOffsets()) {
+		t.Fatalf("%v != %v", target, consumer.committedOffsets())
+	}
+	if target := []uint64{10, 30}; !reflect.DeepEqual(target, imported.get()) {
+		t.Fatalf("%v != %v", target, imported.get())
+	}
+}
+
+func TestNewImporterInvalidOptions(t *testing.T) {
+	client, _ := newTestClient(t, 200)
+	consumer := newFakeConsumer()
+	for i, option := range []ImporterOption{BatchSize(0), FlushInterval(-time.Second)} {
+		if _, err := NewImporter(client, testFrame(t), consumer, csvDecoder, option); err != ErrInvalidImporterOption {
+			t.Fatalf("%d: ErrInvalidImporterOption expected, got %v", i, err)
+		}
+	}
+}
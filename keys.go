@@ -0,0 +1,137 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"fmt"
+	"sync"
+)
+
+// KeyTranslator translates string keys to the integer row and column IDs used by Pilosa.
+// Implementations should return the same ID for the same key every time.
+type KeyTranslator interface {
+	// TranslateRowKey returns the row ID for the given key in a frame.
+	TranslateRowKey(indexName string, frameName string, key string) (uint64, error)
+	// TranslateColumnKey returns the column ID for the given key in an index.
+	TranslateColumnKey(indexName string, key string) (uint64, error)
+}
+
+// LRUKeyTranslator caches the results of another KeyTranslator.
+// At most `size` keys are kept, the least recently used keys are evicted first.
+// It is safe for concurrent use.
+type LRUKeyTranslator struct {
+	translator KeyTranslator
+	mutex      *sync.Mutex
+	ids        *lru
+}
+
+// NewLRUKeyTranslator creates a caching KeyTranslator which wraps the given translator.
+func NewLRUKeyTranslator(translator KeyTranslator, size int) *LRUKeyTranslator {
+	if size <= 0 {
+		size = 1
+	}
+	return &LRUKeyTranslator{
+		translator: translator,
+		mutex:      &sync.Mutex{},
+		ids:        newLRU(size),
+	}
+}
+
+// TranslateRowKey returns the row ID for the given key in a frame.
+func (t *LRUKeyTranslator) TranslateRowKey(indexName string, frameName string, key string) (uint64, error) {
+	cacheKey := fmt.Sprintf("r\x00%s\x00%s\x00%s", indexName, frameName, key)
+	return t.translate(cacheKey, func() (uint64, error) {
+		return t.translator.TranslateRowKey(indexName, frameName, key)
+	})
+}
+
+// TranslateColumnKey returns the column ID for the given key in an index.
+func (t *LRUKeyTranslator) TranslateColumnKey(indexName string, key string) (uint64, error) {
+	cacheKey := fmt.Sprintf("c\x00%s\x00%s", indexName, key)
+	return t.translate(cacheKey, func() (uint64, error) {
+		return t.translator.TranslateColumnKey(indexName, key)
+	})
+}
+
+// Len returns the number of cached keys.
+func (t *LRUKeyTranslator) Len() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.ids.len()
+}
+
+func (t *LRUKeyTranslator) translate(cacheKey string, fn func() (uint64, error)) (uint64, error) {
+	t.mutex.Lock()
+	if id, ok := t.ids.get(cacheKey); ok {
+		t.mutex.Unlock()
+		return id.(uint64), nil
+	}
+	t.mutex.Unlock()
+
+	// do not hold the lock while the underlying translator is running
+	id, err := fn()
+	if err != nil {
+		return 0, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.ids.add(cacheKey, id)
+	return id, nil
+}
+
+func (f *Frame) translateRowKey(key string) (uint64, error) {
+	if f.options.KeyTranslator == nil {
+		return 0, ErrNoKeyTranslator
+	}
+	return f.options.KeyTranslator.TranslateRowKey(f.index.name, f.name, key)
+}
+
+func (f *Frame) translateColumnKey(key string) (uint64, error) {
+	if f.options.KeyTranslator == nil {
+		return 0, ErrNoKeyTranslator
+	}
+	return f.options.KeyTranslator.TranslateColumnKey(f.index.name, key)
+}
+
+func (f *Frame) translateKeys(rowKey string, columnKey string) (rowID uint64, columnID uint64, err error) {
+	rowID, err = f.translateRowKey(rowKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	columnID, err = f.translateColumnKey(columnKey)
+	if err != nil {
+		return 0, 0, err
+	}
+	return rowID, columnID, nil
+}
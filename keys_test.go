@@ -0,0 +1,139 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"errors"
+	"testing"
+)
+
+type mapKeyTranslator struct {
+	rows    map[string]uint64
+	columns map[string]uint64
+	calls   int
+}
+
+func (t *mapKeyTranslator) TranslateRowKey(indexName string, frameName string, key string) (uint64, error) {
+	t.calls++
+	if id, ok := t.rows[key]; ok {
+		return id, nil
+	}
+	return 0, errors.New("unknown row key")
+}
+
+func (t *mapKeyTranslator) TranslateColumnKey(indexName string, key string) (uint64, error) {
+	t.calls++
+	if id, ok := t.columns[key]; ok {
+		return id, nil
+	}
+	return 0, errors.New("unknown column key")
+}
+
+func newMapKeyTranslator() *mapKeyTranslator {
+	return &mapKeyTranslator{
+		rows:    map[string]uint64{"alpha": 1, "beta": 2, "gamma": 3},
+		columns: map[string]uint64{"one": 10, "two": 20},
+	}
+}
+
+func TestFrameKeys(t *testing.T) {
+	frame, err := sampleIndex.Frame("keyed-frame", KeyTranslation(newMapKeyTranslator()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comparePQL(t,
+		"Bitmap(rowID=2, frame='keyed-frame')",
+		frame.BitmapK("beta"))
+	comparePQL(t,
+		"SetBit(rowID=1, frame='keyed-frame', columnID=20)",
+		frame.SetBitK("alpha", "two"))
+	comparePQL(t,
+		"ClearBit(rowID=3, frame='keyed-frame', columnID=10)",
+		frame.ClearBitK("gamma", "one"))
+	if frame.options.String() != `{"options": {"rowLabel":"rowID"}}` {
+		t.Fatalf("key translator should not be serialized: %s", frame.options.String())
+	}
+}
+
+func TestFrameKeysFail(t *testing.T) {
+	frame, err := sampleIndex.Frame("keyed-frame-fail", KeyTranslation(newMapKeyTranslator()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.BitmapK("unknown").Error() == nil {
+		t.Fatalf("unknown row key should fail")
+	}
+	if frame.SetBitK("unknown", "one").Error() == nil {
+		t.Fatalf("unknown row key should fail")
+	}
+	if frame.ClearBitK("alpha", "unknown").Error() == nil {
+		t.Fatalf("unknown column key should fail")
+	}
+	if err := sampleFrame.BitmapK("alpha").Error(); err != ErrNoKeyTranslator {
+		t.Fatalf("%v != %v", ErrNoKeyTranslator, err)
+	}
+}
+
+func TestLRUKeyTranslator(t *testing.T) {
+	backend := newMapKeyTranslator()
+	translator := NewLRUKeyTranslator(backend, 2)
+	for i := 0; i < 3; i++ {
+		id, err := translator.TranslateRowKey("i", "f", "alpha")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != 1 {
+			t.Fatalf("1 != %d", id)
+		}
+	}
+	if backend.calls != 1 {
+		t.Fatalf("translated keys should be cached, calls: %d", backend.calls)
+	}
+	translator.TranslateColumnKey("i", "one")
+	translator.TranslateRowKey("i", "f", "beta")
+	if translator.Len() != 2 {
+		t.Fatalf("2 != %d", translator.Len())
+	}
+	// alpha was the least recently used key, so it should have been evicted
+	translator.TranslateRowKey("i", "f", "alpha")
+	if backend.calls != 4 {
+		t.Fatalf("4 != %d", backend.calls)
+	}
+	// errors should not be cached
+	if _, err := translator.TranslateRowKey("i", "f", "unknown"); err == nil {
+		t.Fatalf("should have failed")
+	}
+	if translator.Len() != 2 {
+		t.Fatalf("2 != %d", translator.Len())
+	}
+}
@@ -0,0 +1,371 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+	"github.com/pkg/errors"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errInvalidProtobuf = errors.New("invalid protobuf message")
+
+// protoReader reads the fields of a protobuf message without copying their contents.
+type protoReader struct {
+	data []byte
+	err  error
+}
+
+// next reads the key of the next field. It returns false at the end of the message or on error.
+func (r *protoReader) next() (field uint64, wireType uint64, ok bool) {
+	if len(r.data) == 0 || r.err != nil {
+		return 0, 0, false
+	}
+	key := r.varint()
+	return key >> 3, key & 7, r.err == nil
+}
+
+func (r *protoReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errInvalidProtobuf
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+// bytes returns the contents of a length delimited field, which refers to the message buffer.
+func (r *protoReader) bytes() []byte {
+	n := r.varint()
+	if r.err != nil {
+		return nil
+	}
+	if n > uint64(len(r.data)) {
+		r.err = errInvalidProtobuf
+		return nil
+	}
+	b := r.data[:n:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *protoReader) skip(wireType uint64) {
+	switch wireType {
+	case wireVarint:
+		r.varint()
+	case wireBytes:
+		r.bytes()
+	case wireFixed64, wireFixed32:
+		n := 8
+		if wireType == wireFixed32 {
+			n = 4
+		}
+		if len(r.data) < n {
+			r.err = errInvalidProtobuf
+			return
+		}
+		r.data = r.data[n:]
+	default:
+		r.err = errInvalidProtobuf
+	}
+}
+
+// unmarshal decodes a length delimited field into msg.
+func (r *protoReader) unmarshal(msg proto.Message) {
+	data := r.bytes()
+	if r.err == nil {
+		r.err = proto.Unmarshal(data, msg)
+	}
+}
+
+// decodeQueryResponseLazily decodes a protobuf query response like newQueryResponseFromInternal,
+// except the bits of bitmap results are kept as packed varints in data, which must not be modified afterwards.
+// A packed bit takes up to 10 bytes, but usually much less than the 8 bytes of a decoded uint64.
+func decodeQueryResponseLazily(data []byte) (*QueryResponse, error) {
+	response := &pbuf.QueryResponse{}
+	var packed [][]byte
+	r := &protoReader{data: data}
+	for {
+		field, wireType, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			response.Err = string(r.bytes())
+		case field == 2 && wireType == wireBytes:
+			result, resultPacked, err := decodeQueryResultLazily(r.bytes())
+			if err != nil {
+				return nil, err
+			}
+			response.Results = append(response.Results, result)
+			packed = append(packed, resultPacked)
+		case field == 3 && wireType == wireBytes:
+			columnAttrSet := &pbuf.ColumnAttrSet{}
+			r.unmarshal(columnAttrSet)
+			response.ColumnAttrSets = append(response.ColumnAttrSets, columnAttrSet)
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "decoding query response")
+	}
+	queryResponse, err := newQueryResponseFromInternal(response)
+	if err != nil {
+		return nil, err
+	}
+	for i, result := range queryResponse.ResultList {
+		if packed[i] == nil {
+			continue
+		}
+		count, err := countPackedBits(packed[i])
+		if err != nil {
+			return nil, err
+		}
+		result.Bitmap.packed = packed[i]
+		result.Bitmap.packedCount = count
+	}
+	return queryResponse, nil
+}
+
+// decodeQueryResultLazily decodes a query result except the bits of its bitmap,
+// which are returned as packed varints.
+func decodeQueryResultLazily(data []byte) (*pbuf.QueryResult, []byte, error) {
+	result := &pbuf.QueryResult{}
+	var packed []byte
+	r := &protoReader{data: data}
+	for {
+		field, wireType, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			bitmap, bitmapPacked, err := decodeBitmapLazily(r.bytes())
+			if err != nil {
+				return nil, nil, err
+			}
+			result.Bitmap = bitmap
+			packed = bitmapPacked
+		case field == 2 && wireType == wireVarint:
+			result.N = r.varint()
+		case field == 3 && wireType == wireBytes:
+			pair := &pbuf.Pair{}
+			r.unmarshal(pair)
+			result.Pairs = append(result.Pairs, pair)
+		case field == 4 && wireType == wireVarint:
+			result.Changed = r.varint() != 0
+		case field == 5 && wireType == wireBytes:
+			result.SumCount = &pbuf.SumCount{}
+			r.unmarshal(result.SumCount)
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil {
+		return nil, nil, errors.Wrap(r.err, "decoding query result")
+	}
+	return result, packed, nil
+}
+
+// decodeBitmapLazily decodes the attributes of a bitmap and returns its bits as packed varints.
+// Bits which are not packed, which the server does not send, are decoded into the Bits of the bitmap.
+func decodeBitmapLazily(data []byte) (*pbuf.Bitmap, []byte, error) {
+	bitmap := &pbuf.Bitmap{}
+	var packed []byte
+	r := &protoReader{data: data}
+	for {
+		field, wireType, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wireType == wireBytes:
+			if packed == nil {
+				packed = r.bytes()
+			} else {
+				// a repeated field may be split into several packed fields
+				packed = append(packed[:len(packed):len(packed)], r.bytes()...)
+			}
+		case field == 1 && wireType == wireVarint:
+			bitmap.Bits = append(bitmap.Bits, r.varint())
+		case field == 2 && wireType == wireBytes:
+			attr := &pbuf.Attr{}
+			r.unmarshal(attr)
+			bitmap.Attrs = append(bitmap.Attrs, attr)
+		default:
+			r.skip(wireType)
+		}
+	}
+	if r.err != nil {
+		return nil, nil, errors.Wrap(r.err, "decoding bitmap")
+	}
+	if len(bitmap.Bits) > 0 && packed != nil {
+		// keep the bits in order if both forms are used
+		bits := decodePackedBits(packed)
+		if bits == nil {
+			return nil, nil, errors.Wrap(errInvalidProtobuf, "decoding bitmap")
+		}
+		bitmap.Bits = append(bits, bitmap.Bits...)
+		packed = nil
+	}
+	return bitmap, packed, nil
+}
+
+// countPackedBits returns the number of varints in packed.
+// It validates all of them, so the bits can be decoded later without checking for errors.
+func countPackedBits(packed []byte) (int, error) {
+	count := 0
+	for len(packed) > 0 {
+		// n is 0 for a truncated varint and negative for a varint which overflows 64 bits
+		_, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return 0, errors.Wrap(errInvalidProtobuf, "decoding bitmap")
+		}
+		count++
+		packed = packed[n:]
+	}
+	return count, nil
+}
+
+// decodePackedBits decodes all of the varints in packed, or returns nil if they are invalid.
+func decodePackedBits(packed []byte) []uint64 {
+	bits := []uint64{}
+	for len(packed) > 0 {
+		bit, n := binary.Uvarint(packed)
+		if n <= 0 {
+			return nil
+		}
+		bits = append(bits, bit)
+		packed = packed[n:]
+	}
+	return bits
+}
+
+// Len returns the number of bits in the result.
+func (b *BitmapResult) Len() int {
+	if b.packed != nil {
+		return b.packedCount
+	}
+	return len(b.Bits)
+}
+
+// Columns returns the bits of the result.
+// It returns Bits, or decodes the bits of a lazily decoded result into a new slice on every call.
+func (b *BitmapResult) Columns() []uint64 {
+	if b.packed == nil {
+		return b.Bits
+	}
+	columns := make([]uint64, 0, b.packedCount)
+	for data := b.packed; len(data) > 0; {
+		column, n := binary.Uvarint(data)
+		columns = append(columns, column)
+		data = data[n:]
+	}
+	return columns
+}
+
+// Chunks returns an iterator over the bits of the result in chunks of at most size bits,
+// so the bits of a lazily decoded result can be processed without decoding all of them at once.
+func (b *BitmapResult) Chunks(size int) *BitChunkIterator {
+	if size <= 0 {
+		size = 1
+	}
+	return &BitChunkIterator{bits: b.Bits, packed: b.packed, size: size}
+}
+
+// BitChunkIterator returns the bits of a bitmap result in chunks.
+type BitChunkIterator struct {
+	bits   []uint64
+	packed []byte
+	size   int
+	chunk  []uint64
+}
+
+// NextChunk returns the next chunk of bits.
+// The chunk is only valid until the next call of NextChunk, since its memory is reused.
+// Returns io.EOF on end of iteration.
+func (it *BitChunkIterator) NextChunk() ([]uint64, error) {
+	if it.packed == nil {
+		if len(it.bits) == 0 {
+			return nil, io.EOF
+		}
+		n := it.size
+		if n > len(it.bits) {
+			n = len(it.bits)
+		}
+		chunk := it.bits[:n:n]
+		it.bits = it.bits[n:]
+		return chunk, nil
+	}
+	if len(it.packed) == 0 {
+		return nil, io.EOF
+	}
+	if it.chunk == nil {
+		it.chunk = make([]uint64, 0, it.size)
+	}
+	chunk := it.chunk[:0]
+	for len(chunk) < it.size && len(it.packed) > 0 {
+		column, n := binary.Uvarint(it.packed)
+		chunk = append(chunk, column)
+		it.packed = it.packed[n:]
+	}
+	return chunk, nil
+}
+
+// packedColumnIterator returns the bits of a lazily decoded result one by one.
+type packedColumnIterator struct {
+	packed []byte
+}
+
+func (it *packedColumnIterator) NextColumn() (uint64, error) {
+	if len(it.packed) == 0 {
+		return 0, io.EOF
+	}
+	column, n := binary.Uvarint(it.packed)
+	it.packed = it.packed[n:]
+	return column, nil
+}
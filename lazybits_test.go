@@ -0,0 +1,278 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+func lazyTestResponse() *pbuf.QueryResponse {
+	return &pbuf.QueryResponse{
+		Results: []*pbuf.QueryResult{
+			{Bitmap: &pbuf.Bitmap{
+				Bits:  []uint64{1, 300, 1 << 40},
+				Attrs: []*pbuf.Attr{{Key: "name", Type: stringType, StringValue: "a"}},
+			}},
+			{Pairs: []*pbuf.Pair{{Key: 5, Count: 10}, {Key: 7, Count: 3}}},
+			{N: 42},
+			{SumCount: &pbuf.SumCount{Sum: -10, Count: 3}},
+			{Changed: true},
+			{Bitmap: &pbuf.Bitmap{}},
+		},
+		ColumnAttrSets: []*pbuf.ColumnAttrSet{
+			{ID: 1, Attrs: []*pbuf.Attr{{Key: "active", Type: boolType, BoolValue: true}}},
+		},
+	}
+}
+
+func TestDecodeQueryResponseLazily(t *testing.T) {
+	data, err := proto.Marshal(lazyTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := newQueryResponseFromInternal(lazyTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := decodeQueryResponseLazily(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.ResultList[0].Bitmap.packed == nil {
+		t.Fatalf("the bits should be decoded lazily")
+	}
+	if len(response.ResultList) != len(target.ResultList) {
+		t.Fatalf("%d results expected, got %d", len(target.ResultList), len(response.ResultList))
+	}
+	for i, result := range response.ResultList {
+		targetResult := target.ResultList[i]
+		if !reflect.DeepEqual(targetResult.Bitmap.Bits, result.Bitmap.Columns()) {
+			t.Fatalf("result %d: %v != %v", i, targetResult.Bitmap.Bits, result.Bitmap.Columns())
+		}
+		if result.Bitmap.Len() != len(targetResult.Bitmap.Bits) {
+			t.Fatalf("result %d: %d bits expected, got %d", i, len(targetResult.Bitmap.Bits), result.Bitmap.Len())
+		}
+		result.Bitmap.packed = nil
+		result.Bitmap.packedCount = 0
+		result.Bitmap.Bits = targetResult.Bitmap.Bits
+		if !reflect.DeepEqual(targetResult, result) {
+			t.Fatalf("result %d: %v != %v", i, targetResult, result)
+		}
+	}
+	if !reflect.DeepEqual(target.ColumnList, response.ColumnList) {
+		t.Fatalf("%v != %v", target.ColumnList, response.ColumnList)
+	}
+	if !response.Success {
+		t.Fatalf("the response should be successful")
+	}
+}
+
+func TestDecodeQueryResponseLazilyError(t *testing.T) {
+	data, err := proto.Marshal(&pbuf.QueryResponse{Err: "frame not found"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := decodeQueryResponseLazily(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Success || response.ErrorMessage != "frame not found" {
+		t.Fatalf("unexpected response: %v", response)
+	}
+}
+
+func TestDecodeQueryResponseLazilyInvalid(t *testing.T) {
+	data, err := proto.Marshal(lazyTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := [][]byte{
+		data[:len(data)-1],
+		// a result with a bitmap with a truncated varint as its bits
+		{0x12, 0x05, 0x0a, 0x03, 0x0a, 0x01, 0x80},
+		// a result with a bitmap with a varint which overflows 64 bits as its bits
+		{0x12, 0x0e, 0x0a, 0x0c, 0x0a, 0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f},
+		// a field with an unknown wire type
+		{0x0f},
+	}
+	for i, data := range invalid {
+		if _, err := decodeQueryResponseLazily(data); err == nil {
+			t.Fatalf("decoding invalid response %d should fail", i)
+		}
+	}
+}
+
+func TestDecodeBitmapLazilySplitBits(t *testing.T) {
+	// two packed fields with bits 1, 2 and 3
+	data := []byte{0x0a, 0x02, 0x01, 0x02, 0x0a, 0x01, 0x03}
+	bitmap, packed, err := decodeBitmapLazily(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal([]byte{0x01, 0x02, 0x03}, packed) || bitmap.Bits != nil {
+		t.Fatalf("packed bits expected, got %v %v", packed, bitmap.Bits)
+	}
+	if !bytes.Equal([]byte{0x0a, 0x02, 0x01, 0x02, 0x0a, 0x01, 0x03}, data) {
+		t.Fatalf("joining the bits should not modify the response buffer")
+	}
+	// followed by bit 4 which is not packed
+	bitmap, packed, err = decodeBitmapLazily(append(data, 0x08, 0x04))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed != nil || !reflect.DeepEqual([]uint64{1, 2, 3, 4}, bitmap.Bits) {
+		t.Fatalf("decoded bits expected, got %v %v", packed, bitmap.Bits)
+	}
+}
+
+func TestBitmapResultChunks(t *testing.T) {
+	data, err := proto.Marshal(lazyTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := decodeQueryResponseLazily(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eager := &BitmapResult{Bits: []uint64{1, 300, 1 << 40}}
+	for _, bitmap := range []*BitmapResult{lazy.Result().Bitmap, eager} {
+		chunks := [][]uint64{}
+		iterator := bitmap.Chunks(2)
+		for {
+			chunk, err := iterator.NextChunk()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			chunks = append(chunks, append([]uint64{}, chunk...))
+		}
+		target := [][]uint64{{1, 300}, {1 << 40}}
+		if !reflect.DeepEqual(target, chunks) {
+			t.Fatalf("%v != %v", target, chunks)
+		}
+		columns := []uint64{}
+		columnIterator := bitmap.Iterator()
+		for {
+			column, err := columnIterator.NextColumn()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns = append(columns, column)
+		}
+		if !reflect.DeepEqual([]uint64{1, 300, 1 << 40}, columns) {
+			t.Fatalf("unexpected columns: %v", columns)
+		}
+	}
+}
+
+func TestQueryLazyBits(t *testing.T) {
+	data, err := proto.Marshal(lazyTestResponse())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewReader(data)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.QueryWithContext(context.Background(), sampleFrame.Bitmap(1), LazyBits(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bitmap := response.Result().Bitmap
+	if bitmap.Bits != nil {
+		t.Fatalf("the bits should not be decoded")
+	}
+	if !reflect.DeepEqual([]uint64{1, 300, 1 << 40}, bitmap.Columns()) {
+		t.Fatalf("unexpected columns: %v", bitmap.Columns())
+	}
+	buf := &bytes.Buffer{}
+	if err = response.Result().WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1\n300\n1099511627776\n" {
+		t.Fatalf("unexpected CSV: %q", buf.String())
+	}
+}
+
+func BenchmarkDecodeQueryResponse(b *testing.B) {
+	bits := make([]uint64, 1000000)
+	for i := range bits {
+		bits[i] = uint64(i) * 3
+	}
+	data, err := proto.Marshal(&pbuf.QueryResponse{
+		Results: []*pbuf.QueryResult{{Bitmap: &pbuf.Bitmap{Bits: bits}}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Eager", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			response := &pbuf.QueryResponse{}
+			if err := proto.Unmarshal(data, response); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := newQueryResponseFromInternal(response); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Lazy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeQueryResponseLazily(data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,196 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLoggedPQLSize is the maximum number of bytes of a query which are logged.
+const maxLoggedPQLSize = 1024
+
+// Logger receives the log messages of a client, e.g., host selection, retries,
+// slow requests and import progress. Set it with the WithLogger client option.
+// The client does not log anything if no logger is set.
+//
+// Each message comes with key/value pairs describing it, e.g., "host", "node1:10101",
+// which map to the fields of structured loggers.
+// Implementations must be safe for concurrent use.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NopLogger is a Logger which discards all messages.
+type NopLogger struct{}
+
+// Debug does nothing.
+func (NopLogger) Debug(msg string, keyvals ...interface{}) {}
+
+// Info does nothing.
+func (NopLogger) Info(msg string, keyvals ...interface{}) {}
+
+// Warn does nothing.
+func (NopLogger) Warn(msg string, keyvals ...interface{}) {}
+
+// Error does nothing.
+func (NopLogger) Error(msg string, keyvals ...interface{}) {}
+
+// LogLevel is the minimum level of the messages written by a StdLogger.
+type LogLevel int
+
+// Log levels.
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "UNKNOWN"
+}
+
+// StdLogger is a Logger which writes the messages at or above its level to a *log.Logger,
+// one line per message with the key/value pairs in key=value form.
+type StdLogger struct {
+	logger *log.Logger
+	level  LogLevel
+}
+
+// NewStdLogger creates a StdLogger which writes to the given logger the messages at or above the given level.
+// The standard logger of the log package is used if logger is nil.
+func NewStdLogger(logger *log.Logger, level LogLevel) *StdLogger {
+	return &StdLogger{logger: logger, level: level}
+}
+
+// Debug writes a message at the debug level.
+func (l *StdLogger) Debug(msg string, keyvals ...interface{}) {
+	l.write(LevelDebug, msg, keyvals)
+}
+
+// Info writes a message at the info level.
+func (l *StdLogger) Info(msg string, keyvals ...interface{}) {
+	l.write(LevelInfo, msg, keyvals)
+}
+
+// Warn writes a message at the warn level.
+func (l *StdLogger) Warn(msg string, keyvals ...interface{}) {
+	l.write(LevelWarn, msg, keyvals)
+}
+
+// Error writes a message at the error level.
+func (l *StdLogger) Error(msg string, keyvals ...interface{}) {
+	l.write(LevelError, msg, keyvals)
+}
+
+func (l *StdLogger) write(level LogLevel, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	line := formatLogLine(level, msg, keyvals)
+	if l.logger == nil {
+		log.Print(line)
+	} else {
+		l.logger.Print(line)
+	}
+}
+
+// formatLogLine formats a message like `WARN go-pilosa: retrying request path=/status attempt=1`.
+// Values containing spaces, quotes or equal signs are quoted.
+// A key without a value is written with the value MISSING.
+func formatLogLine(level LogLevel, msg string, keyvals []interface{}) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s go-pilosa: %s", level, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var value interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		formatted := fmt.Sprint(value)
+		if strings.ContainsAny(formatted, " \"=") {
+			formatted = strconv.Quote(formatted)
+		}
+		fmt.Fprintf(buf, " %v=%s", keyvals[i], formatted)
+	}
+	return buf.String()
+}
+
+// logger returns the logger of the client, which discards messages if no logger is set.
+func (c *Client) logger() Logger {
+	if c.options.Logger == nil {
+		return NopLogger{}
+	}
+	return c.options.Logger
+}
+
+// logSlowQuery logs a query which took at least the SlowQueryThreshold of the client, with the time spent
+// sending the request and receiving the response, including retries, and the time spent decoding the response.
+func (c *Client) logSlowQuery(ctx context.Context, index string, pql string, metadata *ResponseMetadata, duration time.Duration) {
+	threshold := c.options.SlowQueryThreshold
+	if threshold <= 0 || duration < threshold {
+		return
+	}
+	pql = normalizePQL(pql)
+	if len(pql) > maxLoggedPQLSize {
+		pql = pql[:maxLoggedPQLSize] + "..."
+	}
+	requestID, _ := RequestIDFromContext(ctx)
+	c.logger().Warn("slow query",
+		"index", index,
+		"host", metadata.Host,
+		"request_id", requestID,
+		"pql", pql,
+		"duration", duration,
+		"request", metadata.Duration,
+		"decode", duration-metadata.Duration,
+		"size", metadata.Size)
+}
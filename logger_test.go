@@ -0,0 +1,225 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type logEntry struct {
+	level   LogLevel
+	msg     string
+	keyvals []interface{}
+}
+
+func (e logEntry) value(key string) interface{} {
+	for i := 0; i+1 < len(e.keyvals); i += 2 {
+		if e.keyvals[i] == key {
+			return e.keyvals[i+1]
+		}
+	}
+	return nil
+}
+
+type recordingLogger struct {
+	mutex   sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordingLogger) add(level LogLevel, msg string, keyvals []interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, keyvals: keyvals})
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) { l.add(LevelDebug, msg, keyvals) }
+func (l *recordingLogger) Info(msg string, keyvals ...interface{})  { l.add(LevelInfo, msg, keyvals) }
+func (l *recordingLogger) Warn(msg string, keyvals ...interface{})  { l.add(LevelWarn, msg, keyvals) }
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) { l.add(LevelError, msg, keyvals) }
+
+func (l *recordingLogger) messages() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	messages := make([]string, len(l.entries))
+	for i, entry := range l.entries {
+		messages[i] = entry.msg
+	}
+	return messages
+}
+
+func TestLogger(t *testing.T) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection refused")
+		}
+		if attempts == 2 {
+			return &http.Response{
+				StatusCode: 503,
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
+		}
+		time.Sleep(5 * time.Millisecond)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	logger := &recordingLogger{}
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{503}}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true),
+		Retry(policy), WithLogger(logger), SlowRequestThreshold(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleIndex.Count(sampleFrame.Bitmap(1))); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{
+		"selected host",
+		"request failed",
+		"retrying request",
+		"selected host",
+		"retrying request",
+		"selected host",
+		"slow request",
+	}
+	messages := logger.messages()
+	if len(messages) != len(target) {
+		t.Fatalf("%v != %v", target, messages)
+	}
+	for i := range target {
+		if messages[i] != target[i] {
+			t.Fatalf("%v != %v", target, messages)
+		}
+	}
+	failed, retried, slow := logger.entries[1], logger.entries[4], logger.entries[6]
+	if failed.level != LevelWarn || failed.value("host") != "node1:10101" || failed.value("error") == nil {
+		t.Fatalf("unexpected entry: %v", failed)
+	}
+	if retried.level != LevelInfo || retried.value("attempt") != 2 || !IsRetryable(retried.value("error").(error)) {
+		t.Fatalf("unexpected entry: %v", retried)
+	}
+	if slow.level != LevelWarn || slow.value("path") != "/index/sample-index/query" || slow.value("status") != 200 {
+		t.Fatalf("unexpected entry: %v", slow)
+	}
+}
+
+func TestNoLogger(t *testing.T) {
+	client, err := NewClient("node1:10101")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.logger().(NopLogger); !ok {
+		t.Fatalf("unexpected logger: %v", client.logger())
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	logger := NewStdLogger(log.New(buf, "", 0), LevelInfo)
+	logger.Debug("selected host", "host", "node1:10101")
+	logger.Info("retrying request", "path", "/status", "attempt", 1, "error", errors.New("connection refused"))
+	logger.Error("odd", "key")
+	target := "INFO go-pilosa: retrying request path=/status attempt=1 error=\"connection refused\"\n" +
+		"ERROR go-pilosa: odd key=MISSING\n"
+	if buf.String() != target {
+		t.Fatalf("%q != %q", target, buf.String())
+	}
+}
+
+func TestSlowQueryLogging(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		time.Sleep(5 * time.Millisecond)
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+			Request:    req,
+		}, nil
+	})
+	logger := &recordingLogger{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true),
+		WithLogger(logger), SlowQueryThreshold(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleIndex.RawQuery("Count(  Bitmap(frame='f1',   rowID=1))")); err != nil {
+		t.Fatal(err)
+	}
+	var slow *logEntry
+	for i, entry := range logger.entries {
+		if entry.msg == "slow query" {
+			slow = &logger.entries[i]
+		}
+	}
+	if slow == nil {
+		t.Fatalf("slow query is not logged: %v", logger.messages())
+	}
+	if slow.value("index") != "sample-index" || slow.value("host") != "node1:10101" {
+		t.Fatalf("unexpected entry: %v", slow)
+	}
+	if slow.value("pql") != normalizePQL("Count(  Bitmap(frame='f1',   rowID=1))") {
+		t.Fatalf("unexpected pql: %v", slow.value("pql"))
+	}
+	duration, request := slow.value("duration").(time.Duration), slow.value("request").(time.Duration)
+	if request < 5*time.Millisecond || duration < request || slow.value("decode").(time.Duration) != duration-request {
+		t.Fatalf("unexpected timing: %v", slow)
+	}
+	if slow.value("size") != len(`{"results": [5]}`) {
+		t.Fatalf("unexpected size: %v", slow.value("size"))
+	}
+
+	logger.entries = nil
+	client, err = NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true),
+		WithLogger(logger), SlowQueryThreshold(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleIndex.Count(sampleFrame.Bitmap(1))); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range logger.messages() {
+		if message == "slow query" {
+			t.Fatal("fast query is logged as slow")
+		}
+	}
+}
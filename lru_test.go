@@ -0,0 +1,58 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	cache := newLRU(2)
+	cache.add("a", 1)
+	cache.add("b", 2)
+	cache.get("a")
+	cache.add("c", 3)
+	if _, ok := cache.get("b"); ok {
+		t.Fatalf("the least recently used value should be evicted")
+	}
+	cache.add("a", 4)
+	if value, ok := cache.get("a"); !ok || value != 4 {
+		t.Fatalf("the value should be replaced, got %v", value)
+	}
+	cache.removeIf(func(value interface{}) bool { return value == 3 })
+	if _, ok := cache.get("c"); ok || cache.len() != 1 {
+		t.Fatalf("the value should be removed, %d values left", cache.len())
+	}
+	cache.remove("a")
+	if cache.len() != 0 {
+		t.Fatalf("no values should be left, got %d", cache.len())
+	}
+}
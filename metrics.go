@@ -0,0 +1,182 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsCollector collects metrics about the requests of a client, e.g., to export them to Prometheus.
+// Set it with the Metrics client option.
+// Implementations must be safe for concurrent use and should return quickly,
+// since they are called while the requests are processed.
+type MetricsCollector interface {
+	// RequestDone is called when the response body of a request is closed, or the request fails.
+	RequestDone(request RequestMetrics)
+	// RequestRetried is called before a request to the given endpoint is retried.
+	RequestRetried(endpoint string)
+}
+
+// RequestMetrics describes a request sent by the client.
+type RequestMetrics struct {
+	// Host is the host the request was sent to, in host:port form,
+	// or the path of the socket for a Unix domain socket.
+	Host   string
+	Method string
+	// Endpoint is the path of the request without the query string, with the names of indexes,
+	// frames, fields and views and slice numbers replaced by placeholders, e.g., /index/{index}/query.
+	Endpoint string
+	// StatusCode is the status code of the response, or 0 if there is no response.
+	StatusCode int
+	// Err is the error of the request if there is no response.
+	Err error
+	// Duration is the time from sending the request to closing the response body.
+	Duration time.Duration
+	// BytesOut is the size of the request body sent, after compression.
+	BytesOut int64
+	// BytesIn is the size of the response body read, after decompression.
+	BytesIn int64
+}
+
+// Failed returns true if the request failed or the server responded with an error status.
+func (m RequestMetrics) Failed() bool {
+	return m.Err != nil || m.StatusCode < 200 || m.StatusCode >= 300
+}
+
+// StatusLabel returns the status code of the response as a string, or "error" if there is no response.
+// It is meant to be used as a metric label.
+func (m RequestMetrics) StatusLabel() string {
+	if m.StatusCode == 0 {
+		return "error"
+	}
+	return strconv.Itoa(m.StatusCode)
+}
+
+var endpointPlaceholders = map[string]string{
+	"index":          "{index}",
+	"frame":          "{frame}",
+	"field":          "{field}",
+	"view":           "{view}",
+	"import-roaring": "{slice}",
+}
+
+// endpointFromPath returns the path without the query string and with
+// the names of resources and slice numbers replaced by placeholders.
+func endpointFromPath(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if placeholder, ok := endpointPlaceholders[parts[i-1]]; ok && parts[i] != "" {
+			parts[i] = placeholder
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// observeRequest reports a request which failed without a response to the collector of the client.
+// If there is a response, its body is wrapped so the request is reported when the body is closed.
+func (c *Client) observeRequest(host *URI, method string, path string, bytesOut int, start time.Time, resp *http.Response, err error) {
+	collector := c.options.Metrics
+	if collector == nil {
+		return
+	}
+	metrics := RequestMetrics{
+		Host:     host.address(),
+		Method:   method,
+		Endpoint: endpointFromPath(path),
+		BytesOut: int64(bytesOut),
+	}
+	if err != nil {
+		metrics.Err = err
+		metrics.Duration = time.Since(start)
+		collector.RequestDone(metrics)
+		return
+	}
+	metrics.StatusCode = resp.StatusCode
+	resp.Body = &metricsBody{
+		ReadCloser: resp.Body,
+		collector:  collector,
+		metrics:    metrics,
+		start:      start,
+	}
+}
+
+// observeRetry reports a retried request to the collector of the client.
+func (c *Client) observeRetry(path string) {
+	if c.options.Metrics != nil {
+		c.options.Metrics.RequestRetried(endpointFromPath(path))
+	}
+}
+
+// countRetries returns a function which calls fn and reports and logs each call after the first one as a retry.
+func (c *Client) countRetries(path string, fn func() error) func() error {
+	attempt := 0
+	return func() error {
+		if attempt > 0 {
+			c.logger().Info("retrying request", "path", path, "attempt", attempt)
+			c.observeRetry(path)
+		}
+		attempt++
+		return fn()
+	}
+}
+
+// metricsBody counts the bytes read from a response body and reports the request when it is closed.
+type metricsBody struct {
+	io.ReadCloser
+	collector MetricsCollector
+	metrics   RequestMetrics
+	start     time.Time
+	once      sync.Once
+}
+
+func (b *metricsBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.metrics.BytesIn += int64(n)
+	return n, err
+}
+
+func (b *metricsBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.metrics.Duration = time.Since(b.start)
+		b.collector.RequestDone(b.metrics)
+	})
+	return err
+}
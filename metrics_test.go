@@ -0,0 +1,131 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingMetrics struct {
+	mutex    sync.Mutex
+	requests []RequestMetrics
+	retries  []string
+}
+
+func (m *recordingMetrics) RequestDone(request RequestMetrics) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.requests = append(m.requests, request)
+}
+
+func (m *recordingMetrics) RequestRetried(endpoint string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retries = append(m.retries, endpoint)
+}
+
+func TestMetrics(t *testing.T) {
+	attempts := 0
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("connection refused")
+		}
+		if attempts == 2 {
+			return &http.Response{
+				StatusCode: 503,
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	metrics := &recordingMetrics{}
+	policy := &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{503}}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true), Metrics(metrics), Retry(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := sampleIndex.Count(sampleFrame.Bitmap(1))
+	if _, err = client.Query(query); err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics.requests) != 3 {
+		t.Fatalf("unexpected requests: %v", metrics.requests)
+	}
+	for _, request := range metrics.requests {
+		if request.Host != "node1:10101" || request.Method != "POST" || request.Endpoint != "/index/{index}/query" {
+			t.Fatalf("unexpected request: %v", request)
+		}
+		if request.BytesOut != int64(len(query.serialize())) {
+			t.Fatalf("unexpected bytes out: %d", request.BytesOut)
+		}
+	}
+	failed, unavailable, succeeded := metrics.requests[0], metrics.requests[1], metrics.requests[2]
+	if failed.Err == nil || failed.StatusCode != 0 || !failed.Failed() || failed.StatusLabel() != "error" {
+		t.Fatalf("unexpected failed request: %v", failed)
+	}
+	if unavailable.StatusCode != 503 || !unavailable.Failed() || unavailable.BytesIn != int64(len("unavailable")) {
+		t.Fatalf("unexpected unavailable request: %v", unavailable)
+	}
+	if succeeded.Failed() || succeeded.StatusLabel() != "200" || succeeded.BytesIn != int64(len(`{"results": [5]}`)) {
+		t.Fatalf("unexpected succeeded request: %v", succeeded)
+	}
+	if len(metrics.retries) != 2 || metrics.retries[1] != "/index/{index}/query" {
+		t.Fatalf("unexpected retries: %v", metrics.retries)
+	}
+}
+
+func TestEndpointFromPath(t *testing.T) {
+	paths := map[string]string{
+		"/status":                                   "/status",
+		"/index/i1/query?columnAttrs=true":          "/index/{index}/query",
+		"/index/i1/frame/f1/field/x":                "/index/{index}/frame/{frame}/field/{field}",
+		"/index/i1/frame/f1/view/standard":          "/index/{index}/frame/{frame}/view/{view}",
+		"/index/i1/frame/f1/import-roaring/3":       "/index/{index}/frame/{frame}/import-roaring/{slice}",
+		"/export?index=i1&frame=f1&slice=0&view=st": "/export",
+		"/index/i1/frame/f1/views":                  "/index/{index}/frame/{frame}/views",
+	}
+	for path, target := range paths {
+		if endpoint := endpointFromPath(path); endpoint != target {
+			t.Fatalf("%s: %s != %s", path, target, endpoint)
+		}
+	}
+}
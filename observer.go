@@ -0,0 +1,103 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+// ClusterObserver is notified about the changes in a cluster and the requests routed to its hosts.
+// Register observers with Cluster.RegisterObserver.
+//
+// Observers are called synchronously, after the cluster is unlocked, so they may use the cluster.
+// They should return quickly, since they delay the request which triggered them.
+type ClusterObserver interface {
+	// HostAdded is called when a host is added to the cluster.
+	HostAdded(host *URI)
+	// HostRemoved is called when a host is removed from the cluster.
+	HostRemoved(host *URI)
+	// HostDown is called when the circuit breaker of a host opens or it fails a health check.
+	HostDown(host *URI)
+	// HostUp is called when a host which was down succeeds a request or passes a health check.
+	HostUp(host *URI)
+	// RequestRouted is called when a host is selected for a request about the given index.
+	// index is empty if the request is not about an index.
+	RequestRouted(host *URI, index string)
+}
+
+// NopClusterObserver is a ClusterObserver which does nothing.
+// Embed it to implement only some of the methods of ClusterObserver.
+type NopClusterObserver struct{}
+
+// HostAdded does nothing.
+func (NopClusterObserver) HostAdded(host *URI) {}
+
+// HostRemoved does nothing.
+func (NopClusterObserver) HostRemoved(host *URI) {}
+
+// HostDown does nothing.
+func (NopClusterObserver) HostDown(host *URI) {}
+
+// HostUp does nothing.
+func (NopClusterObserver) HostUp(host *URI) {}
+
+// RequestRouted does nothing.
+func (NopClusterObserver) RequestRouted(host *URI, index string) {}
+
+type clusterEventKind int
+
+const (
+	eventHostAdded clusterEventKind = iota
+	eventHostRemoved
+	eventHostDown
+	eventHostUp
+	eventRequestRouted
+)
+
+// clusterEvent is recorded while the cluster is locked and sent to the observers after it is unlocked.
+type clusterEvent struct {
+	kind  clusterEventKind
+	host  *URI
+	index string
+}
+
+func (e clusterEvent) notify(observer ClusterObserver) {
+	switch e.kind {
+	case eventHostAdded:
+		observer.HostAdded(e.host)
+	case eventHostRemoved:
+		observer.HostRemoved(e.host)
+	case eventHostDown:
+		observer.HostDown(e.host)
+	case eventHostUp:
+		observer.HostUp(e.host)
+	case eventRequestRouted:
+		observer.RequestRouted(e.host, e.index)
+	}
+}
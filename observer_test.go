@@ -0,0 +1,112 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"reflect"
+	"testing"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) HostAdded(host *URI) {
+	o.events = append(o.events, "added "+host.HostPort())
+}
+func (o *recordingObserver) HostRemoved(host *URI) {
+	o.events = append(o.events, "removed "+host.HostPort())
+}
+func (o *recordingObserver) HostDown(host *URI) { o.events = append(o.events, "down "+host.HostPort()) }
+func (o *recordingObserver) HostUp(host *URI)   { o.events = append(o.events, "up "+host.HostPort()) }
+func (o *recordingObserver) RequestRouted(host *URI, index string) {
+	o.events = append(o.events, "routed "+host.HostPort()+" "+index)
+}
+
+func TestClusterObserver(t *testing.T) {
+	host1 := URIFromAddress("host1:10101")
+	host2 := URIFromAddress("host2:10101")
+	host3 := URIFromAddress("host3:10101")
+	c := DefaultCluster()
+	observer := &recordingObserver{}
+	c.RegisterObserver(observer)
+	c.AddHost(host1)
+	c.AddHostWithWeight(host2, 2)
+	c.AddHost(host1)
+	c.hostFor("repository", defaultBreakerSettings)
+	c.hostFailed(host1, defaultBreakerSettings)
+	// the host is already down
+	c.hostFailed(host1, defaultBreakerSettings)
+	c.hostSucceeded(host1, defaultBreakerSettings)
+	// the host was not down
+	c.hostSucceeded(host1, defaultBreakerSettings)
+	c.setHealthy(host2, false)
+	c.setHealthy(host2, true)
+	c.RemoveHost(host1)
+	c.syncHosts([]*URI{host3})
+	target := []string{
+		"added host1:10101",
+		"added host2:10101",
+		"routed host2:10101 repository",
+		"down host1:10101",
+		"up host1:10101",
+		"down host2:10101",
+		"up host2:10101",
+		"removed host1:10101",
+		"added host3:10101",
+		"removed host2:10101",
+	}
+	if !reflect.DeepEqual(target, observer.events) {
+		t.Fatalf("%v != %v", target, observer.events)
+	}
+}
+
+func TestClusterObserverMayUseCluster(t *testing.T) {
+	c := NewClusterWithHost(URIFromAddress("host1:10101"))
+	observer := &hostsObserver{cluster: c}
+	c.RegisterObserver(observer)
+	c.AddHost(URIFromAddress("host2:10101"))
+	if observer.hosts != 2 {
+		t.Fatalf("the observer should see the added host")
+	}
+}
+
+type hostsObserver struct {
+	NopClusterObserver
+	cluster *Cluster
+	hosts   int
+}
+
+func (o *hostsObserver) HostAdded(host *URI) {
+	o.hosts = len(o.cluster.Hosts())
+}
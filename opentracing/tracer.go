@@ -0,0 +1,100 @@
+// +build opentracing
+
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Package opentracing reports the requests of a Pilosa client as OpenTracing spans.
+//
+// The package is built only with the opentracing build tag, so the client
+// does not depend on the OpenTracing library otherwise:
+//
+//	go build -tags opentracing
+package opentracing
+
+import (
+	"context"
+	"net/http"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+// Tracer is a pilosa.Tracer which starts OpenTracing client spans
+// and propagates them to the server in HTTP headers.
+type Tracer struct {
+	tracer ot.Tracer
+}
+
+// NewTracer creates a Tracer which starts spans with the given OpenTracing tracer.
+// The global tracer at the time a span is started is used if tracer is nil.
+func NewTracer(tracer ot.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// StartSpan starts a client span as a child of the OpenTracing span in ctx, if there is one.
+func (t *Tracer) StartSpan(ctx context.Context, operation string) pilosa.Span {
+	tracer := t.tracer
+	if tracer == nil {
+		tracer = ot.GlobalTracer()
+	}
+	options := []ot.StartSpanOption{ext.SpanKindRPCClient}
+	if parent := ot.SpanFromContext(ctx); parent != nil {
+		options = append(options, ot.ChildOf(parent.Context()))
+	}
+	return &span{
+		span:   tracer.StartSpan(operation, options...),
+		tracer: tracer,
+	}
+}
+
+type span struct {
+	span   ot.Span
+	tracer ot.Tracer
+}
+
+func (s *span) SetTag(key string, value interface{}) {
+	s.span.SetTag(key, value)
+}
+
+func (s *span) InjectHeaders(header http.Header) {
+	// a tracer which doesn't support HTTP headers only loses propagation, the span is still reported
+	_ = s.tracer.Inject(s.span.Context(), ot.HTTPHeaders, ot.HTTPHeadersCarrier(header))
+}
+
+func (s *span) Finish(err error) {
+	if err != nil {
+		ext.Error.Set(s.span, true)
+		s.span.LogFields(log.Error(err))
+	}
+	s.span.Finish()
+}
@@ -0,0 +1,83 @@
+// +build opentracing
+
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package opentracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	ot "github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/mocktracer"
+)
+
+func TestTracer(t *testing.T) {
+	mock := mocktracer.New()
+	tracer := NewTracer(mock)
+	parent := mock.StartSpan("parent")
+	ctx := ot.ContextWithSpan(context.Background(), parent)
+
+	span := tracer.StartSpan(ctx, "pilosa POST /index/{index}/query")
+	span.SetTag("db.instance", "i1")
+	header := http.Header{}
+	span.InjectHeaders(header)
+	if len(header) == 0 {
+		t.Fatal("trace headers are not injected")
+	}
+	span.Finish(nil)
+
+	failed := tracer.StartSpan(context.Background(), "pilosa GET /status")
+	failed.Finish(errors.New("connection refused"))
+
+	spans := mock.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	queried, status := spans[0], spans[1]
+	if queried.ParentID != parent.(*mocktracer.MockSpan).SpanContext.SpanID {
+		t.Fatal("span is not a child of the span in the context")
+	}
+	if queried.Tag("db.instance") != "i1" || queried.Tag("span.kind") != ext.SpanKindRPCClientEnum {
+		t.Fatalf("unexpected tags: %v", queried.Tags())
+	}
+	if queried.Tag("error") != nil || status.Tag("error") != true {
+		t.Fatalf("unexpected error tags: %v %v", queried.Tags(), status.Tags())
+	}
+	if status.ParentID != 0 || len(status.Logs()) != 1 {
+		t.Fatalf("unexpected span: %v", status)
+	}
+}
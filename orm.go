@@ -36,7 +36,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -88,6 +90,127 @@ func (s *Schema) Indexes() map[string]*Index {
 	return result
 }
 
+// SchemaDiff contains the differences between two schemas.
+type SchemaDiff struct {
+	// Extra contains the indexes and frames which are in the schema but not in the other schema.
+	Extra *Schema
+	// Missing contains the indexes and frames which are in the other schema but not in the schema.
+	Missing *Schema
+	// Changed contains the options which have different values in the two schemas,
+	// for the indexes and frames which are in both.
+	Changed []OptionDiff
+}
+
+// Empty returns true if the schemas have the same indexes, frames and options.
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Extra.indexes) == 0 && len(d.Missing.indexes) == 0 && len(d.Changed) == 0
+}
+
+// OptionDiff contains an index or frame option which has different values in two schemas.
+type OptionDiff struct {
+	// Index is the name of the index.
+	Index string
+	// Frame is the name of the frame, or empty for an index option.
+	Frame string
+	// Option is the name of the option, e.g., timeQuantum.
+	Option string
+	// Value is the value of the option in the schema.
+	Value interface{}
+	// OtherValue is the value of the option in the other schema.
+	OtherValue interface{}
+}
+
+// Diff compares the schema with another schema, e.g., the schema on the server.
+// Cache types and cache sizes are compared only if they are set in both schemas,
+// since the server fills in its defaults for them.
+func (s *Schema) Diff(other *Schema) *SchemaDiff {
+	result := &SchemaDiff{
+		Extra:   s.diff(other),
+		Missing: other.diff(s),
+		Changed: []OptionDiff{},
+	}
+	indexNames := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+	for _, indexName := range indexNames {
+		index := s.indexes[indexName]
+		otherIndex, ok := other.indexes[indexName]
+		if !ok {
+			continue
+		}
+		result.Changed = append(result.Changed, index.diffOptions(otherIndex)...)
+		frameNames := make([]string, 0, len(index.frames))
+		for name := range index.frames {
+			frameNames = append(frameNames, name)
+		}
+		sort.Strings(frameNames)
+		for _, frameName := range frameNames {
+			if otherFrame, ok := otherIndex.frames[frameName]; ok {
+				result.Changed = append(result.Changed, index.frames[frameName].diffOptions(otherFrame)...)
+			}
+		}
+	}
+	return result
+}
+
+func (idx *Index) diffOptions(other *Index) []OptionDiff {
+	diffs := []OptionDiff{}
+	add := func(option string, value interface{}, otherValue interface{}) {
+		diffs = append(diffs, OptionDiff{Index: idx.name, Option: option, Value: value, OtherValue: otherValue})
+	}
+	if idx.options.ColumnLabel != other.options.ColumnLabel {
+		add("columnLabel", idx.options.ColumnLabel, other.options.ColumnLabel)
+	}
+	if idx.options.TimeQuantum != other.options.TimeQuantum {
+		add("timeQuantum", idx.options.TimeQuantum, other.options.TimeQuantum)
+	}
+	return diffs
+}
+
+func (f *Frame) diffOptions(other *Frame) []OptionDiff {
+	diffs := []OptionDiff{}
+	add := func(option string, value interface{}, otherValue interface{}) {
+		diffs = append(diffs, OptionDiff{Index: f.index.name, Frame: f.name, Option: option, Value: value, OtherValue: otherValue})
+	}
+	options, otherOptions := f.options, other.options
+	if options.RowLabel != otherOptions.RowLabel {
+		add("rowLabel", options.RowLabel, otherOptions.RowLabel)
+	}
+	if options.TimeQuantum != otherOptions.TimeQuantum {
+		add("timeQuantum", options.TimeQuantum, otherOptions.TimeQuantum)
+	}
+	if options.InverseEnabled != otherOptions.InverseEnabled {
+		add("inverseEnabled", options.InverseEnabled, otherOptions.InverseEnabled)
+	}
+	if options.CacheType != CacheTypeDefault && otherOptions.CacheType != CacheTypeDefault && options.CacheType != otherOptions.CacheType {
+		add("cacheType", options.CacheType, otherOptions.CacheType)
+	}
+	if options.CacheSize != 0 && otherOptions.CacheSize != 0 && options.CacheSize != otherOptions.CacheSize {
+		add("cacheSize", options.CacheSize, otherOptions.CacheSize)
+	}
+	// frames with fields are range enabled
+	rangeEnabled := options.RangeEnabled || len(options.fields) > 0
+	otherRangeEnabled := otherOptions.RangeEnabled || len(otherOptions.fields) > 0
+	if rangeEnabled != otherRangeEnabled {
+		add("rangeEnabled", rangeEnabled, otherRangeEnabled)
+	}
+	fields, otherFields := options.Fields(), otherOptions.Fields()
+	if !reflect.DeepEqual(fields, otherFields) {
+		add("fields", fields, otherFields)
+	}
+	return diffs
+}
+
+func (s *Schema) copy() *Schema {
+	result := NewSchema()
+	for name, index := range s.indexes {
+		result.indexes[name] = index.copy()
+	}
+	return result
+}
+
 func (s *Schema) diff(other *Schema) *Schema {
 	result := NewSchema()
 	for indexName, index := range s.indexes {
@@ -120,6 +243,12 @@ type PQLQuery interface {
 	Error() error
 }
 
+// SerializeQuery returns the PQL of the given query as it is sent to the server,
+// e.g., to log it or to match it in tests.
+func SerializeQuery(query PQLQuery) string {
+	return query.serialize()
+}
+
 // PQLBaseQuery is the base implementation for PQLQuery.
 type PQLBaseQuery struct {
 	index *Index
@@ -171,6 +300,12 @@ func (q PQLBitmapQuery) Error() error {
 	return q.err
 }
 
+// WithOptions wraps this query with an Options call.
+// See Index.Options for details.
+func (q *PQLBitmapQuery) WithOptions(options ...OptionsOption) *PQLBaseQuery {
+	return q.index.Options(q, options...)
+}
+
 // PQLBatchQuery contains a batch of PQL queries.
 // Use Index.BatchQuery function to create an instance.
 //
@@ -211,6 +346,7 @@ func (q *PQLBatchQuery) Add(query PQLQuery) {
 }
 
 // IndexOptions contains options to customize Index structs and column queries.
+// Frames of the index which don't set a time quantum inherit the time quantum of the index.
 // *Deprecation*: `ColumnLabel` field is deprecated and will be removed in a future release.
 type IndexOptions struct {
 	ColumnLabel string
@@ -229,7 +365,27 @@ func (options *IndexOptions) withDefaults() (updated *IndexOptions) {
 }
 
 func (options IndexOptions) String() string {
-	return fmt.Sprintf(`{"options": {"columnLabel": "%s"}}`, options.ColumnLabel)
+	data, _ := json.Marshal(options.request().Options)
+	return fmt.Sprintf(`{"options": %s}`, data)
+}
+
+// indexRequest is the body of the create index request.
+type indexRequest struct {
+	Options indexRequestOptions `json:"options"`
+}
+
+type indexRequestOptions struct {
+	ColumnLabel string      `json:"columnLabel"`
+	TimeQuantum TimeQuantum `json:"timeQuantum,omitempty"`
+}
+
+func (options IndexOptions) request() indexRequest {
+	return indexRequest{
+		Options: indexRequestOptions{
+			ColumnLabel: options.ColumnLabel,
+			TimeQuantum: options.TimeQuantum,
+		},
+	}
 }
 
 // NewPQLBitmapQuery creates a new PqlBitmapQuery.
@@ -266,6 +422,9 @@ func NewIndex(name string, options *IndexOptions) (*Index, error) {
 	if err := validateLabel(options.ColumnLabel); err != nil {
 		return nil, err
 	}
+	if err := validateTimeQuantum(options.TimeQuantum); err != nil {
+		return nil, err
+	}
 	return &Index{
 		name:    name,
 		options: options,
@@ -282,6 +441,18 @@ func (idx *Index) Frames() map[string]*Frame {
 	return result
 }
 
+// ColumnLabel returns the column label of the index.
+func (idx *Index) ColumnLabel() string {
+	return idx.options.ColumnLabel
+}
+
+// IndexOptions returns a copy of the options of the index.
+func (idx *Index) IndexOptions() *IndexOptions {
+	options := &IndexOptions{}
+	*options = *idx.options
+	return options
+}
+
 func (idx *Index) copy() *Index {
 	frames := make(map[string]*Frame)
 	for name, f := range idx.frames {
@@ -293,6 +464,10 @@ func (idx *Index) copy() *Index {
 		options: &IndexOptions{},
 	}
 	*index.options = *idx.options
+	// the copied frames belong to the copied index
+	for _, frame := range frames {
+		frame.index = index
+	}
 	return index
 }
 
@@ -318,6 +493,12 @@ func (idx *Index) Frame(name string, options ...interface{}) (*Frame, error) {
 	if err := validateLabel(frameOptions.RowLabel); err != nil {
 		return nil, err
 	}
+	if err := validateTimeQuantum(frameOptions.TimeQuantum); err != nil {
+		return nil, err
+	}
+	if err := validateCacheType(frameOptions.CacheType); err != nil {
+		return nil, err
+	}
 	frame := newFrame(name, idx)
 	frame.options = frameOptions
 	idx.frames[name] = frame
@@ -380,6 +561,21 @@ func (idx *Index) Count(bitmap *PQLBitmapQuery) *PQLBaseQuery {
 	return NewPQLBaseQuery(fmt.Sprintf("Count(%s)", bitmap.serialize()), idx, nil)
 }
 
+// Options creates an Options query.
+// Options wraps a bitmap query and modifies the way its result is returned, e.g., by excluding bits or attributes.
+func (idx *Index) Options(bitmap *PQLBitmapQuery, options ...OptionsOption) *PQLBaseQuery {
+	if err := bitmap.Error(); err != nil {
+		return NewPQLBaseQuery("", idx, err)
+	}
+	optionsOptions := &OptionsOptions{}
+	for _, option := range options {
+		if err := option(optionsOptions); err != nil {
+			return NewPQLBaseQuery("", idx, err)
+		}
+	}
+	return NewPQLBaseQuery(fmt.Sprintf("Options(%s)", optionsOptions.serialize(bitmap.serialize())), idx, nil)
+}
+
 // SetColumnAttrs creates a SetColumnAttrs query.
 // SetColumnAttrs associates arbitrary key/value pairs with a column in an index.
 // Following types are accepted: integer, float, string and boolean types.
@@ -404,6 +600,74 @@ func (idx *Index) bitmapOperation(name string, bitmaps ...*PQLBitmapQuery) *PQLB
 	return NewPQLBitmapQuery(fmt.Sprintf("%s(%s)", name, strings.Join(args, ", ")), idx, nil)
 }
 
+// OptionsOptions contains the arguments of an Options call.
+type OptionsOptions struct {
+	// ColumnAttrs enables returning column attributes.
+	ColumnAttrs bool
+	// ExcludeAttrs inhibits returning attributes.
+	ExcludeAttrs bool
+	// ExcludeBits inhibits returning bits.
+	ExcludeBits bool
+	// Slices restricts the query to the given slices.
+	Slices []uint64
+}
+
+func (oo OptionsOptions) serialize(bitmap string) string {
+	args := []string{bitmap}
+	if oo.ColumnAttrs {
+		args = append(args, "columnAttrs=true")
+	}
+	if oo.ExcludeBits {
+		args = append(args, "excludeBits=true")
+	}
+	if oo.ExcludeAttrs {
+		args = append(args, "excludeAttrs=true")
+	}
+	if len(oo.Slices) > 0 {
+		slices := make([]string, 0, len(oo.Slices))
+		for _, slice := range oo.Slices {
+			slices = append(slices, strconv.FormatUint(slice, 10))
+		}
+		args = append(args, fmt.Sprintf("slices=[%s]", strings.Join(slices, ",")))
+	}
+	return strings.Join(args, ", ")
+}
+
+// OptionsOption is used to pass an option to index.Options function.
+type OptionsOption func(options *OptionsOptions) error
+
+// OptionsColumnAttrs enables returning column attributes in the result of an Options call.
+func OptionsColumnAttrs(enable bool) OptionsOption {
+	return func(options *OptionsOptions) error {
+		options.ColumnAttrs = enable
+		return nil
+	}
+}
+
+// OptionsExcludeAttrs enables discarding attributes from the result of an Options call.
+func OptionsExcludeAttrs(enable bool) OptionsOption {
+	return func(options *OptionsOptions) error {
+		options.ExcludeAttrs = enable
+		return nil
+	}
+}
+
+// OptionsExcludeBits enables discarding bits from the result of an Options call.
+func OptionsExcludeBits(enable bool) OptionsOption {
+	return func(options *OptionsOptions) error {
+		options.ExcludeBits = enable
+		return nil
+	}
+}
+
+// OptionsSlices restricts an Options call to the given slices.
+func OptionsSlices(slices ...uint64) OptionsOption {
+	return func(options *OptionsOptions) error {
+		options.Slices = slices
+		return nil
+	}
+}
+
 // FrameInfo represents schema information for a frame.
 type FrameInfo struct {
 	Name string `json:"name"`
@@ -420,7 +684,10 @@ type FrameOptions struct {
 	CacheType      CacheType
 	CacheSize      uint
 	RangeEnabled   bool
-	fields         map[string]rangeField
+	// KeyTranslator translates string keys for the *K query functions of the frame, like BitmapK and SetBitK.
+	// It is not sent to the server.
+	KeyTranslator KeyTranslator
+	fields        map[string]rangeField
 }
 
 func (fo *FrameOptions) withDefaults() (updated *FrameOptions) {
@@ -438,33 +705,56 @@ func (fo *FrameOptions) withDefaults() (updated *FrameOptions) {
 }
 
 func (fo FrameOptions) String() string {
-	mopt := map[string]interface{}{
-		"rowLabel": fo.RowLabel,
-	}
-	if fo.InverseEnabled {
-		mopt["inverseEnabled"] = true
-	}
-	if fo.TimeQuantum != TimeQuantumNone {
-		mopt["timeQuantum"] = string(fo.TimeQuantum)
-	}
-	if fo.CacheType != CacheTypeDefault {
-		mopt["cacheType"] = string(fo.CacheType)
-	}
-	if fo.CacheSize != 0 {
-		mopt["cacheSize"] = fo.CacheSize
-	}
-	if fo.RangeEnabled {
-		mopt["rangeEnabled"] = true
+	data, _ := json.Marshal(fo.request().Options)
+	return fmt.Sprintf(`{"options": %s}`, data)
+}
+
+// frameRequest is the body of the create frame request.
+type frameRequest struct {
+	Options frameRequestOptions `json:"options"`
+}
+
+type frameRequestOptions struct {
+	RowLabel       string      `json:"rowLabel"`
+	InverseEnabled bool        `json:"inverseEnabled,omitempty"`
+	TimeQuantum    TimeQuantum `json:"timeQuantum,omitempty"`
+	CacheType      CacheType   `json:"cacheType,omitempty"`
+	CacheSize      uint        `json:"cacheSize,omitempty"`
+	RangeEnabled   bool        `json:"rangeEnabled,omitempty"`
+	Fields         []FieldInfo `json:"fields,omitempty"`
+}
+
+func (fo FrameOptions) request() frameRequest {
+	options := frameRequestOptions{
+		RowLabel:       fo.RowLabel,
+		InverseEnabled: fo.InverseEnabled,
+		TimeQuantum:    fo.TimeQuantum,
+		CacheType:      fo.CacheType,
+		CacheSize:      fo.CacheSize,
+		RangeEnabled:   fo.RangeEnabled,
 	}
 	if len(fo.fields) > 0 {
-		mopt["rangeEnabled"] = true
-		fields := make([]rangeField, 0, len(fo.fields))
-		for _, field := range fo.fields {
-			fields = append(fields, field)
-		}
-		mopt["fields"] = fields
+		// frames with fields should be range enabled
+		options.RangeEnabled = true
+		options.Fields = fo.Fields()
 	}
-	return fmt.Sprintf(`{"options": %s}`, encodeMap(mopt))
+	return frameRequest{Options: options}
+}
+
+// Fields returns the definitions of the fields in the frame options, sorted by name.
+func (fo *FrameOptions) Fields() []FieldInfo {
+	fields := make([]FieldInfo, 0, len(fo.fields))
+	for name, field := range fo.fields {
+		info := FieldInfo{Name: name}
+		info.Type, _ = field["type"].(string)
+		info.Min, _ = field.intValue("min")
+		info.Max, _ = field.intValue("max")
+		fields = append(fields, info)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
 }
 
 // AddIntField adds an integer field to the frame options
@@ -536,6 +826,14 @@ func RangeEnabled(enabled bool) FrameOption {
 	}
 }
 
+// KeyTranslation sets the translator used for string row and column keys.
+func KeyTranslation(translator KeyTranslator) FrameOption {
+	return func(options *FrameOptions) error {
+		options.KeyTranslator = translator
+		return nil
+	}
+}
+
 // IntField adds an integer field to the frame.
 func IntField(name string, min int, max int) FrameOption {
 	return func(options *FrameOptions) error {
@@ -571,6 +869,48 @@ func (f *Frame) Name() string {
 	return f.name
 }
 
+// Index returns the index of the frame.
+func (f *Frame) Index() *Index {
+	return f.index
+}
+
+// RowLabel returns the row label of the frame.
+func (f *Frame) RowLabel() string {
+	return f.options.RowLabel
+}
+
+// FrameOptions returns a copy of the options of the frame.
+// Frames in the schema returned by the server have their options set from the server configuration.
+func (f *Frame) FrameOptions() *FrameOptions {
+	options := &FrameOptions{}
+	*options = *f.options
+	options.fields = copyFields(f.options.fields)
+	return options
+}
+
+// bitCall serializes a Bitmap, SetBit or ClearBit call without fmt.Sprintf,
+// since high-frequency writers build one of these for every bit.
+// The column argument is omitted if columnLabel is empty.
+func (f *Frame) bitCall(name string, rowLabel string, rowID uint64, columnLabel string, columnID uint64) string {
+	buf := make([]byte, 0, 64)
+	buf = append(buf, name...)
+	buf = append(buf, '(')
+	buf = append(buf, rowLabel...)
+	buf = append(buf, '=')
+	buf = strconv.AppendUint(buf, rowID, 10)
+	buf = append(buf, ", frame='"...)
+	buf = append(buf, f.name...)
+	buf = append(buf, '\'')
+	if columnLabel != "" {
+		buf = append(buf, ", "...)
+		buf = append(buf, columnLabel...)
+		buf = append(buf, '=')
+		buf = strconv.AppendUint(buf, columnID, 10)
+	}
+	buf = append(buf, ')')
+	return string(buf)
+}
+
 func (f *Frame) copy() *Frame {
 	frame := newFrame(f.name, f.index)
 	*frame.options = *f.options
@@ -585,23 +925,41 @@ func (f *Frame) copy() *Frame {
 // Bitmap retrieves the indices of all the set bits in a row or column based on whether the row label or column label is given in the query.
 // It also retrieves any attributes set on that row or column.
 func (f *Frame) Bitmap(rowID uint64) *PQLBitmapQuery {
-	return NewPQLBitmapQuery(fmt.Sprintf("Bitmap(%s=%d, frame='%s')",
-		f.options.RowLabel, rowID, f.name), f.index, nil)
+	return NewPQLBitmapQuery(f.bitCall("Bitmap", f.options.RowLabel, rowID, "", 0), f.index, nil)
+}
+
+// BitmapK creates a bitmap query using a string row key.
+// The key is translated to a row ID using the key translator of the frame.
+func (f *Frame) BitmapK(rowKey string) *PQLBitmapQuery {
+	rowID, err := f.translateRowKey(rowKey)
+	if err != nil {
+		return NewPQLBitmapQuery("", f.index, err)
+	}
+	return f.Bitmap(rowID)
 }
 
 // InverseBitmap creates a bitmap query using the column label.
 // Bitmap retrieves the indices of all the set bits in a row or column based on whether the row label or column label is given in the query.
 // It also retrieves any attributes set on that row or column.
-func (f *Frame) InverseBitmap(columnID uint64) *PQLBaseQuery {
-	return NewPQLBaseQuery(fmt.Sprintf("Bitmap(%s=%d, frame='%s')",
-		f.index.options.ColumnLabel, columnID, f.name), f.index, nil)
+// The frame should be created with InverseEnabled set.
+func (f *Frame) InverseBitmap(columnID uint64) *PQLBitmapQuery {
+	return NewPQLBitmapQuery(f.bitCall("Bitmap", f.index.options.ColumnLabel, columnID, "", 0), f.index, nil)
 }
 
 // SetBit creates a SetBit query.
 // SetBit, assigns a value of 1 to a bit in the binary matrix, thus associating the given row in the given frame with the given column.
 func (f *Frame) SetBit(rowID uint64, columnID uint64) *PQLBaseQuery {
-	return NewPQLBaseQuery(fmt.Sprintf("SetBit(%s=%d, frame='%s', %s=%d)",
-		f.options.RowLabel, rowID, f.name, f.index.options.ColumnLabel, columnID), f.index, nil)
+	return NewPQLBaseQuery(f.bitCall("SetBit", f.options.RowLabel, rowID, f.index.options.ColumnLabel, columnID), f.index, nil)
+}
+
+// SetBitK creates a SetBit query using string row and column keys.
+// The keys are translated to IDs using the key translator of the frame.
+func (f *Frame) SetBitK(rowKey string, columnKey string) *PQLBaseQuery {
+	rowID, columnID, err := f.translateKeys(rowKey, columnKey)
+	if err != nil {
+		return NewPQLBaseQuery("", f.index, err)
+	}
+	return f.SetBit(rowID, columnID)
 }
 
 // SetBitTimestamp creates a SetBit query with timestamp.
@@ -616,8 +974,17 @@ func (f *Frame) SetBitTimestamp(rowID uint64, columnID uint64, timestamp time.Ti
 // ClearBit creates a ClearBit query.
 // ClearBit, assigns a value of 0 to a bit in the binary matrix, thus disassociating the given row in the given frame from the given column.
 func (f *Frame) ClearBit(rowID uint64, columnID uint64) *PQLBaseQuery {
-	return NewPQLBaseQuery(fmt.Sprintf("ClearBit(%s=%d, frame='%s', %s=%d)",
-		f.options.RowLabel, rowID, f.name, f.index.options.ColumnLabel, columnID), f.index, nil)
+	return NewPQLBaseQuery(f.bitCall("ClearBit", f.options.RowLabel, rowID, f.index.options.ColumnLabel, columnID), f.index, nil)
+}
+
+// ClearBitK creates a ClearBit query using string row and column keys.
+// The keys are translated to IDs using the key translator of the frame.
+func (f *Frame) ClearBitK(rowKey string, columnKey string) *PQLBaseQuery {
+	rowID, columnID, err := f.translateKeys(rowKey, columnKey)
+	if err != nil {
+		return NewPQLBaseQuery("", f.index, err)
+	}
+	return f.ClearBit(rowID, columnID)
 }
 
 // TopN creates a TopN query with the given item count.
@@ -784,6 +1151,7 @@ const (
 	CacheTypeDefault CacheType = ""
 	CacheTypeLRU     CacheType = "lru"
 	CacheTypeRanked  CacheType = "ranked"
+	CacheTypeNone    CacheType = "none"
 )
 
 // rangeField represents a single field.
@@ -806,6 +1174,36 @@ func newIntRangeField(name string, min int, max int) (rangeField, error) {
 	}, nil
 }
 
+// intValue returns the value of an integer attribute of the field.
+// Fields defined locally store int values, the ones read from the server store int64 values.
+func (f rangeField) intValue(key string) (int64, bool) {
+	switch v := f[key].(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	}
+	return 0, false
+}
+
+// copyFields returns a copy of the given field definitions.
+// Frame copies share their options, so the definitions are copied before they are modified.
+func copyFields(fields map[string]rangeField) map[string]rangeField {
+	result := make(map[string]rangeField, len(fields)+1)
+	for name, field := range fields {
+		result[name] = field
+	}
+	return result
+}
+
+// FieldInfo contains the definition of a field.
+type FieldInfo struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Min  int64  `json:"min"`
+	Max  int64  `json:"max"`
+}
+
 // RangeField enables writing queries for range encoded fields.
 type RangeField struct {
 	frame *Frame
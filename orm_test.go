@@ -77,6 +77,45 @@ func TestSchemaDiff(t *testing.T) {
 	}
 }
 
+func TestSchemaDiffOptions(t *testing.T) {
+	schema1 := NewSchema()
+	index11, _ := schema1.Index("diff-index1", &IndexOptions{TimeQuantum: TimeQuantumYear})
+	index11.Frame("frame1", CacheTypeRanked, IntField("foo", 0, 10))
+	index11.Frame("frame2", InverseEnabled(true), CacheSize(100))
+	index11.Frame("frame3")
+
+	schema2 := NewSchema()
+	index21, _ := schema2.Index("diff-index1", nil)
+	index21.Frame("frame1", CacheTypeRanked, CacheSize(50000), IntField("foo", 0, 100))
+	index21.Frame("frame2", CacheTypeLRU, CacheSize(100))
+	index22, _ := schema2.Index("diff-index2", nil)
+	index22.Frame("frame2-1")
+
+	diff := schema1.Diff(schema2)
+	if diff.Empty() {
+		t.Fatalf("the diff should not be empty")
+	}
+	if len(diff.Extra.indexes) != 1 || len(diff.Extra.indexes["diff-index1"].frames) != 1 {
+		t.Fatalf("frame3 should be extra: %v", diff.Extra)
+	}
+	if len(diff.Missing.indexes) != 1 || diff.Missing.indexes["diff-index2"] == nil {
+		t.Fatalf("diff-index2 should be missing: %v", diff.Missing)
+	}
+	target := []OptionDiff{
+		{Index: "diff-index1", Option: "timeQuantum", Value: TimeQuantumYear, OtherValue: TimeQuantumNone},
+		{Index: "diff-index1", Frame: "frame1", Option: "fields",
+			Value:      []FieldInfo{{Name: "foo", Type: "int", Min: 0, Max: 10}},
+			OtherValue: []FieldInfo{{Name: "foo", Type: "int", Min: 0, Max: 100}}},
+		{Index: "diff-index1", Frame: "frame2", Option: "inverseEnabled", Value: true, OtherValue: false},
+	}
+	if !reflect.DeepEqual(target, diff.Changed) {
+		t.Fatalf("%v != %v", target, diff.Changed)
+	}
+	if !schema1.Diff(schema1).Empty() {
+		t.Fatalf("the diff of a schema with itself should be empty")
+	}
+}
+
 func TestSchemaIndexes(t *testing.T) {
 	schema1 := NewSchema()
 	index11, _ := schema1.Index("diff-index1", nil)
@@ -195,6 +234,23 @@ func TestFrame(t *testing.T) {
 	}
 }
 
+func TestIndexAndFrameGetters(t *testing.T) {
+	index, err := NewIndex("getters", &IndexOptions{ColumnLabel: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("frame", &FrameOptions{RowLabel: "repo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index.ColumnLabel() != "user" {
+		t.Fatalf("unexpected column label: %s", index.ColumnLabel())
+	}
+	if frame.Name() != "frame" || frame.Index() != index || frame.RowLabel() != "repo" {
+		t.Fatalf("unexpected frame: %s %s %s", frame.Name(), frame.Index().Name(), frame.RowLabel())
+	}
+}
+
 func TestFrameCopy(t *testing.T) {
 	options := &FrameOptions{
 		RowLabel:       "rowlabel",
@@ -224,6 +280,32 @@ func TestNewFrameWithInvalidName(t *testing.T) {
 	}
 }
 
+func TestNewFrameWithInvalidTimeQuantum(t *testing.T) {
+	index, err := NewIndex("foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = index.Frame("foo", TimeQuantum("DY"))
+	if err != ErrInvalidTimeQuantum {
+		t.Fatalf("%v != %v", ErrInvalidTimeQuantum, err)
+	}
+	_, err = NewIndex("foo", &IndexOptions{TimeQuantum: "HY"})
+	if err != ErrInvalidTimeQuantum {
+		t.Fatalf("%v != %v", ErrInvalidTimeQuantum, err)
+	}
+}
+
+func TestNewFrameWithInvalidCacheType(t *testing.T) {
+	index, err := NewIndex("foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = index.Frame("foo", CacheType("fifo"))
+	if err != ErrInvalidCacheType {
+		t.Fatalf("%v != %v", ErrInvalidCacheType, err)
+	}
+}
+
 func TestFrameToString(t *testing.T) {
 	schema1 := NewSchema()
 	index, _ := schema1.Index("test-index", nil)
@@ -268,6 +350,9 @@ func TestInverseBitmap(t *testing.T) {
 	comparePQL(t,
 		"Bitmap(user=5, frame='f1-inversable')",
 		f1.InverseBitmap(5))
+	comparePQL(t,
+		"Union(Bitmap(user=5, frame='f1-inversable'), Bitmap(user=6, frame='f1-inversable'))",
+		projectIndex.Union(f1.InverseBitmap(5), f1.InverseBitmap(6)))
 }
 
 func TestSetBit(t *testing.T) {
@@ -534,6 +619,35 @@ func TestSum(t *testing.T) {
 		sampleFrame.Sum(b, "foo"))
 }
 
+func TestOptions(t *testing.T) {
+	comparePQL(t,
+		"Options(Bitmap(rowID=10, frame='sample-frame'))",
+		sampleIndex.Options(b1))
+	comparePQL(t,
+		"Options(Bitmap(rowID=10, frame='sample-frame'), columnAttrs=true, excludeBits=true, excludeAttrs=true, slices=[1,3])",
+		sampleIndex.Options(b1,
+			OptionsColumnAttrs(true),
+			OptionsExcludeBits(true),
+			OptionsExcludeAttrs(true),
+			OptionsSlices(1, 3)))
+	comparePQL(t,
+		"Options(Union(Bitmap(rowID=10, frame='sample-frame'), Bitmap(rowID=20, frame='sample-frame')), excludeAttrs=true)",
+		sampleIndex.Union(b1, b2).WithOptions(OptionsExcludeAttrs(true)))
+}
+
+func TestOptionsWithError(t *testing.T) {
+	q := sampleIndex.Options(sampleIndex.Xor(b1))
+	if q.Error() == nil {
+		t.Fatalf("should have failed")
+	}
+	q = sampleIndex.Options(b1, func(*OptionsOptions) error {
+		return errors.New("Some error")
+	})
+	if q.Error() == nil {
+		t.Fatalf("should have failed")
+	}
+}
+
 func TestBatchQuery(t *testing.T) {
 	q := sampleIndex.BatchQuery()
 	if q.Index() != sampleIndex {
@@ -547,6 +661,12 @@ func TestBatchQuery(t *testing.T) {
 	comparePQL(t, "Bitmap(rowID=44, frame='sample-frame')Bitmap(rowID=10101, frame='sample-frame')", q)
 }
 
+func TestSerializeQuery(t *testing.T) {
+	if pql := SerializeQuery(sampleFrame.Bitmap(44)); pql != "Bitmap(rowID=44, frame='sample-frame')" {
+		t.Fatalf("unexpected PQL: %s", pql)
+	}
+}
+
 func TestBatchQueryWithError(t *testing.T) {
 	q := sampleIndex.BatchQuery()
 	q.Add(sampleFrame.FilterFieldTopN(12, collabFrame.Bitmap(7), "$invalid$", 80, 81))
@@ -590,6 +710,19 @@ func TestInvalidRowLabelFails(t *testing.T) {
 	}
 }
 
+func TestIndexOptionsToString(t *testing.T) {
+	options := IndexOptions{ColumnLabel: "user"}
+	target := `{"options": {"columnLabel":"user"}}`
+	if target != options.String() {
+		t.Fatalf("`%s` != `%s`", target, options.String())
+	}
+	options.TimeQuantum = TimeQuantumYearMonth
+	target = `{"options": {"columnLabel":"user","timeQuantum":"YM"}}`
+	if target != options.String() {
+		t.Fatalf("`%s` != `%s`", target, options.String())
+	}
+}
+
 func TestFrameOptionsToString(t *testing.T) {
 	frame, err := sampleIndex.Frame("stargazer",
 		TimeQuantumDayHour,
@@ -609,6 +742,18 @@ func TestFrameOptionsToString(t *testing.T) {
 	}
 }
 
+func TestFrameOptionsCacheTypeNoneToString(t *testing.T) {
+	frame, err := sampleIndex.Frame("no-cache", CacheTypeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonString := frame.options.String()
+	targetString := `{"options": {"cacheType":"none","rowLabel":"rowID"}}`
+	if sortedString(targetString) != sortedString(jsonString) {
+		t.Fatalf("`%s` != `%s`", targetString, jsonString)
+	}
+}
+
 func TestInvalidFrameOption(t *testing.T) {
 	_, err := sampleIndex.Frame("invalid-frame-opt", 1)
 	if err == nil {
@@ -0,0 +1,473 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"fmt"
+	"sort"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/go-pilosa/internal/pqlparse"
+)
+
+// bitmapCalls are the calls which return a bitmap.
+var bitmapCalls = map[string]bool{
+	"Bitmap":     true,
+	"Union":      true,
+	"Intersect":  true,
+	"Difference": true,
+	"Xor":        true,
+	"Range":      true,
+}
+
+// run evaluates a top level call of a query.
+func (idx *memoryIndex) run(call *pqlparse.Call, options *pilosa.QueryOptions) (*pilosa.QueryResult, error) {
+	result := &pilosa.QueryResult{
+		Bitmap:     &pilosa.BitmapResult{Attributes: map[string]interface{}{}, Bits: []uint64{}},
+		CountItems: []*pilosa.CountResultItem{},
+	}
+	var err error
+	switch call.Name {
+	case "Bitmap", "Union", "Intersect", "Difference", "Xor", "Range":
+		var bits bitmap
+		var attrs map[string]interface{}
+		if bits, attrs, err = idx.evalBitmap(call); err != nil {
+			return nil, err
+		}
+		if !options.ExcludeBits {
+			result.Bitmap.Bits = bits.sorted()
+		}
+		if !options.ExcludeAttrs && attrs != nil {
+			result.Bitmap.Attributes = copyAttrs(attrs)
+		}
+	case "Count":
+		var bits bitmap
+		if bits, err = idx.childBitmap(call, true); err != nil {
+			return nil, err
+		}
+		result.Count = uint64(len(bits))
+	case "TopN":
+		result.CountItems, err = idx.topN(call)
+	case "Sum":
+		result.Sum, result.Count, err = idx.sum(call)
+	case "SetBit", "ClearBit":
+		err = idx.setBit(call, call.Name == "SetBit")
+	case "SetRowAttrs":
+		err = idx.setRowAttrs(call)
+	case "SetColumnAttrs":
+		err = idx.setColumnAttrs(call)
+	case "SetFieldValue":
+		err = idx.setFieldValue(call)
+	default:
+		err = badRequest(fmt.Sprintf("unsupported call: %s", call.Name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// evalBitmap evaluates a bitmap call and returns its bits and the attributes of its row, if any.
+func (idx *memoryIndex) evalBitmap(call *pqlparse.Call) (bitmap, map[string]interface{}, error) {
+	if !bitmapCalls[call.Name] {
+		return nil, nil, badRequest(fmt.Sprintf("%s cannot be used as a bitmap", call.Name))
+	}
+	if call.Name == "Bitmap" {
+		return idx.bitmap(call)
+	}
+	if call.Name == "Range" {
+		bits, err := idx.rangeBitmap(call)
+		return bits, nil, err
+	}
+	children := make([]bitmap, 0, len(call.Children))
+	for _, child := range call.Children {
+		bits, _, err := idx.evalBitmap(child)
+		if err != nil {
+			return nil, nil, err
+		}
+		children = append(children, bits)
+	}
+	result := bitmap{}
+	if call.Name != "Union" && len(children) == 0 {
+		return nil, nil, badRequest(fmt.Sprintf("%s requires at least 1 bitmap", call.Name))
+	}
+	switch call.Name {
+	case "Union":
+		for _, bits := range children {
+			for id := range bits {
+				result[id] = true
+			}
+		}
+	case "Intersect":
+		for id := range children[0] {
+			in := true
+			for _, bits := range children[1:] {
+				in = in && bits[id]
+			}
+			if in {
+				result[id] = true
+			}
+		}
+	case "Difference":
+		for id := range children[0] {
+			in := true
+			for _, bits := range children[1:] {
+				in = in && !bits[id]
+			}
+			if in {
+				result[id] = true
+			}
+		}
+	case "Xor":
+		for _, bits := range children {
+			for id := range bits {
+				if result[id] {
+					delete(result, id)
+				} else {
+					result[id] = true
+				}
+			}
+		}
+	}
+	return result, nil, nil
+}
+
+// bitmap evaluates a Bitmap call on a row, or on a column of the inverse view.
+func (idx *memoryIndex) bitmap(call *pqlparse.Call) (bitmap, map[string]interface{}, error) {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return nil, nil, err
+	}
+	rowID, ok, err := uintArg(call, f.options.RowLabel)
+	if err != nil {
+		return nil, nil, badRequest(err.Error())
+	}
+	if ok {
+		return copyBitmap(f.rows[rowID]), f.rowAttrs[rowID], nil
+	}
+	columnID, ok, err := uintArg(call, idx.options.ColumnLabel)
+	if err != nil {
+		return nil, nil, badRequest(err.Error())
+	}
+	if !ok {
+		return nil, nil, badRequest(fmt.Sprintf("Bitmap: %s or %s is required", f.options.RowLabel, idx.options.ColumnLabel))
+	}
+	if !f.options.InverseEnabled {
+		return nil, nil, badRequest("inverse is not enabled for the frame")
+	}
+	result := bitmap{}
+	for rowID, row := range f.rows {
+		if row[columnID] {
+			result[rowID] = true
+		}
+	}
+	return result, idx.columnAttrs[columnID], nil
+}
+
+// rangeBitmap evaluates a Range call with a condition on a field.
+func (idx *memoryIndex) rangeBitmap(call *pqlparse.Call) (bitmap, error) {
+	if call.Condition == nil {
+		return nil, badRequest("Range: time ranges are not supported")
+	}
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return nil, err
+	}
+	cond := call.Condition
+	if _, ok := f.fields[cond.Field]; !ok {
+		return nil, notFound("field not found")
+	}
+	var min, max int64
+	if cond.Op == "><" {
+		list, ok := cond.Value.([]interface{})
+		if !ok || len(list) != 2 {
+			return nil, badRequest("Range: >< requires a list of 2 integers")
+		}
+		if min, err = intValue(list[0]); err == nil {
+			max, err = intValue(list[1])
+		}
+	} else {
+		min, err = intValue(cond.Value)
+	}
+	if err != nil {
+		return nil, badRequest(fmt.Sprintf("Range: %v", err))
+	}
+	match := map[string]func(v int64) bool{
+		"==": func(v int64) bool { return v == min },
+		"!=": func(v int64) bool { return v != min },
+		"<":  func(v int64) bool { return v < min },
+		"<=": func(v int64) bool { return v <= min },
+		">":  func(v int64) bool { return v > min },
+		">=": func(v int64) bool { return v >= min },
+		"><": func(v int64) bool { return v >= min && v <= max },
+	}[cond.Op]
+	if match == nil {
+		return nil, badRequest(fmt.Sprintf("Range: invalid operator %s", cond.Op))
+	}
+	result := bitmap{}
+	for columnID, value := range f.values[cond.Field] {
+		if match(value) {
+			result[columnID] = true
+		}
+	}
+	return result, nil
+}
+
+// childBitmap evaluates the bitmap argument of a call.
+// It returns nil if the call has no bitmap argument and it is optional.
+func (idx *memoryIndex) childBitmap(call *pqlparse.Call, required bool) (bitmap, error) {
+	switch {
+	case len(call.Children) > 1:
+		return nil, badRequest(fmt.Sprintf("%s accepts only 1 bitmap", call.Name))
+	case len(call.Children) == 0 && required:
+		return nil, badRequest(fmt.Sprintf("%s requires a bitmap", call.Name))
+	case len(call.Children) == 0:
+		return nil, nil
+	}
+	bits, _, err := idx.evalBitmap(call.Children[0])
+	return bits, err
+}
+
+func (idx *memoryIndex) topN(call *pqlparse.Call) ([]*pilosa.CountResultItem, error) {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := idx.childBitmap(call, false)
+	if err != nil {
+		return nil, err
+	}
+	n, _, err := uintArg(call, "n")
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	rows, rowAttrs := f.rows, f.rowAttrs
+	if inverse, _ := call.Args["inverse"].(bool); inverse {
+		if !f.options.InverseEnabled {
+			return nil, badRequest("inverse is not enabled for the frame")
+		}
+		rows, rowAttrs = f.inverseRows(), idx.columnAttrs
+	}
+	var accept func(rowID uint64) bool
+	if _, ok := call.Args["field"]; ok {
+		field, err := stringArg(call, "field")
+		if err != nil {
+			return nil, badRequest(err.Error())
+		}
+		filters, _ := call.Args["filters"].([]interface{})
+		accept = func(rowID uint64) bool {
+			value, ok := rowAttrs[rowID][field]
+			for _, filter := range filters {
+				if filterValue, err := attrValue(filter); ok && err == nil && filterValue == value {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	items := []*pilosa.CountResultItem{}
+	for rowID, row := range rows {
+		if accept != nil && !accept(rowID) {
+			continue
+		}
+		count := uint64(0)
+		for columnID := range row {
+			if filter == nil || filter[columnID] {
+				count++
+			}
+		}
+		if count > 0 {
+			items = append(items, &pilosa.CountResultItem{ID: rowID, Count: count})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].ID < items[j].ID
+	})
+	if n > 0 && uint64(len(items)) > n {
+		items = items[:n]
+	}
+	return items, nil
+}
+
+func (idx *memoryIndex) sum(call *pqlparse.Call) (int64, uint64, error) {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return 0, 0, err
+	}
+	filter, err := idx.childBitmap(call, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	name, err := stringArg(call, "field")
+	if err != nil {
+		return 0, 0, badRequest(err.Error())
+	}
+	if _, ok := f.fields[name]; !ok {
+		return 0, 0, notFound("field not found")
+	}
+	sum, count := int64(0), uint64(0)
+	for columnID, value := range f.values[name] {
+		if filter == nil || filter[columnID] {
+			sum += value
+			count++
+		}
+	}
+	return sum, count, nil
+}
+
+func (idx *memoryIndex) setBit(call *pqlparse.Call, set bool) error {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return err
+	}
+	rowID, err := requiredUintArg(call, f.options.RowLabel)
+	if err != nil {
+		return err
+	}
+	columnID, err := requiredUintArg(call, idx.options.ColumnLabel)
+	if err != nil {
+		return err
+	}
+	if set {
+		f.setBit(rowID, columnID)
+	} else {
+		f.clearBit(rowID, columnID)
+	}
+	return nil
+}
+
+func (idx *memoryIndex) setRowAttrs(call *pqlparse.Call) error {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return err
+	}
+	rowID, err := requiredUintArg(call, f.options.RowLabel)
+	if err != nil {
+		return err
+	}
+	return setAttrs(f.rowAttrs, rowID, call, f.options.RowLabel, "frame")
+}
+
+func (idx *memoryIndex) setColumnAttrs(call *pqlparse.Call) error {
+	columnID, err := requiredUintArg(call, idx.options.ColumnLabel)
+	if err != nil {
+		return err
+	}
+	return setAttrs(idx.columnAttrs, columnID, call, idx.options.ColumnLabel)
+}
+
+func (idx *memoryIndex) setFieldValue(call *pqlparse.Call) error {
+	f, err := idx.callFrame(call)
+	if err != nil {
+		return err
+	}
+	columnID, err := requiredUintArg(call, idx.options.ColumnLabel)
+	if err != nil {
+		return err
+	}
+	for name, arg := range call.Args {
+		if name == "frame" || name == idx.options.ColumnLabel {
+			continue
+		}
+		value, err := intValue(arg)
+		if err != nil {
+			return badRequest(fmt.Sprintf("SetFieldValue: invalid %s: %v", name, err))
+		}
+		if err := f.setValue(name, columnID, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *memoryIndex) callFrame(call *pqlparse.Call) (*memoryFrame, error) {
+	name, err := stringArg(call, "frame")
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	return idx.frame(name)
+}
+
+func requiredUintArg(call *pqlparse.Call, key string) (uint64, error) {
+	n, ok, err := uintArg(call, key)
+	if err != nil {
+		return 0, badRequest(err.Error())
+	}
+	if !ok {
+		return 0, badRequest(fmt.Sprintf("%s: %s is required", call.Name, key))
+	}
+	return n, nil
+}
+
+// setAttrs sets the attributes in the arguments of the call except the given keys.
+// Attributes with null values are removed.
+func setAttrs(attrSets map[uint64]map[string]interface{}, id uint64, call *pqlparse.Call, skip ...string) error {
+	attrs := attrSets[id]
+	if attrs == nil {
+		attrs = map[string]interface{}{}
+	}
+args:
+	for key, arg := range call.Args {
+		for _, s := range skip {
+			if key == s {
+				continue args
+			}
+		}
+		value, err := attrValue(arg)
+		if err != nil {
+			return badRequest(fmt.Sprintf("%s: invalid %s: %v", call.Name, key, err))
+		}
+		if value == nil {
+			delete(attrs, key)
+		} else {
+			attrs[key] = value
+		}
+	}
+	if len(attrs) == 0 {
+		delete(attrSets, id)
+	} else {
+		attrSets[id] = attrs
+	}
+	return nil
+}
+
+func copyBitmap(b bitmap) bitmap {
+	result := make(bitmap, len(b))
+	for id := range b {
+		result[id] = true
+	}
+	return result
+}
@@ -0,0 +1,781 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	"github.com/pilosa/go-pilosa/internal/pqlparse"
+)
+
+const (
+	standardView    = "standard"
+	inverseView     = "inverse"
+	fieldViewPrefix = "field_"
+)
+
+// memoryHost is the host of the errors returned by MemoryClient.
+const memoryHost = "memory"
+
+// MemoryClient is a pilosa.ClientInterface which keeps the data in memory and evaluates the queries itself,
+// so the query logic of applications can be tested deterministically without a server.
+//
+// SetBit, ClearBit, Bitmap, Union, Intersect, Difference, Xor, Count, TopN, SetRowAttrs,
+// SetColumnAttrs, SetFieldValue, Sum and Range calls on fields are supported.
+// Time ranges and the Options call are not supported, and timestamps of bits are ignored.
+// It is meant for small datasets and is safe for concurrent use.
+type MemoryClient struct {
+	mutex   sync.Mutex
+	indexes map[string]*memoryIndex
+}
+
+var _ pilosa.ClientInterface = (*MemoryClient)(nil)
+
+type memoryIndex struct {
+	options     *pilosa.IndexOptions
+	frames      map[string]*memoryFrame
+	columnAttrs map[uint64]map[string]interface{}
+}
+
+type memoryFrame struct {
+	options  *pilosa.FrameOptions
+	fields   map[string]pilosa.FieldInfo
+	rows     map[uint64]bitmap
+	rowAttrs map[uint64]map[string]interface{}
+	values   map[string]map[uint64]int64
+}
+
+// bitmap is a set of column or row IDs.
+type bitmap map[uint64]bool
+
+// NewMemoryClient creates a MemoryClient without any indexes.
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{indexes: map[string]*memoryIndex{}}
+}
+
+// Query runs the query on the data in memory.
+func (c *MemoryClient) Query(query pilosa.PQLQuery, options ...interface{}) (*pilosa.QueryResponse, error) {
+	return c.QueryWithContext(context.Background(), query, options...)
+}
+
+// QueryWithContext runs the query on the data in memory.
+// Calls of a batch query are run in order, and the calls before a failing call are not rolled back.
+func (c *MemoryClient) QueryWithContext(ctx context.Context, query pilosa.PQLQuery, options ...interface{}) (*pilosa.QueryResponse, error) {
+	if err := query.Error(); err != nil {
+		return nil, err
+	}
+	queryOptions, err := memoryQueryOptions(options)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	calls, err := pqlparse.Parse(pilosa.SerializeQuery(query))
+	if err != nil {
+		return nil, badRequest(err.Error())
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	idx, err := c.index(query.Index().Name())
+	if err != nil {
+		return nil, err
+	}
+	response := &pilosa.QueryResponse{
+		ResultList: make([]*pilosa.QueryResult, 0, len(calls)),
+		ColumnList: []*pilosa.ColumnItem{},
+		Success:    true,
+	}
+	columns := bitmap{}
+	for _, call := range calls {
+		result, err := idx.run(call, queryOptions)
+		if err != nil {
+			return nil, err
+		}
+		if bitmapCalls[call.Name] {
+			for _, id := range result.Bitmap.Bits {
+				columns[id] = true
+			}
+		}
+		response.ResultList = append(response.ResultList, result)
+	}
+	if queryOptions.Columns {
+		for _, id := range columns.sorted() {
+			if attrs, ok := idx.columnAttrs[id]; ok {
+				response.ColumnList = append(response.ColumnList, &pilosa.ColumnItem{ID: id, Attributes: copyAttrs(attrs)})
+			}
+		}
+	}
+	return response, nil
+}
+
+// CreateIndex creates an index in memory.
+// Returns pilosa.ErrIndexExists if the index exists.
+func (c *MemoryClient) CreateIndex(index *pilosa.Index) error {
+	return c.CreateIndexWithContext(context.Background(), index)
+}
+
+// CreateIndexWithContext creates an index in memory.
+// Returns pilosa.ErrIndexExists if the index exists.
+func (c *MemoryClient) CreateIndexWithContext(ctx context.Context, index *pilosa.Index) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.createIndex(index.Name(), index.IndexOptions())
+}
+
+// CreateFrame creates a frame in memory with the fields in its options.
+// Returns pilosa.ErrFrameExists if the frame exists.
+func (c *MemoryClient) CreateFrame(frame *pilosa.Frame) error {
+	return c.CreateFrameWithContext(context.Background(), frame)
+}
+
+// CreateFrameWithContext creates a frame in memory with the fields in its options.
+// Returns pilosa.ErrFrameExists if the frame exists.
+func (c *MemoryClient) CreateFrameWithContext(ctx context.Context, frame *pilosa.Frame) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.createFrame(frame.Index().Name(), frame.Name(), frame.FrameOptions())
+}
+
+// EnsureIndex creates an index in memory if it does not exist.
+func (c *MemoryClient) EnsureIndex(index *pilosa.Index) error {
+	return c.EnsureIndexWithContext(context.Background(), index)
+}
+
+// EnsureIndexWithContext creates an index in memory if it does not exist.
+func (c *MemoryClient) EnsureIndexWithContext(ctx context.Context, index *pilosa.Index) error {
+	if err := c.CreateIndexWithContext(ctx, index); err != pilosa.ErrIndexExists {
+		return err
+	}
+	return nil
+}
+
+// EnsureFrame creates a frame in memory if it does not exist.
+func (c *MemoryClient) EnsureFrame(frame *pilosa.Frame) error {
+	return c.EnsureFrameWithContext(context.Background(), frame)
+}
+
+// EnsureFrameWithContext creates a frame in memory if it does not exist.
+func (c *MemoryClient) EnsureFrameWithContext(ctx context.Context, frame *pilosa.Frame) error {
+	if err := c.CreateFrameWithContext(ctx, frame); err != pilosa.ErrFrameExists {
+		return err
+	}
+	return nil
+}
+
+// DeleteIndex deletes an index and its data.
+func (c *MemoryClient) DeleteIndex(index *pilosa.Index) error {
+	return c.DeleteIndexWithContext(context.Background(), index)
+}
+
+// DeleteIndexWithContext deletes an index and its data.
+func (c *MemoryClient) DeleteIndexWithContext(ctx context.Context, index *pilosa.Index) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := c.index(index.Name()); err != nil {
+		return err
+	}
+	delete(c.indexes, index.Name())
+	return nil
+}
+
+// DeleteFrame deletes a frame and its data.
+func (c *MemoryClient) DeleteFrame(frame *pilosa.Frame) error {
+	return c.DeleteFrameWithContext(context.Background(), frame)
+}
+
+// DeleteFrameWithContext deletes a frame and its data.
+func (c *MemoryClient) DeleteFrameWithContext(ctx context.Context, frame *pilosa.Frame) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, err := c.frame(frame); err != nil {
+		return err
+	}
+	delete(c.indexes[frame.Index().Name()].frames, frame.Name())
+	return nil
+}
+
+// CreateIntField creates an integer range field in a frame.
+func (c *MemoryClient) CreateIntField(frame *pilosa.Frame, name string, min int, max int) error {
+	return c.CreateIntFieldWithContext(context.Background(), frame, name, min, max)
+}
+
+// CreateIntFieldWithContext creates an integer range field in a frame.
+func (c *MemoryClient) CreateIntFieldWithContext(ctx context.Context, frame *pilosa.Frame, name string, min int, max int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// validate the field with the same rules as the client
+	if err := (&pilosa.FrameOptions{}).AddIntField(name, min, max); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.fields[name]; ok {
+		return memoryError(http.StatusConflict, "field already exists")
+	}
+	f.fields[name] = pilosa.FieldInfo{Name: name, Type: "int", Min: int64(min), Max: int64(max)}
+	return nil
+}
+
+// DeleteField deletes a field and its values.
+func (c *MemoryClient) DeleteField(frame *pilosa.Frame, name string) error {
+	return c.DeleteFieldWithContext(context.Background(), frame, name)
+}
+
+// DeleteFieldWithContext deletes a field and its values.
+func (c *MemoryClient) DeleteFieldWithContext(ctx context.Context, frame *pilosa.Frame, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.fields[name]; !ok {
+		return notFound("field not found")
+	}
+	delete(f.fields, name)
+	delete(f.values, name)
+	return nil
+}
+
+// Schema returns the indexes and frames in memory.
+func (c *MemoryClient) Schema() (*pilosa.Schema, error) {
+	return c.SchemaWithContext(context.Background())
+}
+
+// SchemaWithContext returns the indexes and frames in memory.
+func (c *MemoryClient) SchemaWithContext(ctx context.Context) (*pilosa.Schema, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.schema()
+}
+
+// SyncSchema creates the indexes and frames of the schema in memory,
+// and adds the indexes and frames in memory to the schema.
+func (c *MemoryClient) SyncSchema(schema *pilosa.Schema, options ...pilosa.SyncSchemaOption) error {
+	return c.SyncSchemaWithContext(context.Background(), schema, options...)
+}
+
+// SyncSchemaWithContext creates the indexes and frames of the schema in memory,
+// and adds the indexes and frames in memory to the schema.
+func (c *MemoryClient) SyncSchemaWithContext(ctx context.Context, schema *pilosa.Schema, options ...pilosa.SyncSchemaOption) error {
+	syncOptions := &pilosa.SyncSchemaOptions{}
+	for _, option := range options {
+		if err := option(syncOptions); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	memorySchema, err := c.schema()
+	if err != nil {
+		return err
+	}
+	if report := syncOptions.Report; report != nil {
+		diff := schema.Diff(memorySchema)
+		report.Created = diff.Extra
+		report.Extraneous = diff.Missing
+	}
+	for indexName, index := range schema.Indexes() {
+		if err := c.createIndex(indexName, index.IndexOptions()); err != nil && err != pilosa.ErrIndexExists {
+			return err
+		}
+		for frameName, frame := range index.Frames() {
+			if err := c.createFrame(indexName, frameName, frame.FrameOptions()); err != nil && err != pilosa.ErrFrameExists {
+				return err
+			}
+		}
+	}
+	for indexName, memoryIndex := range memorySchema.Indexes() {
+		index, err := schema.Index(indexName, memoryIndex.IndexOptions())
+		if err != nil {
+			return err
+		}
+		for frameName, frame := range memoryIndex.Frames() {
+			if _, err := index.Frame(frameName, frame.FrameOptions()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ImportFrame sets the bits from the iterator, or clears them if the Clear import option is set.
+// The batch size is ignored.
+func (c *MemoryClient) ImportFrame(frame *pilosa.Frame, bitIterator pilosa.BitIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportFrameWithContext(context.Background(), frame, bitIterator, batchSize, options...)
+}
+
+// ImportFrameWithContext sets the bits from the iterator, or clears them if the Clear import option is set.
+// The batch size is ignored.
+func (c *MemoryClient) ImportFrameWithContext(ctx context.Context, frame *pilosa.Frame, bitIterator pilosa.BitIterator, batchSize uint, options ...interface{}) error {
+	importOptions, err := memoryImportOptions(options)
+	if err != nil {
+		return err
+	}
+	bits := []pilosa.Bit{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		bit, err := bitIterator.NextBit()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		bits = append(bits, bit)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return err
+	}
+	for _, bit := range bits {
+		if importOptions.Clear {
+			f.clearBit(bit.RowID, bit.ColumnID)
+		} else {
+			f.setBit(bit.RowID, bit.ColumnID)
+		}
+	}
+	return nil
+}
+
+// ImportValueFrame sets the values of a field from the iterator. The batch size is ignored.
+func (c *MemoryClient) ImportValueFrame(frame *pilosa.Frame, field string, valueIterator pilosa.ValueIterator, batchSize uint, options ...interface{}) error {
+	return c.ImportValueFrameWithContext(context.Background(), frame, field, valueIterator, batchSize, options...)
+}
+
+// ImportValueFrameWithContext sets the values of a field from the iterator. The batch size is ignored.
+func (c *MemoryClient) ImportValueFrameWithContext(ctx context.Context, frame *pilosa.Frame, field string, valueIterator pilosa.ValueIterator, batchSize uint, options ...interface{}) error {
+	importOptions, err := memoryImportOptions(options)
+	if err != nil {
+		return err
+	}
+	if importOptions.Clear {
+		return pilosa.ErrInvalidImportOption
+	}
+	values := []pilosa.FieldValue{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		value, err := valueIterator.NextValue()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		values = append(values, value)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := f.setValue(field, value.ColumnID, value.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportFrame returns the bits of the standard or the inverse view of a frame,
+// sorted by row and column.
+func (c *MemoryClient) ExportFrame(frame *pilosa.Frame, view string) (pilosa.BitIterator, error) {
+	return c.ExportFrameWithContext(context.Background(), frame, view)
+}
+
+// ExportFrameWithContext returns the bits of the standard or the inverse view of a frame,
+// sorted by row and column.
+func (c *MemoryClient) ExportFrameWithContext(ctx context.Context, frame *pilosa.Frame, view string) (pilosa.BitIterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return nil, err
+	}
+	var rows map[uint64]bitmap
+	switch {
+	case view == standardView:
+		rows = f.rows
+	case view == inverseView && f.options.InverseEnabled:
+		rows = f.inverseRows()
+	default:
+		return nil, notFound("view not found")
+	}
+	bits := []pilosa.Bit{}
+	for _, rowID := range sortedKeys(rows) {
+		for _, columnID := range rows[rowID].sorted() {
+			bits = append(bits, pilosa.Bit{RowID: rowID, ColumnID: columnID})
+		}
+	}
+	return pilosa.NewSliceBitIterator(bits), nil
+}
+
+// Views returns the views of a frame which contain data.
+func (c *MemoryClient) Views(frame *pilosa.Frame) ([]string, error) {
+	return c.ViewsWithContext(context.Background(), frame)
+}
+
+// ViewsWithContext returns the views of a frame which contain data.
+func (c *MemoryClient) ViewsWithContext(ctx context.Context, frame *pilosa.Frame) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return nil, err
+	}
+	return f.views(), nil
+}
+
+// DeleteView deletes the data of the standard view or a field view of a frame.
+// The inverse view is kept in sync with the standard view, so deleting it has no effect.
+func (c *MemoryClient) DeleteView(frame *pilosa.Frame, view string) error {
+	return c.DeleteViewWithContext(context.Background(), frame, view)
+}
+
+// DeleteViewWithContext deletes the data of the standard view or a field view of a frame.
+// The inverse view is kept in sync with the standard view, so deleting it has no effect.
+func (c *MemoryClient) DeleteViewWithContext(ctx context.Context, frame *pilosa.Frame, view string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	f, err := c.frame(frame)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, name := range f.views() {
+		found = found || name == view
+	}
+	if !found {
+		return notFound("view not found")
+	}
+	switch {
+	case view == standardView:
+		f.rows = map[uint64]bitmap{}
+	case strings.HasPrefix(view, fieldViewPrefix):
+		delete(f.values, strings.TrimPrefix(view, fieldViewPrefix))
+	}
+	return nil
+}
+
+func (c *MemoryClient) index(name string) (*memoryIndex, error) {
+	idx, ok := c.indexes[name]
+	if !ok {
+		return nil, notFound("index not found")
+	}
+	return idx, nil
+}
+
+func (c *MemoryClient) frame(frame *pilosa.Frame) (*memoryFrame, error) {
+	idx, err := c.index(frame.Index().Name())
+	if err != nil {
+		return nil, err
+	}
+	return idx.frame(frame.Name())
+}
+
+func (c *MemoryClient) createIndex(name string, options *pilosa.IndexOptions) error {
+	if _, ok := c.indexes[name]; ok {
+		return pilosa.ErrIndexExists
+	}
+	c.indexes[name] = &memoryIndex{
+		options:     options,
+		frames:      map[string]*memoryFrame{},
+		columnAttrs: map[uint64]map[string]interface{}{},
+	}
+	return nil
+}
+
+func (c *MemoryClient) createFrame(indexName string, name string, options *pilosa.FrameOptions) error {
+	idx, err := c.index(indexName)
+	if err != nil {
+		return err
+	}
+	if _, ok := idx.frames[name]; ok {
+		return pilosa.ErrFrameExists
+	}
+	fields := map[string]pilosa.FieldInfo{}
+	for _, field := range options.Fields() {
+		fields[field.Name] = field
+	}
+	idx.frames[name] = &memoryFrame{
+		options:  options,
+		fields:   fields,
+		rows:     map[uint64]bitmap{},
+		rowAttrs: map[uint64]map[string]interface{}{},
+		values:   map[string]map[uint64]int64{},
+	}
+	return nil
+}
+
+func (c *MemoryClient) schema() (*pilosa.Schema, error) {
+	schema := pilosa.NewSchema()
+	for indexName, idx := range c.indexes {
+		index, err := schema.Index(indexName, idx.options)
+		if err != nil {
+			return nil, err
+		}
+		for frameName, f := range idx.frames {
+			// the fields are added to fresh options, since deleted fields cannot be removed from the options of a frame
+			options := &pilosa.FrameOptions{
+				RowLabel:       f.options.RowLabel,
+				TimeQuantum:    f.options.TimeQuantum,
+				InverseEnabled: f.options.InverseEnabled,
+				CacheType:      f.options.CacheType,
+				CacheSize:      f.options.CacheSize,
+				RangeEnabled:   f.options.RangeEnabled,
+			}
+			for _, field := range f.fields {
+				if err := options.AddIntField(field.Name, int(field.Min), int(field.Max)); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := index.Frame(frameName, options); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return schema, nil
+}
+
+func (idx *memoryIndex) frame(name string) (*memoryFrame, error) {
+	f, ok := idx.frames[name]
+	if !ok {
+		return nil, notFound("frame not found")
+	}
+	return f, nil
+}
+
+func (f *memoryFrame) setBit(rowID uint64, columnID uint64) bool {
+	row, ok := f.rows[rowID]
+	if !ok {
+		row = bitmap{}
+		f.rows[rowID] = row
+	}
+	changed := !row[columnID]
+	row[columnID] = true
+	return changed
+}
+
+func (f *memoryFrame) clearBit(rowID uint64, columnID uint64) bool {
+	row := f.rows[rowID]
+	if !row[columnID] {
+		return false
+	}
+	delete(row, columnID)
+	if len(row) == 0 {
+		delete(f.rows, rowID)
+	}
+	return true
+}
+
+func (f *memoryFrame) setValue(name string, columnID uint64, value int64) error {
+	field, ok := f.fields[name]
+	if !ok {
+		return notFound("field not found")
+	}
+	if value < field.Min || value > field.Max {
+		return badRequest(fmt.Sprintf("value %d is out of the range of field %s", value, name))
+	}
+	values, ok := f.values[name]
+	if !ok {
+		values = map[uint64]int64{}
+		f.values[name] = values
+	}
+	values[columnID] = value
+	return nil
+}
+
+// inverseRows returns the rows of the inverse view, i.e., the rows of each column.
+func (f *memoryFrame) inverseRows() map[uint64]bitmap {
+	rows := map[uint64]bitmap{}
+	for rowID, row := range f.rows {
+		for columnID := range row {
+			if rows[columnID] == nil {
+				rows[columnID] = bitmap{}
+			}
+			rows[columnID][rowID] = true
+		}
+	}
+	return rows
+}
+
+func (f *memoryFrame) views() []string {
+	views := []string{}
+	if len(f.rows) > 0 {
+		views = append(views, standardView)
+		if f.options.InverseEnabled {
+			views = append(views, inverseView)
+		}
+	}
+	for name, values := range f.values {
+		if len(values) > 0 {
+			views = append(views, fieldViewPrefix+name)
+		}
+	}
+	sort.Strings(views)
+	return views
+}
+
+func (b bitmap) sorted() []uint64 {
+	ids := make([]uint64, 0, len(b))
+	for id := range b {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sortedKeys(rows map[uint64]bitmap) []uint64 {
+	ids := make([]uint64, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func copyAttrs(attrs map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		result[k] = v
+	}
+	return result
+}
+
+func memoryQueryOptions(options []interface{}) (*pilosa.QueryOptions, error) {
+	queryOptions := &pilosa.QueryOptions{}
+	for i, option := range options {
+		switch o := option.(type) {
+		case nil:
+			if i != 0 {
+				return nil, pilosa.ErrInvalidQueryOption
+			}
+		case *pilosa.QueryOptions:
+			if i != 0 {
+				return nil, pilosa.ErrInvalidQueryOption
+			}
+			*queryOptions = *o
+		case pilosa.QueryOption:
+			if err := o(queryOptions); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, pilosa.ErrInvalidQueryOption
+		}
+	}
+	return queryOptions, nil
+}
+
+func memoryImportOptions(options []interface{}) (*pilosa.ImportOptions, error) {
+	importOptions := &pilosa.ImportOptions{}
+	for i, option := range options {
+		switch o := option.(type) {
+		case nil:
+			if i != 0 {
+				return nil, pilosa.ErrInvalidImportOption
+			}
+		case *pilosa.ImportOptions:
+			if i != 0 {
+				return nil, pilosa.ErrInvalidImportOption
+			}
+			*importOptions = *o
+		case pilosa.ImportOption:
+			if err := o(importOptions); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, pilosa.ErrInvalidImportOption
+		}
+	}
+	return importOptions, nil
+}
+
+func memoryError(status int, message string) error {
+	return &pilosa.PilosaError{StatusCode: status, Host: memoryHost, ServerMessage: message}
+}
+
+func notFound(message string) error {
+	return memoryError(http.StatusNotFound, message)
+}
+
+func badRequest(message string) error {
+	return memoryError(http.StatusBadRequest, message)
+}
@@ -0,0 +1,310 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+func newMemoryClient(t *testing.T) *MemoryClient {
+	client := NewMemoryClient()
+	if err := client.CreateIndex(repository); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(stargazer); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestMemoryQuery(t *testing.T) {
+	client := newMemoryClient(t)
+	_, err := client.Query(repository.BatchQuery(
+		stargazer.SetBit(1, 10),
+		stargazer.SetBit(1, 20),
+		stargazer.SetBit(2, 20),
+		stargazer.SetBit(2, 30),
+		stargazer.SetBit(3, 30),
+		stargazer.SetBit(3, 40),
+		stargazer.ClearBit(3, 40),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		query pilosa.PQLQuery
+		bits  []uint64
+		count uint64
+	}{
+		{query: stargazer.Bitmap(1), bits: []uint64{10, 20}},
+		{query: stargazer.Bitmap(4), bits: []uint64{}},
+		{query: repository.Union(stargazer.Bitmap(1), stargazer.Bitmap(2)), bits: []uint64{10, 20, 30}},
+		{query: repository.Intersect(stargazer.Bitmap(1), stargazer.Bitmap(2)), bits: []uint64{20}},
+		{query: repository.Difference(stargazer.Bitmap(2), stargazer.Bitmap(1)), bits: []uint64{30}},
+		{query: repository.Xor(stargazer.Bitmap(1), stargazer.Bitmap(2)), bits: []uint64{10, 30}},
+		{query: repository.Count(repository.Union(stargazer.Bitmap(1), stargazer.Bitmap(3))), bits: []uint64{}, count: 3},
+	}
+	for i, test := range tests {
+		response, err := client.Query(test.query)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		result := response.Result()
+		if !reflect.DeepEqual(result.Bitmap.Bits, test.bits) || result.Count != test.count {
+			t.Fatalf("%d: unexpected result for %s: %v %d", i, pilosa.SerializeQuery(test.query), result.Bitmap.Bits, result.Count)
+		}
+	}
+	response, err := client.Query(stargazer.BitmapTopN(2, repository.Union(stargazer.Bitmap(1), stargazer.Bitmap(3))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := response.Result().CountItems
+	if len(items) != 2 || *items[0] != (pilosa.CountResultItem{ID: 1, Count: 2}) || *items[1] != (pilosa.CountResultItem{ID: 2, Count: 2}) {
+		t.Fatalf("unexpected TopN result: %v", items)
+	}
+}
+
+func TestMemoryQueryFailures(t *testing.T) {
+	client := newMemoryClient(t)
+	other, err := repository.Frame("other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Query(other.Bitmap(1)); !pilosa.IsNotFound(err) {
+		t.Fatalf("not found error expected, got: %v", err)
+	}
+	if _, err := client.Query(stargazer.InverseBitmap(1)); err == nil {
+		t.Fatal("inverse bitmap should fail if inverse is not enabled")
+	}
+	if _, err := client.Query(repository.RawQuery("Options(Bitmap(frame='stargazer', rowID=1))")); err == nil {
+		t.Fatal("unsupported call should fail")
+	}
+	if _, err := client.Query(repository.RawQuery("Bitmap(frame='stargazer', rowID=1")); err == nil {
+		t.Fatal("invalid query should fail")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.QueryWithContext(ctx, stargazer.Bitmap(1)); err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got: %v", err)
+	}
+}
+
+func TestMemoryInverse(t *testing.T) {
+	client := NewMemoryClient()
+	index, err := pilosa.NewIndex("inverse-index", &pilosa.IndexOptions{ColumnLabel: "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := index.Frame("follows", &pilosa.FrameOptions{RowLabel: "project", InverseEnabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(frame); err != nil {
+		t.Fatal(err)
+	}
+	bits := []pilosa.Bit{{RowID: 1, ColumnID: 100}, {RowID: 2, ColumnID: 100}, {RowID: 2, ColumnID: 200}}
+	if err := client.ImportFrame(frame, pilosa.NewSliceBitIterator(bits), 10); err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Query(frame.InverseBitmap(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(response.Result().Bitmap.Bits, []uint64{1, 2}) {
+		t.Fatalf("unexpected inverse bitmap: %v", response.Result().Bitmap.Bits)
+	}
+	iterator, err := client.ExportFrame(frame, "inverse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := []pilosa.Bit{}
+	for {
+		bit, err := iterator.NextBit()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, bit)
+	}
+	target := []pilosa.Bit{{RowID: 100, ColumnID: 1}, {RowID: 100, ColumnID: 2}, {RowID: 200, ColumnID: 2}}
+	if !reflect.DeepEqual(exported, target) {
+		t.Fatalf("unexpected exported bits: %v", exported)
+	}
+	views, err := client.Views(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(views, []string{"inverse", "standard"}) {
+		t.Fatalf("unexpected views: %v", views)
+	}
+	if err := client.ImportFrame(frame, pilosa.NewSliceBitIterator(bits[:1]), 10, pilosa.ClearBits(true)); err != nil {
+		t.Fatal(err)
+	}
+	response, err = client.Query(index.Count(frame.Bitmap(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Result().Count != 0 {
+		t.Fatalf("cleared bits should not be counted: %d", response.Result().Count)
+	}
+}
+
+func TestMemoryFields(t *testing.T) {
+	client := newMemoryClient(t)
+	if err := client.CreateIntField(stargazer, "stars", 0, 1000); err != nil {
+		t.Fatal(err)
+	}
+	values := []pilosa.FieldValue{{ColumnID: 10, Value: 5}, {ColumnID: 20, Value: 50}, {ColumnID: 30, Value: 500}}
+	if err := client.ImportValueFrame(stargazer, "stars", pilosa.NewSliceValueIterator(values), 10); err != nil {
+		t.Fatal(err)
+	}
+	field := stargazer.Field("stars")
+	response, err := client.Query(repository.BatchQuery(
+		field.SetIntValue(40, 100),
+		stargazer.SetBit(1, 20),
+		stargazer.SetBit(1, 40),
+		field.GT(50),
+		field.Between(5, 50),
+		field.Sum(stargazer.Bitmap(1)),
+		field.Sum(nil),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bits := response.ResultAt(3).Bitmap.Bits; !reflect.DeepEqual(bits, []uint64{30, 40}) {
+		t.Fatalf("unexpected GT result: %v", bits)
+	}
+	if bits := response.ResultAt(4).Bitmap.Bits; !reflect.DeepEqual(bits, []uint64{10, 20}) {
+		t.Fatalf("unexpected Between result: %v", bits)
+	}
+	if result := response.ResultAt(5); result.Sum != 150 || result.Count != 2 {
+		t.Fatalf("unexpected Sum result: %d %d", result.Sum, result.Count)
+	}
+	if result := response.ResultAt(6); result.Sum != 655 || result.Count != 4 {
+		t.Fatalf("unexpected Sum result: %d %d", result.Sum, result.Count)
+	}
+	if _, err := client.Query(field.SetIntValue(50, 2000)); err == nil {
+		t.Fatal("value out of range should fail")
+	}
+	if err := client.DeleteField(stargazer, "stars"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Query(field.Sum(nil)); !pilosa.IsNotFound(err) {
+		t.Fatalf("not found error expected, got: %v", err)
+	}
+}
+
+func TestMemoryAttrs(t *testing.T) {
+	client := newMemoryClient(t)
+	_, err := client.Query(repository.BatchQuery(
+		stargazer.SetBit(1, 10),
+		stargazer.SetBit(2, 10),
+		stargazer.SetBit(2, 20),
+		stargazer.SetRowAttrs(1, map[string]interface{}{"name": "go-pilosa", "active": true}),
+		stargazer.SetRowAttrs(2, map[string]interface{}{"name": "pilosa"}),
+		repository.SetColumnAttrs(10, map[string]interface{}{"stars": 42}),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := client.Query(stargazer.Bitmap(1), pilosa.ColumnAttrs(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attrs := map[string]interface{}{"name": "go-pilosa", "active": true}
+	if !reflect.DeepEqual(response.Result().Bitmap.Attributes, attrs) {
+		t.Fatalf("unexpected attributes: %v", response.Result().Bitmap.Attributes)
+	}
+	columns := []*pilosa.ColumnItem{{ID: 10, Attributes: map[string]interface{}{"stars": int64(42)}}}
+	if !reflect.DeepEqual(response.Columns(), columns) {
+		t.Fatalf("unexpected columns: %v", response.Columns())
+	}
+	response, err = client.Query(stargazer.FilterFieldTopN(10, nil, "name", "pilosa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := response.Result().CountItems
+	if len(items) != 1 || *items[0] != (pilosa.CountResultItem{ID: 2, Count: 2}) {
+		t.Fatalf("unexpected TopN result: %v", items)
+	}
+}
+
+func TestMemorySchema(t *testing.T) {
+	client := newMemoryClient(t)
+	if err := client.CreateIndex(repository); err != pilosa.ErrIndexExists {
+		t.Fatalf("ErrIndexExists expected, got: %v", err)
+	}
+	if err := client.EnsureFrame(stargazer); err != nil {
+		t.Fatal(err)
+	}
+	schema := pilosa.NewSchema()
+	index, err := schema.Index("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := index.Frame("f1"); err != nil {
+		t.Fatal(err)
+	}
+	report := &pilosa.SchemaReport{}
+	if err := client.SyncSchema(schema, pilosa.SyncSchemaReport(report)); err != nil {
+		t.Fatal(err)
+	}
+	if report.Created.Indexes()["other"] == nil || report.Extraneous.Indexes()["repository"] == nil {
+		t.Fatalf("unexpected report: %v %v", report.Created, report.Extraneous)
+	}
+	if schema.Indexes()["repository"].Frames()["stargazer"] == nil {
+		t.Fatal("the frames in memory should be added to the schema")
+	}
+	memorySchema, err := client.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if memorySchema.Indexes()["other"].Frames()["f1"] == nil {
+		t.Fatal("the frames of the schema should be created")
+	}
+	if err := client.DeleteIndex(repository); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(stargazer); !pilosa.IsNotFound(err) {
+		t.Fatalf("not found error expected, got: %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/pilosa/go-pilosa/internal/pqlparse"
+)
+
+// uintArg returns the value of an unsigned integer argument.
+func uintArg(c *pqlparse.Call, key string) (uint64, bool, error) {
+	value, ok := c.Args[key]
+	if !ok {
+		return 0, false, nil
+	}
+	n, err := uintValue(value)
+	if err != nil {
+		return 0, true, fmt.Errorf("%s: invalid %s: %v", c.Name, key, err)
+	}
+	return n, true, nil
+}
+
+// stringArg returns the value of a string argument.
+func stringArg(c *pqlparse.Call, key string) (string, error) {
+	value, ok := c.Args[key]
+	if !ok {
+		return "", fmt.Errorf("%s: %s is required", c.Name, key)
+	}
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %s should be a string", c.Name, key)
+	}
+	return s, nil
+}
+
+func uintValue(value interface{}) (uint64, error) {
+	n, ok := value.(pqlparse.Number)
+	if !ok {
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	return strconv.ParseUint(string(n), 10, 64)
+}
+
+func intValue(value interface{}) (int64, error) {
+	n, ok := value.(pqlparse.Number)
+	if !ok {
+		return 0, fmt.Errorf("%v is not an integer", value)
+	}
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// attrValue converts a parsed value to the type of an attribute value.
+func attrValue(value interface{}) (interface{}, error) {
+	n, ok := value.(pqlparse.Number)
+	if !ok {
+		return value, nil
+	}
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i, nil
+	}
+	return strconv.ParseFloat(string(n), 64)
+}
@@ -0,0 +1,292 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"unicode/utf8"
+)
+
+// RecorderMode controls whether a Recorder sends requests to the server or replays them.
+type RecorderMode int
+
+// Recorder modes.
+const (
+	// ModeReplay responds to requests with the interactions loaded from the file,
+	// without sending them to the server.
+	ModeReplay RecorderMode = iota
+	// ModeRecord sends requests to the server and records the interactions.
+	ModeRecord
+	// ModeAuto replays the interactions if the file exists, otherwise it records them.
+	ModeAuto
+)
+
+// Recorder is an http.RoundTripper which records the interactions with a server to a file
+// and replays them later, so tests can run without a Pilosa cluster.
+// Use it with the pilosa.HTTPTransport client option:
+//
+//	recorder, err := pilosatest.NewRecorder("testdata/import.json", pilosatest.ModeAuto, nil)
+//	client, err := pilosa.NewClient(address, pilosa.HTTPTransport(recorder))
+//	// run the test...
+//	err = recorder.Save()
+//
+// Requests are matched by their method, path, query string and body, so they can be replayed
+// against any address. Headers are not matched and the headers of requests are not recorded.
+// Recorded interactions are replayed in order, and the last matching interaction is replayed
+// again if a request is sent more times than it was recorded.
+// Requests without a recorded interaction get a 501 Not Implemented response.
+// It is safe for concurrent use.
+type Recorder struct {
+	mode         RecorderMode
+	path         string
+	transport    http.RoundTripper
+	mutex        sync.Mutex
+	interactions []*Interaction
+	replayed     []bool
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a recorded request.
+type RecordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	RecordedBody
+}
+
+// RecordedResponse is a recorded response.
+type RecordedResponse struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	RecordedBody
+}
+
+// RecordedBody is the body of a recorded request or response.
+// Text bodies are kept readable in the file and binary bodies, e.g., protobuf, are stored in base64.
+type RecordedBody struct {
+	Text   string `json:"body,omitempty"`
+	Binary []byte `json:"bodyBase64,omitempty"`
+}
+
+func newRecordedBody(body []byte) RecordedBody {
+	if utf8.Valid(body) {
+		return RecordedBody{Text: string(body)}
+	}
+	return RecordedBody{Binary: body}
+}
+
+// Bytes returns the body.
+func (b RecordedBody) Bytes() []byte {
+	if b.Binary != nil {
+		return b.Binary
+	}
+	return []byte(b.Text)
+}
+
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// NewRecorder creates a Recorder which records to or replays from the file at path.
+// Requests are sent with transport when recording, or with http.DefaultTransport if it is nil.
+// The file should exist in ModeReplay.
+func NewRecorder(path string, mode RecorderMode, transport http.RoundTripper) (*Recorder, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	r := &Recorder{
+		mode:         mode,
+		path:         path,
+		transport:    transport,
+		interactions: []*Interaction{},
+	}
+	if mode == ModeAuto {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+	switch r.mode {
+	case ModeRecord:
+		return r, nil
+	case ModeReplay:
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c := cassette{}
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("pilosatest: reading %s: %v", path, err)
+		}
+		r.interactions = c.Interactions
+		r.replayed = make([]bool, len(c.Interactions))
+		return r, nil
+	}
+	return nil, fmt.Errorf("pilosatest: invalid recorder mode: %d", mode)
+}
+
+// Mode returns ModeRecord or ModeReplay, depending on what the recorder does.
+func (r *Recorder) Mode() RecorderMode {
+	return r.mode
+}
+
+// Interactions returns the recorded or loaded interactions.
+func (r *Recorder) Interactions() []*Interaction {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Interaction{}, r.interactions...)
+}
+
+// Save writes the recorded interactions to the file. It does nothing when replaying.
+func (r *Recorder) Save() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mutex.Lock()
+	data, err := json.MarshalIndent(cassette{Interactions: r.interactions}, "", "  ")
+	r.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.path, append(data, '\n'), 0644)
+}
+
+// RoundTrip sends the request and records the interaction, or responds with a recorded interaction.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	request, err := newRecordedRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req, request)
+	}
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	interaction := &Interaction{
+		Request: request,
+		Response: RecordedResponse{
+			StatusCode:   resp.StatusCode,
+			Header:       resp.Header,
+			RecordedBody: newRecordedBody(body),
+		},
+	}
+	r.mutex.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mutex.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, request RecordedRequest) (*http.Response, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	match := -1
+	for i, interaction := range r.interactions {
+		if !interaction.Request.matches(request) {
+			continue
+		}
+		match = i
+		if !r.replayed[i] {
+			break
+		}
+	}
+	var recorded RecordedResponse
+	if match < 0 {
+		// the client would retry a transport error on the other hosts and hide its message
+		recorded = RecordedResponse{
+			StatusCode:   http.StatusNotImplemented,
+			RecordedBody: RecordedBody{Text: fmt.Sprintf("pilosatest: no recorded interaction for %s %s", req.Method, req.URL.RequestURI())},
+		}
+	} else {
+		r.replayed[match] = true
+		recorded = r.interactions[match].Response
+	}
+	header := http.Header{}
+	for k, v := range recorded.Header {
+		header[k] = append([]string{}, v...)
+	}
+	body := recorded.Bytes()
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.StatusCode, http.StatusText(recorded.StatusCode)),
+		StatusCode:    recorded.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func newRecordedRequest(req *http.Request) (RecordedRequest, error) {
+	request := RecordedRequest{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.RawQuery,
+	}
+	if req.Body == nil {
+		return request, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return request, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	request.RecordedBody = newRecordedBody(body)
+	return request, nil
+}
+
+func (r RecordedRequest) matches(other RecordedRequest) bool {
+	return r.Method == other.Method && r.Path == other.Path && r.Query == other.Query &&
+		bytes.Equal(r.Bytes(), other.Bytes())
+}
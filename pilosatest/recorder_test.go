@@ -0,0 +1,114 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+func TestRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pilosatest-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "interactions.json")
+
+	server := NewServer()
+	server.CreateFrame("repository", "stargazer")
+	server.RespondQuery(repository.Count(stargazer.Bitmap(5)), Count(42))
+	recorder, err := NewRecorder(path, ModeAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeRecord {
+		t.Fatalf("recorder should record if the file does not exist")
+	}
+	client, err := server.Client(pilosa.HTTPTransport(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(stargazer); err != pilosa.ErrFrameExists {
+		t.Fatalf("ErrFrameExists expected, got: %v", err)
+	}
+	if _, err := client.Query(repository.Count(stargazer.Bitmap(5))); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.Interactions()) != 2 {
+		t.Fatalf("2 interactions should be recorded: %v", recorder.Interactions())
+	}
+	server.Close()
+
+	recorder, err = NewRecorder(path, ModeAuto, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Mode() != ModeReplay {
+		t.Fatalf("recorder should replay if the file exists")
+	}
+	client, err = pilosa.NewClient(server.Address(), pilosa.HTTPTransport(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateFrame(stargazer); err != pilosa.ErrFrameExists {
+		t.Fatalf("ErrFrameExists expected, got: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		response, err := client.Query(repository.Count(stargazer.Bitmap(5)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Result().Count != 42 {
+			t.Fatalf("recorded count should be replayed: %d", response.Result().Count)
+		}
+	}
+	_, err = client.Query(repository.Count(stargazer.Bitmap(6)))
+	if err == nil || !strings.Contains(err.Error(), "no recorded interaction") {
+		t.Fatalf("unrecorded query should fail, got: %v", err)
+	}
+}
+
+func TestRecorderReplayWithoutFile(t *testing.T) {
+	if _, err := NewRecorder("does-not-exist.json", ModeReplay, nil); err == nil {
+		t.Fatal("replaying should fail if the file does not exist")
+	}
+}
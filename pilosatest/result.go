@@ -0,0 +1,290 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"strings"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+type resultKind int
+
+const (
+	kindNil resultKind = iota
+	kindBitmap
+	kindCount
+	kindTopN
+	kindSum
+	kindChanged
+)
+
+// Result is the canned result of a call in a query.
+type Result struct {
+	kind    resultKind
+	bits    []uint64
+	attrs   map[string]interface{}
+	count   uint64
+	items   []pilosa.CountResultItem
+	sum     int64
+	changed bool
+}
+
+// Bitmap returns the result of a bitmap call, e.g., Bitmap, Union or Range, with the given columns.
+func Bitmap(columns ...uint64) Result {
+	return Result{kind: kindBitmap, bits: columns}
+}
+
+// BitmapWithAttrs returns the result of a bitmap call with the given row attributes and columns.
+// Attribute values should be strings, int64, bool or float64.
+func BitmapWithAttrs(attrs map[string]interface{}, columns ...uint64) Result {
+	return Result{kind: kindBitmap, bits: columns, attrs: attrs}
+}
+
+// Count returns the result of a Count call.
+func Count(n uint64) Result {
+	return Result{kind: kindCount, count: n}
+}
+
+// TopN returns the result of a TopN call with the given rows and counts.
+func TopN(items ...pilosa.CountResultItem) Result {
+	return Result{kind: kindTopN, items: items}
+}
+
+// Sum returns the result of a Sum call.
+func Sum(sum int64, count uint64) Result {
+	return Result{kind: kindSum, sum: sum, count: count}
+}
+
+// Changed returns the result of a SetBit or ClearBit call.
+func Changed(changed bool) Result {
+	return Result{kind: kindChanged, changed: changed}
+}
+
+// Nil returns the result of a call which does not return data, e.g., SetRowAttrs or SetFieldValue.
+func Nil() Result {
+	return Result{kind: kindNil}
+}
+
+func (r Result) internal() *pbuf.QueryResult {
+	result := &pbuf.QueryResult{}
+	switch r.kind {
+	case kindBitmap:
+		result.Bitmap = &pbuf.Bitmap{Bits: r.bits, Attrs: internalAttrs(r.attrs)}
+	case kindCount:
+		result.N = r.count
+	case kindTopN:
+		for _, item := range r.items {
+			result.Pairs = append(result.Pairs, &pbuf.Pair{Key: item.ID, Count: item.Count})
+		}
+	case kindSum:
+		result.SumCount = &pbuf.SumCount{Sum: r.sum, Count: int64(r.count)}
+	case kindChanged:
+		result.Changed = r.changed
+	}
+	return result
+}
+
+func (r Result) json() interface{} {
+	switch r.kind {
+	case kindBitmap:
+		bits := r.bits
+		if bits == nil {
+			bits = []uint64{}
+		}
+		attrs := r.attrs
+		if attrs == nil {
+			attrs = map[string]interface{}{}
+		}
+		return map[string]interface{}{"attrs": attrs, "bits": bits}
+	case kindCount:
+		return r.count
+	case kindTopN:
+		pairs := make([]map[string]uint64, len(r.items))
+		for i, item := range r.items {
+			pairs[i] = map[string]uint64{"id": item.ID, "count": item.Count}
+		}
+		return pairs
+	case kindSum:
+		return map[string]interface{}{"sum": r.sum, "count": r.count}
+	case kindChanged:
+		return r.changed
+	}
+	return nil
+}
+
+// attribute types of the protobuf encoding
+const (
+	stringType = 1
+	intType    = 2
+	boolType   = 3
+	floatType  = 4
+)
+
+func internalAttrs(attrs map[string]interface{}) []*pbuf.Attr {
+	internal := make([]*pbuf.Attr, 0, len(attrs))
+	for key, value := range attrs {
+		attr := &pbuf.Attr{Key: key}
+		switch v := value.(type) {
+		case string:
+			attr.Type, attr.StringValue = stringType, v
+		case int:
+			attr.Type, attr.IntValue = intType, int64(v)
+		case int64:
+			attr.Type, attr.IntValue = intType, v
+		case bool:
+			attr.Type, attr.BoolValue = boolType, v
+		case float64:
+			attr.Type, attr.FloatValue = floatType, v
+		default:
+			continue
+		}
+		internal = append(internal, attr)
+	}
+	return internal
+}
+
+// cannedResponse is the response to a query, either results or an error message.
+type cannedResponse struct {
+	results []Result
+	err     string
+}
+
+func (r *cannedResponse) internal() *pbuf.QueryResponse {
+	if r.err != "" {
+		return &pbuf.QueryResponse{Err: r.err}
+	}
+	response := &pbuf.QueryResponse{Results: make([]*pbuf.QueryResult, len(r.results))}
+	for i, result := range r.results {
+		response.Results[i] = result.internal()
+	}
+	return response
+}
+
+func (r *cannedResponse) json() interface{} {
+	if r.err != "" {
+		return map[string]string{"error": r.err}
+	}
+	results := make([]interface{}, len(r.results))
+	for i, result := range r.results {
+		results[i] = result.json()
+	}
+	return map[string]interface{}{"results": results}
+}
+
+// defaultResponse returns a default result for each top level call of the query.
+func defaultResponse(pql string) *cannedResponse {
+	response := &cannedResponse{}
+	for _, name := range callNames(pql) {
+		var result Result
+		switch name {
+		case "Count":
+			result = Count(0)
+		case "Sum":
+			result = Sum(0, 0)
+		case "TopN":
+			result = TopN()
+		case "SetBit", "ClearBit":
+			result = Changed(true)
+		case "SetRowAttrs", "SetColumnAttrs", "SetFieldValue":
+			result = Nil()
+		default:
+			result = Bitmap()
+		}
+		response.results = append(response.results, result)
+	}
+	return response
+}
+
+func responseKey(indexName string, pql string) string {
+	return indexName + "\x00" + normalizePQL(pql)
+}
+
+// normalizePQL removes the whitespace outside strings.
+func normalizePQL(pql string) string {
+	normalized := make([]byte, 0, len(pql))
+	var quote byte
+	for i := 0; i < len(pql); i++ {
+		c := pql[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(pql) {
+				normalized = append(normalized, c)
+				i++
+				c = pql[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			continue
+		}
+		normalized = append(normalized, c)
+	}
+	return string(normalized)
+}
+
+// callNames returns the names of the top level calls of the query.
+func callNames(pql string) []string {
+	names := []string{}
+	pql = normalizePQL(pql)
+	depth := 0
+	start := 0
+	var quote byte
+	for i := 0; i < len(pql); i++ {
+		c := pql[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			if depth == 0 {
+				names = append(names, strings.TrimSpace(pql[start:i]))
+			}
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				start = i + 1
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,672 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Package pilosatest provides a fake Pilosa server for the unit tests of applications using go-pilosa.
+//
+// The server keeps the indexes and frames created through it and the imported bits and values,
+// and it responds to queries with canned results, so applications can be tested without a running cluster:
+//
+//	server := pilosatest.NewServer()
+//	defer server.Close()
+//	server.Respond("repository", "Count(Bitmap(frame='stargazer', rowID=5))", pilosatest.Count(42))
+//	client, err := server.Client()
+//
+// Failures and latency can be programmed to test the error handling of applications.
+//
+// MemoryClient is a pilosa.ClientInterface which evaluates the queries on data kept in memory,
+// to test the query logic of applications:
+//
+//	client := pilosatest.NewMemoryClient()
+//	client.CreateIndex(repository)
+//	client.CreateFrame(stargazer)
+//	client.Query(stargazer.SetBit(5, 100))
+//	response, err := client.Query(repository.Count(stargazer.Bitmap(5)))
+//
+// Recorder records the interactions with a real server to a file and replays them later.
+package pilosatest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	pilosa "github.com/pilosa/go-pilosa"
+	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
+)
+
+// sliceWidth is the number of columns in a slice.
+const sliceWidth = 1048576
+
+// DefaultVersion is the version the server reports unless it is changed with SetVersion.
+const DefaultVersion = "0.8.0"
+
+// Request is a request received by a Server.
+type Request struct {
+	Method string
+	// Path is the path of the request, without the query string.
+	Path   string
+	Query  string
+	Header http.Header
+	// Body is the body of the request, decompressed if it was compressed.
+	Body []byte
+}
+
+type failure struct {
+	status  int
+	message string
+}
+
+type frame struct {
+	bits   []pilosa.Bit
+	values map[string][]pilosa.FieldValue
+	fields map[string]bool
+}
+
+type index struct {
+	frames map[string]*frame
+	// slices are the slices of the imported bits and values
+	slices map[uint64]bool
+}
+
+// Server is a fake Pilosa server running on a local port.
+// It is safe for concurrent use.
+type Server struct {
+	server    *httptest.Server
+	mutex     sync.Mutex
+	version   string
+	latency   time.Duration
+	indexes   map[string]*index
+	responses map[string]*cannedResponse
+	failures  map[string]failure
+	requests  []Request
+}
+
+// NewServer starts a Server. Close it when the test is done.
+func NewServer() *Server {
+	s := &Server{
+		version:   DefaultVersion,
+		indexes:   map[string]*index{},
+		responses: map[string]*cannedResponse{},
+		failures:  map[string]failure{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// URL returns the URL of the server, e.g., http://127.0.0.1:41234.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Address returns the address of the server in host:port form.
+func (s *Server) Address() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+// Client creates a client for the server with the given options.
+func (s *Server) Client(options ...pilosa.ClientOption) (*pilosa.Client, error) {
+	return pilosa.NewClient(s.Address(), options...)
+}
+
+// SetVersion sets the version reported by the server.
+func (s *Server) SetVersion(version string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.version = version
+}
+
+// SetLatency delays each response of the server by the given duration.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.latency = latency
+}
+
+// Fail makes the server respond to the requests with the given path, without the query string,
+// with the given status code and message until ClearFailures is called.
+// Pass an empty path to fail all requests.
+func (s *Server) Fail(path string, status int, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[path] = failure{status: status, message: message}
+}
+
+// ClearFailures removes the failures set with Fail.
+func (s *Server) ClearFailures() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures = map[string]failure{}
+}
+
+// CreateIndex adds an index to the schema of the server.
+func (s *Server) CreateIndex(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.createIndex(name)
+}
+
+// CreateFrame adds a frame to the schema of the server, creating its index if it does not exist.
+func (s *Server) CreateFrame(indexName string, frameName string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.createIndex(indexName).createFrame(frameName)
+}
+
+// HasIndex returns true if the index is in the schema of the server.
+func (s *Server) HasIndex(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	_, ok := s.indexes[name]
+	return ok
+}
+
+// HasFrame returns true if the frame is in the schema of the server.
+func (s *Server) HasFrame(indexName string, frameName string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.frame(indexName, frameName) != nil
+}
+
+// Respond sets the results the server returns for the given query, one result for each call of the query.
+// Queries are matched ignoring whitespace outside strings.
+// Queries without canned results get a default result for each call: a zero count for Count and Sum,
+// an empty list for TopN, true for SetBit and ClearBit, no data for attribute and field value calls,
+// and an empty bitmap for other calls.
+func (s *Server) Respond(indexName string, pql string, results ...Result) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[responseKey(indexName, pql)] = &cannedResponse{results: results}
+}
+
+// RespondQuery sets the results the server returns for the given query, one result for each call of the query.
+func (s *Server) RespondQuery(query pilosa.PQLQuery, results ...Result) {
+	s.Respond(query.Index().Name(), pilosa.SerializeQuery(query), results...)
+}
+
+// RespondError makes the server return the given error message for the given query.
+func (s *Server) RespondError(indexName string, pql string, message string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses[responseKey(indexName, pql)] = &cannedResponse{err: message}
+}
+
+// Requests returns the requests received by the server, in the order they were received.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Queries returns the queries received for the given index, in the order they were received.
+func (s *Server) Queries(indexName string) []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	queries := []string{}
+	path := "/index/" + indexName + "/query"
+	for _, request := range s.requests {
+		if request.Method == "POST" && request.Path == path {
+			if pql, err := queryFromRequest(request.Header, request.Body); err == nil {
+				queries = append(queries, pql)
+			}
+		}
+	}
+	return queries
+}
+
+// ImportedBits returns the bits imported to the given frame, sorted by row and column.
+func (s *Server) ImportedBits(indexName string, frameName string) []pilosa.Bit {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f := s.frame(indexName, frameName)
+	if f == nil {
+		return []pilosa.Bit{}
+	}
+	bits := append([]pilosa.Bit{}, f.bits...)
+	sort.Slice(bits, func(i, j int) bool {
+		if bits[i].RowID != bits[j].RowID {
+			return bits[i].RowID < bits[j].RowID
+		}
+		return bits[i].ColumnID < bits[j].ColumnID
+	})
+	return bits
+}
+
+// ImportedValues returns the values imported to the given field, sorted by column.
+func (s *Server) ImportedValues(indexName string, frameName string, fieldName string) []pilosa.FieldValue {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f := s.frame(indexName, frameName)
+	if f == nil {
+		return []pilosa.FieldValue{}
+	}
+	values := append([]pilosa.FieldValue{}, f.values[fieldName]...)
+	sort.Slice(values, func(i, j int) bool { return values[i].ColumnID < values[j].ColumnID })
+	return values
+}
+
+func (s *Server) createIndex(name string) *index {
+	idx, ok := s.indexes[name]
+	if !ok {
+		idx = &index{frames: map[string]*frame{}, slices: map[uint64]bool{}}
+		s.indexes[name] = idx
+	}
+	return idx
+}
+
+func (idx *index) createFrame(name string) *frame {
+	f, ok := idx.frames[name]
+	if !ok {
+		f = &frame{values: map[string][]pilosa.FieldValue{}, fields: map[string]bool{}}
+		idx.frames[name] = f
+	}
+	return f
+}
+
+func (s *Server) frame(indexName string, frameName string) *frame {
+	if idx, ok := s.indexes[indexName]; ok {
+		return idx.frames[frameName]
+	}
+	return nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := readRequestBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.mutex.Lock()
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header,
+		Body:   body,
+	})
+	latency := s.latency
+	f, failed := s.failures[r.URL.Path]
+	if !failed {
+		f, failed = s.failures[""]
+	}
+	s.mutex.Unlock()
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if failed {
+		http.Error(w, f.message, f.status)
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status, response := s.route(r, body)
+	if status != http.StatusOK {
+		http.Error(w, string(response), status)
+		return
+	}
+	switch {
+	case len(response) > 0 && (response[0] == '{' || response[0] == '['):
+		w.Header().Set("Content-Type", "application/json")
+	case r.URL.Path == "/export":
+		w.Header().Set("Content-Type", "text/csv")
+	default:
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}
+	w.Write(response)
+}
+
+// route handles a request while the server is locked. It returns the status code and the body of the response.
+func (s *Server) route(r *http.Request, body []byte) (int, []byte) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/version" && r.Method == "GET":
+		return jsonResponse(map[string]string{"version": s.version})
+	case r.URL.Path == "/status" && r.Method == "GET":
+		return jsonResponse(map[string]interface{}{"status": s.status()})
+	case r.URL.Path == "/slices/max" && r.Method == "GET":
+		return jsonResponse(map[string]interface{}{"maxSlices": s.maxSlices()})
+	case r.URL.Path == "/fragment/nodes" && r.Method == "GET":
+		return jsonResponse([]map[string]string{{"scheme": "http", "host": s.Address()}})
+	case r.URL.Path == "/import" && r.Method == "POST":
+		return s.importBits(body, r.URL.Query().Get("clear") == "true")
+	case r.URL.Path == "/import-value" && r.Method == "POST":
+		return s.importValues(body)
+	case r.URL.Path == "/export" && r.Method == "GET":
+		return s.export(r)
+	case len(parts) < 2 || parts[0] != "index":
+		return http.StatusNotFound, []byte("not found")
+	case len(parts) == 2:
+		return s.handleIndex(r.Method, parts[1])
+	case len(parts) == 3 && parts[2] == "query" && r.Method == "POST":
+		return s.query(r, parts[1], body)
+	case len(parts) == 3 && parts[2] == "time-quantum" && r.Method == "PATCH":
+		return s.checkIndex(parts[1])
+	case len(parts) < 4 || parts[2] != "frame":
+		return http.StatusNotFound, []byte("not found")
+	case len(parts) == 4:
+		return s.handleFrame(r.Method, parts[1], parts[3])
+	case len(parts) == 5 && parts[4] == "time-quantum" && r.Method == "PATCH":
+		return s.checkFrame(parts[1], parts[3])
+	case len(parts) == 5 && parts[4] == "views" && r.Method == "GET":
+		return s.views(parts[1], parts[3])
+	case len(parts) == 6 && parts[4] == "field":
+		return s.handleField(r.Method, parts[1], parts[3], parts[5])
+	case len(parts) == 6 && parts[4] == "view" && r.Method == "DELETE":
+		return s.checkFrame(parts[1], parts[3])
+	case len(parts) == 6 && parts[4] == "import-roaring" && r.Method == "POST":
+		return s.checkFrame(parts[1], parts[3])
+	}
+	return http.StatusNotFound, []byte("not found")
+}
+
+func (s *Server) handleIndex(method string, name string) (int, []byte) {
+	_, exists := s.indexes[name]
+	switch method {
+	case "POST":
+		if exists {
+			return http.StatusConflict, []byte("index already exists")
+		}
+		s.createIndex(name)
+		return jsonResponse(map[string]interface{}{})
+	case "DELETE":
+		if !exists {
+			return http.StatusNotFound, []byte("index not found")
+		}
+		delete(s.indexes, name)
+		return jsonResponse(map[string]interface{}{})
+	}
+	return http.StatusMethodNotAllowed, []byte("method not allowed")
+}
+
+func (s *Server) handleFrame(method string, indexName string, name string) (int, []byte) {
+	idx, ok := s.indexes[indexName]
+	if !ok {
+		return http.StatusNotFound, []byte("index not found")
+	}
+	_, exists := idx.frames[name]
+	switch method {
+	case "POST":
+		if exists {
+			return http.StatusConflict, []byte("frame already exists")
+		}
+		idx.createFrame(name)
+		return jsonResponse(map[string]interface{}{})
+	case "DELETE":
+		if !exists {
+			return http.StatusNotFound, []byte("frame not found")
+		}
+		delete(idx.frames, name)
+		return jsonResponse(map[string]interface{}{})
+	}
+	return http.StatusMethodNotAllowed, []byte("method not allowed")
+}
+
+func (s *Server) handleField(method string, indexName string, frameName string, name string) (int, []byte) {
+	f := s.frame(indexName, frameName)
+	if f == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	switch method {
+	case "POST":
+		if f.fields[name] {
+			return http.StatusConflict, []byte("field already exists")
+		}
+		f.fields[name] = true
+		return jsonResponse(map[string]interface{}{})
+	case "DELETE":
+		if !f.fields[name] {
+			return http.StatusNotFound, []byte("field not found")
+		}
+		delete(f.fields, name)
+		delete(f.values, name)
+		return jsonResponse(map[string]interface{}{})
+	}
+	return http.StatusMethodNotAllowed, []byte("method not allowed")
+}
+
+func (s *Server) checkIndex(name string) (int, []byte) {
+	if _, ok := s.indexes[name]; !ok {
+		return http.StatusNotFound, []byte("index not found")
+	}
+	return jsonResponse(map[string]interface{}{})
+}
+
+func (s *Server) checkFrame(indexName string, frameName string) (int, []byte) {
+	if s.frame(indexName, frameName) == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	return jsonResponse(map[string]interface{}{})
+}
+
+func (s *Server) views(indexName string, frameName string) (int, []byte) {
+	f := s.frame(indexName, frameName)
+	if f == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	views := []string{}
+	if len(f.bits) > 0 {
+		views = append(views, "standard")
+	}
+	return jsonResponse(map[string]interface{}{"views": views})
+}
+
+func (s *Server) status() *pilosa.Status {
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	indexes := make([]pilosa.StatusIndex, 0, len(names))
+	for _, name := range names {
+		idx := s.indexes[name]
+		frameNames := make([]string, 0, len(idx.frames))
+		for frameName := range idx.frames {
+			frameNames = append(frameNames, frameName)
+		}
+		sort.Strings(frameNames)
+		frames := make([]pilosa.StatusFrame, len(frameNames))
+		for i, frameName := range frameNames {
+			frames[i] = pilosa.StatusFrame{Name: frameName}
+		}
+		slices := make([]uint64, 0, len(idx.slices))
+		for slice := range idx.slices {
+			slices = append(slices, slice)
+		}
+		sort.Slice(slices, func(i, j int) bool { return slices[i] < slices[j] })
+		indexes = append(indexes, pilosa.StatusIndex{Name: name, Frames: frames, Slices: slices})
+	}
+	return &pilosa.Status{
+		Nodes: []pilosa.StatusNode{{
+			Scheme:  "http",
+			Host:    s.Address(),
+			State:   "UP",
+			Indexes: indexes,
+		}},
+	}
+}
+
+func (s *Server) maxSlices() map[string]uint64 {
+	maxSlices := map[string]uint64{}
+	for name, idx := range s.indexes {
+		maxSlice := uint64(0)
+		for slice := range idx.slices {
+			if slice > maxSlice {
+				maxSlice = slice
+			}
+		}
+		maxSlices[name] = maxSlice
+	}
+	return maxSlices
+}
+
+func (s *Server) query(r *http.Request, indexName string, body []byte) (int, []byte) {
+	if _, ok := s.indexes[indexName]; !ok {
+		return http.StatusNotFound, []byte("index not found")
+	}
+	jsonFormat := r.Header.Get("Content-Type") != "application/x-protobuf"
+	pql, err := queryFromRequest(r.Header, body)
+	if err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+	response, ok := s.responses[responseKey(indexName, pql)]
+	if !ok {
+		response = defaultResponse(pql)
+	}
+	if jsonFormat {
+		return jsonResponse(response.json())
+	}
+	data, err := proto.Marshal(response.internal())
+	if err != nil {
+		return http.StatusInternalServerError, []byte(err.Error())
+	}
+	return http.StatusOK, data
+}
+
+func (s *Server) importBits(body []byte, clear bool) (int, []byte) {
+	request := &pbuf.ImportRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+	f := s.frame(request.Index, request.Frame)
+	if f == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	s.indexes[request.Index].slices[request.Slice] = true
+	for i := range request.RowIDs {
+		bit := pilosa.Bit{RowID: request.RowIDs[i], ColumnID: request.ColumnIDs[i]}
+		if i < len(request.Timestamps) {
+			bit.Timestamp = request.Timestamps[i]
+		}
+		if clear {
+			f.clearBit(bit)
+		} else {
+			f.bits = append(f.bits, bit)
+		}
+	}
+	return jsonResponse(map[string]interface{}{})
+}
+
+func (f *frame) clearBit(bit pilosa.Bit) {
+	bits := f.bits[:0]
+	for _, b := range f.bits {
+		if b.RowID != bit.RowID || b.ColumnID != bit.ColumnID {
+			bits = append(bits, b)
+		}
+	}
+	f.bits = bits
+}
+
+func (s *Server) importValues(body []byte) (int, []byte) {
+	request := &pbuf.ImportValueRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		return http.StatusBadRequest, []byte(err.Error())
+	}
+	f := s.frame(request.Index, request.Frame)
+	if f == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	s.indexes[request.Index].slices[request.Slice] = true
+	for i := range request.ColumnIDs {
+		f.values[request.Field] = append(f.values[request.Field], pilosa.FieldValue{
+			ColumnID: request.ColumnIDs[i],
+			Value:    request.Values[i],
+		})
+	}
+	return jsonResponse(map[string]interface{}{})
+}
+
+func (s *Server) export(r *http.Request) (int, []byte) {
+	params := r.URL.Query()
+	f := s.frame(params.Get("index"), params.Get("frame"))
+	if f == nil {
+		return http.StatusNotFound, []byte("frame not found")
+	}
+	slice, err := strconv.ParseUint(params.Get("slice"), 10, 64)
+	if err != nil {
+		return http.StatusBadRequest, []byte("invalid slice")
+	}
+	buf := &bytes.Buffer{}
+	for _, bit := range f.bits {
+		if bit.ColumnID/sliceWidth == slice {
+			fmt.Fprintf(buf, "%d,%d\n", bit.RowID, bit.ColumnID)
+		}
+	}
+	return http.StatusOK, buf.Bytes()
+}
+
+func jsonResponse(v interface{}) (int, []byte) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return http.StatusInternalServerError, []byte(err.Error())
+	}
+	return http.StatusOK, data
+}
+
+// readRequestBody reads the body of a request, decompressing it if it is compressed with gzip.
+func readRequestBody(r *http.Request) ([]byte, error) {
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return ioutil.ReadAll(reader)
+}
+
+// queryFromRequest returns the PQL of a query request, whose body is protobuf or the raw query in JSON mode.
+func queryFromRequest(header http.Header, body []byte) (string, error) {
+	if header.Get("Content-Type") != "application/x-protobuf" {
+		return string(body), nil
+	}
+	request := &pbuf.QueryRequest{}
+	if err := proto.Unmarshal(body, request); err != nil {
+		return "", err
+	}
+	return request.Query, nil
+}
@@ -0,0 +1,255 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosatest
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+)
+
+var (
+	repository *pilosa.Index
+	stargazer  *pilosa.Frame
+)
+
+func init() {
+	var err error
+	repository, err = pilosa.NewIndex("repository", nil)
+	if err != nil {
+		panic(err)
+	}
+	stargazer, err = repository.Frame("stargazer", nil)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateIndex(repository); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateFrame(stargazer); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CreateFrame(stargazer); err != pilosa.ErrFrameExists {
+		t.Fatalf("ErrFrameExists expected, got: %v", err)
+	}
+	if !server.HasIndex("repository") || !server.HasFrame("repository", "stargazer") {
+		t.Fatal("index and frame should be created")
+	}
+	server.CreateFrame("other", "f1")
+	schema, err := client.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes := schema.Indexes()
+	if len(indexes) != 2 || indexes["repository"] == nil || indexes["repository"].Frames()["stargazer"] == nil {
+		t.Fatalf("unexpected schema: %v", indexes)
+	}
+	if err = client.DeleteFrame(stargazer); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteIndex(repository); err != nil {
+		t.Fatal(err)
+	}
+	if server.HasIndex("repository") {
+		t.Fatal("index should be deleted")
+	}
+	if err = client.DeleteIndex(repository); !pilosa.IsNotFound(err) {
+		t.Fatalf("not found error expected, got: %v", err)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	for _, jsonFormat := range []bool{false, true} {
+		server := NewServer()
+		server.CreateFrame("repository", "stargazer")
+		server.RespondQuery(stargazer.Bitmap(5),
+			BitmapWithAttrs(map[string]interface{}{"name": "go-pilosa"}, 1, 2, 3))
+		server.Respond("repository", "TopN(frame='stargazer', n=2) Count(Bitmap(rowID=5, frame='stargazer'))",
+			TopN(pilosa.CountResultItem{ID: 5, Count: 3}), Count(3))
+		server.RespondError("repository", pilosa.SerializeQuery(stargazer.Bitmap(666)), "row is cursed")
+		client, err := server.Client(pilosa.JSONFormat(jsonFormat))
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Query(stargazer.Bitmap(5))
+		if err != nil {
+			t.Fatal(err)
+		}
+		bitmap := response.Result().Bitmap
+		if !reflect.DeepEqual(bitmap.Bits, []uint64{1, 2, 3}) || bitmap.Attributes["name"] != "go-pilosa" {
+			t.Fatalf("unexpected bitmap: %v", bitmap)
+		}
+		response, err = client.Query(repository.RawQuery("TopN(frame='stargazer', n=2)\nCount(Bitmap(rowID=5, frame='stargazer'))"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := response.Results()
+		if len(results) != 2 || results[0].CountItems[0].ID != 5 || results[1].Count != 3 {
+			t.Fatalf("unexpected results: %v", results)
+		}
+		response, err = client.Query(stargazer.Bitmap(666))
+		if err == nil && response.Success {
+			t.Fatal("query should have failed")
+		}
+		response, err = client.Query(stargazer.SetBit(1, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Results()) != 1 {
+			t.Fatalf("unexpected default results: %v", response.Results())
+		}
+		queries := server.Queries("repository")
+		if len(queries) != 4 || !strings.HasPrefix(queries[3], "SetBit(") {
+			t.Fatalf("unexpected queries: %v", queries)
+		}
+		server.Close()
+	}
+}
+
+func TestFailures(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.CreateFrame("repository", "stargazer")
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Fail("/index/repository/query", http.StatusInternalServerError, "disk full")
+	_, err = client.Query(stargazer.Bitmap(1))
+	pilosaErr, ok := err.(*pilosa.PilosaError)
+	if !ok || pilosaErr.StatusCode != 500 || pilosaErr.ServerMessage != "disk full\n" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = client.Status(); err != nil {
+		t.Fatalf("other paths should not fail: %v", err)
+	}
+	server.ClearFailures()
+	if _, err = client.Query(stargazer.Bitmap(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	server.SetLatency(50 * time.Millisecond)
+	client, err = server.Client(pilosa.RequestTimeout(10 * time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(stargazer.Bitmap(1)); err == nil {
+		t.Fatal("query should have timed out")
+	}
+}
+
+func TestImport(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.CreateFrame("repository", "stargazer")
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []pilosa.Bit{
+		{RowID: 2, ColumnID: 2000000},
+		{RowID: 1, ColumnID: 10},
+		{RowID: 1, ColumnID: 5},
+	}
+	if err = client.ImportFrame(stargazer, pilosa.NewSliceBitIterator(bits), 2); err != nil {
+		t.Fatal(err)
+	}
+	target := []pilosa.Bit{
+		{RowID: 1, ColumnID: 5},
+		{RowID: 1, ColumnID: 10},
+		{RowID: 2, ColumnID: 2000000},
+	}
+	if imported := server.ImportedBits("repository", "stargazer"); !reflect.DeepEqual(target, imported) {
+		t.Fatalf("%v != %v", target, imported)
+	}
+	buf := &bytes.Buffer{}
+	if err = client.ExportFrameTo(stargazer, "standard", buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "1,10\n1,5\n2,2000000\n" && buf.String() != "1,5\n1,10\n2,2000000\n" {
+		t.Fatalf("unexpected export: %q", buf.String())
+	}
+	maxSlices, err := client.MaxSlices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if maxSlices["repository"] != 1 {
+		t.Fatalf("unexpected max slices: %v", maxSlices)
+	}
+
+	if err = client.CreateIntField(stargazer, "stars", 0, 100); err != nil {
+		t.Fatal(err)
+	}
+	values := []pilosa.FieldValue{{ColumnID: 7, Value: 42}, {ColumnID: 3, Value: 10}}
+	if err = client.ImportValueFrame(stargazer, "stars", pilosa.NewSliceValueIterator(values), 10); err != nil {
+		t.Fatal(err)
+	}
+	targetValues := []pilosa.FieldValue{{ColumnID: 3, Value: 10}, {ColumnID: 7, Value: 42}}
+	if imported := server.ImportedValues("repository", "stargazer", "stars"); !reflect.DeepEqual(targetValues, imported) {
+		t.Fatalf("%v != %v", targetValues, imported)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	server.SetVersion("0.7.0")
+	client, err := server.Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CheckVersion(); err == nil {
+		t.Fatal("unsupported version should be detected")
+	}
+}
+
+func TestCallNames(t *testing.T) {
+	names := callNames("Count(Bitmap(frame='f(1)', rowID=1)) SetBit(frame=\"a)\", rowID=1, columnID=2)")
+	if !reflect.DeepEqual(names, []string{"Count", "SetBit"}) {
+		t.Fatalf("unexpected names: %v", names)
+	}
+}
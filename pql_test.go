@@ -0,0 +1,86 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	client := DefaultClient()
+	query := sampleIndex.BatchQuery(
+		sampleFrame.SetBit(1, 2),
+		sampleIndex.Count(b1),
+		sampleFrame.TopN(5),
+		sampleIndex.Intersect(b1, b2),
+		sampleFrame.SetRowAttrs(1, map[string]interface{}{"x": 1}),
+		sampleFrame.Field("foo").Sum(b1))
+	response, err := client.Query(query, DryRun(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := []ResultKind{
+		ResultKindChanged,
+		ResultKindCount,
+		ResultKindCountItems,
+		ResultKindBitmap,
+		ResultKindNone,
+		ResultKindSum,
+	}
+	if len(response.Results()) != len(target) {
+		t.Fatalf("%d != %d", len(target), len(response.Results()))
+	}
+	for i, result := range response.Results() {
+		if result.Kind != target[i] {
+			t.Fatalf("%s != %s", target[i], result.Kind)
+		}
+		if result.Bitmap == nil || result.CountItems == nil {
+			t.Fatalf("dry run results should have defaults")
+		}
+	}
+}
+
+func TestDryRunFails(t *testing.T) {
+	client := DefaultClient()
+	invalid := []string{
+		"Bitmap(rowID=1",
+		"Frobnicate(rowID=5)",
+		"Union(Count(Bitmap(rowID=1, frame='f')))",
+	}
+	for _, pql := range invalid {
+		_, err := client.Query(sampleIndex.RawQuery(pql), DryRun(true))
+		if err == nil {
+			t.Fatalf("dry run of %s should have failed", pql)
+		}
+	}
+}
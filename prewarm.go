@@ -0,0 +1,147 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Prewarm opens connections to each host in the cluster, so the following requests
+// do not wait for the TCP and TLS handshakes.
+// PrewarmConnections connections are opened per host, or one if it is not set.
+// The connections are kept in the idle pool of the HTTP client, so at most PoolSizePerRoute
+// of them are kept per host, until they are idle for IdleConnTimeout.
+func (c *Client) Prewarm() error {
+	return c.PrewarmWithContext(context.Background())
+}
+
+// PrewarmWithContext opens connections to each host in the cluster.
+// It returns the first error, after trying all hosts.
+func (c *Client) PrewarmWithContext(ctx context.Context) error {
+	hosts := c.cluster.allHosts()
+	errs := make([]error, len(hosts))
+	wg := &sync.WaitGroup{}
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host *URI) {
+			defer wg.Done()
+			errs[i] = c.prewarmHost(ctx, host)
+		}(i, host)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prewarmAtStartup opens the connections when the client is created, if PrewarmConnections is set.
+// The client is usable without them, so failures are logged instead of returned.
+func (c *Client) prewarmAtStartup() {
+	if c.options.PrewarmConnections <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.ConnectTimeout)
+	defer cancel()
+	if err := c.PrewarmWithContext(ctx); err != nil {
+		c.logger().Warn("opening connections failed", "error", err)
+	}
+}
+
+// prewarmHost opens the connections to a host by sending concurrent ping requests.
+// The responses are not read until all of them are received, so every request needs a connection of its own.
+func (c *Client) prewarmHost(ctx context.Context, host *URI) error {
+	n := c.options.PrewarmConnections
+	if n <= 0 {
+		n = 1
+	}
+	errs := make([]error, n)
+	received := &sync.WaitGroup{}
+	done := &sync.WaitGroup{}
+	received.Add(n)
+	done.Add(n)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer done.Done()
+			resp, err := c.doRequest(ctx, host, "GET", pingPath, nil, nil)
+			received.Done()
+			if err != nil {
+				errs[i] = errors.Wrapf(err, "opening connection to %s", host.address())
+				return
+			}
+			received.Wait()
+			// the body is read to the end, so the connection is put back into the pool
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}(i)
+	}
+	done.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prewarmObserver opens connections to the hosts which are added to the cluster or come back up,
+// so the requests after a topology change or a failover do not wait for the handshakes.
+type prewarmObserver struct {
+	NopClusterObserver
+	client *Client
+}
+
+// HostAdded opens connections to the new host in the background.
+func (o prewarmObserver) HostAdded(host *URI) {
+	go o.prewarm(host)
+}
+
+// HostUp opens connections to the recovered host in the background.
+func (o prewarmObserver) HostUp(host *URI) {
+	go o.prewarm(host)
+}
+
+func (o prewarmObserver) prewarm(host *URI) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.client.options.ConnectTimeout)
+	defer cancel()
+	if err := o.client.prewarmHost(ctx, host); err != nil {
+		o.client.logger().Warn("opening connections failed", "host", host.address(), "error", err)
+	}
+}
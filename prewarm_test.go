@@ -0,0 +1,179 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectionTransport counts the ping requests to each host,
+// and the maximum number of them which were in flight at the same time,
+// i.e., the number of connections a real transport would open.
+type connectionTransport struct {
+	mutex    sync.Mutex
+	requests map[string]int
+	inFlight map[string]int
+	max      map[string]int
+	failing  map[string]bool
+}
+
+func newConnectionTransport() *connectionTransport {
+	return &connectionTransport{
+		requests: map[string]int{},
+		inFlight: map[string]int{},
+		max:      map[string]int{},
+		failing:  map[string]bool{},
+	}
+}
+
+func (c *connectionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if req.URL.Path != pingPath {
+		return nil, errors.New("unexpected request")
+	}
+	c.requests[host]++
+	if c.failing[host] {
+		return nil, errors.New("connection refused")
+	}
+	c.inFlight[host]++
+	if c.inFlight[host] > c.max[host] {
+		c.max[host] = c.inFlight[host]
+	}
+	body := &closeFunc{Reader: bytes.NewReader([]byte("{}")), close: func() {
+		c.mutex.Lock()
+		c.inFlight[host]--
+		c.mutex.Unlock()
+	}}
+	return &http.Response{StatusCode: 200, Body: body}, nil
+}
+
+func (c *connectionTransport) counts(host string) (requests int, max int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.requests[host], c.max[host]
+}
+
+type closeFunc struct {
+	io.Reader
+	once  sync.Once
+	close func()
+}
+
+func (c *closeFunc) Close() error {
+	c.once.Do(c.close)
+	return nil
+}
+
+func TestPrewarmAtStartup(t *testing.T) {
+	transport := newConnectionTransport()
+	_, err := NewClient([]string{"host1:10101", "host2:10101"}, HTTPTransport(transport), PrewarmConnections(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"host1:10101", "host2:10101"} {
+		requests, max := transport.counts(host)
+		if requests != 3 || max != 3 {
+			t.Fatalf("3 concurrent requests expected to %s, got %d requests, %d concurrent", host, requests, max)
+		}
+	}
+}
+
+func TestPrewarmAtStartupFailureIsLogged(t *testing.T) {
+	transport := newConnectionTransport()
+	transport.failing["host1:10101"] = true
+	logger := &recordingLogger{}
+	_, err := NewClient("host1:10101", HTTPTransport(transport), PrewarmConnections(2), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("failing to open connections should not fail creating the client: %v", err)
+	}
+	if messages := logger.messages(); len(messages) != 1 || messages[0] != "opening connections failed" {
+		t.Fatalf("a warning expected, got %v", messages)
+	}
+}
+
+func TestPrewarmDisabled(t *testing.T) {
+	transport := newConnectionTransport()
+	_, err := NewClient("host1:10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests, _ := transport.counts("host1:10101"); requests != 0 {
+		t.Fatalf("no requests expected, got %d", requests)
+	}
+}
+
+func TestPrewarmWithContextReturnsError(t *testing.T) {
+	transport := newConnectionTransport()
+	transport.failing["host2:10101"] = true
+	client, err := NewClient([]string{"host1:10101", "host2:10101"}, HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.PrewarmWithContext(context.Background()); err == nil {
+		t.Fatalf("an error expected")
+	}
+	if requests, _ := transport.counts("host1:10101"); requests != 1 {
+		t.Fatalf("a single connection expected to the healthy host, got %d", requests)
+	}
+}
+
+func TestPrewarmAddedHost(t *testing.T) {
+	transport := newConnectionTransport()
+	cluster := NewClusterWithHost()
+	client, err := NewClient(cluster, HTTPTransport(transport), PrewarmConnections(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	uri, _ := NewURIFromAddress("host3:10101")
+	client.cluster.AddHost(uri)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		requests, max := transport.counts("host3:10101")
+		if requests == 2 && max == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("2 concurrent requests expected to the added host, got %d requests, %d concurrent", requests, max)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
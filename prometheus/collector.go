@@ -0,0 +1,136 @@
+// +build prometheus
+
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+// Package prometheus exports the metrics of a Pilosa client to Prometheus.
+//
+// The package is built only with the prometheus build tag, so the client
+// does not depend on the Prometheus client library otherwise:
+//
+//	go build -tags prometheus
+package prometheus
+
+import (
+	pilosa "github.com/pilosa/go-pilosa"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a pilosa.MetricsCollector which keeps the metrics of the requests of a client
+// in Prometheus metrics, labeled by host, method and endpoint.
+// It is a prometheus.Collector as well, so it can be registered to a Prometheus registry.
+type Collector struct {
+	requests *prom.CounterVec
+	errors   *prom.CounterVec
+	latency  *prom.HistogramVec
+	bytesIn  *prom.CounterVec
+	bytesOut *prom.CounterVec
+	retries  *prom.CounterVec
+}
+
+// NewCollector creates a Collector whose metrics are in the given namespace, e.g., myapp_pilosa_requests_total.
+// Pass an empty namespace for pilosa_requests_total.
+func NewCollector(namespace string) *Collector {
+	labels := []string{"host", "method", "endpoint"}
+	return &Collector{
+		requests: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "requests_total",
+			Help:      "Number of requests sent to Pilosa, by status code.",
+		}, append(labels, "code")),
+		errors: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "request_errors_total",
+			Help:      "Number of requests to Pilosa which failed or returned an error status.",
+		}, labels),
+		latency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the requests to Pilosa, until the response body is closed.",
+			Buckets:   prom.DefBuckets,
+		}, labels),
+		bytesIn: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "response_bytes_total",
+			Help:      "Number of bytes read from the responses of Pilosa.",
+		}, labels),
+		bytesOut: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "request_bytes_total",
+			Help:      "Number of bytes sent in the requests to Pilosa.",
+		}, labels),
+		retries: prom.NewCounterVec(prom.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pilosa",
+			Name:      "request_retries_total",
+			Help:      "Number of retried requests to Pilosa.",
+		}, []string{"endpoint"}),
+	}
+}
+
+// RequestDone records the metrics of a request.
+func (c *Collector) RequestDone(request pilosa.RequestMetrics) {
+	c.requests.WithLabelValues(request.Host, request.Method, request.Endpoint, request.StatusLabel()).Inc()
+	if request.Failed() {
+		c.errors.WithLabelValues(request.Host, request.Method, request.Endpoint).Inc()
+	}
+	c.latency.WithLabelValues(request.Host, request.Method, request.Endpoint).Observe(request.Duration.Seconds())
+	c.bytesIn.WithLabelValues(request.Host, request.Method, request.Endpoint).Add(float64(request.BytesIn))
+	c.bytesOut.WithLabelValues(request.Host, request.Method, request.Endpoint).Add(float64(request.BytesOut))
+}
+
+// RequestRetried records a retried request.
+func (c *Collector) RequestRetried(endpoint string) {
+	c.retries.WithLabelValues(endpoint).Inc()
+}
+
+// Describe sends the descriptors of the metrics of the collector to ch.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect sends the metrics of the collector to ch.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (c *Collector) collectors() []prom.Collector {
+	return []prom.Collector{c.requests, c.errors, c.latency, c.bytesIn, c.bytesOut, c.retries}
+}
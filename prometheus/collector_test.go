@@ -0,0 +1,95 @@
+// +build prometheus
+
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package prometheus
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	pilosa "github.com/pilosa/go-pilosa"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	collector := NewCollector("test")
+	registry := prom.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Fatal(err)
+	}
+	collector.RequestDone(pilosa.RequestMetrics{
+		Host:       "node1:10101",
+		Method:     "POST",
+		Endpoint:   "/index/{index}/query",
+		StatusCode: 200,
+		Duration:   time.Millisecond,
+		BytesOut:   10,
+		BytesIn:    20,
+	})
+	collector.RequestDone(pilosa.RequestMetrics{
+		Host:     "node1:10101",
+		Method:   "POST",
+		Endpoint: "/index/{index}/query",
+		Err:      errors.New("connection refused"),
+	})
+	collector.RequestRetried("/index/{index}/query")
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			switch {
+			case metric.GetCounter() != nil:
+				values[family.GetName()] += metric.GetCounter().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] += float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	targets := map[string]float64{
+		"test_pilosa_requests_total":           2,
+		"test_pilosa_request_errors_total":     1,
+		"test_pilosa_request_duration_seconds": 2,
+		"test_pilosa_response_bytes_total":     20,
+		"test_pilosa_request_bytes_total":      10,
+		"test_pilosa_request_retries_total":    1,
+	}
+	for name, target := range targets {
+		if values[name] != target {
+			t.Fatalf("%s: %v != %v", name, target, values[name])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	now := time.Date(2017, time.December, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(10, 2)
+	limiter.now = func() time.Time { return now }
+	limiter.last = now
+
+	// the burst is allowed immediately
+	for i := 0; i < 2; i++ {
+		if delay := limiter.reserve(); delay != 0 {
+			t.Fatalf("request %d should not wait, got %v", i, delay)
+		}
+	}
+	if delay := limiter.reserve(); delay != 100*time.Millisecond {
+		t.Fatalf("100ms delay expected, got %v", delay)
+	}
+	if delay := limiter.reserve(); delay != 200*time.Millisecond {
+		t.Fatalf("200ms delay expected, got %v", delay)
+	}
+	limiter.cancel()
+	limiter.cancel()
+
+	// tokens are refilled up to the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 2; i++ {
+		if delay := limiter.reserve(); delay != 0 {
+			t.Fatalf("request %d should not wait, got %v", i, delay)
+		}
+	}
+	if delay := limiter.reserve(); delay == 0 {
+		t.Fatalf("request over the burst should wait")
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+	limiter := newRateLimiter(0.001, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := limiter.wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := limiter.wait(ctx); err != context.Canceled {
+		t.Fatalf("context.Canceled expected, got: %v", err)
+	}
+}
+
+func TestRateLimitOption(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"views": []}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), RateLimit(0.001, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Views(sampleFrame); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = client.ViewsWithContext(ctx, sampleFrame); err == nil {
+		t.Fatalf("the request should wait until the context is done")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestID(t *testing.T) {
+	ids := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ids = append(ids, req.Header.Get(RequestIDHeader))
+		if len(ids)%2 == 1 {
+			return &http.Response{
+				StatusCode: 503,
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	logger := &recordingLogger{}
+	policy := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryableStatusCodes: []int{503}}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true), Retry(policy), WithLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := sampleIndex.Count(sampleFrame.Bitmap(1))
+	if _, err = client.Query(query); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("retries should share the generated request ID: %v", ids)
+	}
+	for _, entry := range logger.entries {
+		if entry.value("request_id") != ids[0] {
+			t.Fatalf("request ID is not logged: %v", entry)
+		}
+	}
+
+	ctx := ContextWithRequestID(context.Background(), "request-42")
+	if _, err = client.QueryWithContext(ctx, query); err != nil {
+		t.Fatal(err)
+	}
+	if ids[2] != "request-42" || ids[3] != "request-42" {
+		t.Fatalf("request ID of the context is not sent: %v", ids)
+	}
+	if _, err = client.Query(query); err != nil {
+		t.Fatal(err)
+	}
+	if ids[4] == ids[0] {
+		t.Fatalf("request IDs should be unique: %v", ids)
+	}
+}
+
+func TestRequestIDInError(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 500,
+			Body:       ioutil.NopCloser(strings.NewReader("some error")),
+		}, nil
+	})
+	client, err := NewClient("node1:10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := ContextWithRequestID(context.Background(), "request-42")
+	err = client.DeleteIndexWithContext(ctx, sampleIndex)
+	pilosaErr, ok := err.(*PilosaError)
+	if !ok || pilosaErr.RequestID != "request-42" {
+		t.Fatalf("unexpected error: %#v", err)
+	}
+	target := "Error: Server error (500) Internal Server Error from node1:10101 (request ID request-42): some error"
+	if err.Error() != target {
+		t.Fatalf("%s != %s", target, err.Error())
+	}
+}
+
+func TestRequestIDFromContext(t *testing.T) {
+	if _, ok := RequestIDFromContext(context.Background()); ok {
+		t.Fatal("no request ID expected")
+	}
+	if _, ok := RequestIDFromContext(ContextWithRequestID(context.Background(), "")); ok {
+		t.Fatal("empty request ID should be ignored")
+	}
+	ctx := ensureRequestID(ContextWithRequestID(context.Background(), "id1"))
+	if id, _ := RequestIDFromContext(ctx); id != "id1" {
+		t.Fatalf("request ID of the context should be kept: %s", id)
+	}
+	if id, ok := RequestIDFromContext(ensureRequestID(context.Background())); !ok || len(id) != 32 {
+		t.Fatalf("unexpected generated request ID: %s", id)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+)
+
+// Resolver returns the hosts of a cluster, e.g., from a service discovery system.
+// Implement it to use Consul, etcd or the Kubernetes API with NewClusterWithResolver.
+type Resolver interface {
+	Hosts(ctx context.Context) ([]URI, error)
+}
+
+// ResolverFunc is an adapter to use a function as a Resolver.
+type ResolverFunc func(ctx context.Context) ([]URI, error)
+
+// Hosts calls f(ctx).
+func (f ResolverFunc) Hosts(ctx context.Context) ([]URI, error) {
+	return f(ctx)
+}
+
+// StaticResolver always returns the same hosts.
+type StaticResolver struct {
+	hosts []URI
+}
+
+// NewStaticResolver returns a resolver which returns the given hosts.
+func NewStaticResolver(hosts ...*URI) *StaticResolver {
+	resolver := &StaticResolver{hosts: make([]URI, 0, len(hosts))}
+	for _, host := range hosts {
+		resolver.hosts = append(resolver.hosts, *host)
+	}
+	return resolver
+}
+
+// Hosts returns the hosts of the resolver.
+func (r *StaticResolver) Hosts(ctx context.Context) ([]URI, error) {
+	hosts := make([]URI, len(r.hosts))
+	copy(hosts, r.hosts)
+	return hosts, nil
+}
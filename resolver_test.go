@@ -0,0 +1,81 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStaticResolver(t *testing.T) {
+	resolver := NewStaticResolver(URIFromAddress("node1:10101"), URIFromAddress("https://node2:10102"))
+	hosts, err := resolver.Hosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, hosts, []string{"http://node1:10101", "https://node2:10102"})
+}
+
+func TestClusterWithResolver(t *testing.T) {
+	hosts := []URI{*URIFromAddress("node1:10101")}
+	var resolveErr error
+	resolver := ResolverFunc(func(ctx context.Context) ([]URI, error) {
+		return hosts, resolveErr
+	})
+	cluster, err := NewClusterWithResolver(context.Background(), resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, cluster.Hosts(), []string{"http://node1:10101"})
+
+	hosts = []URI{*URIFromAddress("node1:10101"), *URIFromAddress("node2:10101")}
+	if err = cluster.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, cluster.Hosts(), []string{"http://node1:10101", "http://node2:10101"})
+
+	resolveErr = errors.New("discovery is down")
+	if err = cluster.Refresh(context.Background()); err != resolveErr {
+		t.Fatalf("the error of the resolver should be returned")
+	}
+	compareHosts(t, cluster.Hosts(), []string{"http://node1:10101", "http://node2:10101"})
+}
+
+func TestRefreshWithoutResolver(t *testing.T) {
+	cluster := NewClusterWithHost(URIFromAddress("node1:10101"))
+	if err := cluster.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	compareHosts(t, cluster.Hosts(), []string{"http://node1:10101"})
+}
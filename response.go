@@ -35,16 +35,73 @@ package pilosa
 import (
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 
 	pbuf "github.com/pilosa/go-pilosa/gopilosa_pbuf"
 )
 
 // QueryResponse represents the response from a Pilosa query.
+// If the server could not run the query, Success is false and ErrorMessage contains the reason.
+// Otherwise, there is a result for each call in the query, in the same order.
 type QueryResponse struct {
 	ResultList   []*QueryResult `json:"results,omitempty"`
 	ColumnList   []*ColumnItem  `json:"columns,omitempty"`
 	ErrorMessage string         `json:"error-message,omitempty"`
 	Success      bool           `json:"success,omitempty"`
+	// Metadata contains information about the request of the query.
+	// It is nil for dry runs.
+	Metadata *ResponseMetadata `json:"-"`
+}
+
+// ResponseMetadata contains information about the request of a query,
+// so applications can log and budget query costs.
+type ResponseMetadata struct {
+	// Host is the host which served the request, in host:port form,
+	// or the path of the socket for a Unix domain socket.
+	Host string
+	// Duration is the wall time of the request, including retries.
+	Duration time.Duration
+	// Size is the size of the response body in bytes.
+	Size int
+	// Cached is true if the response was returned from the result cache of the client.
+	Cached bool
+}
+
+// clone returns a deep copy of the response.
+// The packed bits of lazily decoded results are shared, since they are not modified.
+func (qr *QueryResponse) clone() *QueryResponse {
+	response := *qr
+	if qr.ResultList != nil {
+		response.ResultList = make([]*QueryResult, len(qr.ResultList))
+		for i, result := range qr.ResultList {
+			response.ResultList[i] = result.clone()
+		}
+	}
+	if qr.ColumnList != nil {
+		response.ColumnList = make([]*ColumnItem, len(qr.ColumnList))
+		for i, column := range qr.ColumnList {
+			if column != nil {
+				response.ColumnList[i] = &ColumnItem{ID: column.ID, Attributes: cloneAttributes(column.Attributes)}
+			}
+		}
+	}
+	if qr.Metadata != nil {
+		metadata := *qr.Metadata
+		response.Metadata = &metadata
+	}
+	return &response
+}
+
+func newResponseMetadata(response *http.Response, body []byte, duration time.Duration) *ResponseMetadata {
+	metadata := &ResponseMetadata{
+		Duration: duration,
+		Size:     len(body),
+	}
+	if response != nil && response.Request != nil && response.Request.URL != nil {
+		metadata.Host = hostFromRequestAddress(response.Request.URL.Host)
+	}
+	return metadata
 }
 
 func newQueryResponseFromInternal(response *pbuf.QueryResponse) (*QueryResponse, error) {
@@ -91,6 +148,23 @@ func (qr *QueryResponse) Result() *QueryResult {
 	return qr.ResultList[0]
 }
 
+// ResultAt returns the result at the given index or nil.
+// The result of the i'th call of a batch query is at index i.
+func (qr *QueryResponse) ResultAt(i int) *QueryResult {
+	if i < 0 || i >= len(qr.ResultList) {
+		return nil
+	}
+	return qr.ResultList[i]
+}
+
+// Err returns an error with the error message if the query was not successful, or nil.
+func (qr *QueryResponse) Err() error {
+	if qr.Success {
+		return nil
+	}
+	return NewError(qr.ErrorMessage)
+}
+
 // Columns returns all columns in the response.
 func (qr *QueryResponse) Columns() []*ColumnItem {
 	return qr.ColumnList
@@ -104,12 +178,47 @@ func (qr *QueryResponse) Column() *ColumnItem {
 	return qr.ColumnList[0]
 }
 
+// ColumnAt returns the column at the given index or nil.
+func (qr *QueryResponse) ColumnAt(i int) *ColumnItem {
+	if i < 0 || i >= len(qr.ColumnList) {
+		return nil
+	}
+	return qr.ColumnList[i]
+}
+
 // QueryResult represent one of the results in the response.
 type QueryResult struct {
 	Bitmap     *BitmapResult      `json:"bitmap,omitempty"`
 	CountItems []*CountResultItem `json:"count-items,omitempty"`
 	Count      uint64             `json:"count,omitempty"`
 	Sum        int64              `json:"sum,omitempty"`
+	// Kind is the expected kind of the result. It is only set for dry runs.
+	Kind ResultKind `json:"kind,omitempty"`
+}
+
+func (qr *QueryResult) clone() *QueryResult {
+	if qr == nil {
+		return nil
+	}
+	result := *qr
+	if qr.Bitmap != nil {
+		bitmap := *qr.Bitmap
+		bitmap.Attributes = cloneAttributes(qr.Bitmap.Attributes)
+		if qr.Bitmap.Bits != nil {
+			bitmap.Bits = append([]uint64{}, qr.Bitmap.Bits...)
+		}
+		result.Bitmap = &bitmap
+	}
+	if qr.CountItems != nil {
+		result.CountItems = make([]*CountResultItem, len(qr.CountItems))
+		for i, item := range qr.CountItems {
+			if item != nil {
+				copied := *item
+				result.CountItems[i] = &copied
+			}
+		}
+	}
+	return &result
 }
 
 func newQueryResultFromInternal(result *pbuf.QueryResult) (*QueryResult, error) {
@@ -161,7 +270,14 @@ func countItemsFromInternal(items []*pbuf.Pair) []*CountResultItem {
 // BitmapResult represents a result from Bitmap, Union, Intersect, Difference and Range PQL calls.
 type BitmapResult struct {
 	Attributes map[string]interface{}
-	Bits       []uint64
+	// Bits are the column IDs of the result.
+	// It is nil if the result is decoded lazily with the LazyBits query option;
+	// use Columns, Chunks or Iterator to read the bits of any result.
+	Bits []uint64
+	// packed are the bits of a lazily decoded result as packed varints in the response buffer
+	packed []byte
+	// packedCount is the number of bits in packed
+	packedCount int
 }
 
 func newBitmapResultFromInternal(bitmap *pbuf.Bitmap) (*BitmapResult, error) {
@@ -183,6 +299,18 @@ const (
 	floatType  = 4
 )
 
+// cloneAttributes copies the attributes of a result, whose values are strings, numbers or booleans.
+func cloneAttributes(attrs map[string]interface{}) map[string]interface{} {
+	if attrs == nil {
+		return nil
+	}
+	cloned := make(map[string]interface{}, len(attrs))
+	for key, value := range attrs {
+		cloned[key] = value
+	}
+	return cloned
+}
+
 func convertInternalAttrsToMap(attrs []*pbuf.Attr) (attrsMap map[string]interface{}, err error) {
 	attrsMap = make(map[string]interface{}, len(attrs))
 	for _, attr := range attrs {
@@ -210,6 +338,34 @@ type ColumnItem struct {
 	Attributes map[string]interface{} `json:"attributes,omitempty"`
 }
 
+// GetString returns the value of a string attribute of the column.
+// The second return value is false if the column doesn't have the attribute or it is not a string.
+func (c *ColumnItem) GetString(key string) (string, bool) {
+	value, ok := c.Attributes[key].(string)
+	return value, ok
+}
+
+// GetInt64 returns the value of an integer attribute of the column.
+// The second return value is false if the column doesn't have the attribute or it is not an integer.
+func (c *ColumnItem) GetInt64(key string) (int64, bool) {
+	value, ok := c.Attributes[key].(int64)
+	return value, ok
+}
+
+// GetBool returns the value of a boolean attribute of the column.
+// The second return value is false if the column doesn't have the attribute or it is not a boolean.
+func (c *ColumnItem) GetBool(key string) (bool, bool) {
+	value, ok := c.Attributes[key].(bool)
+	return value, ok
+}
+
+// GetFloat64 returns the value of a float attribute of the column.
+// The second return value is false if the column doesn't have the attribute or it is not a float.
+func (c *ColumnItem) GetFloat64(key string) (float64, bool) {
+	value, ok := c.Attributes[key].(float64)
+	return value, ok
+}
+
 func newColumnItemFromInternal(column *pbuf.ColumnAttrSet) (*ColumnItem, error) {
 	attrs, err := convertInternalAttrsToMap(column.Attrs)
 	if err != nil {
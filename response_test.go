@@ -119,6 +119,15 @@ func TestNewQueryResponseFromInternal(t *testing.T) {
 	if results[0] != qr.Result() {
 		t.Fatalf("Result() should return the first result")
 	}
+	if results[1] != qr.ResultAt(1) || qr.ResultAt(2) != nil || qr.ResultAt(-1) != nil {
+		t.Fatalf("ResultAt() should return the result at the index")
+	}
+	if qr.Err() != nil {
+		t.Fatalf("Err() should be nil for a successful response")
+	}
+	if qr.ColumnAt(0) != nil {
+		t.Fatalf("ColumnAt() should return nil if there are no columns")
+	}
 	if !reflect.DeepEqual(targetAttrs, results[0].Bitmap.Attributes) {
 		t.Fatalf("The bitmap result should contain the attributes")
 	}
@@ -147,6 +156,9 @@ func TestNewQueryResponseWithErrorFromInternal(t *testing.T) {
 	if qr.Result() != nil {
 		t.Fatalf("If there are no results, Result should return nil")
 	}
+	if err := qr.Err(); err == nil || err.Error() != "Error: some error" {
+		t.Fatalf("Err() should return the error message, got: %v", err)
+	}
 }
 
 func TestNewQueryResponseFromInternalFailure(t *testing.T) {
@@ -172,6 +184,39 @@ func TestNewQueryResponseFromInternalFailure(t *testing.T) {
 	}
 }
 
+func TestColumnItemGetters(t *testing.T) {
+	column, err := newColumnItemFromInternal(&pbuf.ColumnAttrSet{
+		ID: 5,
+		Attrs: []*pbuf.Attr{
+			{Key: "name", StringValue: "some string", Type: 1},
+			{Key: "age", IntValue: 95, Type: 2},
+			{Key: "registered", BoolValue: true, Type: 3},
+			{Key: "height", FloatValue: 1.83, Type: 4},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := column.GetString("name"); !ok || name != "some string" {
+		t.Fatalf("unexpected name: %v %v", name, ok)
+	}
+	if age, ok := column.GetInt64("age"); !ok || age != 95 {
+		t.Fatalf("unexpected age: %v %v", age, ok)
+	}
+	if registered, ok := column.GetBool("registered"); !ok || !registered {
+		t.Fatalf("unexpected registered: %v %v", registered, ok)
+	}
+	if height, ok := column.GetFloat64("height"); !ok || height != 1.83 {
+		t.Fatalf("unexpected height: %v %v", height, ok)
+	}
+	if _, ok := column.GetString("age"); ok {
+		t.Fatalf("GetString should fail for an integer attribute")
+	}
+	if _, ok := column.GetInt64("missing"); ok {
+		t.Fatalf("GetInt64 should fail for a missing attribute")
+	}
+}
+
 func TestCountResultItemToString(t *testing.T) {
 	item := &CountResultItem{ID: 100, Count: 50}
 	target := "100:50"
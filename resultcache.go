@@ -0,0 +1,190 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// resultCache keeps the responses of read-only queries for ttl.
+// At most size responses are kept, the least recently used responses are evicted first.
+// Responses are copied when they are cached and when they are returned,
+// so the responses returned to the callers can be modified.
+// A nil resultCache caches nothing.
+type resultCache struct {
+	mutex     sync.Mutex
+	ttl       time.Duration
+	responses *lru
+}
+
+type resultCacheEntry struct {
+	index    string
+	frames   []string
+	response *QueryResponse
+	expires  time.Time
+}
+
+// newResultCache returns a result cache, or nil if size or ttl is 0 or less.
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &resultCache{
+		ttl:       ttl,
+		responses: newLRU(size),
+	}
+}
+
+// resultCacheKey returns the cache key of a query, which includes the options
+// which change the response and the query with whitespace outside of strings removed.
+func resultCacheKey(index string, pql string, options *QueryOptions, jsonFormat bool) string {
+	return fmt.Sprintf("%s\x00%t%t%t%t%t\x00%s", index,
+		options.Columns, options.ExcludeAttrs, options.ExcludeBits, options.LazyBits, jsonFormat, normalizePQL(pql))
+}
+
+// normalizePQL removes the whitespace outside of quoted strings in a query.
+func normalizePQL(pql string) string {
+	normalized := make([]byte, 0, len(pql))
+	var quote byte
+	for i := 0; i < len(pql); i++ {
+		c := pql[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && i+1 < len(pql) {
+				normalized = append(normalized, c)
+				i++
+				c = pql[i]
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		}
+		normalized = append(normalized, c)
+	}
+	return string(normalized)
+}
+
+var frameArgRe = regexp.MustCompile(`\bframe=(?:'([^']*)'|"([^"]*)")`)
+
+// queryFrames returns the names of the frames in a query.
+func queryFrames(pql string) []string {
+	frames := []string{}
+	for _, match := range frameArgRe.FindAllStringSubmatch(pql, -1) {
+		frames = append(frames, match[1]+match[2])
+	}
+	return frames
+}
+
+// get returns the cached response for the key, or nil if there is no response or it is expired.
+// The returned response is a copy of the cached one, with Metadata.Cached set.
+func (r *resultCache) get(key string) *QueryResponse {
+	if r == nil {
+		return nil
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	value, ok := r.responses.get(key)
+	if !ok {
+		return nil
+	}
+	entry := value.(*resultCacheEntry)
+	if time.Now().After(entry.expires) {
+		r.responses.remove(key)
+		return nil
+	}
+	response := entry.response.clone()
+	if response.Metadata != nil {
+		response.Metadata.Cached = true
+	}
+	return response
+}
+
+func (r *resultCache) set(key string, index string, pql string, response *QueryResponse) {
+	if r == nil {
+		return
+	}
+	entry := &resultCacheEntry{
+		index:    index,
+		frames:   queryFrames(pql),
+		response: response.clone(),
+		expires:  time.Now().Add(r.ttl),
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.responses.add(key, entry)
+}
+
+// invalidateQuery removes the responses of queries which use the frames modified by a query.
+// If the query does not refer to a frame, e.g., SetColumnAttrs, all responses for the index are removed.
+func (r *resultCache) invalidateQuery(index string, pql string) {
+	if r == nil {
+		return
+	}
+	frames := queryFrames(pql)
+	if len(frames) == 0 {
+		r.invalidate(index, "")
+		return
+	}
+	for _, frame := range frames {
+		r.invalidate(index, frame)
+	}
+}
+
+// invalidate removes the responses of queries which use the given frame of the index.
+// Responses of queries whose frames are not known are removed as well.
+// Pass an empty frame name to remove all responses for the index.
+func (r *resultCache) invalidate(index string, frame string) {
+	if r == nil {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.responses.removeIf(func(value interface{}) bool {
+		entry := value.(*resultCacheEntry)
+		return entry.index == index && (frame == "" || len(entry.frames) == 0 || containsString(entry.frames, frame))
+	})
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResultCache(t *testing.T) {
+	queries := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		queries = append(queries, string(body))
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"results": [5]}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true), ResultCache(10, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherFrame, err := sampleIndex.Frame("other-frame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := sampleIndex.Count(sampleFrame.Bitmap(1))
+	otherCount := sampleIndex.Count(otherFrame.Bitmap(1))
+	for i := 0; i < 2; i++ {
+		response, err := client.Query(count)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.Result().Count != 5 || response.Metadata.Cached != (i == 1) {
+			t.Fatalf("unexpected response: %v, %v", response.Result(), response.Metadata)
+		}
+		if _, err = client.Query(otherCount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the options which change the response are a part of the key
+	if _, err = client.Query(count, ColumnAttrs(true)); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("unexpected queries: %v", queries)
+	}
+	// a write to the frame invalidates the cached results of the queries which use the frame
+	if _, err = client.Query(sampleFrame.SetBit(1, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(count); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(otherCount); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{
+		"Count(Bitmap(rowID=1, frame='sample-frame'))",
+		"Count(Bitmap(rowID=1, frame='other-frame'))",
+		"Count(Bitmap(rowID=1, frame='sample-frame'))",
+		"SetBit(rowID=1, frame='sample-frame', columnID=10)",
+		"Count(Bitmap(rowID=1, frame='sample-frame'))",
+	}
+	if !reflect.DeepEqual(target, queries) {
+		t.Fatalf("unexpected queries: %v", queries)
+	}
+}
+
+func TestResultCacheCopiesResponses(t *testing.T) {
+	cache := newResultCache(10, time.Minute)
+	response := &QueryResponse{
+		ResultList: []*QueryResult{{
+			Bitmap:     &BitmapResult{Attributes: map[string]interface{}{"name": "a"}, Bits: []uint64{1, 2}},
+			CountItems: []*CountResultItem{{ID: 1, Count: 5}},
+		}},
+		ColumnList: []*ColumnItem{{ID: 1, Attributes: map[string]interface{}{"name": "b"}}},
+		Success:    true,
+		Metadata:   &ResponseMetadata{Host: "node1:10101"},
+	}
+	cache.set("a", "i", "Bitmap(frame='f')", response)
+	// modifying the response after it is cached does not change the cache
+	response.ResultList[0].Bitmap.Bits[0] = 100
+	cached := cache.get("a")
+	// neither does modifying a response returned from the cache
+	cached.ResultList[0].Bitmap.Bits[1] = 200
+	cached.ResultList[0].Bitmap.Attributes["name"] = "x"
+	cached.ResultList[0].CountItems[0].Count = 50
+	cached.ColumnList[0].Attributes["name"] = "y"
+	cached = cache.get("a")
+	result := cached.Result()
+	if !reflect.DeepEqual([]uint64{1, 2}, result.Bitmap.Bits) || result.Bitmap.Attributes["name"] != "a" {
+		t.Fatalf("unexpected bitmap: %v", result.Bitmap)
+	}
+	if result.CountItems[0].Count != 5 || cached.Column().Attributes["name"] != "b" {
+		t.Fatalf("unexpected response: %v, %v", result.CountItems, cached.Column())
+	}
+	if !cached.Metadata.Cached || response.Metadata.Cached {
+		t.Fatalf("only the returned metadata should be marked as cached")
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	cache := newResultCache(2, time.Minute)
+	response := &QueryResponse{Success: true}
+	cache.set("a", "i", "Bitmap(frame='f')", response)
+	cache.set("b", "i", "Bitmap(frame='g')", response)
+	cache.get("a")
+	cache.set("c", "i", "Bitmap(frame='h')", response)
+	if cache.get("b") != nil {
+		t.Fatalf("the least recently used response should be evicted")
+	}
+	if cache.get("a") == nil || cache.get("c") == nil {
+		t.Fatalf("recently used responses should be kept")
+	}
+	cache.invalidateQuery("i", "SetColumnAttrs(columnID=1, x=1)")
+	if cache.get("a") != nil || cache.get("c") != nil {
+		t.Fatalf("a write without a frame should invalidate the index")
+	}
+	cache.set("d", "i", "Bitmap(frame='f')", response)
+	cache.ttl = -time.Second
+	cache.set("e", "i", "Bitmap(frame='f')", response)
+	if cache.get("e") != nil {
+		t.Fatalf("expired responses should not be returned")
+	}
+	if cache.get("d") == nil {
+		t.Fatalf("unexpired responses should be returned")
+	}
+	if newResultCache(0, time.Minute) != nil || newResultCache(10, 0) != nil {
+		t.Fatalf("the cache should be disabled")
+	}
+	var disabled *resultCache
+	disabled.set("a", "i", "Bitmap(frame='f')", response)
+	if disabled.get("a") != nil {
+		t.Fatalf("a disabled cache should not return responses")
+	}
+	disabled.invalidate("i", "f")
+}
+
+func TestNormalizePQL(t *testing.T) {
+	normalized := normalizePQL("Count( Bitmap(rowID=1,\n frame='a b')) SetRowAttrs(x=\"it\\\"s  here\")")
+	if normalized != "Count(Bitmap(rowID=1,frame='a b'))SetRowAttrs(x=\"it\\\"s  here\")" {
+		t.Fatalf("unexpected normalized query: %s", normalized)
+	}
+	frames := queryFrames("Union(Bitmap(rowID=1, frame='a'), Bitmap(rowID=2, frame=\"b\"))")
+	if !reflect.DeepEqual([]string{"a", "b"}, frames) {
+		t.Fatalf("unexpected frames: %v", frames)
+	}
+}
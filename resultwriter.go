@@ -0,0 +1,161 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// kind returns the kind of the result.
+// Kind is used if it is set, otherwise the kind is detected from the contents of the result.
+// An empty result is detected as ResultKindNone.
+func (r *QueryResult) kind() ResultKind {
+	if r.Kind != "" {
+		return r.Kind
+	}
+	switch {
+	case len(r.CountItems) > 0:
+		return ResultKindCountItems
+	case r.Bitmap != nil && (r.Bitmap.Len() > 0 || len(r.Bitmap.Attributes) > 0):
+		return ResultKindBitmap
+	case r.Sum != 0:
+		return ResultKindSum
+	case r.Count > 0:
+		return ResultKindCount
+	}
+	return ResultKindNone
+}
+
+type jsonBitmapOutput struct {
+	Attributes map[string]interface{} `json:"attributes"`
+	Bits       []uint64               `json:"bits"`
+}
+
+type jsonCountItemOutput struct {
+	ID    uint64 `json:"id"`
+	Count uint64 `json:"count"`
+}
+
+type jsonSumOutput struct {
+	Sum   int64  `json:"sum"`
+	Count uint64 `json:"count"`
+}
+
+// WriteJSON writes the result to w as JSON, followed by a newline.
+// Bitmap results are written as objects with attributes and bits,
+// TopN results as lists of objects with id and count,
+// Count results as numbers and Sum results as objects with sum and count.
+// Other results are written as null.
+// The kind of the result is taken from Kind if it is set,
+// otherwise it is detected from the contents of the result.
+func (r *QueryResult) WriteJSON(w io.Writer) error {
+	var output interface{}
+	switch r.kind() {
+	case ResultKindBitmap:
+		bitmap := jsonBitmapOutput{
+			Attributes: map[string]interface{}{},
+			Bits:       []uint64{},
+		}
+		if r.Bitmap != nil {
+			if r.Bitmap.Attributes != nil {
+				bitmap.Attributes = r.Bitmap.Attributes
+			}
+			if bits := r.Bitmap.Columns(); bits != nil {
+				bitmap.Bits = bits
+			}
+		}
+		output = bitmap
+	case ResultKindCountItems:
+		items := make([]jsonCountItemOutput, 0, len(r.CountItems))
+		for _, item := range r.CountItems {
+			items = append(items, jsonCountItemOutput{ID: item.ID, Count: item.Count})
+		}
+		output = items
+	case ResultKindCount:
+		output = r.Count
+	case ResultKindSum:
+		output = jsonSumOutput{Sum: r.Sum, Count: r.Count}
+	}
+	return errors.Wrap(json.NewEncoder(w).Encode(output), "writing JSON result")
+}
+
+// WriteCSV writes the result to w as CSV, without a header.
+// Bitmap results are written as a column ID per line,
+// TopN results as id,count lines,
+// Count results as a single count and Sum results as a single sum,count line.
+// Nothing is written for other results.
+// The kind of the result is taken from Kind if it is set,
+// otherwise it is detected from the contents of the result.
+func (r *QueryResult) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	switch r.kind() {
+	case ResultKindBitmap:
+		if r.Bitmap != nil {
+			iterator := r.Bitmap.Iterator()
+			for {
+				bit, err := iterator.NextColumn()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return errors.Wrap(err, "reading bitmap result")
+				}
+				if err := writer.Write([]string{strconv.FormatUint(bit, 10)}); err != nil {
+					return errors.Wrap(err, "writing CSV result")
+				}
+			}
+		}
+	case ResultKindCountItems:
+		for _, item := range r.CountItems {
+			record := []string{strconv.FormatUint(item.ID, 10), strconv.FormatUint(item.Count, 10)}
+			if err := writer.Write(record); err != nil {
+				return errors.Wrap(err, "writing CSV result")
+			}
+		}
+	case ResultKindCount:
+		if err := writer.Write([]string{strconv.FormatUint(r.Count, 10)}); err != nil {
+			return errors.Wrap(err, "writing CSV result")
+		}
+	case ResultKindSum:
+		record := []string{strconv.FormatInt(r.Sum, 10), strconv.FormatUint(r.Count, 10)}
+		if err := writer.Write(record); err != nil {
+			return errors.Wrap(err, "writing CSV result")
+		}
+	}
+	writer.Flush()
+	return errors.Wrap(writer.Error(), "writing CSV result")
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestQueryResultWriteJSON(t *testing.T) {
+	results := []*QueryResult{
+		{Bitmap: &BitmapResult{Attributes: map[string]interface{}{"name": "a"}, Bits: []uint64{1, 5}}},
+		{Bitmap: &BitmapResult{}, CountItems: []*CountResultItem{{ID: 5, Count: 10}, {ID: 1, Count: 3}}},
+		{Bitmap: &BitmapResult{}, Count: 42},
+		{Bitmap: &BitmapResult{}, Sum: -10, Count: 2},
+		{Bitmap: &BitmapResult{}},
+		{Kind: ResultKindBitmap},
+		{Kind: ResultKindCount},
+	}
+	targets := []string{
+		`{"attributes":{"name":"a"},"bits":[1,5]}`,
+		`[{"id":5,"count":10},{"id":1,"count":3}]`,
+		`42`,
+		`{"sum":-10,"count":2}`,
+		`null`,
+		`{"attributes":{},"bits":[]}`,
+		`0`,
+	}
+	for i, result := range results {
+		buf := &bytes.Buffer{}
+		if err := result.WriteJSON(buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != targets[i]+"\n" {
+			t.Fatalf("%d: unexpected JSON: %s", i, buf.String())
+		}
+	}
+}
+
+func TestQueryResultWriteCSV(t *testing.T) {
+	results := []*QueryResult{
+		{Bitmap: &BitmapResult{Bits: []uint64{1, 5}}},
+		{Bitmap: &BitmapResult{}, CountItems: []*CountResultItem{{ID: 5, Count: 10}, {ID: 1, Count: 3}}},
+		{Bitmap: &BitmapResult{}, Count: 42},
+		{Bitmap: &BitmapResult{}, Sum: -10, Count: 2},
+		{Bitmap: &BitmapResult{}},
+		{Kind: ResultKindCount},
+	}
+	targets := []string{
+		"1\n5\n",
+		"5,10\n1,3\n",
+		"42\n",
+		"-10,2\n",
+		"",
+		"0\n",
+	}
+	for i, result := range results {
+		buf := &bytes.Buffer{}
+		if err := result.WriteCSV(buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != targets[i] {
+			t.Fatalf("%d: unexpected CSV: %q", i, buf.String())
+		}
+	}
+}
+
+func TestQueryResultWriteFails(t *testing.T) {
+	result := &QueryResult{Bitmap: &BitmapResult{Bits: []uint64{1}}}
+	if err := result.WriteJSON(failingWriter{}); err == nil {
+		t.Fatalf("writing JSON should fail")
+	}
+	if err := result.WriteCSV(failingWriter{}); err == nil {
+		t.Fatalf("writing CSV should fail")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
@@ -0,0 +1,167 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy controls how failed requests are retried.
+// A request is retried if it could not be sent to any of the hosts,
+// or the server responded with one of the retryable status codes.
+// If no status codes are set, errors for which IsRetryable returns true are retried.
+// The delay between attempts grows exponentially, starting from BaseDelay.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. There is no cap if it is 0.
+	MaxDelay time.Duration
+	// Jitter is the fraction of the delay which is randomized, between 0 and 1.
+	Jitter float64
+	// RetryableStatusCodes are the HTTP status codes which cause a retry.
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy returns a retry policy which makes at most 3 attempts
+// and retries on 502, 503 and 504 responses.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+	}
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// delay returns the delay after the given attempt, starting from 1.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxDelay > 0 && delay >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 && delay > 0 {
+		jitter := p.Jitter
+		if jitter > 1 {
+			jitter = 1
+		}
+		randomized := time.Duration(jitter * float64(delay))
+		delay = delay - randomized + time.Duration(rand.Int63n(int64(randomized)+1))
+	}
+	return delay
+}
+
+func (p *RetryPolicy) shouldRetry(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	pilosaErr, ok := errors.Cause(err).(*PilosaError)
+	if !ok || len(p.RetryableStatusCodes) == 0 {
+		return IsRetryable(err)
+	}
+	for _, code := range p.RetryableStatusCodes {
+		if pilosaErr.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// sleepContext waits for the given duration or until the context is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+var writeCalls = map[string]bool{
+	"SetBit":         true,
+	"ClearBit":       true,
+	"SetRowAttrs":    true,
+	"SetColumnAttrs": true,
+	"SetFieldValue":  true,
+}
+
+// isReadOnlyPQL returns true if the query does not modify data on the server.
+// Queries which cannot be parsed are assumed to modify data.
+func isReadOnlyPQL(pql string) bool {
+	// batches of writes usually start with one, so they are not parsed
+	for name := range writeCalls {
+		if strings.HasPrefix(pql, name) && strings.HasPrefix(pql[len(name):], "(") {
+			return false
+		}
+	}
+	calls, err := parsePQL(pql)
+	if err != nil {
+		return false
+	}
+	for _, call := range calls {
+		if writeCalls[call.Name] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	}
+	targets := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+	for i, target := range targets {
+		if delay := policy.delay(i + 1); delay != target {
+			t.Fatalf("attempt %d: %v != %v", i+1, target, delay)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for attempt := 1; attempt <= 5; attempt++ {
+		delay := policy.delay(attempt)
+		if delay < 50*time.Millisecond || delay > time.Second {
+			t.Fatalf("attempt %d: delay out of range: %v", attempt, delay)
+		}
+	}
+}
+
+func TestRetryPolicyShouldRetry(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	ctx := context.Background()
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	serverError := func(code int) error {
+		return &PilosaError{StatusCode: code}
+	}
+	targets := []struct {
+		ctx   context.Context
+		err   error
+		retry bool
+	}{
+		{ctx, nil, false},
+		{ctx, ErrTriedMaxHosts, true},
+		{ctx, ErrEmptyCluster, false},
+		{canceled, ErrTriedMaxHosts, false},
+		{ctx, serverError(http.StatusServiceUnavailable), true},
+		{ctx, serverError(http.StatusBadGateway), true},
+		{ctx, serverError(http.StatusConflict), false},
+		{ctx, serverError(http.StatusBadRequest), false},
+	}
+	for i, target := range targets {
+		if retry := policy.shouldRetry(target.ctx, target.err); retry != target.retry {
+			t.Fatalf("case %d: %v != %v", i, target.retry, retry)
+		}
+	}
+
+	policy = &RetryPolicy{RetryableStatusCodes: []int{http.StatusTooManyRequests}}
+	if !policy.shouldRetry(ctx, serverError(http.StatusTooManyRequests)) {
+		t.Fatalf("status codes of the policy should be retried")
+	}
+	if policy.shouldRetry(ctx, serverError(http.StatusServiceUnavailable)) {
+		t.Fatalf("only status codes of the policy should be retried")
+	}
+	policy = &RetryPolicy{}
+	if !policy.shouldRetry(ctx, serverError(http.StatusServiceUnavailable)) {
+		t.Fatalf("retryable errors should be retried if the policy has no status codes")
+	}
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	var policy *RetryPolicy
+	if policy.maxAttempts() != 1 {
+		t.Fatalf("nil policy should make a single attempt")
+	}
+	policy = &RetryPolicy{MaxAttempts: 5}
+	if policy.maxAttempts() != 5 {
+		t.Fatalf("5 attempts expected")
+	}
+}
+
+func TestIsReadOnlyPQL(t *testing.T) {
+	if !isReadOnlyPQL(sampleFrame.Bitmap(1).serialize()) {
+		t.Fatalf("Bitmap should be read-only")
+	}
+	if !isReadOnlyPQL(sampleIndex.Count(sampleFrame.Bitmap(1)).serialize()) {
+		t.Fatalf("Count should be read-only")
+	}
+	if isReadOnlyPQL(sampleIndex.BatchQuery(sampleFrame.Bitmap(1), sampleFrame.SetBit(1, 2)).serialize()) {
+		t.Fatalf("SetBit should not be read-only")
+	}
+	if isReadOnlyPQL(sampleIndex.BatchQuery(sampleFrame.SetBit(1, 2), sampleFrame.ClearBit(3, 4)).serialize()) {
+		t.Fatalf("batches of writes should not be read-only")
+	}
+	if isReadOnlyPQL("SetBit(") {
+		t.Fatalf("invalid writes should not be read-only")
+	}
+	if !isReadOnlyPQL("Bitmap(rowID=1, frame='SetBit(')") {
+		t.Fatalf("call names in strings should not make the query a write")
+	}
+	if isReadOnlyPQL(sampleIndex.RawQuery("Bitmap(").serialize()) {
+		t.Fatalf("invalid queries should not be read-only")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// schemaCache keeps the schema read from the server for ttl.
+// The cache is disabled if ttl is 0.
+type schemaCache struct {
+	mutex   sync.Mutex
+	ttl     time.Duration
+	schema  *Schema
+	expires time.Time
+}
+
+func newSchemaCache(ttl time.Duration) *schemaCache {
+	return &schemaCache{ttl: ttl}
+}
+
+// get returns a copy of the cached schema, or nil if there is no schema or it is expired.
+func (s *schemaCache) get() *Schema {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.schema == nil || time.Now().After(s.expires) {
+		return nil
+	}
+	return s.schema.copy()
+}
+
+func (s *schemaCache) set(schema *Schema) {
+	if s.ttl <= 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.schema = schema.copy()
+	s.expires = time.Now().Add(s.ttl)
+}
+
+func (s *schemaCache) invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.schema = nil
+}
+
+// nameCache keeps the names of the indexes and frames which are known to exist on the server.
+// Only existence is cached; a name which is not in the cache is looked up on the server,
+// since it may be created by another client.
+type nameCache struct {
+	mutex   sync.RWMutex
+	indexes map[string]map[string]struct{}
+}
+
+func newNameCache() *nameCache {
+	return &nameCache{
+		indexes: map[string]map[string]struct{}{},
+	}
+}
+
+// update replaces the cached names with the indexes and frames in the status.
+func (n *nameCache) update(status *Status) {
+	indexes := map[string]map[string]struct{}{}
+	if len(status.Nodes) > 0 {
+		for _, index := range status.Nodes[0].Indexes {
+			frames := map[string]struct{}{}
+			for _, frame := range index.Frames {
+				frames[frame.Name] = struct{}{}
+			}
+			indexes[index.Name] = frames
+		}
+	}
+	n.mutex.Lock()
+	n.indexes = indexes
+	n.mutex.Unlock()
+}
+
+func (n *nameCache) indexNames() []string {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	names := make([]string, 0, len(n.indexes))
+	for name := range n.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (n *nameCache) hasIndex(index string) bool {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	_, ok := n.indexes[index]
+	return ok
+}
+
+func (n *nameCache) hasFrame(index string, frame string) bool {
+	n.mutex.RLock()
+	defer n.mutex.RUnlock()
+	_, ok := n.indexes[index][frame]
+	return ok
+}
+
+func (n *nameCache) addIndex(index string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if _, ok := n.indexes[index]; !ok {
+		n.indexes[index] = map[string]struct{}{}
+	}
+}
+
+func (n *nameCache) addFrame(index string, frame string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	frames, ok := n.indexes[index]
+	if !ok {
+		frames = map[string]struct{}{}
+		n.indexes[index] = frames
+	}
+	frames[frame] = struct{}{}
+}
+
+func (n *nameCache) removeIndex(index string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.indexes, index)
+}
+
+func (n *nameCache) removeFrame(index string, frame string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	delete(n.indexes[index], frame)
+}
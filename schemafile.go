@@ -0,0 +1,150 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// schemaFile is the JSON representation of a schema used by SaveTo and LoadSchema.
+type schemaFile struct {
+	Indexes []schemaFileIndex `json:"indexes"`
+}
+
+type schemaFileIndex struct {
+	Name        string            `json:"name"`
+	ColumnLabel string            `json:"columnLabel,omitempty"`
+	TimeQuantum TimeQuantum       `json:"timeQuantum,omitempty"`
+	Frames      []schemaFileFrame `json:"frames"`
+}
+
+type schemaFileFrame struct {
+	Name           string      `json:"name"`
+	RowLabel       string      `json:"rowLabel,omitempty"`
+	TimeQuantum    TimeQuantum `json:"timeQuantum,omitempty"`
+	InverseEnabled bool        `json:"inverseEnabled,omitempty"`
+	CacheType      CacheType   `json:"cacheType,omitempty"`
+	CacheSize      uint        `json:"cacheSize,omitempty"`
+	RangeEnabled   bool        `json:"rangeEnabled,omitempty"`
+	Fields         []FieldInfo `json:"fields,omitempty"`
+}
+
+// SaveTo writes the schema to w as JSON.
+// Indexes and frames are sorted by name, so the output is suitable for keeping in version control.
+func (s *Schema) SaveTo(w io.Writer) error {
+	file := schemaFile{Indexes: []schemaFileIndex{}}
+	indexNames := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		indexNames = append(indexNames, name)
+	}
+	sort.Strings(indexNames)
+	for _, indexName := range indexNames {
+		index := s.indexes[indexName]
+		fileIndex := schemaFileIndex{
+			Name:        index.name,
+			ColumnLabel: index.options.ColumnLabel,
+			TimeQuantum: index.options.TimeQuantum,
+			Frames:      []schemaFileFrame{},
+		}
+		frameNames := make([]string, 0, len(index.frames))
+		for name := range index.frames {
+			frameNames = append(frameNames, name)
+		}
+		sort.Strings(frameNames)
+		for _, frameName := range frameNames {
+			options := index.frames[frameName].options
+			fileIndex.Frames = append(fileIndex.Frames, schemaFileFrame{
+				Name:           frameName,
+				RowLabel:       options.RowLabel,
+				TimeQuantum:    options.TimeQuantum,
+				InverseEnabled: options.InverseEnabled,
+				CacheType:      options.CacheType,
+				CacheSize:      options.CacheSize,
+				RangeEnabled:   options.RangeEnabled,
+				Fields:         options.Fields(),
+			})
+		}
+		file.Indexes = append(file.Indexes, fileIndex)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshaling schema")
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return errors.Wrap(err, "writing schema")
+}
+
+// LoadSchema reads a schema written by SaveTo from r.
+// The loaded schema can be passed to SyncSchema to create the indexes and frames on the server.
+func LoadSchema(r io.Reader) (*Schema, error) {
+	file := schemaFile{}
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, errors.Wrap(err, "decoding schema")
+	}
+	schema := NewSchema()
+	for _, fileIndex := range file.Indexes {
+		index, err := schema.Index(fileIndex.Name, &IndexOptions{
+			ColumnLabel: fileIndex.ColumnLabel,
+			TimeQuantum: fileIndex.TimeQuantum,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading index %s", fileIndex.Name)
+		}
+		for _, fileFrame := range fileIndex.Frames {
+			options := &FrameOptions{
+				RowLabel:       fileFrame.RowLabel,
+				TimeQuantum:    fileFrame.TimeQuantum,
+				InverseEnabled: fileFrame.InverseEnabled,
+				CacheType:      fileFrame.CacheType,
+				CacheSize:      fileFrame.CacheSize,
+				RangeEnabled:   fileFrame.RangeEnabled,
+			}
+			for _, field := range fileFrame.Fields {
+				if field.Type != "int" {
+					return nil, errors.Errorf("loading frame %s: unknown field type: %s", fileFrame.Name, field.Type)
+				}
+				if err := options.AddIntField(field.Name, int(field.Min), int(field.Max)); err != nil {
+					return nil, errors.Wrapf(err, "loading frame %s", fileFrame.Name)
+				}
+			}
+			if _, err := index.Frame(fileFrame.Name, options); err != nil {
+				return nil, errors.Wrapf(err, "loading frame %s", fileFrame.Name)
+			}
+		}
+	}
+	return schema, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSchemaSaveToLoadSchema(t *testing.T) {
+	schema := NewSchema()
+	index, _ := schema.Index("repository", &IndexOptions{TimeQuantum: TimeQuantumYearMonth})
+	index.Frame("stargazer", InverseEnabled(true), TimeQuantumYearMonthDay)
+	index.Frame("language", CacheTypeRanked, CacheSize(1000), IntField("loc", 0, 1000000))
+	other, _ := schema.Index("other", &IndexOptions{ColumnLabel: "user"})
+	other.Frame("frame", nil)
+
+	buf := &bytes.Buffer{}
+	if err := schema.SaveTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	target := `{
+  "indexes": [
+    {
+      "name": "other",
+      "columnLabel": "user",
+      "frames": [
+        {
+          "name": "frame",
+          "rowLabel": "rowID"
+        }
+      ]
+    },
+    {
+      "name": "repository",
+      "columnLabel": "columnID",
+      "timeQuantum": "YM",
+      "frames": [
+        {
+          "name": "language",
+          "rowLabel": "rowID",
+          "cacheType": "ranked",
+          "cacheSize": 1000,
+          "fields": [
+            {
+              "name": "loc",
+              "type": "int",
+              "min": 0,
+              "max": 1000000
+            }
+          ]
+        },
+        {
+          "name": "stargazer",
+          "rowLabel": "rowID",
+          "timeQuantum": "YMD",
+          "inverseEnabled": true
+        }
+      ]
+    }
+  ]
+}
+`
+	if target != buf.String() {
+		t.Fatalf("%s != %s", target, buf.String())
+	}
+	loaded, err := LoadSchema(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := schema.Diff(loaded); !diff.Empty() {
+		t.Fatalf("the loaded schema should be the same as the saved one: %v", diff)
+	}
+}
+
+func TestLoadSchemaInvalid(t *testing.T) {
+	inputs := []string{
+		`{"indexes": [`,
+		`{"indexes": [{"name": "$invalid"}]}`,
+		`{"indexes": [{"name": "index", "frames": [{"name": "frame", "timeQuantum": "DY"}]}]}`,
+		`{"indexes": [{"name": "index", "frames": [{"name": "frame", "fields": [{"name": "foo", "type": "set"}]}]}]}`,
+		`{"indexes": [{"name": "index", "frames": [{"name": "frame", "fields": [{"name": "foo", "type": "int", "min": 10, "max": 1}]}]}]}`,
+	}
+	for _, input := range inputs {
+		if _, err := LoadSchema(strings.NewReader(input)); err == nil {
+			t.Fatalf("loading should have failed: %s", input)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// SQLBitColumns names the columns of a result set which contain the fields of a bit.
+type SQLBitColumns struct {
+	// RowID is the name of the column which contains the row ID.
+	RowID string
+	// ColumnID is the name of the column which contains the column ID.
+	ColumnID string
+	// Timestamp is the name of the column which contains the timestamp, if any.
+	// The column may contain a time.Time or Unix time in seconds. A NULL timestamp is ignored.
+	Timestamp string
+}
+
+// sqlRows is the subset of *sql.Rows used by SQLBitIterator.
+type sqlRows interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+// SQLBitIterator reads bits from the rows of a query result.
+// The rows are not closed by the iterator,
+// but database/sql closes them once all of them are read.
+type SQLBitIterator struct {
+	rows      sqlRows
+	row       int
+	values    []interface{}
+	dest      []interface{}
+	rowID     int
+	columnID  int
+	timestamp int
+}
+
+// NewSQLBitIterator creates a SQLBitIterator from the rows of a query result.
+// It returns an error if the row ID or column ID columns are not in the result set.
+func NewSQLBitIterator(rows *sql.Rows, columns SQLBitColumns) (*SQLBitIterator, error) {
+	return newSQLBitIterator(rows, columns)
+}
+
+func newSQLBitIterator(rows sqlRows, columns SQLBitColumns) (*SQLBitIterator, error) {
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	it := &SQLBitIterator{
+		rows:      rows,
+		values:    make([]interface{}, len(names)),
+		dest:      make([]interface{}, len(names)),
+		rowID:     -1,
+		columnID:  -1,
+		timestamp: -1,
+	}
+	for i, name := range names {
+		it.dest[i] = &it.values[i]
+		switch name {
+		case columns.RowID:
+			it.rowID = i
+		case columns.ColumnID:
+			it.columnID = i
+		case columns.Timestamp:
+			it.timestamp = i
+		}
+	}
+	if it.rowID < 0 {
+		return nil, fmt.Errorf("Row ID column not found: %s", columns.RowID)
+	}
+	if it.columnID < 0 {
+		return nil, fmt.Errorf("Column ID column not found: %s", columns.ColumnID)
+	}
+	if columns.Timestamp != "" && it.timestamp < 0 {
+		return nil, fmt.Errorf("Timestamp column not found: %s", columns.Timestamp)
+	}
+	return it, nil
+}
+
+// NextBit scans the next row of the result.
+// Returns io.EOF on end of iteration.
+func (s *SQLBitIterator) NextBit() (Bit, error) {
+	if !s.rows.Next() {
+		if err := s.rows.Err(); err != nil {
+			return Bit{}, err
+		}
+		return Bit{}, io.EOF
+	}
+	s.row++
+	if err := s.rows.Scan(s.dest...); err != nil {
+		return Bit{}, err
+	}
+	rowID, err := sqlValueToUint64(s.values[s.rowID])
+	if err != nil {
+		return Bit{}, newRecordError(s.row, "Invalid row ID at row")
+	}
+	columnID, err := sqlValueToUint64(s.values[s.columnID])
+	if err != nil {
+		return Bit{}, newRecordError(s.row, "Invalid column ID at row")
+	}
+	var timestamp int64
+	if s.timestamp >= 0 {
+		timestamp, err = sqlValueToTimestamp(s.values[s.timestamp])
+		if err != nil {
+			return Bit{}, newRecordError(s.row, "Invalid timestamp at row")
+		}
+	}
+	return Bit{RowID: rowID, ColumnID: columnID, Timestamp: timestamp}, nil
+}
+
+// sqlValueToUint64 converts the value of an integer column, as returned by the driver.
+func sqlValueToUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return 0, fmt.Errorf("negative value: %d", v)
+		}
+		return uint64(v), nil
+	case []byte:
+		return strconv.ParseUint(string(v), 10, 64)
+	case string:
+		return strconv.ParseUint(v, 10, 64)
+	}
+	return 0, fmt.Errorf("unsupported value: %v", value)
+}
+
+// sqlValueToTimestamp converts the value of a timestamp column to Unix time in seconds.
+func sqlValueToTimestamp(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case nil:
+		return 0, nil
+	case time.Time:
+		return v.Unix(), nil
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("unsupported value: %v", value)
+}
@@ -0,0 +1,149 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type fakeSQLRows struct {
+	columns []string
+	rows    [][]interface{}
+	index   int
+	err     error
+}
+
+func (r *fakeSQLRows) Columns() ([]string, error) {
+	return r.columns, nil
+}
+
+func (r *fakeSQLRows) Next() bool {
+	if r.index >= len(r.rows) {
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *fakeSQLRows) Scan(dest ...interface{}) error {
+	for i, value := range r.rows[r.index-1] {
+		*dest[i].(*interface{}) = value
+	}
+	return nil
+}
+
+func (r *fakeSQLRows) Err() error {
+	return r.err
+}
+
+func TestSQLBitIterator(t *testing.T) {
+	rows := &fakeSQLRows{
+		columns: []string{"name", "user_id", "product_id", "created_at"},
+		rows: [][]interface{}{
+			{"first", int64(10), int64(1), time.Unix(683793200, 0)},
+			{"second", []byte("20"), "2", nil},
+			{"third", int64(30), int64(3), int64(683793385)},
+		},
+	}
+	it, err := newSQLBitIterator(rows, SQLBitColumns{RowID: "product_id", ColumnID: "user_id", Timestamp: "created_at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits := []Bit{}
+	for {
+		bit, err := it.NextBit()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		bits = append(bits, bit)
+	}
+	target := []Bit{
+		{RowID: 1, ColumnID: 10, Timestamp: 683793200},
+		{RowID: 2, ColumnID: 20},
+		{RowID: 3, ColumnID: 30, Timestamp: 683793385},
+	}
+	if !reflect.DeepEqual(target, bits) {
+		t.Fatalf("%v != %v", target, bits)
+	}
+}
+
+func TestSQLBitIteratorMissingColumns(t *testing.T) {
+	rows := &fakeSQLRows{columns: []string{"row", "col"}}
+	invalid := []SQLBitColumns{
+		{RowID: "row_id", ColumnID: "col"},
+		{RowID: "row", ColumnID: "column_id"},
+		{RowID: "row", ColumnID: "col", Timestamp: "ts"},
+	}
+	for i, columns := range invalid {
+		if _, err := newSQLBitIterator(rows, columns); err == nil {
+			t.Fatalf("%d: should have failed", i)
+		}
+	}
+}
+
+func TestSQLBitIteratorInvalidValues(t *testing.T) {
+	invalid := [][]interface{}{
+		{nil, int64(1), nil},
+		{int64(-1), int64(1), nil},
+		{int64(1), "x", nil},
+		{int64(1), int64(1), 1.5},
+	}
+	for i, row := range invalid {
+		rows := &fakeSQLRows{columns: []string{"row", "col", "ts"}, rows: [][]interface{}{row}}
+		it, err := newSQLBitIterator(rows, SQLBitColumns{RowID: "row", ColumnID: "col", Timestamp: "ts"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := it.NextBit(); err == nil || err == io.EOF {
+			t.Fatalf("%d: should have failed, got %v", i, err)
+		}
+	}
+}
+
+func TestSQLBitIteratorRowsError(t *testing.T) {
+	rowsErr := errors.New("connection lost")
+	rows := &fakeSQLRows{columns: []string{"row", "col"}, err: rowsErr}
+	it, err := newSQLBitIterator(rows, SQLBitColumns{RowID: "row", ColumnID: "col"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := it.NextBit(); err != rowsErr {
+		t.Fatalf("the error of the rows expected, got %v", err)
+	}
+}
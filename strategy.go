@@ -0,0 +1,237 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Strategy selects the host to send a request to.
+type Strategy interface {
+	// Select returns the position of the host to use in hosts.
+	// hosts contains the available hosts in the order they were added to the cluster, and is never empty.
+	// key is the name of the index the request is about, or empty if the request is not about an index.
+	Select(hosts []*URI, key string) int
+}
+
+// WeightedStrategy is implemented by strategies which take the weights of the hosts into account.
+// SelectWeighted is used instead of Select if the available hosts do not all have the same weight.
+type WeightedStrategy interface {
+	// SelectWeighted is like Select, weights contains the positive weight of each host in hosts.
+	SelectWeighted(hosts []*URI, weights []int, key string) int
+}
+
+// RequestTracker is implemented by strategies which track the requests in flight.
+type RequestTracker interface {
+	RequestStarted(host *URI)
+	RequestFinished(host *URI)
+}
+
+// NewRoundRobinStrategy returns a strategy which selects the hosts in turn.
+// Hosts with larger weights are selected more often, interleaved with the others.
+// This is the default strategy.
+func NewRoundRobinStrategy() Strategy {
+	return &roundRobinStrategy{position: -1}
+}
+
+type roundRobinStrategy struct {
+	mutex    sync.Mutex
+	last     *URI
+	position int
+	// current contains the current weights of the hosts for weighted selection
+	current map[string]int
+}
+
+func (s *roundRobinStrategy) Select(hosts []*URI, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	next := 0
+	if s.last != nil {
+		// find the last selected host, since hosts may have been added or removed since then
+		next = s.position
+		if next < len(hosts) && hosts[next].Equals(s.last) {
+			next++
+		} else {
+			for i, host := range hosts {
+				if host.Equals(s.last) {
+					next = i + 1
+					break
+				}
+			}
+		}
+	}
+	next %= len(hosts)
+	s.last = hosts[next]
+	s.position = next
+	return next
+}
+
+// SelectWeighted uses smooth weighted round robin,
+// so a host with weight 3 is not selected three times in a row.
+func (s *roundRobinStrategy) SelectWeighted(hosts []*URI, weights []int, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	current := make(map[string]int, len(hosts))
+	total := 0
+	selected := 0
+	for i, host := range hosts {
+		k := host.Normalize()
+		current[k] = s.current[k] + weights[i]
+		total += weights[i]
+		if current[k] > current[hosts[selected].Normalize()] {
+			selected = i
+		}
+	}
+	current[hosts[selected].Normalize()] -= total
+	s.current = current
+	s.last = hosts[selected]
+	s.position = selected
+	return selected
+}
+
+// NewRandomStrategy returns a strategy which selects a random host.
+func NewRandomStrategy() Strategy {
+	return &randomStrategy{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+type randomStrategy struct {
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func (s *randomStrategy) Select(hosts []*URI, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.rand.Intn(len(hosts))
+}
+
+func (s *randomStrategy) SelectWeighted(hosts []*URI, weights []int, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	total := 0
+	for _, weight := range weights {
+		total += weight
+	}
+	n := s.rand.Intn(total)
+	for i, weight := range weights {
+		if n < weight {
+			return i
+		}
+		n -= weight
+	}
+	return len(hosts) - 1
+}
+
+// NewLeastOutstandingStrategy returns a strategy which selects the host with the fewest requests in flight.
+// If the hosts have weights, the number of requests in flight is divided by the weight of the host.
+func NewLeastOutstandingStrategy() Strategy {
+	return &leastOutstandingStrategy{
+		outstanding: map[string]int{},
+		roundRobin:  NewRoundRobinStrategy(),
+	}
+}
+
+type leastOutstandingStrategy struct {
+	mutex       sync.Mutex
+	outstanding map[string]int
+	roundRobin  Strategy
+}
+
+func (s *leastOutstandingStrategy) Select(hosts []*URI, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// start from a different host each time, so ties are broken in turn
+	start := s.roundRobin.Select(hosts, key)
+	selected := start
+	for i := range hosts {
+		idx := (start + i) % len(hosts)
+		if s.outstanding[hosts[idx].Normalize()] < s.outstanding[hosts[selected].Normalize()] {
+			selected = idx
+		}
+	}
+	return selected
+}
+
+func (s *leastOutstandingStrategy) SelectWeighted(hosts []*URI, weights []int, key string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	start := s.roundRobin.Select(hosts, key)
+	selected := start
+	for i := range hosts {
+		idx := (start + i) % len(hosts)
+		// compare outstanding[idx] / weights[idx] < outstanding[selected] / weights[selected]
+		if s.outstanding[hosts[idx].Normalize()]*weights[selected] < s.outstanding[hosts[selected].Normalize()]*weights[idx] {
+			selected = idx
+		}
+	}
+	return selected
+}
+
+func (s *leastOutstandingStrategy) RequestStarted(host *URI) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.outstanding[host.Normalize()]++
+}
+
+func (s *leastOutstandingStrategy) RequestFinished(host *URI) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	key := host.Normalize()
+	s.outstanding[key]--
+	if s.outstanding[key] <= 0 {
+		delete(s.outstanding, key)
+	}
+}
+
+// NewStickyStrategy returns a strategy which sends the requests about an index to the same host,
+// as long as the available hosts do not change.
+// Other requests are sent to the hosts in turn.
+func NewStickyStrategy() Strategy {
+	return &stickyStrategy{roundRobin: NewRoundRobinStrategy()}
+}
+
+type stickyStrategy struct {
+	roundRobin Strategy
+}
+
+func (s *stickyStrategy) Select(hosts []*URI, key string) int {
+	if key == "" {
+		return s.roundRobin.Select(hosts, key)
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(hosts)))
+}
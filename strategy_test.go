@@ -0,0 +1,193 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"testing"
+)
+
+func strategyHosts() []*URI {
+	return []*URI{
+		URIFromAddress("index1.pilosa.com:10101"),
+		URIFromAddress("index2.pilosa.com:10101"),
+		URIFromAddress("index3.pilosa.com:10101"),
+	}
+}
+
+func TestRoundRobinStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	strategy := NewRoundRobinStrategy()
+	for i, target := range []int{0, 1, 2, 0, 1} {
+		if selected := strategy.Select(hosts, ""); selected != target {
+			t.Fatalf("selection %d: %d != %d", i, target, selected)
+		}
+	}
+	// the last selected host was index2, so index3 comes next even if index1 is gone
+	if selected := strategy.Select(hosts[1:], ""); selected != 1 {
+		t.Fatalf("1 != %d", selected)
+	}
+}
+
+func TestRandomStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	strategy := NewRandomStrategy()
+	for i := 0; i < 100; i++ {
+		if selected := strategy.Select(hosts, ""); selected < 0 || selected >= len(hosts) {
+			t.Fatalf("selection out of range: %d", selected)
+		}
+	}
+}
+
+func TestLeastOutstandingStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	strategy := NewLeastOutstandingStrategy()
+	tracker := strategy.(RequestTracker)
+	tracker.RequestStarted(hosts[0])
+	tracker.RequestStarted(hosts[0])
+	tracker.RequestStarted(hosts[1])
+	for i := 0; i < 3; i++ {
+		if selected := strategy.Select(hosts, ""); selected != 2 {
+			t.Fatalf("the host without requests should be selected, got %d", selected)
+		}
+	}
+	tracker.RequestStarted(hosts[2])
+	tracker.RequestStarted(hosts[2])
+	tracker.RequestFinished(hosts[1])
+	if selected := strategy.Select(hosts, ""); selected != 1 {
+		t.Fatalf("the host with the fewest requests should be selected, got %d", selected)
+	}
+}
+
+func TestStickyStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	strategy := NewStickyStrategy()
+	first := strategy.Select(hosts, "repository")
+	for i := 0; i < 5; i++ {
+		if selected := strategy.Select(hosts, "repository"); selected != first {
+			t.Fatalf("requests for the same index should go to the same host")
+		}
+	}
+	if strategy.Select(hosts, "") == strategy.Select(hosts, "") {
+		t.Fatalf("requests without an index should go to the hosts in turn")
+	}
+}
+
+func TestClusterWithStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	c := NewClusterWithStrategy(NewStickyStrategy(), hosts...)
+	host := c.hostFor("repository", defaultBreakerSettings)
+	for i := 0; i < 5; i++ {
+		if !c.hostFor("repository", defaultBreakerSettings).Equals(host) {
+			t.Fatalf("the cluster should use its strategy")
+		}
+	}
+}
+
+func TestWeightedRoundRobinStrategy(t *testing.T) {
+	hosts := strategyHosts()[:2]
+	strategy := NewRoundRobinStrategy().(WeightedStrategy)
+	for i, target := range []int{0, 0, 1, 0, 0, 0, 1, 0} {
+		if selected := strategy.SelectWeighted(hosts, []int{3, 1}, ""); selected != target {
+			t.Fatalf("selection %d: %d != %d", i, target, selected)
+		}
+	}
+}
+
+func TestWeightedRandomStrategy(t *testing.T) {
+	hosts := strategyHosts()
+	strategy := NewRandomStrategy().(WeightedStrategy)
+	counts := make([]int, len(hosts))
+	for i := 0; i < 1000; i++ {
+		counts[strategy.SelectWeighted(hosts, []int{8, 1, 1}, "")]++
+	}
+	if counts[0] < counts[1] || counts[0] < counts[2] {
+		t.Fatalf("the host with the largest weight should be selected most often: %v", counts)
+	}
+}
+
+func TestWeightedLeastOutstandingStrategy(t *testing.T) {
+	hosts := strategyHosts()[:2]
+	strategy := NewLeastOutstandingStrategy()
+	tracker := strategy.(RequestTracker)
+	tracker.RequestStarted(hosts[0])
+	tracker.RequestStarted(hosts[0])
+	tracker.RequestStarted(hosts[1])
+	if selected := strategy.(WeightedStrategy).SelectWeighted(hosts, []int{4, 1}, ""); selected != 0 {
+		t.Fatalf("the host with the fewest requests per weight should be selected, got %d", selected)
+	}
+}
+
+func TestClusterWithWeights(t *testing.T) {
+	hosts := strategyHosts()
+	c := NewClusterWithHost()
+	c.AddHostWithWeight(hosts[0], 1)
+	c.AddHostWithWeight(hosts[1], 2)
+	c.AddHostWithWeight(hosts[2], 0)
+	counts := map[string]int{}
+	for i := 0; i < 30; i++ {
+		counts[c.Host().HostPort()]++
+	}
+	if counts[hosts[0].HostPort()] != 10 || counts[hosts[1].HostPort()] != 20 {
+		t.Fatalf("hosts should be selected according to their weight: %v", counts)
+	}
+	if counts[hosts[2].HostPort()] != 0 {
+		t.Fatalf("the host with weight 0 should not be selected while others are available")
+	}
+	c.hostFailed(hosts[0], defaultBreakerSettings)
+	c.hostFailed(hosts[1], defaultBreakerSettings)
+	if host := c.Host(); !host.Equals(hosts[2]) {
+		t.Fatalf("the host with weight 0 should be selected when the others are down")
+	}
+	// setting the weight of an existing host does not add it again
+	c.AddHostWithWeight(hosts[2], 5)
+	statuses := c.HostStatus()
+	if len(statuses) != 3 || statuses[2].Weight != 5 || statuses[0].Weight != 1 {
+		t.Fatalf("unexpected host status: %v", statuses)
+	}
+}
+
+func TestIndexFromPath(t *testing.T) {
+	targets := map[string]string{
+		"/index/repository/query":           "repository",
+		"/index/repository":                 "repository",
+		"/index/repository/frame/stargazer": "repository",
+		"/index/repository?timeQuantum=YM":  "repository",
+		"/status":                           "",
+		"/export?index=repository&slice=0":  "",
+	}
+	for path, target := range targets {
+		if name := indexFromPath(path); name != target {
+			t.Fatalf("%s: %s != %s", path, target, name)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// StructMapping maps the fields of a struct type to the frames and integer fields of an index
+// using `pilosa` struct tags. A tag is a comma separated list of options:
+//
+//	type Star struct {
+//		RepoID    uint64    `pilosa:"column"`
+//		UserID    uint64    `pilosa:"frame=stargazer,row=userID,inverse"`
+//		StarredAt time.Time `pilosa:"timestamp"`
+//		Stars     int64     `pilosa:"frame=stats,field=stars,min=0,max=1000000"`
+//	}
+//
+// The column option marks the field which contains the column ID, and the timestamp option marks the
+// time.Time field which contains the timestamp of the bits. Fields with a frame option contain the row ID
+// of a bit in that frame; row sets the row label and inverse enables the inverse view of the frame.
+// Fields with frame and field options contain the value of an integer field, whose range is set by min and max.
+// Struct fields without a tag are ignored.
+type StructMapping struct {
+	typ       reflect.Type
+	column    int
+	timestamp int
+	rows      []structRowMapping
+	values    []structValueMapping
+}
+
+type structRowMapping struct {
+	field int
+	frame *Frame
+}
+
+type structValueMapping struct {
+	field int
+	frame *Frame
+	name  string
+}
+
+type structFrameMapping struct {
+	name    string
+	options *FrameOptions
+}
+
+// NewStructMapping creates a StructMapping for the type of the given struct or struct pointer.
+// The frames and integer fields in the tags are added to the index, so they are created on the server
+// with SyncSchema.
+func NewStructMapping(index *Index, v interface{}) (*StructMapping, error) {
+	typ := reflect.TypeOf(v)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, ErrInvalidStructMapping
+	}
+	mapping := &StructMapping{
+		typ:       typ,
+		column:    -1,
+		timestamp: -1,
+	}
+	frames := []*structFrameMapping{}
+	frameMappings := map[string]*structFrameMapping{}
+	rowFields := map[int]string{}
+	valueFields := map[int][2]string{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, ok := field.Tag.Lookup("pilosa")
+		if !ok || tag == "" || tag == "-" {
+			continue
+		}
+		options, err := parseStructTag(tag)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parsing tag of %s", field.Name)
+		}
+		switch {
+		case options["column"] != "":
+			if mapping.column >= 0 || !isUintKind(field.Type.Kind()) {
+				return nil, errors.Wrapf(ErrInvalidStructMapping, "column field %s", field.Name)
+			}
+			mapping.column = i
+		case options["timestamp"] != "":
+			if mapping.timestamp >= 0 || field.Type != timeType {
+				return nil, errors.Wrapf(ErrInvalidStructMapping, "timestamp field %s", field.Name)
+			}
+			mapping.timestamp = i
+		case options["frame"] != "":
+			frameName := options["frame"]
+			frameMapping, ok := frameMappings[frameName]
+			if !ok {
+				frameMapping = &structFrameMapping{name: frameName, options: &FrameOptions{}}
+				frameMappings[frameName] = frameMapping
+				frames = append(frames, frameMapping)
+			}
+			if fieldName := options["field"]; fieldName != "" {
+				if !isIntKind(field.Type.Kind()) && !isUintKind(field.Type.Kind()) {
+					return nil, errors.Wrapf(ErrInvalidStructMapping, "integer field %s", field.Name)
+				}
+				min, minErr := strconv.Atoi(options["min"])
+				max, maxErr := strconv.Atoi(options["max"])
+				if minErr != nil || maxErr != nil {
+					return nil, errors.Wrapf(ErrInvalidStructMapping, "min and max of integer field %s", field.Name)
+				}
+				if err := frameMapping.options.AddIntField(fieldName, min, max); err != nil {
+					return nil, errors.Wrapf(err, "integer field %s", field.Name)
+				}
+				valueFields[i] = [2]string{frameName, fieldName}
+				continue
+			}
+			if !isIntKind(field.Type.Kind()) && !isUintKind(field.Type.Kind()) {
+				return nil, errors.Wrapf(ErrInvalidStructMapping, "row field %s", field.Name)
+			}
+			if rowLabel := options["row"]; rowLabel != "" {
+				frameMapping.options.RowLabel = rowLabel
+			}
+			if options["inverse"] != "" {
+				frameMapping.options.InverseEnabled = true
+			}
+			rowFields[i] = frameName
+		default:
+			return nil, errors.Wrapf(ErrInvalidStructMapping, "tag of %s", field.Name)
+		}
+	}
+	if mapping.column < 0 {
+		return nil, errors.Wrap(ErrInvalidStructMapping, "no column field")
+	}
+	created := map[string]*Frame{}
+	for _, frameMapping := range frames {
+		frame, err := index.Frame(frameMapping.name, frameMapping.options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "creating frame %s", frameMapping.name)
+		}
+		// the frame may already be in the index, make sure it has the fields
+		for name, field := range frameMapping.options.fields {
+			if _, ok := frame.options.fields[name]; !ok {
+				frame.options.fields = copyFields(frame.options.fields)
+				frame.options.fields[name] = field
+			}
+		}
+		created[frameMapping.name] = frame
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		if frameName, ok := rowFields[i]; ok {
+			mapping.rows = append(mapping.rows, structRowMapping{field: i, frame: created[frameName]})
+		} else if names, ok := valueFields[i]; ok {
+			mapping.values = append(mapping.values, structValueMapping{field: i, frame: created[names[0]], name: names[1]})
+		}
+	}
+	return mapping, nil
+}
+
+// Bits returns the bits for the given frame from a slice of structs or struct pointers.
+func (m *StructMapping) Bits(frame *Frame, records interface{}) ([]Bit, error) {
+	bits := []Bit{}
+	err := m.iterate(records, func(record reflect.Value, columnID uint64) error {
+		for _, row := range m.rows {
+			if row.frame.name != frame.name {
+				continue
+			}
+			rowID, err := structFieldUint(record.Field(row.field))
+			if err != nil {
+				return errors.Wrapf(err, "field %s", m.typ.Field(row.field).Name)
+			}
+			bit := Bit{RowID: rowID, ColumnID: columnID}
+			if m.timestamp >= 0 {
+				if timestamp := record.Field(m.timestamp).Interface().(time.Time); !timestamp.IsZero() {
+					bit.Timestamp = timestamp.Unix()
+				}
+			}
+			bits = append(bits, bit)
+		}
+		return nil
+	})
+	return bits, err
+}
+
+// Values returns the values of an integer field of the given frame from a slice of structs or struct pointers.
+func (m *StructMapping) Values(frame *Frame, field string, records interface{}) ([]FieldValue, error) {
+	values := []FieldValue{}
+	err := m.iterate(records, func(record reflect.Value, columnID uint64) error {
+		for _, value := range m.values {
+			if value.frame.name != frame.name || value.name != field {
+				continue
+			}
+			v, err := structFieldInt(record.Field(value.field))
+			if err != nil {
+				return errors.Wrapf(err, "field %s", m.typ.Field(value.field).Name)
+			}
+			values = append(values, FieldValue{ColumnID: columnID, Value: v})
+		}
+		return nil
+	})
+	return values, err
+}
+
+func (m *StructMapping) iterate(records interface{}, fn func(record reflect.Value, columnID uint64) error) error {
+	slice := reflect.ValueOf(records)
+	if slice.Kind() != reflect.Slice {
+		return ErrInvalidStructMapping
+	}
+	for i := 0; i < slice.Len(); i++ {
+		record := slice.Index(i)
+		if record.Kind() == reflect.Ptr {
+			if record.IsNil() {
+				continue
+			}
+			record = record.Elem()
+		}
+		if record.Type() != m.typ {
+			return errors.Wrapf(ErrInvalidStructMapping, "record %d has type %s", i, record.Type())
+		}
+		if err := fn(record, record.Field(m.column).Uint()); err != nil {
+			return errors.Wrapf(err, "record %d", i)
+		}
+	}
+	return nil
+}
+
+// ImportStructs imports the bits and integer field values in a slice of structs or struct pointers
+// using the given mapping. Each frame and field is imported with batches of batchSize.
+func (c *Client) ImportStructs(mapping *StructMapping, records interface{}, batchSize uint, options ...interface{}) error {
+	return c.ImportStructsWithContext(context.Background(), mapping, records, batchSize, options...)
+}
+
+// ImportStructsWithContext imports the bits and integer field values in a slice of structs or struct pointers
+// using the given mapping. The import stops with an error if the context is canceled.
+func (c *Client) ImportStructsWithContext(ctx context.Context, mapping *StructMapping, records interface{}, batchSize uint, options ...interface{}) error {
+	imported := map[string]bool{}
+	for _, row := range mapping.rows {
+		if imported[row.frame.name] {
+			continue
+		}
+		imported[row.frame.name] = true
+		bits, err := mapping.Bits(row.frame, records)
+		if err != nil {
+			return err
+		}
+		err = c.ImportFrameWithContext(ctx, row.frame, NewSliceBitIterator(bits), batchSize, options...)
+		if err != nil {
+			return errors.Wrapf(err, "importing frame %s", row.frame.name)
+		}
+	}
+	for _, value := range mapping.values {
+		values, err := mapping.Values(value.frame, value.name, records)
+		if err != nil {
+			return err
+		}
+		err = c.ImportValueFrameWithContext(ctx, value.frame, value.name, NewSliceValueIterator(values), batchSize, options...)
+		if err != nil {
+			return errors.Wrapf(err, "importing field %s of frame %s", value.name, value.frame.name)
+		}
+	}
+	return nil
+}
+
+// parseStructTag returns the options in a tag. Options without a value, such as column, are set to their names.
+func parseStructTag(tag string) (map[string]string, error) {
+	options := map[string]string{}
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		key, value := part, part
+		if i := strings.Index(part, "="); i >= 0 {
+			key, value = part[:i], part[i+1:]
+		}
+		switch key {
+		case "column", "timestamp", "inverse", "frame", "row", "field", "min", "max":
+		default:
+			return nil, errors.Wrapf(ErrInvalidStructMapping, "unknown tag option %s", key)
+		}
+		if value == "" {
+			return nil, errors.Wrapf(ErrInvalidStructMapping, "empty tag option %s", key)
+		}
+		options[key] = value
+	}
+	return options, nil
+}
+
+func structFieldUint(v reflect.Value) (uint64, error) {
+	if isUintKind(v.Kind()) {
+		return v.Uint(), nil
+	}
+	if n := v.Int(); n >= 0 {
+		return uint64(n), nil
+	}
+	return 0, errors.New("row ID should not be negative")
+}
+
+func structFieldInt(v reflect.Value) (int64, error) {
+	if isIntKind(v.Kind()) {
+		return v.Int(), nil
+	}
+	if n := v.Uint(); n <= 1<<63-1 {
+		return int64(n), nil
+	}
+	return 0, errors.New("value is out of the int64 range")
+}
+
+func isIntKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return true
+	}
+	return false
+}
+
+func isUintKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
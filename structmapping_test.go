@@ -0,0 +1,190 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type starRecord struct {
+	RepoID    uint64    `pilosa:"column"`
+	UserID    uint32    `pilosa:"frame=stargazer,row=userID,inverse"`
+	StarredAt time.Time `pilosa:"timestamp"`
+	Stars     int64     `pilosa:"frame=stats,field=stars,min=0,max=1000000"`
+	Forks     uint16    `pilosa:"frame=stats,field=forks,min=0,max=1000"`
+	Language  int       `pilosa:"frame=language"`
+	Name      string
+}
+
+func TestNewStructMapping(t *testing.T) {
+	index, err := NewIndex("repository", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewStructMapping(index, &starRecord{}); err != nil {
+		t.Fatal(err)
+	}
+	frames := index.Frames()
+	if len(frames) != 3 {
+		t.Fatalf("3 frames should be created, got: %v", frames)
+	}
+	stargazer := frames["stargazer"].FrameOptions()
+	if stargazer.RowLabel != "userID" || !stargazer.InverseEnabled {
+		t.Fatalf("unexpected stargazer options: %v", stargazer)
+	}
+	target := []FieldInfo{
+		{Name: "forks", Type: "int", Min: 0, Max: 1000},
+		{Name: "stars", Type: "int", Min: 0, Max: 1000000},
+	}
+	if fields := frames["stats"].FrameOptions().Fields(); !reflect.DeepEqual(target, fields) {
+		t.Fatalf("%v != %v", target, fields)
+	}
+}
+
+func TestNewStructMappingInvalid(t *testing.T) {
+	type noColumn struct {
+		UserID uint64 `pilosa:"frame=stargazer"`
+	}
+	type signedColumn struct {
+		RepoID int64 `pilosa:"column"`
+	}
+	type unknownOption struct {
+		RepoID uint64 `pilosa:"column"`
+		UserID uint64 `pilosa:"frame=stargazer,color=red"`
+	}
+	type stringRow struct {
+		RepoID uint64 `pilosa:"column"`
+		UserID string `pilosa:"frame=stargazer"`
+	}
+	type noRange struct {
+		RepoID uint64 `pilosa:"column"`
+		Stars  int64  `pilosa:"frame=stats,field=stars"`
+	}
+	type invalidTimestamp struct {
+		RepoID    uint64 `pilosa:"column"`
+		StarredAt int64  `pilosa:"timestamp"`
+	}
+	values := []interface{}{
+		nil, 1, noColumn{}, signedColumn{}, unknownOption{}, stringRow{}, noRange{}, invalidTimestamp{},
+	}
+	for _, v := range values {
+		index, _ := NewIndex("repository", nil)
+		if _, err := NewStructMapping(index, v); err == nil {
+			t.Fatalf("creating the mapping should fail for %T", v)
+		}
+	}
+}
+
+func TestStructMappingBitsAndValues(t *testing.T) {
+	index, _ := NewIndex("repository", nil)
+	mapping, err := NewStructMapping(index, starRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	starredAt := time.Date(2017, time.October, 1, 12, 0, 0, 0, time.UTC)
+	records := []*starRecord{
+		{RepoID: 10, UserID: 1, StarredAt: starredAt, Stars: 100, Forks: 3, Language: 5},
+		nil,
+		{RepoID: 20, UserID: 2, Stars: 5, Language: 6},
+	}
+	stargazer, _ := index.Frame("stargazer")
+	bits, err := mapping.Bits(stargazer, records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetBits := []Bit{
+		{RowID: 1, ColumnID: 10, Timestamp: starredAt.Unix()},
+		{RowID: 2, ColumnID: 20},
+	}
+	if !reflect.DeepEqual(targetBits, bits) {
+		t.Fatalf("%v != %v", targetBits, bits)
+	}
+	stats, _ := index.Frame("stats")
+	values, err := mapping.Values(stats, "stars", records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	targetValues := []FieldValue{{ColumnID: 10, Value: 100}, {ColumnID: 20, Value: 5}}
+	if !reflect.DeepEqual(targetValues, values) {
+		t.Fatalf("%v != %v", targetValues, values)
+	}
+	if _, err = mapping.Bits(stargazer, []int{1}); err == nil {
+		t.Fatalf("converting records of another type should fail")
+	}
+	if _, err = mapping.Bits(stargazer, []starRecord{{Language: -1}}); err != nil {
+		t.Fatalf("negative rows of other frames should not fail: %v", err)
+	}
+	language, _ := index.Frame("language")
+	if _, err = mapping.Bits(language, []starRecord{{Language: -1}}); err == nil {
+		t.Fatalf("negative row IDs should fail")
+	}
+}
+
+func TestImportStructs(t *testing.T) {
+	requested := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		if strings.HasSuffix(req.URL.Path, "/nodes") {
+			body = `[{"scheme":"http","host":"localhost:10101"}]`
+		} else {
+			requested = append(requested, req.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := NewIndex("repository", nil)
+	mapping, err := NewStructMapping(index, starRecord{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []starRecord{{RepoID: 10, UserID: 1, Stars: 100, Forks: 3, Language: 5}}
+	if err = client.ImportStructs(mapping, records, 100); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(requested)
+	target := []string{"/import", "/import", "/import-value", "/import-value"}
+	if !reflect.DeepEqual(target, requested) {
+		t.Fatalf("%v != %v", target, requested)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// clientCertReloader presents the client certificate in a pair of files,
+// and reloads it when either file changes, so rotated certificates are used without restarting the client.
+type clientCertReloader struct {
+	certFile string
+	keyFile  string
+	mutex    *sync.Mutex
+	cert     *tls.Certificate
+	// certState and keyState are the states of the files the certificate was loaded from
+	certState fileState
+	keyState  fileState
+}
+
+// fileState is the modification time and size of a file, which change when it is rewritten.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func newClientCertReloader(certFile string, keyFile string) (*clientCertReloader, error) {
+	r := &clientCertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		mutex:    &sync.Mutex{},
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reload loads the certificate if the files changed since it was loaded.
+// The mutex must be held by the caller, or the reloader not shared yet.
+func (r *clientCertReloader) reload() error {
+	certState, err := statFile(r.certFile)
+	if err != nil {
+		return errors.Wrap(err, "checking client certificate")
+	}
+	keyState, err := statFile(r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "checking client key")
+	}
+	if r.cert != nil && certState == r.certState && keyState == r.keyState {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "loading client certificate")
+	}
+	r.cert = &cert
+	r.certState = certState
+	r.keyState = keyState
+	return nil
+}
+
+// getClientCertificate is used as the GetClientCertificate function of the TLS configuration,
+// so the files are checked for every TLS handshake.
+// If they cannot be loaded, e.g., while only one of them is replaced, the previous certificate is presented,
+// and loading them is tried again in the next handshake.
+func (r *clientCertReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reload()
+	return r.cert, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestClientCertReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+	reloader, err := newClientCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := reloader.getClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, _ := reloader.getClientCertificate(&tls.CertificateRequestInfo{})
+	if same != first {
+		t.Fatalf("the certificate should not be loaded again if the files did not change")
+	}
+
+	// rotate the certificate, making sure the modification times change
+	writeTestCertificate(t, dir)
+	later := time.Now().Add(time.Minute)
+	for _, path := range []string{certFile, keyFile} {
+		if err = os.Chtimes(path, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rotated, _ := reloader.getClientCertificate(&tls.CertificateRequestInfo{})
+	if bytes.Equal(first.Certificate[0], rotated.Certificate[0]) {
+		t.Fatalf("the rotated certificate should be loaded")
+	}
+
+	// a half written key is not loaded
+	if err = ioutil.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	current, err := reloader.getClientCertificate(&tls.CertificateRequestInfo{})
+	if err != nil || current != rotated {
+		t.Fatalf("the previous certificate should be presented if the files cannot be loaded, got %v", err)
+	}
+}
+
+func TestTLSClientCertFilesWithReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go-pilosa-tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCertificate(t, dir)
+	original := &tls.Config{ServerName: "pilosa.local"}
+	options := &ClientOptions{}
+	if err = options.addOptions(TLSConfig(original), TLSClientCertFilesWithReload(certFile, keyFile)); err != nil {
+		t.Fatal(err)
+	}
+	if original.GetClientCertificate != nil {
+		t.Fatalf("the original TLS configuration should not be modified")
+	}
+	if options.TLSConfig.ServerName != "pilosa.local" || options.TLSConfig.GetClientCertificate == nil {
+		t.Fatalf("TLS configuration was not set correctly")
+	}
+
+	missing := filepath.Join(dir, "does-not-exist.pem")
+	for _, option := range []ClientOption{
+		TLSClientCertFilesWithReload(missing, keyFile),
+		TLSClientCertFilesWithReload(certFile, missing),
+		TLSClientCertFilesWithReload(certFile, certFile),
+	} {
+		if _, err := NewClient(":9999", option); err == nil {
+			t.Fatalf("should have failed")
+		}
+	}
+}
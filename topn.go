@@ -0,0 +1,147 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"io"
+	"sort"
+)
+
+// TopNPager pages through the ranked results of a TopN query.
+// Pilosa does not support an offset for TopN queries, so a page is retrieved by
+// running the query with n set to the end of the page and dropping the items
+// of the previous pages.
+// Since TopN results are approximate, an item may move between pages if the data
+// changes, or if the ranking differs for larger n.
+type TopNPager struct {
+	client   *Client
+	query    func(n uint64) *PQLBitmapQuery
+	options  []interface{}
+	pageSize uint64
+	offset   uint64
+	done     bool
+}
+
+// TopNPager creates a TopNPager which returns pageSize items per page.
+// query creates the TopN query for the given n, e.g., frame.TopN or
+// a closure with a bitmap or filters.
+// The options are passed to Query for each page.
+func (c *Client) TopNPager(pageSize uint64, query func(n uint64) *PQLBitmapQuery, options ...interface{}) *TopNPager {
+	return &TopNPager{
+		client:   c,
+		query:    query,
+		options:  options,
+		pageSize: pageSize,
+	}
+}
+
+// NextPage returns the items of the next page.
+// Returns io.EOF once there are no more items.
+func (p *TopNPager) NextPage() ([]*CountResultItem, error) {
+	return p.NextPageWithContext(context.Background())
+}
+
+// NextPageWithContext returns the items of the next page.
+// Returns io.EOF once there are no more items.
+func (p *TopNPager) NextPageWithContext(ctx context.Context) ([]*CountResultItem, error) {
+	if p.done || p.pageSize == 0 {
+		return nil, io.EOF
+	}
+	n := p.offset + p.pageSize
+	response, err := p.client.QueryWithContext(ctx, p.query(n), p.options...)
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Err(); err != nil {
+		return nil, err
+	}
+	var items []*CountResultItem
+	if result := response.Result(); result != nil {
+		items = result.CountItems
+	}
+	if uint64(len(items)) < n {
+		// the server returned all ranked items
+		p.done = true
+	}
+	if uint64(len(items)) <= p.offset {
+		p.done = true
+		return nil, io.EOF
+	}
+	if uint64(len(items)) > n {
+		items = items[:n]
+	}
+	page := items[p.offset:]
+	p.offset = n
+	return page, nil
+}
+
+// MergeCountItems merges TopN items, e.g., from several frames or time ranges,
+// into a single list ranked by count. The counts of items with the same ID are added.
+// Items with the same count are sorted by ID.
+// At most n items are returned, pass 0 to return all items.
+// If the merged lists are truncated TopN results, the counts of items which are
+// missing from some of the lists are lower bounds.
+func MergeCountItems(n uint64, lists ...[]*CountResultItem) []*CountResultItem {
+	counts := map[uint64]uint64{}
+	for _, items := range lists {
+		for _, item := range items {
+			counts[item.ID] += item.Count
+		}
+	}
+	merged := make([]*CountResultItem, 0, len(counts))
+	for id, count := range counts {
+		merged = append(merged, &CountResultItem{ID: id, Count: count})
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Count != merged[j].Count {
+			return merged[i].Count > merged[j].Count
+		}
+		return merged[i].ID < merged[j].ID
+	})
+	if n > 0 && uint64(len(merged)) > n {
+		merged = merged[:n]
+	}
+	return merged
+}
+
+// MergeTopN merges the TopN items of the given results into a single list ranked by count.
+// See MergeCountItems.
+func MergeTopN(n uint64, results ...*QueryResult) []*CountResultItem {
+	lists := make([][]*CountResultItem, 0, len(results))
+	for _, result := range results {
+		if result != nil {
+			lists = append(lists, result.CountItems)
+		}
+	}
+	return MergeCountItems(n, lists...)
+}
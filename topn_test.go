@@ -0,0 +1,131 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTopNPager(t *testing.T) {
+	ranked := []string{`{"id":7,"count":50}`, `{"id":3,"count":40}`, `{"id":9,"count":30}`, `{"id":1,"count":20}`, `{"id":4,"count":10}`}
+	nRe := regexp.MustCompile(`n=(\d+)`)
+	queries := []string{}
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		queries = append(queries, string(body))
+		n, _ := strconv.Atoi(nRe.FindStringSubmatch(string(body))[1])
+		if n > len(ranked) {
+			n = len(ranked)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(fmt.Sprintf(`{"results":[[%s]]}`, strings.Join(ranked[:n], ",")))),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pager := client.TopNPager(2, sampleFrame.TopN)
+	pages := [][]*CountResultItem{}
+	for {
+		page, err := pager.NextPage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, page)
+	}
+	target := [][]*CountResultItem{
+		{{ID: 7, Count: 50}, {ID: 3, Count: 40}},
+		{{ID: 9, Count: 30}, {ID: 1, Count: 20}},
+		{{ID: 4, Count: 10}},
+	}
+	if !reflect.DeepEqual(target, pages) {
+		t.Fatalf("unexpected pages: %v", pages)
+	}
+	if len(queries) != 3 || queries[2] != "TopN(frame='sample-frame', n=6, inverse=false)" {
+		t.Fatalf("unexpected queries: %v", queries)
+	}
+	if _, err := pager.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got: %v", err)
+	}
+	if len(queries) != 3 {
+		t.Fatalf("no query should be sent after the last page")
+	}
+}
+
+func TestTopNPagerFails(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"error":"frame not found"}`)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.TopNPager(10, sampleFrame.TopN).NextPage()
+	if err == nil || err == io.EOF {
+		t.Fatalf("expected an error, got: %v", err)
+	}
+}
+
+func TestMergeCountItems(t *testing.T) {
+	a := []*CountResultItem{{ID: 1, Count: 10}, {ID: 2, Count: 5}}
+	b := []*CountResultItem{{ID: 3, Count: 12}, {ID: 2, Count: 6}, {ID: 4, Count: 11}}
+	target := []*CountResultItem{{ID: 3, Count: 12}, {ID: 2, Count: 11}, {ID: 4, Count: 11}, {ID: 1, Count: 10}}
+	if merged := MergeCountItems(0, a, b); !reflect.DeepEqual(target, merged) {
+		t.Fatalf("unexpected merged items: %v", merged)
+	}
+	if merged := MergeCountItems(2, a, b); !reflect.DeepEqual(target[:2], merged) {
+		t.Fatalf("unexpected merged items: %v", merged)
+	}
+	if merged := MergeCountItems(5); len(merged) != 0 {
+		t.Fatalf("unexpected merged items: %v", merged)
+	}
+	results := []*QueryResult{{CountItems: a}, nil, {CountItems: b}}
+	if merged := MergeTopN(0, results...); !reflect.DeepEqual(target, merged) {
+		t.Fatalf("unexpected merged items: %v", merged)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Tracer starts a span for each request of a client, e.g., to report Pilosa calls to OpenTracing or OpenTelemetry.
+// Set it with the Tracing client option.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// StartSpan starts a client span with the given operation name,
+	// as a child of the span in ctx if there is one.
+	StartSpan(ctx context.Context, operation string) Span
+}
+
+// Span is a span started by a Tracer for a request.
+type Span interface {
+	// SetTag sets a tag of the span. The keys follow the OpenTracing semantic conventions:
+	// db.type, db.instance (the index), peer.address, http.method, http.url and http.status_code,
+	// besides pilosa.query_kind (the names of the top level calls of a query) and pilosa.response_size.
+	SetTag(key string, value interface{})
+	// InjectHeaders adds the headers which propagate the trace to the request.
+	InjectHeaders(header http.Header)
+	// Finish is called when the response body is closed, or the request fails.
+	// err is not nil if the request failed or the server responded with an error status.
+	Finish(err error)
+}
+
+type traceQueryKey struct{}
+
+// traceQuery is attached to the context of a query so its spans are tagged with the index and kind of the query.
+type traceQuery struct {
+	index string
+	kind  string
+}
+
+// withTraceQuery returns a context which tags the spans of the requests sent with it with the given query.
+func (c *Client) withTraceQuery(ctx context.Context, index string, pql string) context.Context {
+	if c.options.Tracer == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceQueryKey{}, traceQuery{index: index, kind: queryKind(pql)})
+}
+
+// queryKind returns the distinct names of the top level calls of the given PQL, separated by commas.
+func queryKind(pql string) string {
+	calls, err := parsePQL(pql)
+	if err != nil {
+		return ""
+	}
+	names := []string{}
+	for _, call := range calls {
+		if !containsString(names, call.Name) {
+			names = append(names, call.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// startSpan starts the span of a request using the tracer of the client and injects its headers to the request.
+// It returns nil if the client has no tracer.
+func (c *Client) startSpan(ctx context.Context, host *URI, req *http.Request, path string) Span {
+	tracer := c.options.Tracer
+	if tracer == nil {
+		return nil
+	}
+	span := tracer.StartSpan(ctx, "pilosa "+req.Method+" "+endpointFromPath(path))
+	span.SetTag("db.type", "pilosa")
+	if query, ok := ctx.Value(traceQueryKey{}).(traceQuery); ok {
+		span.SetTag("db.instance", query.index)
+		span.SetTag("pilosa.query_kind", query.kind)
+	} else if index := indexFromPath(path); index != "" {
+		span.SetTag("db.instance", index)
+	}
+	span.SetTag("peer.address", host.address())
+	span.SetTag("http.method", req.Method)
+	span.SetTag("http.url", path)
+	span.InjectHeaders(req.Header)
+	return span
+}
+
+// finishSpan finishes the span of a request which failed without a response.
+// If there is a response, its body is wrapped so the span is finished when the body is closed.
+func finishSpan(span Span, host *URI, resp *http.Response, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.Finish(err)
+		return
+	}
+	span.SetTag("http.status_code", resp.StatusCode)
+	var statusErr error
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		statusErr = &PilosaError{StatusCode: resp.StatusCode, Host: host.address()}
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span, err: statusErr}
+}
+
+// spanBody counts the bytes read from a response body and finishes the span of the request when it is closed.
+type spanBody struct {
+	io.ReadCloser
+	span Span
+	err  error
+	size int64
+	once sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.size += int64(n)
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.span.SetTag("pilosa.response_size", b.size)
+		b.span.Finish(b.err)
+	})
+	return err
+}
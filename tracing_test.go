@@ -0,0 +1,171 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+
+package pilosa
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type recordingTracer struct {
+	mutex sync.Mutex
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, operation string) Span {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	span := &recordingSpan{operation: operation, tags: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+type recordingSpan struct {
+	operation string
+	tags      map[string]interface{}
+	finished  int
+	err       error
+}
+
+func (s *recordingSpan) SetTag(key string, value interface{}) {
+	s.tags[key] = value
+}
+
+func (s *recordingSpan) InjectHeaders(header http.Header) {
+	header.Set("X-Trace-Id", "trace-1")
+}
+
+func (s *recordingSpan) Finish(err error) {
+	s.finished++
+	s.err = err
+}
+
+func TestTracing(t *testing.T) {
+	body := `{"results": [5]}`
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("X-Trace-Id") != "trace-1" {
+			t.Fatalf("trace headers are not propagated: %v", req.Header)
+		}
+		if strings.HasPrefix(req.URL.Path, "/index/sample-index/frame") {
+			return &http.Response{
+				StatusCode: 404,
+				Body:       ioutil.NopCloser(strings.NewReader("frame not found")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	tracer := &recordingTracer{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), JSONFormat(true), Tracing(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Query(sampleIndex.Count(sampleFrame.Bitmap(1))); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DeleteFrame(sampleFrame); err == nil {
+		t.Fatal("should have failed")
+	}
+	if len(tracer.spans) != 2 {
+		t.Fatalf("unexpected spans: %v", tracer.spans)
+	}
+	query, deleteFrame := tracer.spans[0], tracer.spans[1]
+	if query.operation != "pilosa POST /index/{index}/query" {
+		t.Fatalf("unexpected operation: %s", query.operation)
+	}
+	targetTags := map[string]interface{}{
+		"db.type":              "pilosa",
+		"db.instance":          "sample-index",
+		"pilosa.query_kind":    "Count",
+		"peer.address":         "node1:10101",
+		"http.method":          "POST",
+		"http.url":             "/index/sample-index/query",
+		"http.status_code":     200,
+		"pilosa.response_size": int64(len(body)),
+	}
+	for key, value := range targetTags {
+		if query.tags[key] != value {
+			t.Fatalf("%s: %v != %v", key, value, query.tags[key])
+		}
+	}
+	if query.finished != 1 || query.err != nil {
+		t.Fatalf("unexpected finish: %d %v", query.finished, query.err)
+	}
+	if deleteFrame.tags["db.instance"] != "sample-index" || deleteFrame.tags["pilosa.query_kind"] != nil {
+		t.Fatalf("unexpected tags: %v", deleteFrame.tags)
+	}
+	if deleteFrame.finished != 1 || !IsNotFound(deleteFrame.err) {
+		t.Fatalf("unexpected finish: %d %v", deleteFrame.finished, deleteFrame.err)
+	}
+}
+
+func TestTracingRequestFails(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, ErrServer
+	})
+	tracer := &recordingTracer{}
+	client, err := NewClient("node1:10101", HTTPTransport(transport), Tracing(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = client.Status(); err == nil {
+		t.Fatal("should have failed")
+	}
+	if len(tracer.spans) == 0 {
+		t.Fatal("no spans")
+	}
+	for _, span := range tracer.spans {
+		if span.finished != 1 || span.err == nil || span.tags["http.status_code"] != nil {
+			t.Fatalf("unexpected span: %v", span)
+		}
+	}
+}
+
+func TestQueryKind(t *testing.T) {
+	kinds := map[string]string{
+		"Bitmap(frame='f1', rowID=1)":                                                    "Bitmap",
+		"TopN(frame='f1', n=5)Count(Bitmap(frame='f1', rowID=1))":                        "TopN,Count",
+		"SetBit(frame='f1', rowID=1, columnID=2)SetBit(frame='f1', rowID=1, columnID=3)": "SetBit",
+	}
+	for pql, target := range kinds {
+		if kind := queryKind(pql); kind != target {
+			t.Fatalf("%s: %s != %s", pql, target, kind)
+		}
+	}
+}
@@ -33,6 +33,7 @@
 package pilosa
 
 import (
+	"encoding/hex"
 	"fmt"
 	"regexp"
 	"strconv"
@@ -44,6 +45,10 @@ import (
 var schemeRegexp = regexp.MustCompile("^[+a-z]+$")
 var hostRegexp = regexp.MustCompile("^[0-9a-z.-]+$|^\\[[:0-9a-fA-F]+\\]$")
 var addressRegexp = regexp.MustCompile("^(([+a-z]+):\\/\\/)?([0-9a-z.-]+|\\[[:0-9a-fA-F]+\\])?(:([0-9]+))?$")
+var unixAddressRegexp = regexp.MustCompile("^([a-z]+\\+unix):\\/\\/(\\/.+)$")
+
+// unixSocketHostSuffix marks the hosts which stand for Unix domain sockets in normalized addresses.
+const unixSocketHostSuffix = ".unix-socket"
 
 // URI represents a Pilosa URI.
 // A Pilosa URI consists of three parts:
@@ -58,11 +63,15 @@ var addressRegexp = regexp.MustCompile("^(([+a-z]+):\\/\\/)?([0-9a-z.-]+|\\[[:0-
 // 	localhost:10101
 // 	localhost
 // 	:10101
+//
+// A URI may also refer to a Unix domain socket, in which case the scheme ends with +unix
+// and is followed by the path of the socket, e.g., `http+unix:///var/run/pilosa.sock`.
 type URI struct {
-	scheme string
-	host   string
-	port   uint16
-	error  error
+	scheme     string
+	host       string
+	port       uint16
+	socketPath string
+	error      error
 }
 
 // DefaultURI creates and returns the default URI.
@@ -140,20 +149,51 @@ func (u *URI) SetPort(port uint16) {
 	u.port = port
 }
 
+// SocketPath returns the path of the Unix domain socket, or an empty string if the URI does not refer to one.
+func (u *URI) SocketPath() string {
+	return u.socketPath
+}
+
 // HostPort returns `Host:Port`
 func (u *URI) HostPort() string {
 	s := fmt.Sprintf("%s:%d", u.host, u.port)
 	return s
 }
 
+// address returns the address of the host reported in errors, logs and metrics:
+// the path of the Unix domain socket, or `Host:Port` for other URIs.
+func (u *URI) address() string {
+	if u.socketPath != "" {
+		return u.socketPath
+	}
+	return u.HostPort()
+}
+
 // Normalize returns the address in a form usable by a HTTP client.
+// The address of a Unix domain socket is returned with its scheme and path, e.g., `http+unix:///var/run/pilosa.sock`.
 func (u *URI) Normalize() string {
+	if u.socketPath != "" {
+		return fmt.Sprintf("%s://%s", u.scheme, u.socketPath)
+	}
+	return fmt.Sprintf("%s://%s:%d", u.baseScheme(), u.host, u.port)
+}
+
+// requestAddress returns the address used in the URL of the requests to the host.
+// The path of a Unix domain socket is encoded in the host, and decoded when dialing.
+func (u *URI) requestAddress() string {
+	if u.socketPath != "" {
+		return fmt.Sprintf("%s://%s%s", u.baseScheme(), hex.EncodeToString([]byte(u.socketPath)), unixSocketHostSuffix)
+	}
+	return u.Normalize()
+}
+
+// baseScheme returns the scheme without the part after +, e.g., http for http+unix.
+func (u *URI) baseScheme() string {
 	scheme := u.scheme
-	index := strings.Index(scheme, "+")
-	if index >= 0 {
+	if index := strings.Index(scheme, "+"); index >= 0 {
 		scheme = scheme[:index]
 	}
-	return fmt.Sprintf("%s://%s:%d", scheme, u.host, u.port)
+	return scheme
 }
 
 // Equals returns true if the checked URI is equivalent to this URI.
@@ -163,7 +203,8 @@ func (u URI) Equals(other *URI) bool {
 	}
 	return u.scheme == other.scheme &&
 		u.host == other.host &&
-		u.port == other.port
+		u.port == other.port &&
+		u.socketPath == other.socketPath
 }
 
 // Error returns the error if this URI has one.
@@ -177,6 +218,12 @@ func (u *URI) Valid() bool {
 }
 
 func parseAddress(address string) (uri *URI, err error) {
+	if m := unixAddressRegexp.FindStringSubmatch(address); m != nil {
+		uri = DefaultURI()
+		uri.scheme = m[1]
+		uri.socketPath = m[2]
+		return uri, nil
+	}
 	m := addressRegexp.FindStringSubmatch(address)
 	if m == nil {
 		return nil, errors.New("Invalid address")
@@ -185,6 +232,9 @@ func parseAddress(address string) (uri *URI, err error) {
 	if m[2] != "" {
 		scheme = m[2]
 	}
+	if strings.HasSuffix(scheme, "+unix") {
+		return nil, errors.New("Invalid Unix domain socket address")
+	}
 	host := "localhost"
 	if m[3] != "" {
 		host = m[3]
@@ -203,3 +253,29 @@ func parseAddress(address string) (uri *URI, err error) {
 	}
 	return uri, nil
 }
+
+// socketPathFromAddress returns the path of the Unix domain socket
+// if the given host:port address is a normalized Unix domain socket URI.
+func socketPathFromAddress(address string) (string, bool) {
+	index := strings.LastIndex(address, ":")
+	if index >= 0 {
+		address = address[:index]
+	}
+	if !strings.HasSuffix(address, unixSocketHostSuffix) {
+		return "", false
+	}
+	path, err := hex.DecodeString(strings.TrimSuffix(address, unixSocketHostSuffix))
+	if err != nil {
+		return "", false
+	}
+	return string(path), true
+}
+
+// hostFromRequestAddress returns the host of a request URL in the form of URI.address,
+// decoding the path of a Unix domain socket.
+func hostFromRequestAddress(address string) string {
+	if path, ok := socketPathFromAddress(address); ok {
+		return path
+	}
+	return address
+}
@@ -32,7 +32,13 @@
 
 package pilosa
 
-import "testing"
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
 
 func TestDefaultURI(t *testing.T) {
 	uri := DefaultURI()
@@ -228,3 +234,85 @@ func validFixture() []uriItem {
 func invalidFixture() []string {
 	return []string{"foo:bar", "http://foo:", "foo:", ":bar", "http://pilosa.com:129999999999999999999999993", "fd42:4201:f86b:7e09:216:3eff:fefa:ed80"}
 }
+
+func TestUnixSocketURI(t *testing.T) {
+	uri, err := NewURIFromAddress("http+unix:///var/run/pilosa.sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme() != "http+unix" || uri.SocketPath() != "/var/run/pilosa.sock" {
+		t.Fatalf("unexpected URI: %v", uri)
+	}
+	if normalized := uri.Normalize(); normalized != "http+unix:///var/run/pilosa.sock" {
+		t.Fatalf("unexpected normalized address: %s", normalized)
+	}
+	address := uri.requestAddress()
+	if address != "http://2f7661722f72756e2f70696c6f73612e736f636b.unix-socket" {
+		t.Fatalf("unexpected request address: %s", address)
+	}
+	path, ok := socketPathFromAddress(strings.TrimPrefix(address, "http://") + ":80")
+	if !ok || path != "/var/run/pilosa.sock" {
+		t.Fatalf("unexpected socket path: %s", path)
+	}
+	if uri.Equals(URIFromAddress("http+unix:///var/run/other.sock")) || uri.Equals(DefaultURI()) {
+		t.Fatalf("URIs with different socket paths should not be equal")
+	}
+	if !uri.Equals(URIFromAddress("http+unix:///var/run/pilosa.sock")) {
+		t.Fatalf("URIs with the same socket path should be equal")
+	}
+	for _, address := range []string{"localhost:10101", "zz.unix-socket:80", "index1.pilosa.com"} {
+		if _, ok := socketPathFromAddress(address); ok {
+			t.Fatalf("not a socket address: %s", address)
+		}
+	}
+	if _, err = NewURIFromAddress("http+unix://relative.sock"); err == nil {
+		t.Fatalf("socket paths should be absolute")
+	}
+}
+
+func TestUnixSocketHost(t *testing.T) {
+	uri := URIFromAddress("http+unix:///var/run/pilosa.sock")
+	if address := uri.address(); address != "/var/run/pilosa.sock" {
+		t.Fatalf("the socket path should be reported, got %s", address)
+	}
+	if address := URIFromAddress("index1.pilosa.com:20202").address(); address != "index1.pilosa.com:20202" {
+		t.Fatalf("host:port should be reported, got %s", address)
+	}
+	request, err := http.NewRequest("GET", uri.requestAddress()+"/status", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response := &http.Response{StatusCode: 500, Request: request}
+	if host := newPilosaError(uri, response, nil).Host; host != "/var/run/pilosa.sock" {
+		t.Fatalf("the socket path should be the host of the error, got %s", host)
+	}
+	if host := newPilosaError(nil, response, nil).Host; host != "/var/run/pilosa.sock" {
+		t.Fatalf("the socket path should be the host of the error, got %s", host)
+	}
+	if host := newResponseMetadata(response, nil, 0).Host; host != "/var/run/pilosa.sock" {
+		t.Fatalf("the socket path should be the host of the metadata, got %s", host)
+	}
+}
+
+func TestUnixSocketWithCustomTransport(t *testing.T) {
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		t.Fatalf("no request should be sent to a Unix domain socket with a custom transport")
+		return nil, nil
+	})
+	if _, err := NewClient("http+unix:///var/run/pilosa.sock", HTTPTransport(transport)); err != ErrUnixSocketUnsupported {
+		t.Fatalf("ErrUnixSocketUnsupported expected, got: %v", err)
+	}
+	if _, err := NewClient("http+unix:///var/run/pilosa.sock", HTTPClient(&http.Client{})); err != ErrUnixSocketUnsupported {
+		t.Fatalf("ErrUnixSocketUnsupported expected, got: %v", err)
+	}
+	// hosts added after the client is created are checked when a request is sent to them
+	cluster := NewClusterWithHost()
+	client, err := NewClient(cluster, HTTPTransport(transport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cluster.AddHost(URIFromAddress("http+unix:///var/run/pilosa.sock"))
+	if _, err = client.Views(sampleFrame); errors.Cause(err) != ErrUnixSocketUnsupported {
+		t.Fatalf("ErrUnixSocketUnsupported expected, got: %v", err)
+	}
+}
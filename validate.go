@@ -61,6 +61,27 @@ func ValidLabel(label string) bool {
 	return len(label) <= maxLabel && labelRegex.Match([]byte(label))
 }
 
+// ValidTimeQuantum returns true if the given time quantum is valid, otherwise false.
+// A valid time quantum is empty or a contiguous combination of Y, M, D and H in that order, e.g., YMD or DH.
+func ValidTimeQuantum(quantum TimeQuantum) bool {
+	switch quantum {
+	case TimeQuantumNone, TimeQuantumYear, TimeQuantumMonth, TimeQuantumDay, TimeQuantumHour,
+		TimeQuantumYearMonth, TimeQuantumMonthDay, TimeQuantumDayHour,
+		TimeQuantumYearMonthDay, TimeQuantumMonthDayHour, TimeQuantumYearMonthDayHour:
+		return true
+	}
+	return false
+}
+
+// ValidCacheType returns true if the given cache type is valid, otherwise false.
+func ValidCacheType(cacheType CacheType) bool {
+	switch cacheType {
+	case CacheTypeDefault, CacheTypeLRU, CacheTypeRanked, CacheTypeNone:
+		return true
+	}
+	return false
+}
+
 func validateIndexName(name string) error {
 	if ValidIndexName(name) {
 		return nil
@@ -81,3 +102,17 @@ func validateLabel(label string) error {
 	}
 	return ErrInvalidLabel
 }
+
+func validateTimeQuantum(quantum TimeQuantum) error {
+	if ValidTimeQuantum(quantum) {
+		return nil
+	}
+	return ErrInvalidTimeQuantum
+}
+
+func validateCacheType(cacheType CacheType) error {
+	if ValidCacheType(cacheType) {
+		return nil
+	}
+	return ErrInvalidCacheType
+}
@@ -106,3 +106,37 @@ func TestValidateLabelInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateTimeQuantum(t *testing.T) {
+	quantums := []TimeQuantum{
+		"", "Y", "M", "D", "H", "YM", "MD", "DH", "YMD", "MDH", "YMDH",
+	}
+	for _, quantum := range quantums {
+		if validateTimeQuantum(quantum) != nil {
+			t.Fatalf("Should be valid time quantum: %s", quantum)
+		}
+	}
+}
+
+func TestValidateTimeQuantumInvalid(t *testing.T) {
+	quantums := []TimeQuantum{
+		"y", "YD", "MY", "HD", "YMH", "YY", "X", "YMDHM",
+	}
+	for _, quantum := range quantums {
+		if validateTimeQuantum(quantum) == nil {
+			t.Fatalf("Should be invalid time quantum: %s", quantum)
+		}
+	}
+}
+
+func TestValidateCacheType(t *testing.T) {
+	cacheTypes := []CacheType{"", "lru", "ranked", "none"}
+	for _, cacheType := range cacheTypes {
+		if validateCacheType(cacheType) != nil {
+			t.Fatalf("Should be valid cache type: %s", cacheType)
+		}
+	}
+	if validateCacheType("LRU") == nil {
+		t.Fatalf("Should be invalid cache type: LRU")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The range of server versions supported by the client:
+// at least MinServerVersion and less than MaxServerVersion.
+const (
+	MinServerVersion = "0.8.0"
+	MaxServerVersion = "0.9.0"
+)
+
+// MinClearImportServerVersion is the first server version which clears the bits of imports with the ClearBits option.
+// Older servers ignore the option and would set the bits instead, so the client clears the bits with ClearBit queries.
+const MinClearImportServerVersion = "0.9.0"
+
+type versionInfo struct {
+	Version string `json:"version"`
+}
+
+// Version returns the version of the server, e.g., v0.8.0.
+func (c *Client) Version() (string, error) {
+	return c.VersionWithContext(context.Background())
+}
+
+// VersionWithContext returns the version of the server.
+func (c *Client) VersionWithContext(ctx context.Context) (string, error) {
+	_, data, err := c.httpRequest(ctx, "GET", "/version", nil, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "requesting /version")
+	}
+	info := versionInfo{}
+	if err = json.Unmarshal(data, &info); err != nil {
+		return "", errors.Wrap(err, "unmarshaling /version data")
+	}
+	return info.Version, nil
+}
+
+// CheckVersion returns an error whose cause is ErrUnsupportedServerVersion
+// if the version of the server is not in the range supported by the client.
+func (c *Client) CheckVersion() error {
+	return c.CheckVersionWithContext(context.Background())
+}
+
+// CheckVersionWithContext returns an error whose cause is ErrUnsupportedServerVersion
+// if the version of the server is not in the range supported by the client.
+func (c *Client) CheckVersionWithContext(ctx context.Context) error {
+	version, err := c.VersionWithContext(ctx)
+	if err != nil {
+		return err
+	}
+	return checkServerVersion(version)
+}
+
+// checkVersionAtStartup checks the version of the server if ServerVersionCheck is set.
+// Unless StrictServerVersion is set, a failed check is logged instead of returned.
+func (c *Client) checkVersionAtStartup() error {
+	if !c.options.ServerVersionCheck {
+		return nil
+	}
+	err := c.CheckVersion()
+	if err != nil && !c.options.StrictServerVersion {
+		c.logger().Warn("server version check failed", "error", err)
+		return nil
+	}
+	return err
+}
+
+// clearImportSupported returns true if the server supports clearing the bits of imports.
+// It returns false if the version of the server cannot be parsed.
+func (c *Client) clearImportSupported(ctx context.Context) (bool, error) {
+	version, err := c.VersionWithContext(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "checking support for clearing imports")
+	}
+	parsed, err := parseVersion(version)
+	min, _ := parseVersion(MinClearImportServerVersion)
+	return err == nil && compareVersions(parsed, min) >= 0, nil
+}
+
+func checkServerVersion(version string) error {
+	parsed, err := parseVersion(version)
+	if err != nil {
+		return errors.Wrapf(ErrUnsupportedServerVersion, "parsing server version %s: %s", version, err)
+	}
+	min, _ := parseVersion(MinServerVersion)
+	max, _ := parseVersion(MaxServerVersion)
+	if compareVersions(parsed, min) < 0 || compareVersions(parsed, max) >= 0 {
+		return errors.Wrapf(ErrUnsupportedServerVersion, "server version %s is not in the supported range [%s, %s)",
+			version, MinServerVersion, MaxServerVersion)
+	}
+	return nil
+}
+
+// parseVersion parses versions like v0.8.1 or 0.8.1-12-gabcdef into major, minor and patch numbers.
+// A missing minor or patch number is 0.
+func parseVersion(version string) ([3]int, error) {
+	parsed := [3]int{}
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	parts := strings.Split(version, ".")
+	if len(parts) > len(parsed) {
+		return parsed, fmt.Errorf("invalid version: %s", version)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return parsed, fmt.Errorf("invalid version: %s", version)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+func compareVersions(a, b [3]int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
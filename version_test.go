@@ -0,0 +1,181 @@
+// Copyright 2017 Pilosa Corp.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions
+// are met:
+//
+// 1. Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright
+// notice, this list of conditions and the following disclaimer in the
+// documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its
+// contributors may be used to endorse or promote products derived
+// from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND
+// CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES,
+// INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF
+// MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE
+// DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR
+// CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING,
+// BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR
+// SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY,
+// WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING
+// NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH
+// DAMAGE.
+package pilosa
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func versionTransport(version string, requests *int) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if requests != nil {
+			*requests++
+		}
+		if req.URL.Path != "/version" {
+			return &http.Response{
+				StatusCode: 404,
+				Body:       ioutil.NopCloser(strings.NewReader("not found")),
+			}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"version":"` + version + `"}`)),
+		}, nil
+	})
+}
+
+func TestVersion(t *testing.T) {
+	client, err := NewClient(":10101", HTTPTransport(versionTransport("v0.8.2", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := client.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != "v0.8.2" {
+		t.Fatalf("unexpected version: %s", version)
+	}
+	if err = client.CheckVersion(); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewClient(":10101", HTTPTransport(versionTransport("v0.7.1", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CheckVersion(); errors.Cause(err) != ErrUnsupportedServerVersion {
+		t.Fatalf("expected ErrUnsupportedServerVersion, got: %v", err)
+	}
+}
+
+func TestCheckServerVersion(t *testing.T) {
+	supported := []string{"v0.8.0", "0.8.3", "v0.8.1-12-gabcdef", "0.8"}
+	for _, version := range supported {
+		if err := checkServerVersion(version); err != nil {
+			t.Fatalf("%s should be supported: %v", version, err)
+		}
+	}
+	unsupported := []string{"v0.7.9", "v0.9.0", "1.0.0", "", "v0.x", "0.8.0.1"}
+	for _, version := range unsupported {
+		if err := checkServerVersion(version); errors.Cause(err) != ErrUnsupportedServerVersion {
+			t.Fatalf("%s should not be supported: %v", version, err)
+		}
+	}
+}
+
+func TestServerVersionCheckAtStartup(t *testing.T) {
+	requests := 0
+	if _, err := NewClient(":10101", HTTPTransport(versionTransport("v0.9.1", &requests))); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Fatalf("the version should not be checked by default")
+	}
+	logger := &recordingLogger{}
+	if _, err := NewClient(":10101", HTTPTransport(versionTransport("v0.9.1", &requests)), ServerVersionCheck(false), WithLogger(logger)); err != nil {
+		t.Fatalf("an unsupported version should only be logged: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("the version should be checked")
+	}
+	warned := false
+	for _, entry := range logger.entries {
+		warned = warned || (entry.level == LevelWarn && entry.msg == "server version check failed")
+	}
+	if !warned {
+		t.Fatalf("the failed check should be logged with the logger of the client, got: %v", logger.messages())
+	}
+	_, err := NewClient(":10101", HTTPTransport(versionTransport("v0.9.1", nil)), ServerVersionCheck(true))
+	if errors.Cause(err) != ErrUnsupportedServerVersion {
+		t.Fatalf("expected ErrUnsupportedServerVersion, got: %v", err)
+	}
+	_, err = NewClient([]string{":10101", ":10102"}, HTTPTransport(versionTransport("v0.9.1", nil)), ServerVersionCheck(true))
+	if errors.Cause(err) != ErrUnsupportedServerVersion {
+		t.Fatalf("expected ErrUnsupportedServerVersion, got: %v", err)
+	}
+	if _, err = NewClient(":10101", HTTPTransport(versionTransport("v0.8.0", nil)), ServerVersionCheck(true)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportFrameClearBitsWithQueries(t *testing.T) {
+	// the server ignores the clear parameter, as servers before MinClearImportServerVersion do
+	imports := 0
+	var queries []string
+	transport := roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := ""
+		switch req.URL.Path {
+		case "/version":
+			body = `{"version": "v0.8.5"}`
+		case "/fragment/nodes":
+			body = `[{"scheme":"http","host":"node1:10101"}]`
+		case "/import":
+			imports++
+		case "/index/sample-index/query":
+			data, err := ioutil.ReadAll(req.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			queries = append(queries, string(data))
+			body = `{"results": [true, false]}`
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+	client, err := NewClient(":10101", HTTPTransport(transport), JSONFormat(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary := &ImportSummary{}
+	iterator := NewSliceBitIterator([]Bit{{RowID: 1, ColumnID: 10}, {RowID: 2, ColumnID: 20}})
+	if err = client.ImportFrame(sampleFrame, iterator, 100, ClearBits(true), Summary(summary)); err != nil {
+		t.Fatal(err)
+	}
+	target := []string{sampleIndex.BatchQuery(sampleFrame.ClearBit(1, 10), sampleFrame.ClearBit(2, 20)).serialize()}
+	if !reflect.DeepEqual(target, queries) {
+		t.Fatalf("%v != %v", target, queries)
+	}
+	if imports != 0 {
+		t.Fatalf("no bits should be imported, got %d import requests", imports)
+	}
+	if summary.Count != 2 || summary.Batches != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+}